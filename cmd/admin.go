@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"forum/cmd/config"
+	repository "forum/internal/database"
+	database "forum/internal/database/migration"
+	"forum/internal/mail"
+	"forum/internal/models"
+	"forum/internal/password"
+	"forum/internal/service"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// adminPasswordEnv holds the password of the admin `forum admin create` creates, for scripts.
+// Without it the password is read from stdin.
+const adminPasswordEnv = "FORUM_ADMIN_PASSWORD"
+
+// runCommand handles the command line subcommands, e.g. `forum admin create`.
+func runCommand(configObj *config.Config, args []string) error {
+	if len(args) >= 2 && args[0] == "admin" && args[1] == "create" {
+		return createAdmin(configObj, args[2:])
+	}
+	if len(args) >= 2 && args[0] == "admin" && args[1] == "unlock" {
+		return unlockAccount(configObj, args[2:])
+	}
+	if len(args) >= 2 && args[0] == "passwords" && args[1] == "blocklist" {
+		return buildBlocklist(configObj, args[2:])
+	}
+	return fmt.Errorf("unknown command %q, usage: forum admin create -email EMAIL -username NAME,"+
+		" forum admin unlock -email EMAIL or forum passwords blocklist -in FILE [-out FILE]", strings.Join(args, " "))
+}
+
+// buildBlocklist turns a list of common or leaked passwords, one per line, into the bloom filter
+// file the password policy loads at startup.
+func buildBlocklist(configObj *config.Config, args []string) error {
+	flags := flag.NewFlagSet("passwords blocklist", flag.ContinueOnError)
+	in := flags.String("in", "", "password list, one password per line")
+	out := flags.String("out", configObj.PasswordPolicy.BlocklistPath, "blocklist file to write")
+	falsePositiveRate := flags.Float64("fp", 0.001, "chance that a password not on the list is refused anyway")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" || *out == "" {
+		return errors.New("-in and -out are required")
+	}
+	if *falsePositiveRate <= 0 || *falsePositiveRate >= 1 {
+		return errors.New("-fp must be between 0 and 1")
+	}
+
+	list, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer list.Close()
+	bloom, count, err := password.BuildBloom(list, *falsePositiveRate)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	size, err := bloom.WriteTo(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d passwords to %s (%d bytes)\n", count, *out, size)
+	return nil
+}
+
+// newService sets up the services like the server does. Mail they write is only queued, the running
+// server sends it.
+func newService(configObj *config.Config, repo *repository.Repository) (*service.Service, error) {
+	mailer, err := mail.New(configObj.Mail)
+	if err != nil {
+		return nil, err
+	}
+	return service.NewService(repo, password.NewPolicy(configObj.PasswordPolicy), mailer, configObj.Mail), nil
+}
+
+// unlockAccount lifts a login lockout, for when the only admin locked themselves out.
+func unlockAccount(configObj *config.Config, args []string) error {
+	flags := flag.NewFlagSet("admin unlock", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the locked account")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+
+	db, err := database.CreateDb(configObj.DbDriver, configObj.DbPath, context.Background())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo := repository.NewRepository(db)
+	user, err := repo.UserRepoInterface.GetUserByEmail(*email)
+	if err != nil {
+		return err
+	}
+	srv, err := newService(configObj, repo)
+	if err != nil {
+		return err
+	}
+	if err := srv.UserServiceInterface.UnlockLogin(models.LoginFailureAccount, strconv.Itoa(user.UserUserID)); err != nil {
+		return err
+	}
+	fmt.Printf("Account %s unlocked\n", user.Username)
+	return nil
+}
+
+func createAdmin(configObj *config.Config, args []string) error {
+	flags := flag.NewFlagSet("admin create", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the new admin")
+	username := flags.String("username", "", "username of the new admin")
+	firstName := flags.String("first-name", "", "first name of the new admin")
+	secondName := flags.String("second-name", "", "second name of the new admin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" || *username == "" {
+		return errors.New("-email and -username are required")
+	}
+	// not a flag, arguments are seen by everyone who can run ps and stay in the shell history
+	password := os.Getenv(adminPasswordEnv)
+	if password == "" {
+		fmt.Print("Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return err
+		}
+		password = strings.TrimSpace(line)
+	}
+	if password == "" {
+		return errors.New("password cannot be empty")
+	}
+
+	db, err := database.CreateDb(configObj.DbDriver, configObj.DbPath, context.Background())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	user := &models.User{
+		FirstName:  *firstName,
+		SecondName: *secondName,
+		Username:   *username,
+		Email:      *email,
+		Password:   password,
+		Role:       models.RoleAdmin,
+	}
+	srv, err := newService(configObj, repository.NewRepository(db))
+	if err != nil {
+		return err
+	}
+	if _, id, err := srv.UserServiceInterface.CreateUser(user); err != nil {
+		return err
+	} else {
+		fmt.Printf("Admin %s created with ID %d\n", *username, id)
+	}
+	return nil
+}
@@ -2,13 +2,19 @@ package config
 
 import (
 	"encoding/json"
+	"forum/internal/mail"
+	"forum/internal/oauth"
+	"forum/internal/password"
 	"io/ioutil"
 )
 
 type Config struct {
-	Address string `json:"address"`
-	DbPath  string `json:"db_path"`
-	DbDriver  string `json:"db_driver"`
+	Address        string                 `json:"address"`
+	DbPath         string                 `json:"db_path"`
+	DbDriver       string                 `json:"db_driver"`
+	OAuthProviders []oauth.ProviderConfig `json:"oauth_providers"`
+	PasswordPolicy password.Config        `json:"password_policy"`
+	Mail           mail.Config            `json:"mail"`
 }
 
 func CreateConfig() *Config {
@@ -29,5 +35,3 @@ func ReadConfig(configFilepath string, config *Config) error {
 
 	return nil
 }
-
-
@@ -0,0 +1,556 @@
+// Command forumctl uses the forum from a terminal, through the JSON API and a personal access token.
+//
+//	forumctl [-url URL] [-token TOKEN] [-insecure] COMMAND [ARGUMENTS]
+//
+// The URL and the token can also be given with FORUM_URL and FORUM_TOKEN. Run forumctl without a
+// command for the list of commands.
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"forum/pkg/forumclient"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: forumctl [-url URL] [-token TOKEN] [-insecure] COMMAND [ARGUMENTS]
+
+commands:
+  me                                    who the token belongs to
+  posts [-category C] [-author U] [-page N]
+                                        list posts, newest first
+  search [-page N] TEXT                 posts with TEXT in the title or content
+  show POST                             a post with its comments
+  post -file FILE [-title T] -category C[,C...]
+                                        publish a Markdown file; the title defaults to its first "# " heading
+  comment POST TEXT | comment -file FILE POST
+                                        comment on a post
+  react post|comment ID like|dislike|none
+  notifications [-follow] [-interval D] your notifications, unread ones marked with *
+  read NOTIFICATION|all                 mark notifications as read
+  queue [-page N]                       what waits for a moderator
+  approve post|comment ID
+  reject [-reason R] post|comment ID    delete content from the queue, telling the author why
+  report POST irrelevant|obscene|illegal|insulting
+  resolve [-reason R] POST keep|remove  answer a report
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "forumctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("forumctl", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	baseURL := flags.String("url", envOr("FORUM_URL", "https://localhost:8080"), "address of the forum")
+	token := flags.String("token", os.Getenv("FORUM_TOKEN"), "personal access token, forum_pat_...")
+	insecure := flags.Bool("insecure", false, "accept a self-signed certificate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no command given")
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if *insecure {
+		httpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	ctl := &forumctl{
+		client: forumclient.New(*baseURL, forumclient.WithToken(*token), forumclient.WithHTTPClient(httpClient)),
+		out:    os.Stdout,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	command, rest := flags.Arg(0), flags.Args()[1:]
+	commands := map[string]func(context.Context, []string) error{
+		"me":            ctl.me,
+		"posts":         ctl.posts,
+		"search":        ctl.search,
+		"show":          ctl.show,
+		"post":          ctl.post,
+		"comment":       ctl.comment,
+		"react":         ctl.react,
+		"notifications": ctl.notifications,
+		"read":          ctl.read,
+		"queue":         ctl.queue,
+		"approve":       ctl.approve,
+		"reject":        ctl.reject,
+		"report":        ctl.report,
+		"resolve":       ctl.resolve,
+	}
+	handle, ok := commands[command]
+	if !ok {
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+	return handle(ctx, rest)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+type forumctl struct {
+	client *forumclient.Client
+	out    io.Writer
+}
+
+func (ctl *forumctl) me(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: forumctl me")
+	}
+	me, err := ctl.client.Me(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctl.out, "%s (%s %s), %s, role %s", me.Username, me.FirstName, me.SecondName, me.Email, me.Role)
+	if me.TokenScope != "" {
+		fmt.Fprintf(ctl.out, ", token scope %s", me.TokenScope)
+	}
+	fmt.Fprintln(ctl.out)
+	return nil
+}
+
+func (ctl *forumctl) posts(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("posts", flag.ContinueOnError)
+	category := flags.String("category", "", "only posts in this category")
+	author := flags.String("author", "", "only posts by this username")
+	page := flags.Int("page", 1, "page of the list")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: forumctl posts [-category C] [-author U] [-page N]")
+	}
+	return ctl.listPosts(ctx, forumclient.ListPostsOptions{PageOptions: forumclient.PageOptions{Page: *page}, Category: *category, Author: *author})
+}
+
+func (ctl *forumctl) search(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	page := flags.Int("page", 1, "page of the results")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	text := strings.TrimSpace(strings.Join(flags.Args(), " "))
+	if text == "" {
+		return errors.New("usage: forumctl search [-page N] TEXT")
+	}
+	return ctl.listPosts(ctx, forumclient.ListPostsOptions{PageOptions: forumclient.PageOptions{Page: *page}, Query: text})
+}
+
+func (ctl *forumctl) listPosts(ctx context.Context, options forumclient.ListPostsOptions) error {
+	page, err := ctl.client.ListPosts(ctx, options)
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(ctl.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tTITLE\tAUTHOR\tCATEGORIES\tLIKES\tDISLIKES\tCREATED")
+	for _, post := range page.Posts {
+		title := post.Title
+		if !post.Approved {
+			title += " (waiting for approval)"
+		}
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%d\t%d\t%s\n", post.ID, title, post.Author.Username,
+			strings.Join(post.Categories, ","), post.Likes, post.Dislikes, formatTime(post.CreatedAt))
+	}
+	table.Flush()
+	printPagination(ctl.out, page.Pagination)
+	return nil
+}
+
+func (ctl *forumctl) show(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: forumctl show POST")
+	}
+	postID, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	post, err := ctl.client.GetPost(ctx, postID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctl.out, "# %s\n\nby %s on %s in %s, %d likes, %d dislikes", post.Title, post.Author.Username,
+		formatTime(post.CreatedAt), strings.Join(post.Categories, ", "), post.Likes, post.Dislikes)
+	if post.MyReaction != "" && post.MyReaction != forumclient.NoReaction {
+		fmt.Fprintf(ctl.out, ", you reacted with %s", post.MyReaction)
+	}
+	fmt.Fprintf(ctl.out, "\n\n%s\n", post.Content)
+
+	for page := 1; ; page++ {
+		comments, err := ctl.client.ListComments(ctx, postID, forumclient.PageOptions{Page: page, PerPage: 100})
+		if err != nil {
+			return err
+		}
+		for _, comment := range comments.Comments {
+			fmt.Fprintf(ctl.out, "\n[%d] %s on %s, %d likes, %d dislikes\n%s\n", comment.ID, comment.Author.Username,
+				formatTime(comment.CreatedAt), comment.Likes, comment.Dislikes, comment.Content)
+		}
+		if page >= comments.Pagination.TotalPages {
+			return nil
+		}
+	}
+}
+
+func (ctl *forumctl) post(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("post", flag.ContinueOnError)
+	file := flags.String("file", "", "Markdown file with the post")
+	title := flags.String("title", "", "title of the post, instead of the first heading of the file")
+	categories := flags.String("category", "", "comma separated categories")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" || *categories == "" || flags.NArg() != 0 {
+		return errors.New("usage: forumctl post -file FILE [-title T] -category C[,C...]")
+	}
+	source, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	newPost := forumclient.NewPost{Title: *title, Content: string(source)}
+	if newPost.Title == "" {
+		newPost.Title, newPost.Content = splitTitle(newPost.Content)
+		if newPost.Title == "" {
+			return fmt.Errorf("%s has no \"# \" heading, give the title with -title", *file)
+		}
+	}
+	for _, category := range strings.Split(*categories, ",") {
+		if category = strings.TrimSpace(category); category != "" {
+			newPost.Categories = append(newPost.Categories, category)
+		}
+	}
+	created, err := ctl.client.CreatePost(ctx, newPost)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctl.out, "Created post %d", created.ID)
+	if !created.Approved {
+		fmt.Fprint(ctl.out, ", it is shown to others once a moderator approves it")
+	}
+	fmt.Fprintln(ctl.out)
+	return nil
+}
+
+// splitTitle takes the first "# " heading out of a Markdown document and returns it with the rest.
+func splitTitle(markdown string) (string, string) {
+	lines := strings.Split(markdown, "\n")
+	for i, line := range lines {
+		if heading, ok := strings.CutPrefix(strings.TrimSpace(line), "# "); ok {
+			rest := append(lines[:i:i], lines[i+1:]...)
+			return strings.TrimSpace(heading), strings.TrimSpace(strings.Join(rest, "\n"))
+		}
+	}
+	return "", markdown
+}
+
+func (ctl *forumctl) comment(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("comment", flag.ContinueOnError)
+	file := flags.String("file", "", "file with the comment, - for standard input")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	const commentUsage = "usage: forumctl comment POST TEXT or forumctl comment -file FILE POST"
+	if flags.NArg() == 0 {
+		return errors.New(commentUsage)
+	}
+	postID, err := parseID(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	content := strings.Join(flags.Args()[1:], " ")
+	switch {
+	case *file != "" && content != "":
+		return errors.New(commentUsage)
+	case *file == "-":
+		source, err := io.ReadAll(bufio.NewReader(os.Stdin))
+		if err != nil {
+			return err
+		}
+		content = string(source)
+	case *file != "":
+		source, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		content = string(source)
+	}
+	if strings.TrimSpace(content) == "" {
+		return errors.New(commentUsage)
+	}
+	created, err := ctl.client.CreateComment(ctx, postID, strings.TrimSpace(content))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctl.out, "Created comment %d\n", created.ID)
+	return nil
+}
+
+func (ctl *forumctl) react(ctx context.Context, args []string) error {
+	if len(args) != 3 {
+		return errors.New("usage: forumctl react post|comment ID like|dislike|none")
+	}
+	id, err := parseID(args[1])
+	if err != nil {
+		return err
+	}
+	reaction := args[2]
+	switch args[0] {
+	case "post":
+		post, err := ctl.client.SetPostReaction(ctx, id, reaction)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(ctl.out, "Post %d: %d likes, %d dislikes\n", post.ID, post.Likes, post.Dislikes)
+	case "comment":
+		comment, err := ctl.client.SetCommentReaction(ctx, id, reaction)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(ctl.out, "Comment %d: %d likes, %d dislikes\n", comment.ID, comment.Likes, comment.Dislikes)
+	default:
+		return errors.New("usage: forumctl react post|comment ID like|dislike|none")
+	}
+	return nil
+}
+
+// notifications prints the latest notifications, and with -follow keeps asking for new ones until interrupted.
+func (ctl *forumctl) notifications(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("notifications", flag.ContinueOnError)
+	follow := flags.Bool("follow", false, "keep printing new notifications")
+	interval := flags.Duration("interval", 15*time.Second, "how often to ask for new notifications with -follow")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 || *interval < time.Second {
+		return errors.New("usage: forumctl notifications [-follow] [-interval D], D at least 1s")
+	}
+
+	seen := map[int]bool{}
+	first := true
+	for {
+		page, err := ctl.client.Notifications(ctx, forumclient.PageOptions{PerPage: 100})
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return nil
+			}
+			return err
+		}
+		// the list is newest first, print them in the order they happened
+		for i := len(page.Notifications) - 1; i >= 0; i-- {
+			notification := page.Notifications[i]
+			if seen[notification.ID] {
+				continue
+			}
+			seen[notification.ID] = true
+			printNotification(ctl.out, notification)
+		}
+		if first && len(page.Notifications) == 0 && !*follow {
+			fmt.Fprintln(ctl.out, "No notifications")
+		}
+		first = false
+		if !*follow {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+func printNotification(out io.Writer, notification forumclient.Notification) {
+	unread := " "
+	if notification.ReadAt == nil {
+		unread = "*"
+	}
+	fmt.Fprintf(out, "%s %s  [%d] %s\n", unread, formatTime(notification.CreatedAt), notification.ID, notification.Message)
+}
+
+func (ctl *forumctl) read(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: forumctl read NOTIFICATION|all")
+	}
+	if args[0] == "all" {
+		if err := ctl.client.MarkAllNotificationsRead(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(ctl.out, "Marked all notifications as read")
+		return nil
+	}
+	notificationID, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	if err := ctl.client.MarkNotificationRead(ctx, notificationID); err != nil {
+		return err
+	}
+	fmt.Fprintf(ctl.out, "Marked notification %d as read\n", notificationID)
+	return nil
+}
+
+func (ctl *forumctl) queue(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("queue", flag.ContinueOnError)
+	page := flags.Int("page", 1, "page of the queue")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: forumctl queue [-page N]")
+	}
+	queue, err := ctl.client.ModerationQueue(ctx, forumclient.PageOptions{Page: *page})
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(ctl.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "TYPE\tID\tPOST\tAUTHOR\tCREATED\tREPORT\tTEXT")
+	for _, item := range queue.Items {
+		text := item.Content
+		if item.Type == "post" {
+			text = item.Title
+		}
+		report := item.Report
+		if report == "" {
+			report = "-"
+		}
+		fmt.Fprintf(table, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", item.Type, item.ID, item.PostID, item.Author.Username,
+			formatTime(item.CreatedAt), report, shorten(text, 60))
+	}
+	table.Flush()
+	printPagination(ctl.out, queue.Pagination)
+	return nil
+}
+
+func (ctl *forumctl) approve(ctx context.Context, args []string) error {
+	kind, id, err := contentArgs("approve", args)
+	if err != nil {
+		return err
+	}
+	if kind == "post" {
+		_, err = ctl.client.ApprovePost(ctx, id)
+	} else {
+		_, err = ctl.client.ApproveComment(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctl.out, "Approved %s %d\n", kind, id)
+	return nil
+}
+
+// reject deletes content from the queue, which is what the reject buttons of the feed do.
+func (ctl *forumctl) reject(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reject", flag.ContinueOnError)
+	reason := flags.String("reason", "", "why, sent to the author")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	kind, id, err := contentArgs("reject [-reason R]", flags.Args())
+	if err != nil {
+		return err
+	}
+	if kind == "post" {
+		err = ctl.client.DeletePost(ctx, id, *reason)
+	} else {
+		err = ctl.client.DeleteComment(ctx, id, *reason)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctl.out, "Deleted %s %d\n", kind, id)
+	return nil
+}
+
+func contentArgs(command string, args []string) (string, int, error) {
+	if len(args) != 2 || (args[0] != "post" && args[0] != "comment") {
+		return "", 0, fmt.Errorf("usage: forumctl %s post|comment ID", command)
+	}
+	id, err := parseID(args[1])
+	return args[0], id, err
+}
+
+func (ctl *forumctl) report(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: forumctl report POST irrelevant|obscene|illegal|insulting")
+	}
+	postID, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	if _, err := ctl.client.ReportPost(ctx, postID, args[1]); err != nil {
+		return err
+	}
+	fmt.Fprintf(ctl.out, "Reported post %d as %s\n", postID, args[1])
+	return nil
+}
+
+func (ctl *forumctl) resolve(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	reason := flags.String("reason", "", "why the post is removed, sent to the author instead of the report category")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) != 2 {
+		return errors.New("usage: forumctl resolve [-reason R] POST keep|remove")
+	}
+	postID, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	if err := ctl.client.ResolveReport(ctx, postID, args[1], *reason); err != nil {
+		return err
+	}
+	if args[1] == "remove" {
+		fmt.Fprintf(ctl.out, "Removed post %d\n", postID)
+	} else {
+		fmt.Fprintf(ctl.out, "Kept post %d, the report is closed\n", postID)
+	}
+	return nil
+}
+
+func parseID(value string) (int, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("%q is not an ID", value)
+	}
+	return id, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format("Jan 2, 2006 at 15:04")
+}
+
+func shorten(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > max {
+		return string(runes[:max-1]) + "…"
+	}
+	return text
+}
+
+func printPagination(out io.Writer, pagination forumclient.Pagination) {
+	if pagination.TotalPages > 1 {
+		fmt.Fprintf(out, "page %d of %d, %d in all\n", pagination.Page, pagination.TotalPages, pagination.Total)
+	}
+}
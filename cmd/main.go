@@ -24,6 +24,14 @@ func main() {
 		log.Fatalf("Error reading config file: %v", err)
 	}
 
+	// Run a subcommand such as `forum admin create` instead of the server
+	if len(os.Args) > 1 {
+		if err := runCommand(configObj, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Display config values for debugging purposes
 	log.Printf("Config loaded: Address=%s, DB Path=%s, DB Driver=%s", configObj.Address, configObj.DbPath, configObj.DbDriver)
 
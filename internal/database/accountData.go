@@ -0,0 +1,310 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"forum/internal/models"
+	"strconv"
+	"time"
+)
+
+type AccountDataRepoImpl struct {
+	db *sql.DB
+}
+
+func CreateNewAccountDataDB(db *sql.DB) *AccountDataRepoImpl {
+	return &AccountDataRepoImpl{db}
+}
+
+func (accountObj *AccountDataRepoImpl) CreateDataExport(export *models.DataExport) (int64, error) {
+	result, err := accountObj.db.Exec(
+		`INSERT INTO data_exports (user_id, status, file_path, created_time, expires_at) VALUES (?, ?, ?, ?, ?);`,
+		export.UserID, export.Status, export.FilePath, export.CreatedTime, export.ExpiresAt)
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+func (accountObj *AccountDataRepoImpl) UpdateDataExport(export *models.DataExport) error {
+	if _, err := accountObj.db.Exec(
+		`UPDATE data_exports SET status = ?, file_path = ?, expires_at = ? WHERE id = ?`,
+		export.Status, export.FilePath, export.ExpiresAt, export.ExportID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (accountObj *AccountDataRepoImpl) GetDataExportByID(exportID int) (*models.DataExport, error) {
+	export := &models.DataExport{}
+	err := accountObj.db.QueryRow(
+		`SELECT id, user_id, status, file_path, created_time, expires_at FROM data_exports WHERE id = ?`,
+		exportID).Scan(&export.ExportID, &export.UserID, &export.Status, &export.FilePath, &export.CreatedTime, &export.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("data export not found")
+		}
+		return nil, err
+	}
+	return export, nil
+}
+
+func (accountObj *AccountDataRepoImpl) GetDataExportsByUserID(userID int) ([]*models.DataExport, error) {
+	return accountObj.queryDataExports(`SELECT id, user_id, status, file_path, created_time, expires_at FROM data_exports WHERE user_id = ? ORDER BY id DESC`, userID)
+}
+
+func (accountObj *AccountDataRepoImpl) GetPendingDataExports() ([]*models.DataExport, error) {
+	return accountObj.queryDataExports(`SELECT id, user_id, status, file_path, created_time, expires_at FROM data_exports WHERE status = ? ORDER BY id`, models.DataExportPending)
+}
+
+func (accountObj *AccountDataRepoImpl) GetExpiredDataExports(now time.Time) ([]*models.DataExport, error) {
+	return accountObj.queryDataExports(`SELECT id, user_id, status, file_path, created_time, expires_at FROM data_exports WHERE expires_at < ?`, now)
+}
+
+func (accountObj *AccountDataRepoImpl) queryDataExports(query string, args ...interface{}) ([]*models.DataExport, error) {
+	exports := []*models.DataExport{}
+	rows, err := accountObj.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var export models.DataExport
+		err = rows.Scan(&export.ExportID, &export.UserID, &export.Status, &export.FilePath, &export.CreatedTime, &export.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, &export)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (accountObj *AccountDataRepoImpl) DeleteDataExport(exportID int) error {
+	if _, err := accountObj.db.Exec(`DELETE FROM data_exports WHERE id = ?`, exportID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (accountObj *AccountDataRepoImpl) GetOldUsernamesByUserID(userID int) ([]string, error) {
+	usernames := []string{}
+	rows, err := accountObj.db.Query(`SELECT old_username FROM username_history WHERE user_id = ? ORDER BY changed_time`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var username string
+		if err = rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return usernames, nil
+}
+
+// SaveAccountDeletion schedules the deletion, replacing one the user already asked for.
+func (accountObj *AccountDataRepoImpl) SaveAccountDeletion(deletion *models.AccountDeletion) error {
+	_, err := accountObj.db.Exec(`
+		INSERT INTO account_deletions (user_id, mode, requested_time, scheduled_time) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET mode = excluded.mode, requested_time = excluded.requested_time, scheduled_time = excluded.scheduled_time`,
+		deletion.UserID, deletion.Mode, deletion.RequestedTime, deletion.ScheduledTime)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (accountObj *AccountDataRepoImpl) GetAccountDeletion(userID int) (*models.AccountDeletion, error) {
+	deletion := &models.AccountDeletion{}
+	err := accountObj.db.QueryRow(
+		`SELECT user_id, mode, requested_time, scheduled_time FROM account_deletions WHERE user_id = ?`,
+		userID).Scan(&deletion.UserID, &deletion.Mode, &deletion.RequestedTime, &deletion.ScheduledTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("account deletion not found")
+		}
+		return nil, err
+	}
+	return deletion, nil
+}
+
+func (accountObj *AccountDataRepoImpl) GetDueAccountDeletions(now time.Time) ([]*models.AccountDeletion, error) {
+	deletions := []*models.AccountDeletion{}
+	rows, err := accountObj.db.Query(
+		`SELECT user_id, mode, requested_time, scheduled_time FROM account_deletions WHERE scheduled_time <= ?`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deletion models.AccountDeletion
+		if err = rows.Scan(&deletion.UserID, &deletion.Mode, &deletion.RequestedTime, &deletion.ScheduledTime); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, &deletion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+func (accountObj *AccountDataRepoImpl) DeleteAccountDeletion(userID int) error {
+	if _, err := accountObj.db.Exec(`DELETE FROM account_deletions WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AnonymizeUserContent hands the posts and comments of the user over to the "deleted user" account.
+func (accountObj *AccountDataRepoImpl) AnonymizeUserContent(userID int) error {
+	trans, err := accountObj.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer trans.Rollback()
+
+	if _, err := trans.Exec(`
+		INSERT INTO users (firstName, secondName, usernames, email, password, role)
+		SELECT 'deleted', 'user', 'deleted user', NULL, '', ? WHERE NOT EXISTS (SELECT 1 FROM users WHERE role = ?)`,
+		models.RoleDeleted, models.RoleDeleted); err != nil {
+		return err
+	}
+	var deletedUserID int
+	if err := trans.QueryRow(`SELECT id FROM users WHERE role = ? ORDER BY id LIMIT 1`, models.RoleDeleted).Scan(&deletedUserID); err != nil {
+		return err
+	}
+	if _, err := trans.Exec(`UPDATE posts SET user_id = ? WHERE user_id = ?`, deletedUserID, userID); err != nil {
+		return err
+	}
+	if _, err := trans.Exec(`UPDATE comments SET user_id = ? WHERE user_id = ?`, deletedUserID, userID); err != nil {
+		return err
+	}
+	if err := deleteUserReactions(trans, userID); err != nil {
+		return err
+	}
+	return trans.Commit()
+}
+
+// EraseUserContent deletes the posts of the user together with everything under them, and the user's
+// comments on other posts. It returns the images of the deleted posts, which are left for the caller to remove.
+func (accountObj *AccountDataRepoImpl) EraseUserContent(userID int) ([]string, error) {
+	trans, err := accountObj.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer trans.Rollback()
+
+	// reactions first, so the counters of content that stays are corrected
+	if err := deleteUserReactions(trans, userID); err != nil {
+		return nil, err
+	}
+
+	images := []string{}
+	rows, err := trans.Query(`SELECT image_path FROM posts WHERE user_id = ? AND image_path != ''`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var image string
+		if err := rows.Scan(&image); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	rows.Close()
+
+	ownPosts := `SELECT id FROM posts WHERE user_id = ?`
+	if _, err := trans.Exec(`DELETE FROM comment_votes WHERE comment_id IN
+		(SELECT id FROM comments WHERE user_id = ? OR post_id IN (`+ownPosts+`))`, userID, userID); err != nil {
+		return nil, err
+	}
+	if _, err := trans.Exec(`DELETE FROM comments WHERE user_id = ? OR post_id IN (`+ownPosts+`)`, userID, userID); err != nil {
+		return nil, err
+	}
+	if _, err := trans.Exec(`DELETE FROM post_votes WHERE post_id IN (`+ownPosts+`)`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := trans.Exec(`DELETE FROM post_category WHERE post_id IN (`+ownPosts+`)`, userID); err != nil {
+		return nil, err
+	}
+	if _, err := trans.Exec(`DELETE FROM posts WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	return images, trans.Commit()
+}
+
+// deleteUserReactions removes the likes and dislikes of the user and takes them off the counters.
+func deleteUserReactions(trans *sql.Tx, userID int) error {
+	statements := []string{
+		`UPDATE posts SET
+			likes_counter = likes_counter - (SELECT COUNT(*) FROM post_votes WHERE post_id = posts.id AND user_id = ? AND reaction = 1),
+			dislikes_counter = dislikes_counter - (SELECT COUNT(*) FROM post_votes WHERE post_id = posts.id AND user_id = ? AND reaction = -1)
+		WHERE id IN (SELECT post_id FROM post_votes WHERE user_id = ?)`,
+		`UPDATE comments SET
+			likes_counter = likes_counter - (SELECT COUNT(*) FROM comment_votes WHERE comment_id = comments.id AND user_id = ? AND reaction = 1),
+			dislikes_counter = dislikes_counter - (SELECT COUNT(*) FROM comment_votes WHERE comment_id = comments.id AND user_id = ? AND reaction = -1)
+		WHERE id IN (SELECT comment_id FROM comment_votes WHERE user_id = ?)`,
+	}
+	for _, statement := range statements {
+		if _, err := trans.Exec(statement, userID, userID, userID); err != nil {
+			return err
+		}
+	}
+	if _, err := trans.Exec(`DELETE FROM post_votes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := trans.Exec(`DELETE FROM comment_votes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteUserAccount removes the user and everything that belongs to the account itself.
+// Content has to be anonymized or erased first.
+func (accountObj *AccountDataRepoImpl) DeleteUserAccount(userID int) error {
+	trans, err := accountObj.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer trans.Rollback()
+
+	// mail to the account, sent or not, including the confirmation of an address change
+	if _, err := trans.Exec(`DELETE FROM mail_queue WHERE to_address IN
+		(SELECT email FROM users WHERE id = ? UNION SELECT new_email FROM email_changes WHERE user_id = ?)`, userID, userID); err != nil {
+		return err
+	}
+	for _, table := range []string{"sessions", "access_tokens", "user_identities", "profile_privacy", "username_history",
+		"email_changes", "password_resets", "data_exports", "account_deletions", "notifications", "notification_preferences",
+		"notification_mutes", "digest_subscriptions", "digest_categories", "digest_items"} {
+		if _, err := trans.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+	}
+	// what the user did stays in the notifications of others, without the name
+	if _, err := trans.Exec(`UPDATE notifications SET actor_id = NULL WHERE actor_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := trans.Exec(`DELETE FROM notification_mutes WHERE target_type = ? AND target_id = ?`, models.MuteUser, userID); err != nil {
+		return err
+	}
+	if _, err := trans.Exec(`DELETE FROM login_failures WHERE kind = ? AND subject = ?`,
+		models.LoginFailureAccount, strconv.Itoa(userID)); err != nil {
+		return err
+	}
+	if _, err := trans.Exec(`DELETE FROM users WHERE id = ?`, userID); err != nil {
+		return err
+	}
+	return trans.Commit()
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"database/sql"
+	"forum/internal/models"
+)
+
+type AuditRepoImpl struct {
+	db *sql.DB
+}
+
+func CreateNewAuditDB(db *sql.DB) *AuditRepoImpl {
+	return &AuditRepoImpl{db}
+}
+
+func (auditObj *AuditRepoImpl) CreateAuditEntry(entry *models.AuditEntry) (int64, error) {
+	result, err := auditObj.db.Exec(`
+		INSERT INTO audit_log (actor_id, action, resource_type, resource_id, owner_id, created_time) VALUES (?, ?, ?, ?, ?, ?);`,
+		entry.ActorID, entry.Action, entry.ResourceType, entry.ResourceID, entry.OwnerID, entry.CreatedTime)
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+func (auditObj *AuditRepoImpl) GetAuditEntries() ([]*models.AuditEntry, error) {
+	entries := []*models.AuditEntry{}
+	rows, err := auditObj.db.Query(`
+	SELECT id, actor_id, action, resource_type, resource_id, owner_id, created_time FROM audit_log ORDER BY created_time DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		err = rows.Scan(&entry.AuditID, &entry.ActorID, &entry.Action, &entry.ResourceType, &entry.ResourceID, &entry.OwnerID, &entry.CreatedTime)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -250,3 +250,41 @@ func (cmnt *CommentRepoImpl) GetCommentByUserID(userID int) ([]*models.Comment,
 	}
 	return comments, nil
 }
+
+// GetUnapprovedComments returns the comments waiting for a moderator, oldest first.
+func (cmnt *CommentRepoImpl) GetUnapprovedComments() ([]*models.Comment, error) {
+	comments := []*models.Comment{}
+	rows, err := cmnt.db.Query(`
+    SELECT id, post_id, user_id, content, created_time, likes_counter,
+           dislikes_counter, is_approved, reports, is_seen
+    FROM comments WHERE is_approved = 0 ORDER BY created_time
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var comment models.Comment
+		err = rows.Scan(
+			&comment.CommentID,
+			&comment.PostID,
+			&comment.UserID,
+			&comment.Content,
+			&comment.CreatedTime,
+			&comment.LikesCounter,
+			&comment.DislikeCounter,
+			&comment.IsApproved,
+			&comment.ReportStatus,
+			&comment.IsSeen,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, &comment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"database/sql"
+	"forum/internal/models"
+	"strings"
+	"time"
+)
+
+// kinds of items recorded in digest_items
+const (
+	digestItemNotification = "notification"
+	digestItemPost         = "post"
+)
+
+type DigestRepoImpl struct {
+	db *sql.DB
+}
+
+func CreateNewDigestDB(db *sql.DB) *DigestRepoImpl {
+	return &DigestRepoImpl{db}
+}
+
+// GetDigestSettings returns the settings of a user, with the digest off when the user never turned it on.
+func (digestObj *DigestRepoImpl) GetDigestSettings(userID int) (*models.DigestSettings, error) {
+	settings := &models.DigestSettings{UserID: userID, Frequency: models.DigestOff, CategoryIDs: []int{}}
+	err := digestObj.db.QueryRow(`SELECT frequency, last_sent_at FROM digest_subscriptions WHERE user_id = ?`, userID).
+		Scan(&settings.Frequency, &settings.LastSentTime)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	rows, err := digestObj.db.Query(`SELECT category_id FROM digest_categories WHERE user_id = ? ORDER BY category_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var categoryID int
+		if err = rows.Scan(&categoryID); err != nil {
+			return nil, err
+		}
+		settings.CategoryIDs = append(settings.CategoryIDs, categoryID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SaveDigestSettings replaces the settings of a user. Turning the digest on starts its first period at
+// now, changing how often it comes keeps the time of the last one.
+func (digestObj *DigestRepoImpl) SaveDigestSettings(settings *models.DigestSettings, now time.Time) error {
+	trans, err := digestObj.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer trans.Rollback()
+
+	if settings.Frequency == models.DigestOff {
+		_, err = trans.Exec(`DELETE FROM digest_subscriptions WHERE user_id = ?`, settings.UserID)
+	} else {
+		_, err = trans.Exec(`
+			INSERT INTO digest_subscriptions (user_id, frequency, last_sent_at) VALUES (?, ?, ?)
+			ON CONFLICT (user_id) DO UPDATE SET frequency = excluded.frequency`,
+			settings.UserID, settings.Frequency, now)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = trans.Exec(`DELETE FROM digest_categories WHERE user_id = ?`, settings.UserID); err != nil {
+		return err
+	}
+	for _, categoryID := range settings.CategoryIDs {
+		if _, err = trans.Exec(`INSERT OR IGNORE INTO digest_categories (user_id, category_id) VALUES (?, ?)`, settings.UserID, categoryID); err != nil {
+			return err
+		}
+	}
+	return trans.Commit()
+}
+
+// GetDueDigests returns the settings of the users whose next digest is due at now.
+func (digestObj *DigestRepoImpl) GetDueDigests(now time.Time) ([]*models.DigestSettings, error) {
+	due := []*models.DigestSettings{}
+	rows, err := digestObj.db.Query(`
+		SELECT user_id, frequency, last_sent_at FROM digest_subscriptions
+		WHERE (frequency = ? AND last_sent_at <= ?) OR (frequency = ? AND last_sent_at <= ?)
+		ORDER BY user_id`,
+		models.DigestDaily, now.Add(-models.DigestPeriod(models.DigestDaily)),
+		models.DigestWeekly, now.Add(-models.DigestPeriod(models.DigestWeekly)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		settings := &models.DigestSettings{}
+		if err = rows.Scan(&settings.UserID, &settings.Frequency, &settings.LastSentTime); err != nil {
+			return nil, err
+		}
+		due = append(due, settings)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+// GetDigestNotifications returns the newest unread notifications of the given types that were in no
+// digest of the user yet.
+func (digestObj *DigestRepoImpl) GetDigestNotifications(userID int, types []string, limit int) ([]*models.Notification, error) {
+	if len(types) == 0 {
+		return []*models.Notification{}, nil
+	}
+	args := []interface{}{userID}
+	for _, notificationType := range types {
+		args = append(args, notificationType)
+	}
+	args = append(args, digestItemNotification, limit)
+	rows, err := digestObj.db.Query(`
+		SELECT n.id, n.user_id, n.type, COALESCE(n.actor_id, 0), COALESCE(u.usernames, ''), n.target_type, n.target_id,
+			n.payload, n.created_at, n.read_at
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = ? AND n.read_at IS NULL AND n.type IN (?`+strings.Repeat(", ?", len(types)-1)+`)
+			AND NOT EXISTS (SELECT 1 FROM digest_items d WHERE d.user_id = n.user_id AND d.item_type = ? AND d.item_id = n.id)
+		ORDER BY n.id DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotifications(rows)
+}
+
+// GetDigestNewPosts returns approved posts of others created since the given time in the categories the
+// user follows, newest first, leaving out the posts that were in a digest of the user already.
+func (digestObj *DigestRepoImpl) GetDigestNewPosts(userID int, since time.Time, limit int) ([]*models.Post, error) {
+	return digestObj.queryDigestPosts(`
+		SELECT p.id, p.user_id, COALESCE(u.usernames, ''), p.title, p.content, p.created_time, p.likes_counter, p.dislikes_counter
+		FROM posts p
+		LEFT JOIN users u ON u.id = p.user_id
+		WHERE p.is_approved = 1 AND p.user_id != ? AND p.created_time >= ?
+			AND p.id IN (
+				SELECT pc.post_id FROM post_category pc
+				JOIN categories c ON c.category_name = pc.category_name
+				JOIN digest_categories dc ON dc.category_id = c.id
+				WHERE dc.user_id = ?)
+			AND NOT EXISTS (SELECT 1 FROM digest_items d WHERE d.user_id = ? AND d.item_type = ? AND d.item_id = p.id)
+		ORDER BY p.created_time DESC
+		LIMIT ?`,
+		userID, since, userID, userID, digestItemPost, limit)
+}
+
+// GetDigestTopPosts returns the approved posts created since the given time with the most reactions,
+// leaving out the posts of the user and those that were in a digest of the user already.
+func (digestObj *DigestRepoImpl) GetDigestTopPosts(userID int, since time.Time, limit int) ([]*models.Post, error) {
+	return digestObj.queryDigestPosts(`
+		SELECT p.id, p.user_id, COALESCE(u.usernames, ''), p.title, p.content, p.created_time, p.likes_counter, p.dislikes_counter
+		FROM posts p
+		LEFT JOIN users u ON u.id = p.user_id
+		WHERE p.is_approved = 1 AND p.user_id != ? AND p.created_time >= ?
+			AND p.likes_counter + p.dislikes_counter > 0
+			AND NOT EXISTS (SELECT 1 FROM digest_items d WHERE d.user_id = ? AND d.item_type = ? AND d.item_id = p.id)
+		ORDER BY p.likes_counter + p.dislikes_counter DESC, p.likes_counter DESC, p.id DESC
+		LIMIT ?`,
+		userID, since, userID, digestItemPost, limit)
+}
+
+func (digestObj *DigestRepoImpl) queryDigestPosts(query string, args ...interface{}) ([]*models.Post, error) {
+	posts := []*models.Post{}
+	rows, err := digestObj.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var post models.Post
+		err = rows.Scan(&post.PostID, &post.UserID, &post.Username, &post.Title, &post.Content, &post.CreatedTime, &post.LikesCounter, &post.DislikeCounter)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, &post)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// MarkDigestSent records what the digest told the user about, so that no later digest repeats it, and
+// starts the next period at now.
+func (digestObj *DigestRepoImpl) MarkDigestSent(digest *models.Digest, now time.Time) error {
+	trans, err := digestObj.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer trans.Rollback()
+
+	userID := digest.Settings.UserID
+	for _, notification := range digest.Notifications {
+		if _, err = trans.Exec(`INSERT OR IGNORE INTO digest_items (user_id, item_type, item_id, sent_at) VALUES (?, ?, ?, ?)`,
+			userID, digestItemNotification, notification.NotificationID, now); err != nil {
+			return err
+		}
+	}
+	for _, post := range append(append([]*models.Post{}, digest.NewPosts...), digest.TopPosts...) {
+		if _, err = trans.Exec(`INSERT OR IGNORE INTO digest_items (user_id, item_type, item_id, sent_at) VALUES (?, ?, ?, ?)`,
+			userID, digestItemPost, post.PostID, now); err != nil {
+			return err
+		}
+	}
+	if _, err = trans.Exec(`UPDATE digest_subscriptions SET last_sent_at = ? WHERE user_id = ?`, now, userID); err != nil {
+		return err
+	}
+	return trans.Commit()
+}
+
+// DeleteOldDigestItems forgets what was sent before the given time. Notifications are deleted by then,
+// and posts that old are no longer new or top posts.
+func (digestObj *DigestRepoImpl) DeleteOldDigestItems(before time.Time) (int64, error) {
+	result, err := digestObj.db.Exec(`DELETE FROM digest_items WHERE sent_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"forum/internal/models"
+	"strings"
+)
+
+type FeedRepoImpl struct {
+	db *sql.DB
+}
+
+func CreateNewFeedDB(db *sql.DB) *FeedRepoImpl {
+	return &FeedRepoImpl{db}
+}
+
+// GetFeedPosts returns the newest approved posts with their author and categories. An empty category
+// and a userID of 0 leave that filter out.
+func (feedObj *FeedRepoImpl) GetFeedPosts(category string, userID int, limit int) ([]*models.Post, error) {
+	query := `
+		SELECT p.id, p.user_id, COALESCE(u.usernames, ''), p.title, p.content, p.created_time, COALESCE(p.image_path, '')
+		FROM posts p
+		LEFT JOIN users u ON u.id = p.user_id
+		WHERE p.is_approved = 1`
+	args := []interface{}{}
+	if category != "" {
+		query += ` AND p.id IN (SELECT post_id FROM post_category WHERE category_name = ?)`
+		args = append(args, category)
+	}
+	if userID != 0 {
+		query += ` AND p.user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` ORDER BY p.created_time DESC, p.id DESC LIMIT ?`
+	args = append(args, limit)
+
+	posts := []*models.Post{}
+	rows, err := feedObj.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[int]*models.Post{}
+	for rows.Next() {
+		var post models.Post
+		err = rows.Scan(&post.PostID, &post.UserID, &post.Username, &post.Title, &post.Content, &post.CreatedTime, &post.ImagePath)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, &post)
+		byID[post.PostID] = &post
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return posts, nil
+	}
+
+	// the categories of all posts in one query instead of one per post
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(posts)), ",")
+	ids := make([]interface{}, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.PostID)
+	}
+	categoryRows, err := feedObj.db.Query(`SELECT post_id, category_name FROM post_category WHERE post_id IN (`+placeholders+`) ORDER BY id`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer categoryRows.Close()
+	for categoryRows.Next() {
+		var postID int
+		var name string
+		if err = categoryRows.Scan(&postID, &name); err != nil {
+			return nil, err
+		}
+		byID[postID].Categories = append(byID[postID].Categories, name)
+	}
+	return posts, categoryRows.Err()
+}
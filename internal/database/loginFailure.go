@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"forum/internal/models"
+	"time"
+)
+
+type LoginFailureRepoImpl struct {
+	db *sql.DB
+}
+
+func CreateNewLoginFailureDB(db *sql.DB) *LoginFailureRepoImpl {
+	return &LoginFailureRepoImpl{db}
+}
+
+// GetLoginFailure returns the failures recorded for kind and subject, or an empty record if there are none.
+func (failureObj *LoginFailureRepoImpl) GetLoginFailure(kind, subject string) (*models.LoginFailure, error) {
+	failure := &models.LoginFailure{Kind: kind, Subject: subject}
+	var lastFailure, lockedUntil sql.NullTime
+	err := failureObj.db.QueryRow(`
+		SELECT failures, unnotified_failures, last_failure, locked_until FROM login_failures WHERE kind = ? AND subject = ?`,
+		kind, subject).Scan(&failure.Failures, &failure.UnnotifiedFailures, &lastFailure, &lockedUntil)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	failure.LastFailure = lastFailure.Time
+	failure.LockedUntil = lockedUntil.Time
+	return failure, nil
+}
+
+// AddLoginFailure counts a failure at now in one statement, so that logins failing at the same time
+// cannot lose a count. Failures before windowStart are forgotten first. It returns the counts after it.
+func (failureObj *LoginFailureRepoImpl) AddLoginFailure(kind, subject string, now, windowStart time.Time) (*models.LoginFailure, error) {
+	failure := &models.LoginFailure{Kind: kind, Subject: subject, LastFailure: now}
+	err := failureObj.db.QueryRow(`
+		INSERT INTO login_failures (kind, subject, failures, unnotified_failures, last_failure) VALUES (?, ?, 1, 1, ?)
+		ON CONFLICT (kind, subject) DO UPDATE SET
+			failures = CASE WHEN login_failures.last_failure < ? THEN 1 ELSE login_failures.failures + 1 END,
+			unnotified_failures = login_failures.unnotified_failures + 1, last_failure = excluded.last_failure
+		RETURNING failures, unnotified_failures`,
+		kind, subject, now, windowStart).Scan(&failure.Failures, &failure.UnnotifiedFailures)
+	if err != nil {
+		return nil, err
+	}
+	return failure, nil
+}
+
+// LockLoginFailure locks kind/subject until the given time, unless a failure was counted after the
+// one failures is the count of: that one sets its own, longer lockout.
+func (failureObj *LoginFailureRepoImpl) LockLoginFailure(kind, subject string, failures int, until time.Time) error {
+	_, err := failureObj.db.Exec(`UPDATE login_failures SET locked_until = ? WHERE kind = ? AND subject = ? AND failures = ?`,
+		until, kind, subject, failures)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (failureObj *LoginFailureRepoImpl) SaveLoginFailure(failure *models.LoginFailure) error {
+	var lockedUntil sql.NullTime
+	if !failure.LockedUntil.IsZero() {
+		lockedUntil = sql.NullTime{Time: failure.LockedUntil, Valid: true}
+	}
+	_, err := failureObj.db.Exec(`
+		INSERT INTO login_failures (kind, subject, failures, unnotified_failures, last_failure, locked_until) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (kind, subject) DO UPDATE SET failures = excluded.failures, unnotified_failures = excluded.unnotified_failures,
+			last_failure = excluded.last_failure, locked_until = excluded.locked_until`,
+		failure.Kind, failure.Subject, failure.Failures, failure.UnnotifiedFailures, failure.LastFailure, lockedUntil)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (failureObj *LoginFailureRepoImpl) DeleteLoginFailure(kind, subject string) error {
+	if _, err := failureObj.db.Exec(`DELETE FROM login_failures WHERE kind = ? AND subject = ?`, kind, subject); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetLockedLoginFailures returns the accounts and addresses that are locked out at now.
+func (failureObj *LoginFailureRepoImpl) GetLockedLoginFailures(now time.Time) ([]*models.LoginFailure, error) {
+	failures := []*models.LoginFailure{}
+	rows, err := failureObj.db.Query(`
+		SELECT kind, subject, failures, unnotified_failures, last_failure, locked_until FROM login_failures
+		WHERE locked_until > ? ORDER BY locked_until DESC`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var failure models.LoginFailure
+		err = rows.Scan(&failure.Kind, &failure.Subject, &failure.Failures, &failure.UnnotifiedFailures, &failure.LastFailure, &failure.LockedUntil)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, &failure)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"forum/internal/models"
+	"time"
+)
+
+type MailRepoImpl struct {
+	db *sql.DB
+}
+
+func CreateNewMailDB(db *sql.DB) *MailRepoImpl {
+	return &MailRepoImpl{db}
+}
+
+func (mailObj *MailRepoImpl) EnqueueMail(mail *models.Mail) (int64, error) {
+	result, err := mailObj.db.Exec(`
+		INSERT INTO mail_queue (to_address, subject, text_body, html_body, status, attempts, next_attempt_at, last_error, created_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, '', ?)`,
+		mail.To, mail.Subject, mail.Text, mail.HTML, models.MailPending, mail.NextAttemptTime, mail.CreatedTime)
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+// GetDueMails returns at most limit pending mails whose next attempt is not after now, oldest first.
+func (mailObj *MailRepoImpl) GetDueMails(now time.Time, limit int) ([]*models.Mail, error) {
+	mails := []*models.Mail{}
+	rows, err := mailObj.db.Query(`
+		SELECT id, to_address, subject, text_body, html_body, status, attempts, next_attempt_at, last_error, created_at
+		FROM mail_queue WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+		models.MailPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mail models.Mail
+		err = rows.Scan(&mail.MailID, &mail.To, &mail.Subject, &mail.Text, &mail.HTML, &mail.Status,
+			&mail.Attempts, &mail.NextAttemptTime, &mail.LastError, &mail.CreatedTime)
+		if err != nil {
+			return nil, err
+		}
+		mails = append(mails, &mail)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return mails, nil
+}
+
+func (mailObj *MailRepoImpl) MarkMailSent(mailID int, now time.Time) error {
+	_, err := mailObj.db.Exec(`UPDATE mail_queue SET status = ?, attempts = attempts + 1, last_error = '', sent_at = ? WHERE id = ?`,
+		models.MailSent, now, mailID)
+	return err
+}
+
+// RetryMail records a failed attempt and leaves the mail pending until next.
+func (mailObj *MailRepoImpl) RetryMail(mailID int, next time.Time, lastError string) error {
+	_, err := mailObj.db.Exec(`UPDATE mail_queue SET attempts = attempts + 1, next_attempt_at = ?, last_error = ? WHERE id = ?`,
+		next, lastError, mailID)
+	return err
+}
+
+func (mailObj *MailRepoImpl) MarkMailFailed(mailID int, lastError string) error {
+	_, err := mailObj.db.Exec(`UPDATE mail_queue SET status = ?, attempts = attempts + 1, last_error = ? WHERE id = ?`,
+		models.MailFailed, lastError, mailID)
+	return err
+}
+
+// DeleteOldMails removes sent and failed mails created before the given time, pending ones stay.
+func (mailObj *MailRepoImpl) DeleteOldMails(before time.Time) (int64, error) {
+	result, err := mailObj.db.Exec(`DELETE FROM mail_queue WHERE status != ? AND created_at < ?`, models.MailPending, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -157,5 +157,382 @@ func CreateAllTables(ctx context.Context, db *sql.DB) error {
 		return err
 	}
 
+	// Create audit_log table
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS audit_log(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor_id INTEGER,
+			action TEXT,
+			resource_type TEXT,
+			resource_id INTEGER,
+			owner_id INTEGER,
+			created_time DATE,
+			FOREIGN KEY (actor_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create profile_privacy table
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS profile_privacy(
+			user_id INTEGER PRIMARY KEY,
+			show_posts BOOLEAN DEFAULT 0,
+			show_comments BOOLEAN DEFAULT 0,
+			show_reactions BOOLEAN DEFAULT 0,
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create invitations table
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS invitations(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token_hash TEXT UNIQUE,
+			role TEXT,
+			created_by INTEGER,
+			expires_at DATE,
+			used_at DATE,
+			used_by INTEGER DEFAULT 0,
+			FOREIGN KEY (created_by) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create user_identities table
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS user_identities(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			provider TEXT,
+			subject TEXT,
+			email TEXT,
+			created_time DATE,
+			UNIQUE (provider, subject),
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create access_tokens table
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS access_tokens(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			name TEXT,
+			token_hash TEXT UNIQUE,
+			scope TEXT,
+			created_time DATE,
+			expires_at DATE,
+			last_used_time DATE,
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create login_failures table
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS login_failures(
+			kind TEXT,
+			subject TEXT,
+			failures INTEGER DEFAULT 0,
+			unnotified_failures INTEGER DEFAULT 0,
+			last_failure DATE,
+			locked_until DATE,
+			PRIMARY KEY (kind, subject)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create username_history table, old usernames keep pointing to the account that used them
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS username_history(
+			old_username TEXT PRIMARY KEY,
+			user_id INTEGER,
+			changed_time DATE,
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create email_changes table
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS email_changes(
+			token_hash TEXT PRIMARY KEY,
+			user_id INTEGER UNIQUE,
+			new_email TEXT,
+			expires_at DATE,
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create password_resets table
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS password_resets(
+			token_hash TEXT PRIMARY KEY,
+			user_id INTEGER UNIQUE,
+			expires_at DATE,
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create data_exports table
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS data_exports(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			status TEXT,
+			file_path TEXT,
+			created_time DATE,
+			expires_at DATE,
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create account_deletions table
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS account_deletions(
+			user_id INTEGER PRIMARY KEY,
+			mode TEXT,
+			requested_time DATE,
+			scheduled_time DATE,
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// comments.is_seen was only ever added by hand to existing databases
+	if err = addColumn(ctx, trans, "comments", "is_seen", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Create notifications table. When it is new, the comments users were told about before are copied
+	// into it; reactions are not, post_votes is recreated empty above
+	var hasNotifications int
+	if err = trans.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'notifications'`).Scan(&hasNotifications); err != nil {
+		return err
+	}
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS notifications(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			actor_id INTEGER,
+			target_type TEXT NOT NULL DEFAULT '',
+			target_id INTEGER NOT NULL DEFAULT 0,
+			payload TEXT NOT NULL DEFAULT '{}',
+			created_at DATETIME NOT NULL,
+			read_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users (id),
+			FOREIGN KEY (actor_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+	if _, err = trans.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS notifications_user_id ON notifications (user_id, id)`); err != nil {
+		return err
+	}
+	if hasNotifications == 0 {
+		if _, err = trans.ExecContext(ctx, `
+			INSERT INTO notifications (user_id, type, actor_id, target_type, target_id, payload, created_at, read_at)
+			SELECT p.user_id, 'post_comment', c.user_id, 'comment', c.id,
+				json_object('post_id', p.id, 'post_title', p.title, 'comment_id', c.id),
+				c.created_time, CASE WHEN c.is_seen = 1 THEN c.created_time END
+			FROM comments c
+			JOIN posts p ON p.id = c.post_id
+			WHERE c.user_id != p.user_id AND c.is_approved = 1
+			ORDER BY c.created_time
+		`); err != nil {
+			return err
+		}
+	}
+
+	// Create notification_preferences table, a row per notification type the user changed
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS notification_preferences(
+			user_id INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			delivery TEXT NOT NULL,
+			PRIMARY KEY (user_id, type),
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create notification_mutes table: the threads (posts) and users a user does not want to hear about
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS notification_mutes(
+			user_id INTEGER NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id INTEGER NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, target_type, target_id),
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create mail_queue table: outbound e-mail, retried with a growing delay until sent or given up on
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS mail_queue(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			to_address TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			text_body TEXT NOT NULL,
+			html_body TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			sent_at DATETIME
+		)
+	`); err != nil {
+		return err
+	}
+	if _, err = trans.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS mail_queue_due ON mail_queue (status, next_attempt_at)`); err != nil {
+		return err
+	}
+
+	// Create digest_subscriptions table, a row per user who turned the digest e-mail on
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS digest_subscriptions(
+			user_id INTEGER PRIMARY KEY,
+			frequency TEXT NOT NULL,
+			last_sent_at DATETIME NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create digest_categories table: the categories whose new posts go into the digest of a user
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS digest_categories(
+			user_id INTEGER NOT NULL,
+			category_id INTEGER NOT NULL,
+			PRIMARY KEY (user_id, category_id),
+			FOREIGN KEY (user_id) REFERENCES users (id),
+			FOREIGN KEY (category_id) REFERENCES categories (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create digest_items table: the notifications and posts a user got in a digest, never sent again
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS digest_items(
+			user_id INTEGER NOT NULL,
+			item_type TEXT NOT NULL,
+			item_id INTEGER NOT NULL,
+			sent_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, item_type, item_id),
+			FOREIGN KEY (user_id) REFERENCES users (id)
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create webhooks table: URLs admins subscribe to forum events, events is a comma separated list
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS webhooks(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT 1,
+			created_by INTEGER,
+			created_at DATETIME NOT NULL
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Create webhook_deliveries table: events on their way to a webhook and the log of the attempts
+	if _, err = trans.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS webhook_deliveries(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id INTEGER NOT NULL,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			response_status INTEGER NOT NULL DEFAULT 0,
+			response_body TEXT NOT NULL DEFAULT '',
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			delivered_at DATETIME,
+			FOREIGN KEY (webhook_id) REFERENCES webhooks (id)
+		)
+	`); err != nil {
+		return err
+	}
+	if _, err = trans.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at)`); err != nil {
+		return err
+	}
+	if _, err = trans.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id)`); err != nil {
+		return err
+	}
+
+	// Profile fields added to existing tables; accounts created before have no join date
+	if err = addColumn(ctx, trans, "users", "created_time", "DATE"); err != nil {
+		return err
+	}
+	if err = addColumn(ctx, trans, "users", "bio", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = addColumn(ctx, trans, "users", "avatar_path", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err = addColumn(ctx, trans, "profile_privacy", "show_stats", "BOOLEAN DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Accounts created by OAuth logins used to get a plain text placeholder password,
+	// they have no local password until the owner sets one
+	if _, err = trans.ExecContext(ctx, `UPDATE users SET password = '' WHERE password = 'dummypassword'`); err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// addColumn adds a column to a table created by an earlier version, CREATE TABLE IF NOT EXISTS leaves those as they are.
+func addColumn(ctx context.Context, trans *sql.Tx, table, column, definition string) error {
+	rows, err := trans.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = trans.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN `+column+` `+definition)
+	return err
+}
@@ -0,0 +1,217 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"forum/internal/models"
+	"time"
+)
+
+type NotificationRepoImpl struct {
+	db *sql.DB
+}
+
+func CreateNewNotificationDB(db *sql.DB) *NotificationRepoImpl {
+	return &NotificationRepoImpl{db}
+}
+
+func (notificationObj *NotificationRepoImpl) CreateNotification(notification *models.Notification) (int64, error) {
+	payload, err := json.Marshal(notification.Payload)
+	if err != nil {
+		return 0, err
+	}
+	var actorID sql.NullInt64
+	if notification.ActorID != 0 {
+		actorID = sql.NullInt64{Int64: int64(notification.ActorID), Valid: true}
+	}
+	result, err := notificationObj.db.Exec(`
+		INSERT INTO notifications (user_id, type, actor_id, target_type, target_id, payload, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		notification.UserID, notification.Type, actorID, notification.TargetType, notification.TargetID, string(payload), notification.CreatedTime)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetNotificationsByUserID returns a page of the notifications of a user, newest first.
+func (notificationObj *NotificationRepoImpl) GetNotificationsByUserID(userID, limit, offset int) ([]*models.Notification, error) {
+	rows, err := notificationObj.db.Query(`
+		SELECT n.id, n.user_id, n.type, COALESCE(n.actor_id, 0), COALESCE(u.usernames, ''), n.target_type, n.target_id,
+			n.payload, n.created_at, n.read_at
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = ?
+		ORDER BY n.id DESC
+		LIMIT ? OFFSET ?`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotifications(rows)
+}
+
+// scanNotifications reads the rows of a query that selects the columns GetNotificationsByUserID does.
+func scanNotifications(rows *sql.Rows) ([]*models.Notification, error) {
+	defer rows.Close()
+	notifications := []*models.Notification{}
+	for rows.Next() {
+		var notification models.Notification
+		var payload string
+		var readAt sql.NullTime
+		err := rows.Scan(
+			&notification.NotificationID,
+			&notification.UserID,
+			&notification.Type,
+			&notification.ActorID,
+			&notification.ActorUsername,
+			&notification.TargetType,
+			&notification.TargetID,
+			&payload,
+			&notification.CreatedTime,
+			&readAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(payload), &notification.Payload); err != nil {
+			return nil, err
+		}
+		notification.ReadTime = readAt.Time
+		notifications = append(notifications, &notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (notificationObj *NotificationRepoImpl) CountNotifications(userID int) (int, error) {
+	var count int
+	err := notificationObj.db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ?`, userID).Scan(&count)
+	return count, err
+}
+
+func (notificationObj *NotificationRepoImpl) CountUnreadNotifications(userID int) (int, error) {
+	var count int
+	err := notificationObj.db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationRead marks one notification of userID as read. It returns sql.ErrNoRows when the
+// user has no such notification.
+func (notificationObj *NotificationRepoImpl) MarkNotificationRead(userID, notificationID int, now time.Time) error {
+	var exists int
+	err := notificationObj.db.QueryRow(`SELECT 1 FROM notifications WHERE id = ? AND user_id = ?`, notificationID, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	_, err = notificationObj.db.Exec(`UPDATE notifications SET read_at = ? WHERE id = ? AND read_at IS NULL`, now, notificationID)
+	return err
+}
+
+func (notificationObj *NotificationRepoImpl) MarkAllNotificationsRead(userID int, now time.Time) error {
+	_, err := notificationObj.db.Exec(`UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL`, now, userID)
+	return err
+}
+
+// DeleteOldNotifications deletes the notifications read before readBefore and all created before createdBefore.
+func (notificationObj *NotificationRepoImpl) DeleteOldNotifications(readBefore, createdBefore time.Time) (int64, error) {
+	result, err := notificationObj.db.Exec(`DELETE FROM notifications WHERE read_at < ? OR created_at < ?`, readBefore, createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (notificationObj *NotificationRepoImpl) GetNotificationPreferences(userID int) (*models.NotificationPreferences, error) {
+	preferences := &models.NotificationPreferences{UserID: userID, Deliveries: map[string]string{}}
+	rows, err := notificationObj.db.Query(`SELECT type, delivery FROM notification_preferences WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var notificationType, delivery string
+		if err := rows.Scan(&notificationType, &delivery); err != nil {
+			return nil, err
+		}
+		preferences.Deliveries[notificationType] = delivery
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return preferences, nil
+}
+
+// UpdateNotificationPreferences replaces the stored preferences of the user with the given ones.
+func (notificationObj *NotificationRepoImpl) UpdateNotificationPreferences(preferences *models.NotificationPreferences) error {
+	trans, err := notificationObj.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer trans.Rollback()
+
+	if _, err := trans.Exec(`DELETE FROM notification_preferences WHERE user_id = ?`, preferences.UserID); err != nil {
+		return err
+	}
+	for notificationType, delivery := range preferences.Deliveries {
+		if _, err := trans.Exec(`INSERT INTO notification_preferences (user_id, type, delivery) VALUES (?, ?, ?)`,
+			preferences.UserID, notificationType, delivery); err != nil {
+			return err
+		}
+	}
+	return trans.Commit()
+}
+
+func (notificationObj *NotificationRepoImpl) AddNotificationMute(mute *models.NotificationMute) error {
+	_, err := notificationObj.db.Exec(`
+		INSERT OR IGNORE INTO notification_mutes (user_id, target_type, target_id, created_at) VALUES (?, ?, ?, ?)`,
+		mute.UserID, mute.TargetType, mute.TargetID, mute.CreatedTime)
+	return err
+}
+
+func (notificationObj *NotificationRepoImpl) DeleteNotificationMute(userID int, targetType string, targetID int) error {
+	_, err := notificationObj.db.Exec(`DELETE FROM notification_mutes WHERE user_id = ? AND target_type = ? AND target_id = ?`,
+		userID, targetType, targetID)
+	return err
+}
+
+// GetNotificationMutes returns the mutes of a user, newest first, with the titles of the posts and the
+// names of the users. Mutes of posts and users that are gone have an empty name.
+func (notificationObj *NotificationRepoImpl) GetNotificationMutes(userID int) ([]*models.NotificationMute, error) {
+	mutes := []*models.NotificationMute{}
+	rows, err := notificationObj.db.Query(`
+		SELECT m.user_id, m.target_type, m.target_id, m.created_at,
+			CASE m.target_type WHEN ? THEN COALESCE(p.title, '') ELSE COALESCE(u.usernames, '') END
+		FROM notification_mutes m
+		LEFT JOIN posts p ON m.target_type = ? AND p.id = m.target_id
+		LEFT JOIN users u ON m.target_type = ? AND u.id = m.target_id
+		WHERE m.user_id = ?
+		ORDER BY m.created_at DESC`, models.MuteThread, models.MuteThread, models.MuteUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mute models.NotificationMute
+		if err := rows.Scan(&mute.UserID, &mute.TargetType, &mute.TargetID, &mute.CreatedTime, &mute.Name); err != nil {
+			return nil, err
+		}
+		mutes = append(mutes, &mute)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return mutes, nil
+}
+
+// IsNotificationMuted tells whether userID muted the thread postID or the user actorID. Either may be 0.
+func (notificationObj *NotificationRepoImpl) IsNotificationMuted(userID, postID, actorID int) (bool, error) {
+	var muted bool
+	err := notificationObj.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM notification_mutes WHERE user_id = ? AND
+			((target_type = ? AND target_id = ?) OR (target_type = ? AND target_id = ?)))`,
+		userID, models.MuteThread, postID, models.MuteUser, actorID).Scan(&muted)
+	return muted, err
+}
@@ -4,8 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"forum/internal/models"
-	"log"
-	"time"
+	"strings"
 )
 
 type PostRepoImpl struct {
@@ -48,6 +47,54 @@ func (postObj *PostRepoImpl) GetAllPosts() ([]*models.Post, error) {
 	return posts, nil
 }
 
+// QueryPosts returns one page of the posts the query selects and how many it selects in all.
+func (postObj *PostRepoImpl) QueryPosts(query *models.PostQuery) ([]*models.Post, int, error) {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+	if query.AuthorID != 0 {
+		where = append(where, "user_id = ?")
+		args = append(args, query.AuthorID)
+	}
+	if query.Category != "" {
+		where = append(where, "id IN (SELECT post_id FROM post_category WHERE category_name = ?)")
+		args = append(args, query.Category)
+	}
+	if query.Search != "" {
+		where = append(where, "instr(lower(title || char(10) || content), lower(?)) > 0")
+		args = append(args, query.Search)
+	}
+	if !query.WithUnapproved {
+		where = append(where, "(is_approved = 1 OR user_id = ?)")
+		args = append(args, query.ViewerID)
+	}
+	condition := strings.Join(where, " AND ")
+
+	var total int
+	if err := postObj.db.QueryRow("SELECT COUNT(*) FROM posts WHERE "+condition, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := postObj.db.Query("SELECT * FROM posts WHERE "+condition+" ORDER BY created_time DESC, id DESC LIMIT ? OFFSET ?",
+		append(args, query.Limit, query.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	posts := []*models.Post{}
+	for rows.Next() {
+		var post models.Post
+		err = rows.Scan(&post.PostID, &post.UserID, &post.Title, &post.Content, &post.CreatedTime, &post.LikesCounter, &post.DislikeCounter, &post.ImagePath, &post.IsApproved, &post.ReportStatus, &post.ReportCategories)
+		if err != nil {
+			return nil, 0, err
+		}
+		posts = append(posts, &post)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return posts, total, nil
+}
+
 func (postObj *PostRepoImpl) GetCategoriesByPostID(postID int) ([]string, error) {
 	categories := []string{}
 	rows, err := postObj.db.Query("SELECT category_name FROM post_category WHERE post_id = ?", postID)
@@ -142,8 +189,9 @@ func (postObj *PostRepoImpl) GetPostByID(postID int) (*models.Post, error) {
 	post := &models.Post{}
 
 	if err := postObj.db.QueryRow(
-		`SELECT id, user_id, title, content, created_time, likes_counter, dislikes_counter, image_path FROM posts WHERE id = ?`,
-		postID).Scan(&post.PostID, &post.UserID, &post.Title, &post.Content, &post.CreatedTime, &post.LikesCounter, &post.DislikeCounter, &post.ImagePath); err != nil {
+		`SELECT id, user_id, title, content, created_time, likes_counter, dislikes_counter, image_path, is_approved, reports, report_category FROM posts WHERE id = ?`,
+		postID).Scan(&post.PostID, &post.UserID, &post.Title, &post.Content, &post.CreatedTime, &post.LikesCounter, &post.DislikeCounter, &post.ImagePath,
+		&post.IsApproved, &post.ReportStatus, &post.ReportCategories); err != nil {
 		return nil, err
 	}
 	// fmt.Println("Retrieved post.ImagePath:", post.ImagePath)
@@ -312,6 +360,10 @@ func (postObj *PostRepoImpl) DeletePostCategoryByCategoryID(CategoryID int) erro
 	if err != nil {
 		return err
 	}
+	// nobody follows it in their digest anymore
+	if _, err = postObj.db.Exec("DELETE FROM digest_categories WHERE category_id = ?", CategoryID); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -359,188 +411,3 @@ func (postObj *PostRepoImpl) GetMyReactedPosts(userID int) (map[int]int, error)
 
 	return postToReaction, nil
 }
-
-func (postObj *PostRepoImpl) GetAllMyPostsLikedByOtherUsers(userID int) ([]*models.PostVotes, error) {
-	var PostVotes []*models.PostVotes
-	rows, err := postObj.db.Query(`
-        SELECT 
-            pv.post_votes_id,
-            pv.post_id,
-            pv.user_id,
-            pv.reaction,
-            COALESCE(pv.is_seen, 0) as is_seen,
-            pv.created_at as time,
-            u.usernames as reactor_username,
-            p.title as post_title
-        FROM post_votes pv
-        JOIN posts p ON p.id = pv.post_id
-        JOIN users u ON u.id = pv.user_id
-        WHERE p.user_id = ?  
-        ORDER BY pv.created_at DESC`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var PostVote models.PostVotes
-		var timeStr sql.NullString
-		err = rows.Scan(
-			&PostVote.PostVotesID,
-			&PostVote.PostID,
-			&PostVote.UserID,
-			&PostVote.Reaction,
-			&PostVote.IsSeen,
-			&timeStr,
-			&PostVote.ReactorUsername,
-			&PostVote.PostTitle,
-		)
-		if err != nil {
-			log.Printf("Scan error: %v", err)
-			return nil, err
-		}
-		// log.Printf("Found post vote: ID=%d, PostID=%d, Reaction=%d",
-		// 	PostVote.PostVotesID, PostVote.PostID, PostVote.Reaction)
-
-		if timeStr.Valid {
-			formats := []string{
-				"2006-01-02 15:04:05",
-				"2006-01-02 15:04:05.999999999-07:00",
-				"2006-01-02 15:04:05.999999999+07:00",
-				"2006-01-02T15:04:05.999999999-07:00",
-				"2006-01-02T15:04:05.999999999+07:00",
-			}
-			var parsedTime time.Time
-			var parseErr error
-			for _, format := range formats {
-				parsedTime, parseErr = time.Parse(format, timeStr.String)
-				if parseErr == nil {
-					break
-				}
-			}
-			if parseErr != nil {
-				PostVote.Time = time.Now()
-			} else {
-				PostVote.Time = parsedTime
-			}
-		} else {
-			PostVote.Time = time.Now()
-		}
-
-		PostVotes = append(PostVotes, &PostVote)
-	}
-	return PostVotes, nil
-}
-
-func (postObj *PostRepoImpl) GetAllMyPostsCommentedByOtherUsers(userID int) ([]*models.PostVotes, error) {
-	var PostVotes []*models.PostVotes
-	rows, err := postObj.db.Query(`
-        SELECT c.id,
-               c.post_id,
-               c.user_id,
-               0 as reaction,
-               COALESCE(c.is_seen, 0) as is_seen,
-               c.created_time as time
-        FROM comments c
-        JOIN posts p ON p.id = c.post_id
-        WHERE p.user_id = ?  -- You are the post owner
-        ORDER BY c.created_time DESC`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var PostVote models.PostVotes
-		var timeStr sql.NullString
-		err = rows.Scan(
-			&PostVote.PostVotesID,
-			&PostVote.PostID,
-			&PostVote.UserID,
-			&PostVote.Reaction,
-			&PostVote.IsSeen,
-			&timeStr,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		if timeStr.Valid {
-			formats := []string{
-				"2006-01-02 15:04:05",
-				"2006-01-02 15:04:05.999999999-07:00",
-				"2006-01-02 15:04:05.999999999+07:00",
-				"2006-01-02T15:04:05.999999999-07:00",
-				"2006-01-02T15:04:05.999999999+07:00",
-				"2006-01-02T15:04:05Z",
-				time.RFC3339,
-				time.RFC3339Nano,
-			}
-			var parsedTime time.Time
-			var parseErr error
-			for _, format := range formats {
-				parsedTime, parseErr = time.Parse(format, timeStr.String)
-				if parseErr == nil {
-					break
-				}
-			}
-			if parseErr != nil {
-				PostVote.Time = time.Now()
-			} else {
-				PostVote.Time = parsedTime
-			}
-		} else {
-			PostVote.Time = time.Now()
-		}
-		PostVotes = append(PostVotes, &PostVote)
-	}
-	return PostVotes, nil
-}
-
-func (postObj *PostRepoImpl) CountUnseenNotifications(userID int) (int, error) {
-	query := `
-        SELECT COUNT(*) FROM (
-            SELECT id FROM post_votes pv
-            JOIN posts p ON p.id = pv.post_id
-            WHERE p.user_id = ? AND pv.user_id != ? AND pv.is_seen = 0
-            UNION ALL
-            SELECT id FROM comments c
-            JOIN posts p ON p.id = c.post_id
-            WHERE p.user_id = ? AND c.user_id != ? AND c.is_seen = 0
-        ) notifications
-    `
-	var count int
-	err := postObj.db.QueryRow(query, userID, userID, userID, userID).Scan(&count)
-	return count, err
-}
-
-func (postObj *PostRepoImpl) MarkNotificationAsSeen(notificationID int) error {
-	// Try post_votes first
-	result, err := postObj.db.Exec(`
-        UPDATE post_votes 
-        SET is_seen = 1 
-        WHERE id = ?
-    `, notificationID)
-	if err != nil {
-		return err
-	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	// If no rows affected in post_votes, try comments
-	if rows == 0 {
-		_, err = postObj.db.Exec(`
-            UPDATE comments
-            SET is_seen = 1
-            WHERE id = ?
-        `, notificationID)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
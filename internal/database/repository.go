@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"forum/internal/models"
+	"time"
 )
 
 type UserRepoInterface interface {
@@ -19,11 +20,39 @@ type UserRepoInterface interface {
 	ChangeUserRole(string, int) error
 	GetUserRole(int) (string, error)
 	GetUserByRole(string) ([]*models.User, error)
+	GetProfilePrivacy(int) (*models.ProfilePrivacy, error)
+	UpdateProfilePrivacy(*models.ProfilePrivacy) error
+	CreateInvitation(*models.Invitation) (int64, error)
+	GetInvitationByTokenHash(string) (*models.Invitation, error)
+	GetAllInvitations() ([]*models.Invitation, error)
+	ClaimInvitation(string, time.Time) (bool, error)
+	ReleaseInvitation(string) error
+	SetInvitationUser(string, int) error
+	UpdateUserPassword(int, string) error
+	CreateUserIdentity(*models.UserIdentity) (int64, error)
+	GetUserIdentity(string, string) (*models.UserIdentity, error)
+	GetUserIdentitiesByUserID(int) ([]*models.UserIdentity, error)
+	DeleteUserIdentity(int, int) error
+	UpdateUserNames(int, string, string) error
+	ChangeUsername(int, string, string, time.Time) error
+	GetUserIDByOldUsername(string) (int, error)
+	UpdateUserEmail(int, string) error
+	SaveEmailChange(*models.EmailChange) error
+	GetEmailChangeByTokenHash(string) (*models.EmailChange, error)
+	GetEmailChangeByUserID(int) (*models.EmailChange, error)
+	DeleteEmailChange(int) error
+	SavePasswordReset(*models.PasswordReset) error
+	GetPasswordResetByTokenHash(string) (*models.PasswordReset, error)
+	DeletePasswordReset(int) error
+	GetUserProfile(int) (*models.UserProfile, error)
+	UpdateUserBio(int, string) error
+	UpdateUserAvatar(int, string) error
 }
 
 type PostRepoInterface interface {
 	CreatePostRepo(*models.Post) (int64, error)
 	GetAllPosts() ([]*models.Post, error)
+	QueryPosts(*models.PostQuery) ([]*models.Post, int, error)
 	GetCategoriesByPostID(int) ([]string, error)
 	GetPostByID(int) (*models.Post, error)
 	GetPostsByUserId(int) ([]*models.Post, error)
@@ -47,10 +76,6 @@ type PostRepoInterface interface {
 	CreateCategory(string) (int64, error)
 	UpdatePostContentByPostID(int, string) error
 	GetMyReactedPosts(int) (map[int]int, error)
-	GetAllMyPostsLikedByOtherUsers(int) ([]*models.PostVotes, error)
-	GetAllMyPostsCommentedByOtherUsers(int) ([]*models.PostVotes, error)
-	CountUnseenNotifications(userID int) (int, error)
-	MarkNotificationAsSeen(notificationID int) error
 }
 
 type CommentRepoInterface interface {
@@ -71,19 +96,131 @@ type CommentRepoInterface interface {
 	GetMyReactedComments(int) (map[int]int, error)
 	GetCommentByID(int) (*models.Comment, error)
 	GetCommentByUserID(int) ([]*models.Comment, error)
+	GetUnapprovedComments() ([]*models.Comment, error)
+}
+
+type TokenRepoInterface interface {
+	CreateAccessToken(*models.AccessToken) (int64, error)
+	GetAccessTokenByHash(string) (*models.AccessToken, error)
+	GetAccessTokensByUserID(int) ([]*models.AccessToken, error)
+	DeleteAccessToken(int, int) error
+	UpdateAccessTokenLastUsed(int, time.Time) error
+}
+
+type LoginFailureRepoInterface interface {
+	GetLoginFailure(string, string) (*models.LoginFailure, error)
+	AddLoginFailure(string, string, time.Time, time.Time) (*models.LoginFailure, error)
+	LockLoginFailure(string, string, int, time.Time) error
+	SaveLoginFailure(*models.LoginFailure) error
+	DeleteLoginFailure(string, string) error
+	GetLockedLoginFailures(time.Time) ([]*models.LoginFailure, error)
+}
+
+type AuditRepoInterface interface {
+	CreateAuditEntry(*models.AuditEntry) (int64, error)
+	GetAuditEntries() ([]*models.AuditEntry, error)
+}
+
+type AccountDataRepoInterface interface {
+	CreateDataExport(*models.DataExport) (int64, error)
+	UpdateDataExport(*models.DataExport) error
+	GetDataExportByID(int) (*models.DataExport, error)
+	GetDataExportsByUserID(int) ([]*models.DataExport, error)
+	GetPendingDataExports() ([]*models.DataExport, error)
+	GetExpiredDataExports(time.Time) ([]*models.DataExport, error)
+	DeleteDataExport(int) error
+	GetOldUsernamesByUserID(int) ([]string, error)
+	SaveAccountDeletion(*models.AccountDeletion) error
+	GetAccountDeletion(int) (*models.AccountDeletion, error)
+	GetDueAccountDeletions(time.Time) ([]*models.AccountDeletion, error)
+	DeleteAccountDeletion(int) error
+	AnonymizeUserContent(int) error
+	EraseUserContent(int) ([]string, error)
+	DeleteUserAccount(int) error
+}
+
+type NotificationRepoInterface interface {
+	CreateNotification(*models.Notification) (int64, error)
+	GetNotificationsByUserID(int, int, int) ([]*models.Notification, error)
+	CountNotifications(int) (int, error)
+	CountUnreadNotifications(int) (int, error)
+	MarkNotificationRead(int, int, time.Time) error
+	MarkAllNotificationsRead(int, time.Time) error
+	DeleteOldNotifications(time.Time, time.Time) (int64, error)
+	GetNotificationPreferences(int) (*models.NotificationPreferences, error)
+	UpdateNotificationPreferences(*models.NotificationPreferences) error
+	AddNotificationMute(*models.NotificationMute) error
+	DeleteNotificationMute(int, string, int) error
+	GetNotificationMutes(int) ([]*models.NotificationMute, error)
+	IsNotificationMuted(int, int, int) (bool, error)
+}
+
+type MailRepoInterface interface {
+	EnqueueMail(*models.Mail) (int64, error)
+	GetDueMails(time.Time, int) ([]*models.Mail, error)
+	MarkMailSent(int, time.Time) error
+	RetryMail(int, time.Time, string) error
+	MarkMailFailed(int, string) error
+	DeleteOldMails(time.Time) (int64, error)
+}
+
+type DigestRepoInterface interface {
+	GetDigestSettings(int) (*models.DigestSettings, error)
+	SaveDigestSettings(*models.DigestSettings, time.Time) error
+	GetDueDigests(time.Time) ([]*models.DigestSettings, error)
+	GetDigestNotifications(int, []string, int) ([]*models.Notification, error)
+	GetDigestNewPosts(int, time.Time, int) ([]*models.Post, error)
+	GetDigestTopPosts(int, time.Time, int) ([]*models.Post, error)
+	MarkDigestSent(*models.Digest, time.Time) error
+	DeleteOldDigestItems(time.Time) (int64, error)
+}
+
+type WebhookRepoInterface interface {
+	CreateWebhook(*models.Webhook) (int64, error)
+	GetWebhooks() ([]*models.Webhook, error)
+	GetWebhookByID(int) (*models.Webhook, error)
+	SetWebhookActive(int, bool) error
+	DeleteWebhook(int) error
+	CreateWebhookDelivery(*models.WebhookDelivery) (int64, error)
+	GetDueWebhookDeliveries(time.Time, int) ([]*models.WebhookDelivery, error)
+	GetWebhookDeliveries(int, int) ([]*models.WebhookDelivery, error)
+	UpdateWebhookDelivery(*models.WebhookDelivery) error
+	DeleteOldWebhookDeliveries(time.Time) (int64, error)
+}
+
+type FeedRepoInterface interface {
+	GetFeedPosts(string, int, int) ([]*models.Post, error)
 }
 
 type Repository struct {
 	UserRepoInterface
 	PostRepoInterface
 	CommentRepoInterface
+	AuditRepoInterface
+	TokenRepoInterface
+	LoginFailureRepoInterface
+	AccountDataRepoInterface
+	NotificationRepoInterface
+	MailRepoInterface
+	DigestRepoInterface
+	WebhookRepoInterface
+	FeedRepoInterface
 }
 
 func NewRepository(db *sql.DB) *Repository {
 	repositoryObj := Repository{
-		UserRepoInterface:    CreateNewUserDB(db),
-		PostRepoInterface:    CreateNewPostDB(db),
-		CommentRepoInterface: CreateNewCommentDB(db),
+		UserRepoInterface:         CreateNewUserDB(db),
+		PostRepoInterface:         CreateNewPostDB(db),
+		CommentRepoInterface:      CreateNewCommentDB(db),
+		AuditRepoInterface:        CreateNewAuditDB(db),
+		TokenRepoInterface:        CreateNewTokenDB(db),
+		LoginFailureRepoInterface: CreateNewLoginFailureDB(db),
+		AccountDataRepoInterface:  CreateNewAccountDataDB(db),
+		NotificationRepoInterface: CreateNewNotificationDB(db),
+		MailRepoInterface:         CreateNewMailDB(db),
+		DigestRepoInterface:       CreateNewDigestDB(db),
+		WebhookRepoInterface:      CreateNewWebhookDB(db),
+		FeedRepoInterface:         CreateNewFeedDB(db),
 	}
 	return &repositoryObj
 }
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"forum/internal/models"
+	"time"
+)
+
+type TokenRepoImpl struct {
+	db *sql.DB
+}
+
+func CreateNewTokenDB(db *sql.DB) *TokenRepoImpl {
+	return &TokenRepoImpl{db}
+}
+
+func (tokenObj *TokenRepoImpl) CreateAccessToken(token *models.AccessToken) (int64, error) {
+	var expiresAt sql.NullTime
+	if !token.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: token.ExpiresAt, Valid: true}
+	}
+	result, err := tokenObj.db.Exec(`
+		INSERT INTO access_tokens (user_id, name, token_hash, scope, created_time, expires_at) VALUES (?, ?, ?, ?, ?, ?);`,
+		token.UserID, token.Name, token.TokenHash, token.Scope, token.CreatedTime, expiresAt)
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+func (tokenObj *TokenRepoImpl) GetAccessTokenByHash(tokenHash string) (*models.AccessToken, error) {
+	row := tokenObj.db.QueryRow(`
+		SELECT id, user_id, name, token_hash, scope, created_time, expires_at, last_used_time FROM access_tokens WHERE token_hash = ?`,
+		tokenHash)
+	token, err := scanAccessToken(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("access token not found")
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (tokenObj *TokenRepoImpl) GetAccessTokensByUserID(userID int) ([]*models.AccessToken, error) {
+	tokens := []*models.AccessToken{}
+	rows, err := tokenObj.db.Query(`
+		SELECT id, user_id, name, token_hash, scope, created_time, expires_at, last_used_time FROM access_tokens WHERE user_id = ? ORDER BY id DESC`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (tokenObj *TokenRepoImpl) DeleteAccessToken(tokenID, userID int) error {
+	result, err := tokenObj.db.Exec(`DELETE FROM access_tokens WHERE id = ? AND user_id = ?`, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("access token not found")
+	}
+	return nil
+}
+
+func (tokenObj *TokenRepoImpl) UpdateAccessTokenLastUsed(tokenID int, lastUsed time.Time) error {
+	if _, err := tokenObj.db.Exec(`UPDATE access_tokens SET last_used_time = ? WHERE id = ?`, lastUsed, tokenID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// scanAccessToken reads one access_tokens row selected in the column order used above
+func scanAccessToken(row interface{ Scan(...interface{}) error }) (*models.AccessToken, error) {
+	token := &models.AccessToken{}
+	var expiresAt, lastUsed sql.NullTime
+	err := row.Scan(&token.TokenID, &token.UserID, &token.Name, &token.TokenHash, &token.Scope, &token.CreatedTime, &expiresAt, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+	token.ExpiresAt = expiresAt.Time
+	token.LastUsedTime = lastUsed.Time
+	return token, nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"forum/internal/models"
+	"time"
 )
 
 type UserRepoImpl struct {
@@ -16,14 +17,19 @@ func CreateNewUserDB(db *sql.DB) *UserRepoImpl {
 
 func (userObj *UserRepoImpl) CreateUserRepo(user *models.User) (int64, error) {
 	result, err := userObj.db.Exec(
-		`INSERT INTO users (firstName, secondName, usernames, email, password, role) VALUES (?, ?, ?, ?, ?, ?);`,
-		user.FirstName, user.SecondName, user.Username, user.Email, user.Password, user.Role)
+		`INSERT INTO users (firstName, secondName, usernames, email, password, role, created_time) VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		user.FirstName, user.SecondName, user.Username, nullIfEmpty(user.Email), user.Password, user.Role, time.Now())
 	if err != nil {
 		return -1, err
 	}
 	return result.LastInsertId() // return the auto generated ID of the last added user
 }
 
+// nullIfEmpty stores a missing email as NULL, so several accounts without one do not clash on the UNIQUE constraint
+func nullIfEmpty(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
 func (userObj *UserRepoImpl) GetUserByEmail(email string) (*models.User, error) {
 	user := &models.User{}
 	err := userObj.db.QueryRow(
@@ -42,8 +48,8 @@ func (userObj *UserRepoImpl) GetUserByEmail(email string) (*models.User, error)
 func (userObj *UserRepoImpl) GetUserByUsername(username string) (*models.User, error) {
 	user := &models.User{}
 	err := userObj.db.QueryRow(
-		`SELECT id, firstName, secondName, usernames, email, password FROM users WHERE usernames = ?`,
-		username).Scan(&user.UserUserID, &user.FirstName, &user.SecondName, &user.Username, &user.Email, &user.Password)
+		`SELECT id, firstName, secondName, usernames, COALESCE(email, ''), password, role FROM users WHERE usernames = ?`,
+		username).Scan(&user.UserUserID, &user.FirstName, &user.SecondName, &user.Username, &user.Email, &user.Password, &user.Role)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("element with USERNAME not found")
@@ -56,7 +62,7 @@ func (userObj *UserRepoImpl) GetUserByUsername(username string) (*models.User, e
 func (userObj *UserRepoImpl) GetUserByUserID(userID int) (*models.User, error) {
 	user := &models.User{}
 	err := userObj.db.QueryRow(
-		`SELECT id, firstName, secondName, usernames, email, password, role FROM users WHERE id = ?`,
+		`SELECT id, firstName, secondName, usernames, COALESCE(email, ''), password, role FROM users WHERE id = ?`,
 		userID).Scan(&user.UserUserID, &user.FirstName, &user.SecondName, &user.Username, &user.Email, &user.Password, &user.Role)
 	if err != nil {
 		return nil, err
@@ -151,7 +157,7 @@ func (userObj *UserRepoImpl) GetUserRole(userID int) (string, error) {
 
 func (userObj *UserRepoImpl) GetUserByRole(role string) ([]*models.User, error) {
 	users := []*models.User{}
-	rows, err := userObj.db.Query("SELECT id, usernames, email FROM users WHERE role = ?", role)
+	rows, err := userObj.db.Query("SELECT id, usernames, COALESCE(email, '') FROM users WHERE role = ?", role)
 	if err != nil {
 		return nil, err
 	}
@@ -169,3 +175,325 @@ func (userObj *UserRepoImpl) GetUserByRole(role string) ([]*models.User, error)
 	}
 	return users, nil
 }
+
+func (userObj *UserRepoImpl) GetProfilePrivacy(userID int) (*models.ProfilePrivacy, error) {
+	privacy := &models.ProfilePrivacy{UserID: userID}
+	err := userObj.db.QueryRow(
+		`SELECT show_posts, show_comments, show_reactions, show_stats FROM profile_privacy WHERE user_id = ?`,
+		userID).Scan(&privacy.ShowPosts, &privacy.ShowComments, &privacy.ShowReactions, &privacy.ShowStats)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return privacy, nil
+}
+
+func (userObj *UserRepoImpl) UpdateProfilePrivacy(privacy *models.ProfilePrivacy) error {
+	_, err := userObj.db.Exec(`
+		INSERT INTO profile_privacy (user_id, show_posts, show_comments, show_reactions, show_stats) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET show_posts = excluded.show_posts, show_comments = excluded.show_comments,
+			show_reactions = excluded.show_reactions, show_stats = excluded.show_stats`,
+		privacy.UserID, privacy.ShowPosts, privacy.ShowComments, privacy.ShowReactions, privacy.ShowStats)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (userObj *UserRepoImpl) CreateInvitation(invitation *models.Invitation) (int64, error) {
+	result, err := userObj.db.Exec(
+		`INSERT INTO invitations (token_hash, role, created_by, expires_at, used_by) VALUES (?, ?, ?, ?, 0);`,
+		invitation.TokenHash, invitation.Role, invitation.CreatedBy, invitation.ExpiresAt)
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+func (userObj *UserRepoImpl) GetInvitationByTokenHash(tokenHash string) (*models.Invitation, error) {
+	invitation := &models.Invitation{}
+	err := userObj.db.QueryRow(
+		`SELECT id, token_hash, role, created_by, expires_at, used_by FROM invitations WHERE token_hash = ?`,
+		tokenHash).Scan(&invitation.InvitationID, &invitation.TokenHash, &invitation.Role, &invitation.CreatedBy, &invitation.ExpiresAt, &invitation.UsedBy)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invitation not found")
+		}
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (userObj *UserRepoImpl) GetAllInvitations() ([]*models.Invitation, error) {
+	invitations := []*models.Invitation{}
+	rows, err := userObj.db.Query(`SELECT id, role, created_by, expires_at, used_by FROM invitations ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var invitation models.Invitation
+		err = rows.Scan(&invitation.InvitationID, &invitation.Role, &invitation.CreatedBy, &invitation.ExpiresAt, &invitation.UsedBy)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, &invitation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// ClaimInvitation marks an unused, unexpired invitation as used.
+// It reports false if somebody else already claimed it.
+func (userObj *UserRepoImpl) ClaimInvitation(tokenHash string, now time.Time) (bool, error) {
+	result, err := userObj.db.Exec(
+		`UPDATE invitations SET used_at = ?, used_by = -1 WHERE token_hash = ? AND used_by = 0 AND expires_at > ?`,
+		now, tokenHash, now)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (userObj *UserRepoImpl) ReleaseInvitation(tokenHash string) error {
+	if _, err := userObj.db.Exec(`UPDATE invitations SET used_at = NULL, used_by = 0 WHERE token_hash = ?`, tokenHash); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (userObj *UserRepoImpl) SetInvitationUser(tokenHash string, userID int) error {
+	if _, err := userObj.db.Exec(`UPDATE invitations SET used_by = ? WHERE token_hash = ?`, userID, tokenHash); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (userObj *UserRepoImpl) UpdateUserPassword(userID int, password string) error {
+	if _, err := userObj.db.Exec(`UPDATE users SET password = ? WHERE id = ?`, password, userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (userObj *UserRepoImpl) CreateUserIdentity(identity *models.UserIdentity) (int64, error) {
+	result, err := userObj.db.Exec(
+		`INSERT INTO user_identities (user_id, provider, subject, email, created_time) VALUES (?, ?, ?, ?, ?);`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedTime)
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+func (userObj *UserRepoImpl) GetUserIdentity(provider, subject string) (*models.UserIdentity, error) {
+	identity := &models.UserIdentity{}
+	err := userObj.db.QueryRow(
+		`SELECT id, user_id, provider, subject, email, created_time FROM user_identities WHERE provider = ? AND subject = ?`,
+		provider, subject).Scan(&identity.IdentityID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("identity not found")
+		}
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (userObj *UserRepoImpl) GetUserIdentitiesByUserID(userID int) ([]*models.UserIdentity, error) {
+	identities := []*models.UserIdentity{}
+	rows, err := userObj.db.Query(
+		`SELECT id, user_id, provider, subject, email, created_time FROM user_identities WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var identity models.UserIdentity
+		err = rows.Scan(&identity.IdentityID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedTime)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, &identity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (userObj *UserRepoImpl) DeleteUserIdentity(identityID, userID int) error {
+	if _, err := userObj.db.Exec(`DELETE FROM user_identities WHERE id = ? AND user_id = ?`, identityID, userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (userObj *UserRepoImpl) UpdateUserNames(userID int, firstName, secondName string) error {
+	if _, err := userObj.db.Exec(`UPDATE users SET firstName = ?, secondName = ? WHERE id = ?`, firstName, secondName, userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ChangeUsername renames the user and remembers the old name, so links to it still find the account.
+// A name the user had before is taken back out of the history.
+func (userObj *UserRepoImpl) ChangeUsername(userID int, oldUsername, newUsername string, now time.Time) error {
+	trans, err := userObj.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer trans.Rollback()
+
+	if _, err := trans.Exec(`UPDATE users SET usernames = ? WHERE id = ?`, newUsername, userID); err != nil {
+		return err
+	}
+	if _, err := trans.Exec(`DELETE FROM username_history WHERE old_username = ? AND user_id = ?`, newUsername, userID); err != nil {
+		return err
+	}
+	if _, err := trans.Exec(
+		`INSERT INTO username_history (old_username, user_id, changed_time) VALUES (?, ?, ?)
+		ON CONFLICT (old_username) DO UPDATE SET user_id = excluded.user_id, changed_time = excluded.changed_time`,
+		oldUsername, userID, now); err != nil {
+		return err
+	}
+	return trans.Commit()
+}
+
+func (userObj *UserRepoImpl) GetUserIDByOldUsername(username string) (int, error) {
+	var userID int
+	err := userObj.db.QueryRow(`SELECT user_id FROM username_history WHERE old_username = ?`, username).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, errors.New("old username not found")
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (userObj *UserRepoImpl) UpdateUserEmail(userID int, email string) error {
+	if _, err := userObj.db.Exec(`UPDATE users SET email = ? WHERE id = ?`, nullIfEmpty(email), userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SaveEmailChange replaces any email change the user was already waiting on.
+func (userObj *UserRepoImpl) SaveEmailChange(change *models.EmailChange) error {
+	_, err := userObj.db.Exec(`
+		INSERT INTO email_changes (token_hash, user_id, new_email, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET token_hash = excluded.token_hash, new_email = excluded.new_email, expires_at = excluded.expires_at`,
+		change.TokenHash, change.UserID, change.NewEmail, change.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (userObj *UserRepoImpl) GetEmailChangeByTokenHash(tokenHash string) (*models.EmailChange, error) {
+	change := &models.EmailChange{}
+	err := userObj.db.QueryRow(
+		`SELECT token_hash, user_id, new_email, expires_at FROM email_changes WHERE token_hash = ?`,
+		tokenHash).Scan(&change.TokenHash, &change.UserID, &change.NewEmail, &change.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("email change not found")
+		}
+		return nil, err
+	}
+	return change, nil
+}
+
+func (userObj *UserRepoImpl) GetEmailChangeByUserID(userID int) (*models.EmailChange, error) {
+	change := &models.EmailChange{}
+	err := userObj.db.QueryRow(
+		`SELECT token_hash, user_id, new_email, expires_at FROM email_changes WHERE user_id = ?`,
+		userID).Scan(&change.TokenHash, &change.UserID, &change.NewEmail, &change.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("email change not found")
+		}
+		return nil, err
+	}
+	return change, nil
+}
+
+func (userObj *UserRepoImpl) DeleteEmailChange(userID int) error {
+	if _, err := userObj.db.Exec(`DELETE FROM email_changes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SavePasswordReset replaces any reset the user was already waiting on.
+func (userObj *UserRepoImpl) SavePasswordReset(reset *models.PasswordReset) error {
+	_, err := userObj.db.Exec(`
+		INSERT INTO password_resets (token_hash, user_id, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET token_hash = excluded.token_hash, expires_at = excluded.expires_at`,
+		reset.TokenHash, reset.UserID, reset.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (userObj *UserRepoImpl) GetPasswordResetByTokenHash(tokenHash string) (*models.PasswordReset, error) {
+	reset := &models.PasswordReset{}
+	err := userObj.db.QueryRow(
+		`SELECT token_hash, user_id, expires_at FROM password_resets WHERE token_hash = ?`,
+		tokenHash).Scan(&reset.TokenHash, &reset.UserID, &reset.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("password reset not found")
+		}
+		return nil, err
+	}
+	return reset, nil
+}
+
+func (userObj *UserRepoImpl) DeletePasswordReset(userID int) error {
+	if _, err := userObj.db.Exec(`DELETE FROM password_resets WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (userObj *UserRepoImpl) GetUserProfile(userID int) (*models.UserProfile, error) {
+	profile := &models.UserProfile{UserID: userID}
+	var joined sql.NullTime
+	err := userObj.db.QueryRow(`
+		SELECT COALESCE(bio, ''), COALESCE(avatar_path, ''), created_time,
+			(SELECT COUNT(*) FROM posts WHERE user_id = users.id AND is_approved = 1),
+			(SELECT COUNT(*) FROM comments WHERE user_id = users.id AND is_approved = 1),
+			(SELECT COALESCE(SUM(likes_counter - dislikes_counter), 0) FROM posts WHERE user_id = users.id AND is_approved = 1) +
+			(SELECT COALESCE(SUM(likes_counter - dislikes_counter), 0) FROM comments WHERE user_id = users.id AND is_approved = 1)
+		FROM users WHERE id = ?`,
+		userID).Scan(&profile.Bio, &profile.AvatarPath, &joined, &profile.PostCount, &profile.CommentCount, &profile.Reputation)
+	if err != nil {
+		return nil, err
+	}
+	profile.JoinedTime = joined.Time
+	return profile, nil
+}
+
+func (userObj *UserRepoImpl) UpdateUserBio(userID int, bio string) error {
+	if _, err := userObj.db.Exec(`UPDATE users SET bio = ? WHERE id = ?`, bio, userID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (userObj *UserRepoImpl) UpdateUserAvatar(userID int, avatarPath string) error {
+	if _, err := userObj.db.Exec(`UPDATE users SET avatar_path = ? WHERE id = ?`, avatarPath, userID); err != nil {
+		return err
+	}
+	return nil
+}
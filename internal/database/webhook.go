@@ -0,0 +1,161 @@
+package database
+
+import (
+	"database/sql"
+	"forum/internal/models"
+	"strings"
+	"time"
+)
+
+type WebhookRepoImpl struct {
+	db *sql.DB
+}
+
+func CreateNewWebhookDB(db *sql.DB) *WebhookRepoImpl {
+	return &WebhookRepoImpl{db}
+}
+
+func (webhookObj *WebhookRepoImpl) CreateWebhook(webhook *models.Webhook) (int64, error) {
+	result, err := webhookObj.db.Exec(`INSERT INTO webhooks (url, secret, events, active, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Active, webhook.CreatedBy, webhook.CreatedTime)
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+func (webhookObj *WebhookRepoImpl) GetWebhooks() ([]*models.Webhook, error) {
+	webhooks := []*models.Webhook{}
+	rows, err := webhookObj.db.Query(`SELECT id, url, secret, events, active, created_by, created_at FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetWebhookByID returns sql.ErrNoRows when there is no such webhook.
+func (webhookObj *WebhookRepoImpl) GetWebhookByID(webhookID int) (*models.Webhook, error) {
+	return scanWebhook(webhookObj.db.QueryRow(`SELECT id, url, secret, events, active, created_by, created_at FROM webhooks WHERE id = ?`, webhookID))
+}
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var events string
+	if err := row.Scan(&webhook.WebhookID, &webhook.URL, &webhook.Secret, &events, &webhook.Active, &webhook.CreatedBy, &webhook.CreatedTime); err != nil {
+		return nil, err
+	}
+	webhook.Events = []string{}
+	if events != "" {
+		webhook.Events = strings.Split(events, ",")
+	}
+	return &webhook, nil
+}
+
+func (webhookObj *WebhookRepoImpl) SetWebhookActive(webhookID int, active bool) error {
+	_, err := webhookObj.db.Exec(`UPDATE webhooks SET active = ? WHERE id = ?`, active, webhookID)
+	return err
+}
+
+// DeleteWebhook deletes the webhook with its delivery log.
+func (webhookObj *WebhookRepoImpl) DeleteWebhook(webhookID int) error {
+	trans, err := webhookObj.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer trans.Rollback()
+
+	if _, err = trans.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, webhookID); err != nil {
+		return err
+	}
+	if _, err = trans.Exec(`DELETE FROM webhooks WHERE id = ?`, webhookID); err != nil {
+		return err
+	}
+	return trans.Commit()
+}
+
+func (webhookObj *WebhookRepoImpl) CreateWebhookDelivery(delivery *models.WebhookDelivery) (int64, error) {
+	result, err := webhookObj.db.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, event, payload, status, attempts, next_attempt_at, response_status, response_body, last_error, created_at)
+		VALUES (?, ?, ?, ?, 0, ?, 0, '', '', ?)`,
+		delivery.WebhookID, delivery.Event, delivery.Payload, models.WebhookDeliveryPending, delivery.NextAttemptTime, delivery.CreatedTime)
+	if err != nil {
+		return -1, err
+	}
+	return result.LastInsertId()
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at, response_status, response_body, last_error, created_at, delivered_at`
+
+// GetDueWebhookDeliveries returns at most limit pending deliveries whose next attempt is not after now,
+// oldest first.
+func (webhookObj *WebhookRepoImpl) GetDueWebhookDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	return webhookObj.queryWebhookDeliveries(`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+		models.WebhookDeliveryPending, now, limit)
+}
+
+// GetWebhookDeliveries returns the latest deliveries to a webhook, newest first.
+func (webhookObj *WebhookRepoImpl) GetWebhookDeliveries(webhookID, limit int) ([]*models.WebhookDelivery, error) {
+	return webhookObj.queryWebhookDeliveries(`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`, webhookID, limit)
+}
+
+func (webhookObj *WebhookRepoImpl) queryWebhookDeliveries(query string, args ...interface{}) ([]*models.WebhookDelivery, error) {
+	deliveries := []*models.WebhookDelivery{}
+	rows, err := webhookObj.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var deliveredAt sql.NullTime
+		err = rows.Scan(&delivery.DeliveryID, &delivery.WebhookID, &delivery.Event, &delivery.Payload, &delivery.Status,
+			&delivery.Attempts, &delivery.NextAttemptTime, &delivery.ResponseStatus, &delivery.ResponseBody,
+			&delivery.LastError, &delivery.CreatedTime, &deliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		if deliveredAt.Valid {
+			delivery.DeliveredTime = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery saves the outcome of an attempt.
+func (webhookObj *WebhookRepoImpl) UpdateWebhookDelivery(delivery *models.WebhookDelivery) error {
+	_, err := webhookObj.db.Exec(`
+		UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, response_status = ?, response_body = ?,
+			last_error = ?, delivered_at = ?
+		WHERE id = ?`,
+		delivery.Status, delivery.Attempts, delivery.NextAttemptTime, delivery.ResponseStatus, delivery.ResponseBody,
+		delivery.LastError, delivery.DeliveredTime, delivery.DeliveryID)
+	return err
+}
+
+// DeleteOldWebhookDeliveries removes delivered and failed deliveries created before the given time.
+func (webhookObj *WebhookRepoImpl) DeleteOldWebhookDeliveries(before time.Time) (int64, error) {
+	result, err := webhookObj.db.Exec(`DELETE FROM webhook_deliveries WHERE status != ? AND created_at < ?`, models.WebhookDeliveryPending, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
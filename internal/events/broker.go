@@ -0,0 +1,150 @@
+// Package events passes what happens on the forum to the users it concerns while they are online.
+// The broker lives in the process: events are not stored, only the latest ones are kept so that a
+// client that lost its connection can catch up.
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is something that happened to the content of one user.
+type Event struct {
+	ID     string // "<boot>-<sequence>", the SSE event ID
+	UserID int    // who is told
+	Type   string // "notification"
+	Data   interface{}
+}
+
+// Broker hands published events to the subscriptions of the user they are for.
+type Broker struct {
+	mu          sync.Mutex
+	boot        string // tells IDs of an earlier run of the server apart
+	sequence    int64
+	recent      []Event // the latest events of all users, oldest first
+	backlog     int
+	subscribers map[int]map[*Subscription]bool
+	closed      bool
+}
+
+// Subscription receives the events of one user until it is closed. Events that do not fit into
+// C close it, a client that reconnects with the ID of the last event it got misses nothing.
+type Subscription struct {
+	C      <-chan Event
+	events chan Event
+	userID int
+	broker *Broker
+	closed bool
+}
+
+// NewBroker returns a broker that keeps the last backlog events for clients that reconnect.
+func NewBroker(backlog int) *Broker {
+	return &Broker{
+		boot:        strconv.FormatInt(time.Now().UnixNano(), 36),
+		backlog:     backlog,
+		subscribers: map[int]map[*Subscription]bool{},
+	}
+}
+
+// Publish sends an event of the given type to userID. It never blocks.
+func (b *Broker) Publish(userID int, eventType string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sequence++
+	event := Event{ID: fmt.Sprintf("%s-%d", b.boot, b.sequence), UserID: userID, Type: eventType, Data: data}
+	b.recent = append(b.recent, event)
+	if len(b.recent) > b.backlog {
+		b.recent = b.recent[len(b.recent)-b.backlog:]
+	}
+	for sub := range b.subscribers[userID] {
+		select {
+		case sub.events <- event:
+		default:
+			b.unsubscribe(sub) // too slow, it has to reconnect and catch up
+		}
+	}
+}
+
+// Subscribe starts delivering the events of userID. With lastEventID, the ID of the last event the
+// client received, it also returns the events published since. complete is false when some of them
+// are no longer known, after a restart or a long absence, and the client has to reload instead.
+func (b *Broker) Subscribe(userID int, lastEventID string) (sub *Subscription, missed []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := make(chan Event, 32)
+	sub = &Subscription{C: events, events: events, userID: userID, broker: b}
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = map[*Subscription]bool{}
+	}
+	b.subscribers[userID][sub] = true
+	if b.closed {
+		b.unsubscribe(sub)
+		return sub, nil, true
+	}
+
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+	last, ok := b.sequenceOf(lastEventID)
+	if !ok {
+		return sub, nil, false
+	}
+	// recent holds the sequences up to b.sequence without gaps
+	first := b.sequence - int64(len(b.recent)) + 1
+	if last+1 < first {
+		return sub, nil, false
+	}
+	for _, event := range b.recent[last+1-first:] {
+		if event.UserID == userID {
+			missed = append(missed, event)
+		}
+	}
+	return sub, missed, true
+}
+
+func (b *Broker) sequenceOf(id string) (int64, bool) {
+	boot, number, found := strings.Cut(id, "-")
+	if !found || boot != b.boot {
+		return 0, false
+	}
+	sequence, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || sequence < 0 || sequence > b.sequence {
+		return 0, false
+	}
+	return sequence, true
+}
+
+// Close closes every subscription, and those made afterwards right away, so that the streams end
+// when the server shuts down instead of holding it up.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, subs := range b.subscribers {
+		for sub := range subs {
+			b.unsubscribe(sub)
+		}
+	}
+}
+
+// Close stops the subscription and closes C.
+func (sub *Subscription) Close() {
+	sub.broker.mu.Lock()
+	defer sub.broker.mu.Unlock()
+	sub.broker.unsubscribe(sub)
+}
+
+func (b *Broker) unsubscribe(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.events)
+	delete(b.subscribers[sub.userID], sub)
+	if len(b.subscribers[sub.userID]) == 0 {
+		delete(b.subscribers, sub.userID)
+	}
+}
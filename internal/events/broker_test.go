@@ -0,0 +1,44 @@
+package events
+
+import "testing"
+
+func TestBrokerDelivers(t *testing.T) {
+	b := NewBroker(10)
+	sub, _, _ := b.Subscribe(1, "")
+	defer sub.Close()
+	b.Publish(2, "notification", "for someone else")
+	b.Publish(1, "notification", "hello")
+	if event := <-sub.C; event.UserID != 1 || event.Data != "hello" {
+		t.Errorf("event %+v", event)
+	}
+
+	// a client that reconnects gets what it missed
+	b.Publish(1, "notification", "while away")
+	again, missed, complete := b.Subscribe(1, b.recent[len(b.recent)-2].ID)
+	defer again.Close()
+	if !complete || len(missed) != 1 || missed[0].Data != "while away" {
+		t.Errorf("missed %+v, complete %v", missed, complete)
+	}
+	if _, _, complete := b.Subscribe(1, "another-boot-1"); complete {
+		t.Error("an ID of another run counts as complete")
+	}
+}
+
+// Close ends the streams for shutdown: open subscriptions and later ones are closed.
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker(10)
+	first, _, _ := b.Subscribe(1, "")
+	second, _, _ := b.Subscribe(2, "")
+	b.Close()
+	for _, sub := range []*Subscription{first, second} {
+		if _, open := <-sub.C; open {
+			t.Error("subscription still open")
+		}
+	}
+	sub, _, _ := b.Subscribe(1, "")
+	if _, open := <-sub.C; open {
+		t.Error("subscription made after Close is open")
+	}
+	sub.Close()
+	b.Publish(1, "notification", "nobody listens")
+}
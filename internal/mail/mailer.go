@@ -0,0 +1,82 @@
+// Package mail writes and delivers the e-mails of the forum. Messages are rendered from the templates
+// in TemplatesDir and handed to a Mailer: SMTP in production, a directory of .eml files during
+// development, or the log when mail is not set up.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+)
+
+// Mailer delivers one message. Errors are worth retrying later unless the message itself is wrong.
+type Mailer interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+type Config struct {
+	Driver    string     `json:"driver"` // "smtp", "outbox", or "" to only log recipients and subjects
+	From      string     `json:"from"`   // "My Forum <forum@example.com>"
+	BaseURL   string     `json:"base_url"`
+	OutboxDir string     `json:"outbox_dir"`
+	SMTP      SMTPConfig `json:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	Username    string `json:"username"`
+	PasswordEnv string `json:"password_env"` // environment variable holding the password
+	TLS         string `json:"tls"`          // "starttls" (the default), "tls" or "none"
+}
+
+// New returns the mailer the config asks for.
+func New(config Config) (Mailer, error) {
+	if config.Driver != "" {
+		if _, err := mail.ParseAddress(config.From); err != nil {
+			return nil, fmt.Errorf("mail: from %q: %w", config.From, err)
+		}
+	}
+	switch config.Driver {
+	case "":
+		return logMailer{}, nil
+	case "outbox":
+		if config.OutboxDir == "" {
+			return nil, fmt.Errorf("mail: outbox_dir is required with the outbox driver")
+		}
+		return &OutboxMailer{Dir: config.OutboxDir}, nil
+	case "smtp":
+		smtpConfig := config.SMTP
+		if smtpConfig.Host == "" {
+			return nil, fmt.Errorf("mail: smtp.host is required with the smtp driver")
+		}
+		if smtpConfig.Port == 0 {
+			smtpConfig.Port = 587
+		}
+		switch smtpConfig.TLS {
+		case "":
+			smtpConfig.TLS = "starttls"
+		case "starttls", "tls", "none":
+		default:
+			return nil, fmt.Errorf("mail: smtp.tls must be starttls, tls or none, not %q", smtpConfig.TLS)
+		}
+		password := ""
+		if smtpConfig.PasswordEnv != "" {
+			password = os.Getenv(smtpConfig.PasswordEnv)
+		}
+		return &SMTPMailer{config: smtpConfig, password: password}, nil
+	}
+	return nil, fmt.Errorf("mail: unknown driver %q", config.Driver)
+}
+
+// logMailer stands in when mail is not set up. It logs who a message was for, never the body: that
+// holds confirmation and other one-time links, which do not belong in server logs. The outbox driver
+// keeps whole messages for development.
+type logMailer struct{}
+
+func (logMailer) Send(ctx context.Context, message *Message) error {
+	log.Printf("Mail is not set up, message to %s not sent: %s", message.To, message.Subject)
+	return nil
+}
@@ -0,0 +1,32 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OutboxMailer writes every message to an .eml file in Dir instead of sending it. Mail clients open
+// the files, which is enough to follow the links while developing.
+type OutboxMailer struct {
+	Dir string
+}
+
+func (mailer *OutboxMailer) Send(ctx context.Context, message *Message) error {
+	body, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mailer.Dir, 0o700); err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix) + ".eml"
+	return os.WriteFile(filepath.Join(mailer.Dir, name), body, 0o600)
+}
@@ -0,0 +1,205 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"log"
+	"net"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSMTP is an SMTP server that accepts one message per connection and remembers what it got.
+type fakeSMTP struct {
+	listener   net.Listener
+	extensions []string          // advertised in the EHLO answer
+	replies    map[string]string // replaces the answer to a command, by its verb
+	wg         sync.WaitGroup
+
+	mu       sync.Mutex
+	auth     string // the decoded AUTH PLAIN credentials
+	from, to string
+	data     string
+}
+
+func newFakeSMTP(t *testing.T, extensions ...string) *fakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTP{listener: listener, extensions: extensions, replies: map[string]string{}}
+	server.wg.Add(1)
+	go func() {
+		defer server.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		server.wg.Wait()
+	})
+	return server
+}
+
+func (server *fakeSMTP) port() int {
+	return server.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (server *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, argument, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+		if reply, ok := server.replies[verb]; ok {
+			text.PrintfLine("%s", reply)
+			continue
+		}
+		server.mu.Lock()
+		switch verb {
+		case "EHLO", "HELO":
+			lines := append([]string{"fake"}, server.extensions...)
+			for i, extension := range lines {
+				separator := "-"
+				if i == len(lines)-1 {
+					separator = " "
+				}
+				text.PrintfLine("250%s%s", separator, extension)
+			}
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(argument, "PLAIN "))
+			server.auth = string(credentials)
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			server.from = argument
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			server.to = argument
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, _ := text.ReadDotBytes()
+			server.data = string(data)
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			server.mu.Unlock()
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+		server.mu.Unlock()
+	}
+}
+
+func testMessage() *Message {
+	return &Message{
+		From:    "Forum <forum@example.com>",
+		To:      "Someone <someone@example.com>",
+		Subject: "Confirm your e-mail",
+		Text:    "Open https://forum.test/confirm_email/token to confirm.",
+	}
+}
+
+func TestSMTPMailerSends(t *testing.T) {
+	server := newFakeSMTP(t, "AUTH PLAIN")
+	mailer, err := New(Config{
+		Driver: "smtp",
+		From:   "Forum <forum@example.com>",
+		SMTP:   SMTPConfig{Host: "127.0.0.1", Port: server.port(), Username: "forum", PasswordEnv: "FORUM_TEST_SMTP_PASSWORD", TLS: "none"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailer.(*SMTPMailer).password = "secret"
+	if err := mailer.Send(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.auth != "\x00forum\x00secret" {
+		t.Errorf("AUTH PLAIN with %q", server.auth)
+	}
+	if server.from != "FROM:<forum@example.com>" || server.to != "TO:<someone@example.com>" {
+		t.Errorf("envelope %q %q", server.from, server.to)
+	}
+	message, err := textproto.NewReader(bufio.NewReader(strings.NewReader(server.data))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Get("Subject") != "Confirm your e-mail" || message.Get("To") != `"Someone" <someone@example.com>` {
+		t.Errorf("headers %v", message)
+	}
+	if !strings.Contains(server.data, "https://forum.test/confirm_email/token") {
+		t.Errorf("body %q", server.data)
+	}
+}
+
+func TestSMTPMailerFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		tls        string
+		extensions []string
+		replies    map[string]string
+		err        string
+	}{
+		{"recipient refused", "none", nil, map[string]string{"RCPT": "550 no such user"}, "550"},
+		{"message refused", "none", nil, map[string]string{"DATA": "554 rejected"}, "554"},
+		{"no STARTTLS", "starttls", nil, nil, "does not support STARTTLS"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeSMTP(t, test.extensions...)
+			for verb, reply := range test.replies {
+				server.replies[verb] = reply
+			}
+			mailer := &SMTPMailer{config: SMTPConfig{Host: "127.0.0.1", Port: server.port(), TLS: test.tls}}
+			err := mailer.Send(context.Background(), testMessage())
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %v, want %q", err, test.err)
+			}
+		})
+	}
+
+	// nobody listening
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	mailer := &SMTPMailer{config: SMTPConfig{Host: "127.0.0.1", Port: port, TLS: "none"}}
+	if err := mailer.Send(context.Background(), testMessage()); err == nil {
+		t.Error("sent without a server on port " + strconv.Itoa(port))
+	}
+}
+
+// Without a driver the links in a message must not end up in the log.
+func TestLogMailerLeavesOutTheBody(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	if err := (logMailer{}).Send(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logged.String(), "confirm_email") || !strings.Contains(logged.String(), "Confirm your e-mail") {
+		t.Errorf("logged %q", logged.String())
+	}
+}
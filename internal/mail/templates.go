@@ -0,0 +1,41 @@
+package mail
+
+import (
+	htmltemplate "html/template"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// TemplatesDir holds the messages. Every message has a NAME.txt that defines a "subject" template
+// next to the text body, and a NAME.html with the "content" of the HTML body, which layout.html wraps.
+const TemplatesDir = "internal/mail/templates"
+
+// Render fills the message called name with data.
+func Render(name string, data interface{}) (*Message, error) {
+	text, err := texttemplate.ParseFiles(filepath.Join(TemplatesDir, name+".txt"))
+	if err != nil {
+		return nil, err
+	}
+	var subject, body strings.Builder
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := text.ExecuteTemplate(&body, name+".txt", data); err != nil {
+		return nil, err
+	}
+
+	html, err := htmltemplate.ParseFiles(filepath.Join(TemplatesDir, "layout.html"), filepath.Join(TemplatesDir, name+".html"))
+	if err != nil {
+		return nil, err
+	}
+	var htmlBody strings.Builder
+	if err := html.ExecuteTemplate(&htmlBody, "layout.html", data); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+		HTML:    htmlBody.String(),
+	}, nil
+}
@@ -0,0 +1,86 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the templates are loaded by paths relative to the root of the repository
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// Every message the forum sends renders with the data its sender passes, in text and HTML.
+func TestRenderMessages(t *testing.T) {
+	post := map[string]interface{}{"Title": "A post", "Author": "someone", "Excerpt": "The start", "Likes": 3, "Dislikes": 1,
+		"Link": "https://forum.test/p/1/a-post"}
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		subject string
+		text    []string // in the text and the HTML body
+	}{
+		{"password_reset", map[string]interface{}{"Username": "owner", "Link": "https://forum.test/reset_password/abc", "Minutes": 60},
+			"Reset your forum password", []string{"Hello owner", "https://forum.test/reset_password/abc", "60 minutes"}},
+		{"email_change", map[string]interface{}{"Username": "owner", "Email": "new@example.com", "Link": "https://forum.test/confirm_email/abc"},
+			"Confirm your new e-mail address", []string{"new@example.com", "https://forum.test/confirm_email/abc"}},
+		{"account_locked", map[string]interface{}{"Username": "owner", "Failures": 5, "Minutes": 1, "Link": "https://forum.test/account"},
+			"Your forum account was locked", []string{"5 times", "1 minute(s)", "https://forum.test/account"}},
+		{"notification", map[string]interface{}{"Username": "owner", "Message": "someone commented on your post", "Link": "https://forum.test/p/1",
+			"SettingsLink": "https://forum.test/notification_settings"},
+			"someone commented on your post", []string{"someone commented on your post", "https://forum.test/p/1", "/notification_settings"}},
+		{"digest", map[string]interface{}{"Username": "owner", "Frequency": "weekly",
+			"Notifications": []map[string]interface{}{{"Message": "someone liked your post", "Link": ""}},
+			"NewPosts":      []map[string]interface{}{post}, "TopPosts": []map[string]interface{}{post},
+			"SettingsLink": "https://forum.test/notification_settings"},
+			"Your weekly forum digest", []string{"someone liked your post", "A post", "https://forum.test/p/1/a-post"}},
+	}
+	tested := map[string]bool{}
+	for _, test := range tests {
+		tested[test.name] = true
+		t.Run(test.name, func(t *testing.T) {
+			test.data["BaseURL"] = "https://forum.test"
+			message, err := Render(test.name, test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if message.Subject != test.subject {
+				t.Errorf("subject %q, want %q", message.Subject, test.subject)
+			}
+			for _, want := range test.text {
+				if !strings.Contains(message.Text, want) {
+					t.Errorf("text body without %q:\n%s", want, message.Text)
+				}
+				if !strings.Contains(message.HTML, want) {
+					t.Errorf("HTML body without %q:\n%s", want, message.HTML)
+				}
+			}
+		})
+	}
+
+	names, err := filepath.Glob(filepath.Join(TemplatesDir, "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if name := strings.TrimSuffix(filepath.Base(name), ".txt"); !tested[name] {
+			t.Errorf("message %s is not rendered by this test", name)
+		}
+	}
+}
+
+// Usernames and the rest of the data are escaped in the HTML body.
+func TestRenderEscapesHTML(t *testing.T) {
+	message, err := Render("password_reset", map[string]interface{}{"Username": "<b>owner</b>", "Link": "https://forum.test/x", "Minutes": 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(message.HTML, "<b>owner</b>") || !strings.Contains(message.HTML, "&lt;b&gt;owner&lt;/b&gt;") {
+		t.Errorf("username not escaped in %s", message.HTML)
+	}
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// states of a DataExport
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is a "download my data" job. The ZIP it produces is kept until ExpiresAt.
+type DataExport struct {
+	ExportID    int
+	UserID      int
+	Status      string
+	FilePath    string
+	CreatedTime time.Time
+	ExpiresAt   time.Time
+}
+
+// what happens to the posts and comments of a deleted account
+const (
+	DeletionAnonymize = "anonymize" // kept, attributed to the "deleted user" account
+	DeletionErase     = "erase"     // deleted together with the account
+)
+
+// AccountDeletion is a deletion the owner asked for, waiting out its cooling-off period until ScheduledTime.
+type AccountDeletion struct {
+	UserID        int
+	Mode          string
+	RequestedTime time.Time
+	ScheduledTime time.Time
+}
@@ -5,60 +5,43 @@ import (
 	"time"
 )
 
-type GitHubResponseToken struct {
-	AccessToken string `json:"access_token"`
-	TokenID     string `json:"id_token"`
-	Scope       string `json:"scope"`
+// ExternalIdentity is the user as described by an OAuth2 / OpenID Connect provider.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	FirstName     string
+	SecondName    string
 }
 
-type GoogleResponseToken struct {
-	AccessToken string `json:"access_token"`
-	TokenID     string `json:"id_token"`
+// UserIdentity links a local user to an account at a login provider.
+// Provider and Subject identify the provider account; the email is kept for display only.
+type UserIdentity struct {
+	IdentityID  int
+	UserID      int
+	Provider    string
+	Subject     string
+	Email       string
+	CreatedTime time.Time
 }
 
-type GoogleUserResult struct {
-	Id             string
-	Email          string
-	Verified_email bool
-	Name           string
-	Given_name     string
-	Family_name    string
-	Picture        string
-	Locale         string
-	Password       string
-}
-
-type GitHubUserResult struct {
-	Id             string
-	Email          string
-	Verified_email bool
-	Name           string
-	Given_name     string
-	Family_name    string
-	Picture        string
-	Locale         string
-	Password       string
-}
-
-type GoogleLoginUserData struct {
-	ID         int
-	Name       string
-	Email      string
-	Password   string
-	FirstName  string
-	SecondName string
-	Provider   string
-}
+// kinds of LoginFailure records
+const (
+	LoginFailureAccount = "account" // Subject is the user ID
+	LoginFailureIP      = "ip"      // Subject is the client address
+)
 
-type GitHubLoginUserData struct {
-	ID         int
-	Name       string
-	Email      string
-	Password   string
-	FirstName  string
-	SecondName string
-	Login      string
-	Provider   string
+// LoginFailure counts failed password logins for one account or one client address.
+// UnnotifiedFailures keeps counting until the account owner is told about them.
+type LoginFailure struct {
+	Kind               string
+	Subject            string
+	Failures           int
+	UnnotifiedFailures int
+	LastFailure        time.Time
+	LockedUntil        time.Time
 }
 
 type User struct {
@@ -71,6 +54,56 @@ type User struct {
 	Role       string
 }
 
+// ProfilePrivacy holds which parts of a user's activity other people may see.
+// Everything is private until the owner opts in.
+type ProfilePrivacy struct {
+	UserID        int
+	ShowPosts     bool
+	ShowComments  bool
+	ShowReactions bool
+	ShowStats     bool // post and comment counts and reputation
+}
+
+// UserProfile is what /u/{username} shows about a user besides their content.
+// JoinedTime is zero for accounts created before join dates were recorded.
+type UserProfile struct {
+	UserID       int
+	Bio          string
+	AvatarPath   string
+	JoinedTime   time.Time
+	PostCount    int
+	CommentCount int
+	Reputation   int // likes minus dislikes on approved posts and comments
+}
+
+// Invitation lets a new staff member register with a role other than "user".
+// Only the SHA-256 hash of the token is stored.
+type Invitation struct {
+	InvitationID int
+	TokenHash    string
+	Role         string
+	CreatedBy    int
+	ExpiresAt    time.Time
+	UsedBy       int
+}
+
+// EmailChange is a new email address waiting for its owner to confirm it.
+// Only the SHA-256 hash of the confirmation token is stored.
+type EmailChange struct {
+	TokenHash string
+	UserID    int
+	NewEmail  string
+	ExpiresAt time.Time
+}
+
+// PasswordReset lets the owner of an account set a new password with the token mailed to them.
+// Only the SHA-256 hash of the token is stored.
+type PasswordReset struct {
+	TokenHash string
+	UserID    int
+	ExpiresAt time.Time
+}
+
 type Session struct {
 	UserID  int
 	Token   string
@@ -132,16 +165,3 @@ type CommentsWithPosts struct {
 	CommentContent    string
 	CommentTimeString string
 }
-
-type PostVotes struct {
-	PostVotesID      int
-	PostID           int
-	UserID           int
-	Reaction         int
-	ReactionStr      string
-	IsSeen           bool
-	ReactorUsername  string
-	Time             time.Time
-	PostTitle        string
-	NotificationType string
-}
@@ -1,11 +0,0 @@
-package models
-
-var GitHubAuthURL = "https://github.com/login/oauth/authorize"
-var GitHubClientID = "Ov23liWreTob0ii8qddK"
-var GitHubClientSecret = "13a92b42d550ebda7c427fff4d1ac13b7edce1b1"
-var GitHubRedirectURL = "https://localhost:8080/github/callback"
-
-var GoogleAuthURL = "https://accounts.google.com/o/oauth2/v2/auth"
-var GoogleClientID = "13218466247-r3oiccef63hoqfr0s9n42utffvflo3s4.apps.googleusercontent.com"
-var GoogleClientSecret = "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"
-var GoogleRedirectURL = "https://localhost:8080/google/callback"
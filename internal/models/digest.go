@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// how often a user gets the digest e-mail
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+var DigestFrequencies = []string{DigestOff, DigestDaily, DigestWeekly}
+
+// DigestPeriod is the time between two digests, 0 when they are off.
+func DigestPeriod(frequency string) time.Duration {
+	switch frequency {
+	case DigestDaily:
+		return 24 * time.Hour
+	case DigestWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// DigestSettings is the opt-in of a user to digests. New posts of the followed categories go into the
+// digest next to the top posts of the period. LastSentTime starts when the digest is turned on.
+type DigestSettings struct {
+	UserID       int
+	Frequency    string
+	CategoryIDs  []int
+	LastSentTime time.Time
+}
+
+// Follows tells whether the user follows the category in the digest.
+func (settings *DigestSettings) Follows(categoryID int) bool {
+	for _, id := range settings.CategoryIDs {
+		if id == categoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// Digest is what one digest e-mail tells a user about, none of it sent to the user in a digest before.
+type Digest struct {
+	Settings      *DigestSettings
+	Since         time.Time
+	Notifications []*Notification // unread, of the types the user gets in the digest
+	NewPosts      []*Post         // in the followed categories
+	TopPosts      []*Post         // with the most reactions
+}
+
+func (digest *Digest) Empty() bool {
+	return len(digest.Notifications) == 0 && len(digest.NewPosts) == 0 && len(digest.TopPosts) == 0
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Feed is a list of approved posts for feed readers: the front page, a category or a user.
+// All links are absolute, feed readers fetch them from elsewhere.
+type Feed struct {
+	Title    string
+	Subtitle string
+	Link     string // the page of the forum the feed follows
+	AtomURL  string
+	RSSURL   string
+	Updated  time.Time // when the newest entry was written, zero without entries
+	Entries  []*FeedEntry
+}
+
+type FeedEntry struct {
+	Title       string
+	ID          string // the short link of the post, which stays the same when the title changes
+	Link        string
+	Author      string
+	AuthorLink  string
+	Categories  []string
+	Published   time.Time
+	ContentHTML string
+	Image       *FeedImage // nil for posts without an image
+}
+
+// FeedImage is the image of a post, sent as an enclosure.
+type FeedImage struct {
+	URL    string
+	Type   string
+	Length int64
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// states of a queued Mail
+const (
+	MailPending = "pending" // waiting for NextAttemptTime
+	MailSent    = "sent"
+	MailFailed  = "failed" // gave up after too many attempts
+)
+
+// Mail is a rendered e-mail in the outbound queue. It is retried with a growing delay until it is sent
+// or given up on.
+type Mail struct {
+	MailID          int
+	To              string
+	Subject         string
+	Text            string
+	HTML            string
+	Status          string
+	Attempts        int
+	NextAttemptTime time.Time
+	LastError       string
+	CreatedTime     time.Time
+	SentTime        *time.Time
+}
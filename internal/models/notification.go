@@ -0,0 +1,213 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// kinds of Notification
+const (
+	NotificationPostReaction     = "post_reaction"     // somebody reacted to your post
+	NotificationPostComment      = "post_comment"      // somebody commented on your post
+	NotificationCommentReaction  = "comment_reaction"  // somebody reacted to your comment
+	NotificationLoginFailures    = "login_failures"    // somebody failed to log in to your account
+	NotificationThreadComment    = "thread_comment"    // somebody commented on a post you commented on
+	NotificationMention          = "mention"           // somebody wrote @username in a post or comment
+	NotificationApproved         = "approved"          // a moderator approved your post or comment
+	NotificationRejected         = "rejected"          // a moderator deleted your post or comment before approving it
+	NotificationDeleted          = "deleted"           // a moderator deleted your approved post or comment
+	NotificationModeratorRequest = "moderator_request" // an administrator decided on your request to become a moderator
+	NotificationRoleChange       = "role_change"       // an administrator changed your role
+)
+
+// how a type of notification reaches a user
+const (
+	DeliveryInApp       = "in_app"       // the notifications page and the badge
+	DeliveryEmailDigest = "email_digest" // in the app, and collected into a digest e-mail
+	DeliveryEmail       = "email"        // in the app, and by e-mail right away
+	DeliveryOff         = "off"
+)
+
+// NotificationDeliveries are the choices of the settings page, in its order.
+var NotificationDeliveries = []string{DeliveryInApp, DeliveryEmailDigest, DeliveryEmail, DeliveryOff}
+
+// NotificationTypes are the types of notifications users choose the delivery of, in the order the
+// settings page shows them, with how it names them.
+var NotificationTypes = []struct{ Type, Label string }{
+	{NotificationPostComment, "Comments on my posts"},
+	{NotificationThreadComment, "Comments on posts I commented on"},
+	{NotificationMention, "Mentions of my username"},
+	{NotificationPostReaction, "Reactions to my posts"},
+	{NotificationCommentReaction, "Reactions to my comments"},
+	{NotificationApproved, "My posts and comments approved"},
+	{NotificationRejected, "My posts and comments rejected"},
+	{NotificationDeleted, "My posts and comments deleted by a moderator"},
+	{NotificationModeratorRequest, "Decisions on my moderator request"},
+	{NotificationRoleChange, "Changes of my role"},
+	{NotificationLoginFailures, "Failed attempts to log in to my account"},
+}
+
+// IsNotificationDelivery tells whether value is one of NotificationDeliveries.
+func IsNotificationDelivery(value string) bool {
+	for _, delivery := range NotificationDeliveries {
+		if delivery == value {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotificationType tells whether value is one of NotificationTypes.
+func IsNotificationType(value string) bool {
+	for _, kind := range NotificationTypes {
+		if kind.Type == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationPreferences holds how each type of notification reaches a user. Types that are not in
+// Deliveries use DeliveryInApp.
+type NotificationPreferences struct {
+	UserID     int
+	Deliveries map[string]string
+}
+
+// Delivery returns how notifications of the given type reach the user.
+func (p *NotificationPreferences) Delivery(notificationType string) string {
+	if delivery, ok := p.Deliveries[notificationType]; ok {
+		return delivery
+	}
+	return DeliveryInApp
+}
+
+// what a NotificationMute silences
+const (
+	MuteThread = "post" // a post and its comments
+	MuteUser   = "user" // whatever a user does
+)
+
+// NotificationMute silences the notifications about a thread or caused by a user. Name is the title
+// of the post or the username, for the settings page.
+type NotificationMute struct {
+	UserID      int
+	TargetType  string
+	TargetID    int
+	Name        string
+	CreatedTime time.Time
+}
+
+// Notification tells a user that something happened to their content or account. ActorID is 0 when
+// nobody in particular did it; TargetType is ResourcePost, ResourceComment or empty.
+type Notification struct {
+	NotificationID int
+	UserID         int
+	Type           string
+	ActorID        int
+	ActorUsername  string
+	TargetType     string
+	TargetID       int
+	Payload        NotificationPayload
+	CreatedTime    time.Time
+	ReadTime       time.Time // zero while unread
+}
+
+// NotificationPayload keeps what a notification shows as it was when it happened, so that it still
+// makes sense after the post is renamed or deleted. It is stored as JSON.
+type NotificationPayload struct {
+	PostID    int    `json:"post_id,omitempty"`
+	PostTitle string `json:"post_title,omitempty"`
+	CommentID int    `json:"comment_id,omitempty"`
+	Reaction  string `json:"reaction,omitempty"` // "like" or "dislike"
+	Count     int    `json:"count,omitempty"`    // failed logins
+	Reason    string `json:"reason,omitempty"`   // why a moderator removed the content
+	Approved  bool   `json:"approved,omitempty"` // the decision on a moderator request
+	OldRole   string `json:"old_role,omitempty"`
+	NewRole   string `json:"new_role,omitempty"`
+}
+
+// Mutable tells whether muting a thread or a user silences the notification. What moderators and
+// administrators decide, and what happens to the account, always gets through.
+func (n *Notification) Mutable() bool {
+	switch n.Type {
+	case NotificationPostReaction, NotificationPostComment, NotificationCommentReaction, NotificationThreadComment, NotificationMention:
+		return true
+	}
+	return false
+}
+
+func (n *Notification) IsRead() bool {
+	return !n.ReadTime.IsZero()
+}
+
+// Message is the notification in words, for pages and e-mails.
+func (n *Notification) Message() string {
+	actor := n.ActorUsername
+	if actor == "" {
+		actor = "Somebody"
+	}
+	reacted := "disliked"
+	if n.Payload.Reaction == "like" {
+		reacted = "liked"
+	}
+	switch n.Type {
+	case NotificationPostReaction:
+		return fmt.Sprintf("%s %s your post %q", actor, reacted, n.Payload.PostTitle)
+	case NotificationPostComment:
+		return fmt.Sprintf("%s commented on your post %q", actor, n.Payload.PostTitle)
+	case NotificationCommentReaction:
+		return fmt.Sprintf("%s %s your comment on %q", actor, reacted, n.Payload.PostTitle)
+	case NotificationLoginFailures:
+		return fmt.Sprintf("There were %d failed attempts to log in to your account. If it was not you, consider changing your password.", n.Payload.Count)
+	case NotificationThreadComment:
+		return fmt.Sprintf("%s also commented on %q", actor, n.Payload.PostTitle)
+	case NotificationMention:
+		if n.TargetType == ResourceComment {
+			return fmt.Sprintf("%s mentioned you in a comment on %q", actor, n.Payload.PostTitle)
+		}
+		return fmt.Sprintf("%s mentioned you in %q", actor, n.Payload.PostTitle)
+	case NotificationApproved:
+		return fmt.Sprintf("A moderator approved your %s", n.content())
+	case NotificationRejected:
+		return fmt.Sprintf("A moderator rejected your %s%s", n.content(), n.reason())
+	case NotificationDeleted:
+		return fmt.Sprintf("A moderator deleted your %s%s", n.content(), n.reason())
+	case NotificationModeratorRequest:
+		if n.Payload.Approved {
+			return "Your request to become a moderator was approved"
+		}
+		return "Your request to become a moderator was declined"
+	case NotificationRoleChange:
+		return fmt.Sprintf("Your role was changed from %s to %s", n.Payload.OldRole, n.Payload.NewRole)
+	}
+	return "Something happened"
+}
+
+// content names the post or comment a moderation notification is about.
+func (n *Notification) content() string {
+	if n.TargetType == ResourceComment {
+		return fmt.Sprintf("comment on %q", n.Payload.PostTitle)
+	}
+	return fmt.Sprintf("post %q", n.Payload.PostTitle)
+}
+
+func (n *Notification) reason() string {
+	if n.Payload.Reason == "" {
+		return ""
+	}
+	return ": " + n.Payload.Reason
+}
+
+// Link is the page the notification is about, or "" when there is none.
+func (n *Notification) Link() string {
+	switch {
+	case (n.Type == NotificationRejected || n.Type == NotificationDeleted) && n.TargetType == ResourcePost:
+		return "" // the post is gone
+	case n.Payload.PostID != 0:
+		return PostPath(n.Payload.PostID, n.Payload.PostTitle)
+	case n.Type == NotificationLoginFailures:
+		return "/account"
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package models
+
+// roles stored in users.role
+const (
+	RoleUser      = "user"
+	RolePending   = "pending" // user who applied to become a moderator
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+	RoleDeleted   = "deleted" // placeholder account that content of deleted accounts is attributed to
+)
+
+type Permission string
+
+const (
+	PermCreateContent    Permission = "content.create"
+	PermReact            Permission = "content.react"
+	PermRequestModerator Permission = "moderator.request"
+	PermSkipApproval     Permission = "content.skip_approval"
+	PermApproveContent   Permission = "content.approve"
+	PermReportContent    Permission = "content.report"
+	PermResolveReports   Permission = "reports.resolve"
+	PermManageModerators Permission = "moderators.manage"
+	PermManageCategories Permission = "categories.manage"
+	PermInviteStaff      Permission = "staff.invite"
+	PermEditAnyContent   Permission = "content.edit_any"
+	PermDeleteAnyContent Permission = "content.delete_any"
+	PermUnlockAccounts   Permission = "accounts.unlock"
+	PermManageWebhooks   Permission = "webhooks.manage"
+)
+
+// RolePermissions maps every role to the permissions it is granted.
+var RolePermissions = map[string][]Permission{
+	RoleUser: {
+		PermCreateContent, PermReact, PermRequestModerator,
+	},
+	RolePending: {
+		PermCreateContent, PermReact,
+	},
+	RoleModerator: {
+		PermCreateContent, PermReact, PermSkipApproval, PermApproveContent, PermReportContent,
+		PermDeleteAnyContent,
+	},
+	RoleAdmin: {
+		PermCreateContent, PermReact, PermSkipApproval, PermApproveContent, PermReportContent,
+		PermResolveReports, PermManageModerators, PermManageCategories,
+		PermEditAnyContent, PermDeleteAnyContent, PermInviteStaff, PermUnlockAccounts,
+		PermManageWebhooks,
+	},
+}
+
+func RoleHasPermission(role string, perm Permission) bool {
+	for _, p := range RolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+type Action string
+
+const (
+	ActionEdit    Action = "edit"
+	ActionDelete  Action = "delete"
+	ActionApprove Action = "approve"
+)
+
+// resource types the policy service knows about
+const (
+	ResourcePost    = "post"
+	ResourceComment = "comment"
+)
+
+type AuditEntry struct {
+	AuditID      int
+	ActorID      int
+	Action       Action
+	ResourceType string
+	ResourceID   int
+	OwnerID      int
+	CreatedTime  time.Time
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const slugMaxLength = 80 // runes
+
+// Slugify turns a title into the readable part of a post's address: lower case letters and digits
+// joined by single dashes, "how-do-i-brew-boba". Titles without either give "post".
+func Slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	slug := b.String()
+	if runes := []rune(slug); len(runes) > slugMaxLength {
+		slug = string(runes[:slugMaxLength])
+		// a cut word looks like a typo, drop it when there are whole words before it
+		if i := strings.LastIndexByte(slug, '-'); i > 0 {
+			slug = slug[:i]
+		}
+	}
+	if slug == "" {
+		return "post"
+	}
+	return slug
+}
+
+// PostPath is the canonical address of a post, /p/{id}/{slug}. Only the ID counts, addresses with
+// an old slug are redirected here.
+func PostPath(postID int, title string) string {
+	return "/p/" + strconv.Itoa(postID) + "/" + url.PathEscape(Slugify(title))
+}
+
+func (post *Post) Permalink() string {
+	return PostPath(post.PostID, post.Title)
+}
+
+// Excerpt is the start of the post on one line, at most n runes long.
+func (post *Post) Excerpt(n int) string {
+	excerpt := strings.Join(strings.Fields(post.Content), " ")
+	if runes := []rune(excerpt); len(runes) > n {
+		excerpt = string(runes[:n-1]) + "…"
+	}
+	return excerpt
+}
+
+func (commented *CommentsWithPosts) Permalink() string {
+	return PostPath(commented.PostID, commented.PostTitle)
+}
+
+// PostQuery selects one page of posts, newest first. Zero fields do not filter.
+type PostQuery struct {
+	AuthorID int
+	Category string
+	Search   string // in the title or the content, ignoring case
+	// posts waiting for approval are left out, except those of ViewerID and all of them for
+	// moderators (WithUnapproved)
+	ViewerID       int
+	WithUnapproved bool
+	Limit, Offset  int
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		slug  string
+	}{
+		{"How do I brew boba?", "how-do-i-brew-boba"},
+		{"  Tea -- & -- coffee  ", "tea-coffee"},
+		{"Version 2.0", "version-2-0"},
+		{"Crème brûlée", "crème-brûlée"},
+		{"Привет, мир", "привет-мир"},
+		{"日本語のタイトル", "日本語のタイトル"},
+		{"", "post"},
+		{"?!", "post"},
+		{"🍵 ☕", "post"},
+		// cut at slugMaxLength runes, back to the last whole word
+		{strings.Repeat("word ", 30), strings.Repeat("word-", 15) + "word"},
+		{"abc " + strings.Repeat("x", 100), "abc"},
+		{strings.Repeat("x", 100), strings.Repeat("x", slugMaxLength)},
+		{strings.Repeat("ж", 100), strings.Repeat("ж", slugMaxLength)},
+	}
+	for _, test := range tests {
+		slug := Slugify(test.title)
+		if slug != test.slug {
+			t.Errorf("Slugify(%q) = %q, want %q", test.title, slug, test.slug)
+		}
+		if utf8.RuneCountInString(slug) > slugMaxLength {
+			t.Errorf("Slugify(%q) is %d runes long", test.title, utf8.RuneCountInString(slug))
+		}
+	}
+}
+
+// The slug of a permalink is escaped, the router unescapes it again before it is compared.
+func TestPostPath(t *testing.T) {
+	if path := PostPath(42, "What is 50% of boba?"); path != "/p/42/what-is-50-of-boba" {
+		t.Errorf("PostPath = %q", path)
+	}
+	if path := PostPath(7, "Crème brûlée"); path != "/p/7/cr%C3%A8me-br%C3%BBl%C3%A9e" {
+		t.Errorf("PostPath = %q", path)
+	}
+}
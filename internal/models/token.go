@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// TokenScope limits what a personal access token may do on top of its owner's role.
+// Scopes are ordered, each one includes the ones before it in TokenScopes.
+type TokenScope string
+
+const (
+	ScopeRead     TokenScope = "read"     // GET requests only
+	ScopeWrite    TokenScope = "write"    // posting, commenting, reacting, editing own content
+	ScopeModerate TokenScope = "moderate" // moderation queue and reports
+	ScopeAdmin    TokenScope = "admin"    // moderators, categories and invitations
+)
+
+var TokenScopes = []TokenScope{ScopeRead, ScopeWrite, ScopeModerate, ScopeAdmin}
+
+// SessionScope is what a browser session may do: everything the role of the user allows.
+const SessionScope = ScopeAdmin
+
+// PermissionScopes is the scope a token needs to use a permission in a state changing request.
+var PermissionScopes = map[Permission]TokenScope{
+	PermCreateContent:    ScopeWrite,
+	PermReact:            ScopeWrite,
+	PermRequestModerator: ScopeWrite,
+	PermReportContent:    ScopeWrite,
+	PermSkipApproval:     ScopeWrite,
+	PermApproveContent:   ScopeModerate,
+	PermResolveReports:   ScopeModerate,
+	PermEditAnyContent:   ScopeModerate,
+	PermDeleteAnyContent: ScopeModerate,
+	PermManageModerators: ScopeAdmin,
+	PermManageCategories: ScopeAdmin,
+	PermInviteStaff:      ScopeAdmin,
+	PermUnlockAccounts:   ScopeAdmin,
+	PermManageWebhooks:   ScopeAdmin,
+}
+
+func scopeRank(scope TokenScope) int {
+	for i, s := range TokenScopes {
+		if s == scope {
+			return i
+		}
+	}
+	return -1
+}
+
+func IsValidScope(scope TokenScope) bool {
+	return scopeRank(scope) >= 0
+}
+
+// ScopeIncludes reports whether a token with scope have may act where want is required.
+func ScopeIncludes(have, want TokenScope) bool {
+	return IsValidScope(have) && scopeRank(have) >= scopeRank(want)
+}
+
+// AccessToken is a personal access token; only the hash of the token is stored.
+// A zero ExpiresAt means the token does not expire, a zero LastUsedTime that it was never used.
+type AccessToken struct {
+	TokenID      int
+	UserID       int
+	Name         string
+	TokenHash    string
+	Scope        TokenScope
+	CreatedTime  time.Time
+	ExpiresAt    time.Time
+	LastUsedTime time.Time
+}
@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// events a Webhook can subscribe to
+const (
+	WebhookPostCreated    = "post.created"
+	WebhookPostApproved   = "post.approved"
+	WebhookPostDeleted    = "post.deleted"
+	WebhookCommentCreated = "comment.created"
+	WebhookReportFiled    = "report.filed"
+	WebhookUserRegistered = "user.registered"
+	WebhookPing           = "ping" // the test event of the admin page, sent to one webhook only
+)
+
+// WebhookEvents are the events admins choose from, in the order the admin page lists them.
+var WebhookEvents = []struct {
+	Event string
+	Label string
+}{
+	{WebhookPostCreated, "A post is created"},
+	{WebhookPostApproved, "A post is approved"},
+	{WebhookPostDeleted, "A post is deleted"},
+	{WebhookCommentCreated, "A comment is created"},
+	{WebhookReportFiled, "A post is reported"},
+	{WebhookUserRegistered, "A user registers"},
+}
+
+func IsWebhookEvent(event string) bool {
+	for _, known := range WebhookEvents {
+		if known.Event == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook is a URL that forum events are POSTed to, signed with Secret.
+type Webhook struct {
+	WebhookID   int
+	URL         string
+	Secret      string
+	Events      []string
+	Active      bool
+	CreatedBy   int
+	CreatedTime time.Time
+}
+
+func (webhook *Webhook) Subscribes(event string) bool {
+	for _, subscribed := range webhook.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// states of a WebhookDelivery
+const (
+	WebhookDeliveryPending   = "pending" // waiting for NextAttemptTime
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed" // gave up after too many attempts
+)
+
+// WebhookDelivery is one event on its way to one webhook, and the log of how it went.
+type WebhookDelivery struct {
+	DeliveryID      int
+	WebhookID       int
+	Event           string
+	Payload         string
+	Status          string
+	Attempts        int
+	NextAttemptTime time.Time
+	ResponseStatus  int // of the last attempt, 0 when there was no response
+	ResponseBody    string
+	LastError       string
+	CreatedTime     time.Time
+	DeliveredTime   *time.Time
+}
@@ -0,0 +1,322 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProviderConfig describes one login provider in Config.json.
+// When Issuer is set the provider is treated as OpenID Connect and its
+// endpoints are discovered from {issuer}/.well-known/openid-configuration;
+// otherwise AuthURL, TokenURL and UserInfoURL must be given (plain OAuth2, e.g. GitHub).
+type ProviderConfig struct {
+	Name            string          `json:"name"`
+	DisplayName     string          `json:"display_name"`
+	Issuer          string          `json:"issuer"`
+	AuthURL         string          `json:"auth_url"`
+	TokenURL        string          `json:"token_url"`
+	UserInfoURL     string          `json:"userinfo_url"`
+	ClientID        string          `json:"client_id"`
+	ClientSecret    string          `json:"client_secret"`
+	ClientSecretEnv string          `json:"client_secret_env"`
+	RedirectURL     string          `json:"redirect_url"`
+	Scopes          []string        `json:"scopes"`
+	Claims          UserInfoMapping `json:"claims"`
+}
+
+// UserInfoMapping names the claims or userinfo fields holding the user details.
+// Empty fields fall back to the standard OpenID Connect claim names.
+type UserInfoMapping struct {
+	Subject       string `json:"subject"`
+	Email         string `json:"email"`
+	EmailVerified string `json:"email_verified"`
+	Username      string `json:"username"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+type Provider struct {
+	config ProviderConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	discovered  bool
+	authURL     string
+	tokenURL    string
+	userInfoURL string
+	jwksURL     string
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// ProviderInfo is what the templates need to render a login button.
+type ProviderInfo struct {
+	Name        string
+	DisplayName string
+}
+
+// AuthRequest is the per-login secret data kept between the redirect and the callback.
+// LinkUserID is set when a logged in user links the provider to their account instead of logging in.
+type AuthRequest struct {
+	Provider     string
+	State        string
+	Nonce        string
+	CodeVerifier string
+	LinkUserID   int
+	ExpTime      time.Time
+}
+
+func NewProvider(config ProviderConfig, client *http.Client) (*Provider, error) {
+	if config.Name == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oauth provider needs name, client_id and redirect_url")
+	}
+	if config.Issuer == "" && (config.AuthURL == "" || config.TokenURL == "" || config.UserInfoURL == "") {
+		return nil, fmt.Errorf("oauth provider %s needs either issuer or auth_url, token_url and userinfo_url", config.Name)
+	}
+	if config.ClientSecret == "" && config.ClientSecretEnv != "" {
+		config.ClientSecret = os.Getenv(config.ClientSecretEnv)
+	}
+	if config.DisplayName == "" {
+		config.DisplayName = config.Name
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{
+		config:      config,
+		client:      client,
+		authURL:     config.AuthURL,
+		tokenURL:    config.TokenURL,
+		userInfoURL: config.UserInfoURL,
+	}, nil
+}
+
+func (p *Provider) Info() ProviderInfo {
+	return ProviderInfo{Name: p.config.Name, DisplayName: p.config.DisplayName}
+}
+
+func (p *Provider) isOIDC() bool {
+	return p.config.Issuer != ""
+}
+
+// discover fills the endpoints from the issuer's discovery document the first time they are needed,
+// so the server can start even when the provider is unreachable.
+func (p *Provider) discover() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.isOIDC() || p.discovered {
+		return nil
+	}
+
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(wellKnown, "", &doc); err != nil {
+		return fmt.Errorf("discovery for %s: %w", p.config.Name, err)
+	}
+	if doc.Issuer != p.config.Issuer {
+		return fmt.Errorf("discovery for %s: issuer mismatch %q", p.config.Name, doc.Issuer)
+	}
+	if p.authURL == "" {
+		p.authURL = doc.AuthorizationEndpoint
+	}
+	if p.tokenURL == "" {
+		p.tokenURL = doc.TokenEndpoint
+	}
+	if p.userInfoURL == "" {
+		p.userInfoURL = doc.UserInfoEndpoint
+	}
+	p.jwksURL = doc.JWKSURI
+	p.discovered = true
+	return nil
+}
+
+// NewAuthRequest creates fresh state, nonce and PKCE verifier and the URL to send the browser to.
+func (p *Provider) NewAuthRequest() (*AuthRequest, string, error) {
+	if err := p.discover(); err != nil {
+		return nil, "", err
+	}
+	state, err := randomString()
+	if err != nil {
+		return nil, "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return nil, "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return nil, "", err
+	}
+	authRequest := &AuthRequest{
+		Provider:     p.config.Name,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpTime:      time.Now().Add(10 * time.Minute),
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	values := url.Values{}
+	values.Set("client_id", p.config.ClientID)
+	values.Set("redirect_uri", p.config.RedirectURL)
+	values.Set("response_type", "code")
+	values.Set("scope", strings.Join(p.config.Scopes, " "))
+	values.Set("state", state)
+	values.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	values.Set("code_challenge_method", "S256")
+	if p.isOIDC() {
+		values.Set("nonce", nonce)
+	}
+
+	separator := "?"
+	if strings.Contains(p.authURL, "?") {
+		separator = "&"
+	}
+	return authRequest, p.authURL + separator + values.Encode(), nil
+}
+
+// Identity exchanges the authorization code and returns who the user is at the provider.
+// For OpenID Connect providers the ID token is validated against the provider's keys.
+func (p *Provider) Identity(code string, authRequest *AuthRequest) (*models.ExternalIdentity, error) {
+	if err := p.discover(); err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", p.config.RedirectURL)
+	values.Set("client_id", p.config.ClientID)
+	values.Set("client_secret", p.config.ClientSecret)
+	values.Set("code_verifier", authRequest.CodeVerifier)
+
+	req, err := http.NewRequest("POST", p.tokenURL, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+	}
+	if err := p.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if token.Error != "" || token.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange failed: %s", token.Error)
+	}
+
+	claims := map[string]interface{}{}
+	if p.isOIDC() {
+		if token.IDToken == "" {
+			return nil, errors.New("provider did not return an ID token")
+		}
+		if claims, err = p.verifyIDToken(token.IDToken, authRequest.Nonce); err != nil {
+			return nil, fmt.Errorf("invalid ID token: %w", err)
+		}
+	}
+
+	if p.userInfoURL != "" {
+		userInfo := map[string]interface{}{}
+		if err := p.getJSON(p.userInfoURL, token.AccessToken, &userInfo); err != nil {
+			return nil, fmt.Errorf("userinfo: %w", err)
+		}
+		// the ID token is authoritative for the subject, userinfo only adds details
+		for key, value := range userInfo {
+			if _, ok := claims[key]; !ok {
+				claims[key] = value
+			}
+		}
+	}
+	return p.mapIdentity(claims)
+}
+
+func (p *Provider) mapIdentity(claims map[string]interface{}) (*models.ExternalIdentity, error) {
+	mapping := p.config.Claims
+	field := func(name, fallback string) string {
+		if name == "" {
+			name = fallback
+		}
+		switch value := claims[name].(type) {
+		case string:
+			return value
+		case float64:
+			return fmt.Sprintf("%.0f", value)
+		case bool:
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+
+	identity := &models.ExternalIdentity{
+		Provider:      p.config.Name,
+		Subject:       field(mapping.Subject, "sub"),
+		Email:         field(mapping.Email, "email"),
+		EmailVerified: field(mapping.EmailVerified, "email_verified") == "true",
+		Username:      field(mapping.Username, "preferred_username"),
+		FirstName:     field(mapping.GivenName, "given_name"),
+		SecondName:    field(mapping.FamilyName, "family_name"),
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("provider did not return a subject")
+	}
+	return identity, nil
+}
+
+func (p *Provider) getJSON(rawURL, accessToken string, target interface{}) error {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return p.doJSON(req, target)
+}
+
+func (p *Provider) doJSON(req *http.Request, target interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, string(body))
+	}
+	return json.Unmarshal(body, target)
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
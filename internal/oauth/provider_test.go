@@ -0,0 +1,299 @@
+package oauth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientID = "forum-client"
+
+// mockIdP is an OpenID Connect provider: discovery, a key set, and a token endpoint that checks the
+// PKCE verifier and returns an ID token with the claims the test asks for.
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu         sync.Mutex
+	challenges map[string]string // code challenge by authorization code
+	jwksCalls  int
+	// claims changes the ID token claims before signing, and signingKey what signs it
+	claims     func(map[string]interface{})
+	signingKey *rsa.PrivateKey
+	headerKid  string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{t: t, key: key, kid: "key-1", challenges: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		idp.jwksCalls++
+		idp.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": idp.kid,
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize does what the browser and the login page of the provider do: it takes the URL the
+// forum redirects to and returns the code the provider sends back with the state.
+func (idp *mockIdP) authorize(authURL string) (code, state, nonce string) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != testClientID {
+		idp.t.Fatalf("unexpected authorization request %s", authURL)
+	}
+	code = "code-" + query.Get("state")[:8]
+	idp.mu.Lock()
+	idp.challenges[code] = query.Get("code_challenge") + " " + query.Get("nonce")
+	idp.mu.Unlock()
+	return code, query.Get("state"), query.Get("nonce")
+}
+
+func (idp *mockIdP) jwksFetches() int {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	return idp.jwksCalls
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	pending, ok := idp.challenges[r.FormValue("code")]
+	delete(idp.challenges, r.FormValue("code"))
+	idp.mu.Unlock()
+	challenge, nonce, _ := strings.Cut(pending, " ")
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":                idp.server.URL,
+		"aud":                testClientID,
+		"sub":                "subject-1",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"nonce":              nonce,
+		"email":              "someone@example.com",
+		"email_verified":     true,
+		"preferred_username": "someone",
+	}
+	signingKey, kid := idp.key, idp.kid
+	if idp.claims != nil {
+		idp.claims(claims)
+	}
+	if idp.signingKey != nil {
+		signingKey = idp.signingKey
+	}
+	if idp.headerKid != "" {
+		kid = idp.headerKid
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access",
+		"id_token":     signJWT(idp.t, signingKey, kid, claims),
+	})
+}
+
+func signJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hashed := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (idp *mockIdP) provider() *Provider {
+	provider, err := NewProvider(ProviderConfig{
+		Name:        "mock",
+		Issuer:      idp.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://forum.test/auth/mock/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	}, idp.server.Client())
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return provider
+}
+
+// login runs the whole flow through a registry, as the handlers do, with change applied to the
+// pending request before the code is exchanged.
+func (idp *mockIdP) login(provider *Provider, change func(*AuthRequest)) (*AuthRequest, error) {
+	registry := &Registry{providers: map[string]*Provider{"mock": provider}, pending: map[string]*AuthRequest{}}
+	authRequest, authURL, err := provider.NewAuthRequest()
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	registry.SaveAuthRequest(authRequest)
+	code, state, _ := idp.authorize(authURL)
+	pending, err := registry.TakeAuthRequest(state)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	if change != nil {
+		change(pending)
+	}
+	_, err = provider.Identity(code, pending)
+	return pending, err
+}
+
+func TestIdentityFromMockProvider(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	authRequest, authURL, err := provider.NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state, nonce := idp.authorize(authURL)
+	if state != authRequest.State || nonce != authRequest.Nonce {
+		t.Fatalf("state %q and nonce %q are not those of the request", state, nonce)
+	}
+	identity, err := provider.Identity(code, authRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "subject-1" || identity.Email != "someone@example.com" || !identity.EmailVerified || identity.Username != "someone" {
+		t.Errorf("identity %+v", identity)
+	}
+}
+
+func TestIdentityRefusesBadLogins(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		change func(*AuthRequest)
+		setup  func(*mockIdP)
+		err    string
+	}{
+		{"nonce mismatch", func(r *AuthRequest) { r.Nonce = "another nonce" }, nil, "nonce mismatch"},
+		{"wrong PKCE verifier", func(r *AuthRequest) { r.CodeVerifier = "another verifier" }, nil, "invalid_grant"},
+		{"wrong issuer", nil, func(idp *mockIdP) {
+			idp.claims = func(c map[string]interface{}) { c["iss"] = "https://evil.example" }
+		}, "wrong issuer"},
+		{"wrong audience", nil, func(idp *mockIdP) {
+			idp.claims = func(c map[string]interface{}) { c["aud"] = []string{"another-client"} }
+		}, "wrong audience"},
+		{"expired token", nil, func(idp *mockIdP) {
+			idp.claims = func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }
+		}, "token expired"},
+		{"bad signature", nil, func(idp *mockIdP) { idp.signingKey = otherKey }, "bad signature"},
+		{"unknown key", nil, func(idp *mockIdP) { idp.headerKid = "key-2" }, "unknown signing key"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			if test.setup != nil {
+				test.setup(idp)
+			}
+			_, err := idp.login(idp.provider(), test.change)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestStateWorksOnce(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	registry := &Registry{providers: map[string]*Provider{"mock": provider}, pending: map[string]*AuthRequest{}}
+	authRequest, _, err := provider.NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.SaveAuthRequest(authRequest)
+
+	if _, err := registry.TakeAuthRequest("a state nobody was given"); err == nil {
+		t.Error("unknown state accepted")
+	}
+	if _, err := registry.TakeAuthRequest(authRequest.State); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.TakeAuthRequest(authRequest.State); err == nil {
+		t.Error("state accepted twice")
+	}
+
+	expired := &AuthRequest{State: "expired", ExpTime: time.Now().Add(-time.Second)}
+	registry.pending[expired.State] = expired
+	if _, err := registry.TakeAuthRequest(expired.State); err == nil {
+		t.Error("expired state accepted")
+	}
+}
+
+// Tokens naming keys the provider never published make the key set be fetched again at most once a
+// jwksRefetchInterval.
+func TestUnknownKeysDoNotRefetchKeySetEveryTime(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := idp.provider()
+	if _, err := idp.login(provider, nil); err != nil {
+		t.Fatal(err)
+	}
+	idp.headerKid = "forged"
+	for i := 0; i < 5; i++ {
+		if _, err := idp.login(provider, nil); err == nil {
+			t.Fatal("token with an unknown key accepted")
+		}
+	}
+	if fetches := idp.jwksFetches(); fetches != 1 {
+		t.Errorf("key set fetched %d times, want 1", fetches)
+	}
+
+	// after the interval a rotated key is picked up
+	provider.mu.Lock()
+	provider.keysFetched = time.Now().Add(-jwksRefetchInterval)
+	provider.mu.Unlock()
+	idp.kid, idp.headerKid = "key-2", ""
+	if _, err := idp.login(provider, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fetches := idp.jwksFetches(); fetches != 2 {
+		t.Errorf("key set fetched %d times, want 2", fetches)
+	}
+}
@@ -0,0 +1,77 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Registry holds the configured providers and the pending login requests.
+type Registry struct {
+	providers map[string]*Provider
+	order     []string
+
+	mu      sync.Mutex
+	pending map[string]*AuthRequest // keyed by state
+}
+
+func NewRegistry(configs []ProviderConfig) (*Registry, error) {
+	registry := &Registry{
+		providers: make(map[string]*Provider),
+		pending:   make(map[string]*AuthRequest),
+	}
+	for _, config := range configs {
+		provider, err := NewProvider(config, nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := registry.providers[config.Name]; ok {
+			return nil, fmt.Errorf("oauth provider %s configured twice", config.Name)
+		}
+		registry.providers[config.Name] = provider
+		registry.order = append(registry.order, config.Name)
+	}
+	return registry, nil
+}
+
+func (registry *Registry) Get(name string) (*Provider, bool) {
+	provider, ok := registry.providers[name]
+	return provider, ok
+}
+
+// List returns the providers in configuration order.
+func (registry *Registry) List() []ProviderInfo {
+	infos := []ProviderInfo{}
+	for _, name := range registry.order {
+		infos = append(infos, registry.providers[name].Info())
+	}
+	return infos
+}
+
+func (registry *Registry) SaveAuthRequest(authRequest *AuthRequest) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	now := time.Now()
+	for state, pending := range registry.pending {
+		if now.After(pending.ExpTime) {
+			delete(registry.pending, state)
+		}
+	}
+	registry.pending[authRequest.State] = authRequest
+}
+
+// TakeAuthRequest returns the pending request for state and forgets it, so every state works only once.
+func (registry *Registry) TakeAuthRequest(state string) (*AuthRequest, error) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	authRequest, ok := registry.pending[state]
+	if !ok {
+		return nil, errors.New("unknown or already used login state")
+	}
+	delete(registry.pending, state)
+	if time.Now().After(authRequest.ExpTime) {
+		return nil, errors.New("login request expired")
+	}
+	return authRequest, nil
+}
@@ -0,0 +1,126 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// bloomMagic starts every blocklist file, followed by the number of hash functions and the number of bits.
+const bloomMagic = "FBLM1"
+
+// Bloom is a bloom filter of lower-cased passwords. A lookup can report a password that was never added
+// (at the rate the filter was built for) but never misses one that was.
+type Bloom struct {
+	bits   []uint64
+	m      uint64 // number of bits
+	hashes uint32
+}
+
+// NewBloom sizes a filter for n passwords with the given false positive rate.
+func NewBloom(n int, falsePositiveRate float64) *Bloom {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	hashes := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+	return &Bloom{bits: make([]uint64, (m+63)/64), m: m, hashes: hashes}
+}
+
+func (bloom *Bloom) Add(password string) {
+	h1, h2 := bloomHashes(password)
+	for i := uint32(0); i < bloom.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % bloom.m
+		bloom.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (bloom *Bloom) Contains(password string) bool {
+	h1, h2 := bloomHashes(password)
+	for i := uint32(0); i < bloom.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % bloom.m
+		if bloom.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes derives the two hashes the k bit positions are built from (Kirsch-Mitzenmacher).
+func bloomHashes(password string) (uint64, uint64) {
+	sum := sha256.Sum256([]byte(strings.ToLower(password)))
+	return binary.LittleEndian.Uint64(sum[0:8]), binary.LittleEndian.Uint64(sum[8:16]) | 1
+}
+
+func (bloom *Bloom) WriteTo(w io.Writer) (int64, error) {
+	buf := bufio.NewWriter(w)
+	buf.WriteString(bloomMagic)
+	binary.Write(buf, binary.LittleEndian, bloom.hashes)
+	binary.Write(buf, binary.LittleEndian, bloom.m)
+	if err := binary.Write(buf, binary.LittleEndian, bloom.bits); err != nil {
+		return 0, err
+	}
+	return int64(len(bloomMagic) + 4 + 8 + 8*len(bloom.bits)), buf.Flush()
+}
+
+func ReadBloom(r io.Reader) (*Bloom, error) {
+	buf := bufio.NewReader(r)
+	magic := make([]byte, len(bloomMagic))
+	if _, err := io.ReadFull(buf, magic); err != nil || string(magic) != bloomMagic {
+		return nil, errors.New("not a password blocklist file")
+	}
+	bloom := &Bloom{}
+	if err := binary.Read(buf, binary.LittleEndian, &bloom.hashes); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &bloom.m); err != nil {
+		return nil, err
+	}
+	if bloom.m == 0 || bloom.hashes == 0 || bloom.m > 1<<36 {
+		return nil, errors.New("password blocklist file is corrupt")
+	}
+	bloom.bits = make([]uint64, (bloom.m+63)/64)
+	if err := binary.Read(buf, binary.LittleEndian, bloom.bits); err != nil {
+		return nil, err
+	}
+	return bloom, nil
+}
+
+func LoadBloom(path string) (*Bloom, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadBloom(file)
+}
+
+// BuildBloom reads one password per line and returns a filter holding all of them.
+func BuildBloom(r io.Reader, falsePositiveRate float64) (*Bloom, int, error) {
+	var passwords []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			passwords = append(passwords, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	bloom := NewBloom(len(passwords), falsePositiveRate)
+	for _, password := range passwords {
+		bloom.Add(password)
+	}
+	return bloom, len(passwords), nil
+}
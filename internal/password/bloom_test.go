@@ -0,0 +1,121 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const commonPasswords = "../../data/common-passwords.txt"
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+// A filter built, written and loaded again holds every password of the list, and few others.
+func TestBloomRoundTrip(t *testing.T) {
+	file, err := os.Open(commonPasswords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	built, count, err := BuildBloom(file, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := readLines(t, commonPasswords)
+	if count != len(lines) {
+		t.Errorf("built from %d passwords, the list has %d", count, len(lines))
+	}
+
+	path := filepath.Join(t.TempDir(), "blocklist.bloom")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := built.WriteTo(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	if info, err := os.Stat(path); err != nil || info.Size() != written {
+		t.Errorf("WriteTo reported %d bytes, the file has %v (%v)", written, info.Size(), err)
+	}
+
+	loaded, err := LoadBloom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range lines {
+		if !loaded.Contains(line) {
+			t.Errorf("%q is missing after LoadBloom", line)
+		}
+		if !loaded.Contains(strings.ToUpper(line)) {
+			t.Errorf("%q is missing in upper case", line)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if loaded.Contains(fmt.Sprintf("not-a-common-password-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Errorf("%d of 10000 unlisted passwords found, built for 0.1%%", falsePositives)
+	}
+}
+
+// The blocklist shipped in data/ must be built from the list next to it.
+func TestShippedBlocklistHoldsTheList(t *testing.T) {
+	shipped, err := LoadBloom("../../data/common-passwords.bloom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range readLines(t, commonPasswords) {
+		if !shipped.Contains(line) {
+			t.Errorf("%q is not in data/common-passwords.bloom, rebuild it", line)
+		}
+	}
+}
+
+func TestReadBloomRefusesOtherFiles(t *testing.T) {
+	var valid bytes.Buffer
+	if _, err := NewBloom(10, 0.01).WriteTo(&valid); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := append([]byte{}, valid.Bytes()...)
+	for i := len(bloomMagic) + 4; i < len(bloomMagic)+12; i++ {
+		corrupt[i] = 0 // no bits
+	}
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"text":      []byte("123456\npassword\n"),
+		"truncated": valid.Bytes()[:valid.Len()-1],
+		"no bits":   corrupt,
+	} {
+		if _, err := ReadBloom(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s file read as a blocklist", name)
+		}
+	}
+}
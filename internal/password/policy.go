@@ -0,0 +1,131 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxBytes is the longest password bcrypt can hash, it rejects anything longer.
+const maxBytes = 72
+
+type Config struct {
+	MinLength      int     `json:"min_length"`
+	MinEntropyBits float64 `json:"min_entropy_bits"`
+	BlocklistPath  string  `json:"blocklist_path"`
+}
+
+// Policy decides whether a password may be set, at registration, password change and password reset.
+type Policy struct {
+	minLength      int
+	minEntropyBits float64
+	blocklist      *Bloom
+}
+
+// NewPolicy applies the defaults for a missing config and loads the blocklist. A missing blocklist
+// file is logged and skipped so a broken deployment still lets people register.
+func NewPolicy(config Config) *Policy {
+	policy := &Policy{minLength: config.MinLength, minEntropyBits: config.MinEntropyBits}
+	if policy.minLength < 1 {
+		policy.minLength = 8
+	}
+	if config.BlocklistPath != "" {
+		blocklist, err := LoadBloom(config.BlocklistPath)
+		if err != nil {
+			log.Printf("Password blocklist %s not loaded: %v", config.BlocklistPath, err)
+		} else {
+			policy.blocklist = blocklist
+		}
+	}
+	return policy
+}
+
+// Check returns the reason the password is refused, or nil. personal holds the user's own details
+// (username, email) which must not be used as the password.
+func (policy *Policy) Check(password string, personal ...string) error {
+	if utf8.RuneCountInString(password) < policy.minLength {
+		return fmt.Errorf("Password must be at least %d characters long", policy.minLength)
+	}
+	if len(password) > maxBytes {
+		return fmt.Errorf("Password cannot be longer than %d bytes", maxBytes)
+	}
+	lower := strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(value)
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			value = local
+		}
+		if len(value) >= 4 && strings.Contains(lower, value) {
+			return errors.New("Password cannot contain your username or email")
+		}
+	}
+	if policy.blocklist != nil {
+		// "Password2024!" is as guessable as "password", so the suffix is tried off as well
+		stripped := strings.TrimRightFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+		if policy.blocklist.Contains(lower) || (stripped != "" && policy.blocklist.Contains(stripped)) {
+			return errors.New("This password is too common, it appears in lists of leaked passwords")
+		}
+	}
+	if Entropy(password) < policy.minEntropyBits {
+		return errors.New("Password is too easy to guess, make it longer or mix in other kinds of characters")
+	}
+	return nil
+}
+
+// Entropy estimates the strength of a password in bits: every character is worth log2 of the
+// alphabet the password draws from, except repeats and runs like "aaa" or "123", worth one bit each.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	perChar := math.Log2(float64(pool))
+	bits := 0.0
+	runes := []rune(password)
+	for i, r := range runes {
+		switch {
+		case i > 0 && r == runes[i-1]:
+			bits++
+		case i > 1 && (r-runes[i-1] == 1 || r-runes[i-1] == -1) && r-runes[i-1] == runes[i-1]-runes[i-2]:
+			bits++
+		default:
+			bits += perChar
+		}
+	}
+	return bits
+}
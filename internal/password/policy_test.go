@@ -0,0 +1,91 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := NewPolicy(Config{MinLength: 10, MinEntropyBits: 40, BlocklistPath: "../../data/common-passwords.bloom"})
+	if policy.blocklist == nil {
+		t.Fatal("blocklist not loaded")
+	}
+	personal := []string{"owner", "alice.w@example.com"}
+	tests := []struct {
+		name     string
+		password string
+		err      string // part of the error, "" when the password is fine
+	}{
+		{"one character short", "k7#Vq2!zP", "at least 10 characters"},
+		{"just long enough", "k7#Vq2!zPm", ""},
+		{"length counts characters", "ßüöäéèàçñ", "at least 10 characters"},
+		{"characters beyond ASCII", "ßüöäéèàçñõ", ""},
+		{"bcrypt limit", strings.Repeat("aB3$", 18), ""},
+		{"one byte over the bcrypt limit", strings.Repeat("aB3$", 18) + "x", "longer than 72 bytes"},
+		{"multi-byte over the bcrypt limit", strings.Repeat("ü", 37), "longer than 72 bytes"},
+		{"username", "my-owner-pass-91", "username or email"},
+		{"username in capitals", "my-OWNER-pass-91", "username or email"},
+		{"local part of the email", "xx-alice.w-xx-91", "username or email"},
+		{"listed", "1234567890", "too common"},
+		{"listed in capitals", "PASSWORD12", "too common"},
+		{"listed with a suffix", "Password2024!", "too common"},
+		{"listed with digits stripped", "qwertyuiop2024", "too common"},
+		{"repeated character", "aaaaaaaaaaaaaaaa", "too easy to guess"},
+		{"run", "abcdefghijklmnop", "too easy to guess"},
+		{"passphrase", "correct horse battery staple", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.Check(test.password, personal...)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("refused: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestPolicyDefaults(t *testing.T) {
+	policy := NewPolicy(Config{BlocklistPath: "a file that is not there"})
+	if policy.blocklist != nil {
+		t.Error("blocklist from a missing file")
+	}
+	if err := policy.Check("1234567"); err == nil {
+		t.Error("7 characters accepted with the default minimum of 8")
+	}
+	// without the blocklist and the entropy estimate only the length counts
+	if err := policy.Check("password"); err != nil {
+		t.Errorf("refused: %v", err)
+	}
+	// personal details shorter than 4 characters would refuse too much
+	if err := policy.Check("bob-likes-tea", "bob"); err != nil {
+		t.Errorf("refused: %v", err)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	lower, mixed := math.Log2(26), math.Log2(26+26+10+33)
+	tests := []struct {
+		password string
+		bits     float64
+	}{
+		{"", 0},
+		{"a", lower},
+		{"ab", 2 * lower},
+		{"aaaa", lower + 3},   // repeats are worth a bit
+		{"abcd", 2*lower + 2}, // and so are runs, from the third character on
+		{"dcba", 2*lower + 2}, // in both directions
+		{"acegi", 5 * lower},  // steps of two are no run
+		{"aB3$", 4 * mixed},   // every kind of character widens the alphabet
+		{"ü", math.Log2(100)}, // beyond ASCII
+		{"1111", math.Log2(10) + 3},
+	}
+	for _, test := range tests {
+		if bits := Entropy(test.password); math.Abs(bits-test.bits) > 1e-9 {
+			t.Errorf("Entropy(%q) = %.2f, want %.2f", test.password, bits, test.bits)
+		}
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"forum/cmd/config"
 	repository "forum/internal/database"
 	database "forum/internal/database/migration"
+	"forum/internal/mail"
+	"forum/internal/oauth"
+	"forum/internal/password"
 	"forum/internal/service"
 	handlers "forum/internal/web/handlers"
 	"log"
@@ -25,8 +28,24 @@ func InitServer(conf *config.Config, ctx context.Context) (*Server, *sql.DB) {
 	}
 
 	repository := repository.NewRepository(db) // stores the db in the repository
-	service := service.NewService(repository)
-	handler := handlers.NewHandler(service)
+	mailer, err := mail.New(conf.Mail)
+	if err != nil {
+		log.Fatal(err)
+	}
+	service := service.NewService(repository, password.NewPolicy(conf.PasswordPolicy), mailer, conf.Mail)
+	providers, err := oauth.NewRegistry(conf.OAuthProviders)
+	if err != nil {
+		log.Fatal(err)
+	}
+	handler := handlers.NewHandler(service, providers)
+
+	// exports, account deletions, the cleanup of old notifications, digests, the mail queue and webhook
+	// deliveries run in the background until shutdown
+	go service.AccountDataServiceInterface.RunJobs(ctx)
+	go service.NotificationServiceInterface.RunNotificationJobs(ctx)
+	go service.DigestServiceInterface.RunDigestJobs(ctx)
+	go service.WebhookServiceInterface.RunWebhookJobs(ctx)
+	go service.MailServiceInterface.RunMailJobs(ctx)
 
 	// Server configuration
 
@@ -51,6 +70,9 @@ func InitServer(conf *config.Config, ctx context.Context) (*Server, *sql.DB) {
 		},
 	}
 
+	// event streams stay open for minutes, they are ended when the server shuts down
+	ServerObj.httpServer.RegisterOnShutdown(service.Events.Close)
+
 	// Return server object and the DB connection
 	return &ServerObj, db
 }
@@ -61,12 +83,13 @@ func (server *Server) Start() error {
 }
 
 func (server *Server) Shutdown(ctx context.Context, db *sql.DB) error {
+	// Gracefully shutdown the HTTP server, the requests still running need the database
+	shutdownErr := server.httpServer.Shutdown(ctx)
+
 	// Close the database connection
 	if err := db.Close(); err != nil {
 		log.Printf("Error closing database connection: %v", err)
 		return err
 	}
-
-	// Gracefully shutdown the HTTP server
-	return server.httpServer.Shutdown(ctx)
+	return shutdownErr
 }
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"errors"
+	"forum/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	emailChangeTTL   = 24 * time.Hour
+	passwordResetTTL = time.Hour
+)
+
+func (userObj *UserServiceImpl) UpdateNames(userID int, firstName, secondName string) error {
+	firstName, secondName = strings.TrimSpace(firstName), strings.TrimSpace(secondName)
+	if firstName == "" {
+		return errors.New("First Name is required.")
+	}
+	if secondName == "" {
+		return errors.New("Second Name is required.")
+	}
+	return userObj.repo.UpdateUserNames(userID, firstName, secondName)
+}
+
+// ChangeUsername renames the user. The old name keeps redirecting to the account and cannot be taken
+// by anybody else.
+func (userObj *UserServiceImpl) ChangeUsername(userID int, username string) error {
+	user, err := userObj.repo.GetUserByUserID(userID)
+	if err != nil {
+		return err
+	}
+	username = strings.TrimSpace(username)
+	if username == user.Username {
+		return nil
+	}
+	if err := userObj.isUserNameValid(&models.User{Username: username}); err != nil {
+		return err
+	}
+
+	free, err := userObj.isUsernameFree(username, userID)
+	if err != nil {
+		return err
+	}
+	if !free {
+		return errors.New("This username is already taken")
+	}
+	return userObj.repo.ChangeUsername(userID, user.Username, username, time.Now())
+}
+
+// GetUserByFormerUsername finds the account that used to have the username.
+func (userObj *UserServiceImpl) GetUserByFormerUsername(username string) (*models.User, error) {
+	userID, err := userObj.repo.GetUserIDByOldUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	return userObj.repo.GetUserByUserID(userID)
+}
+
+// RequestEmailChange keeps the current email until the new one is confirmed with the token mailed to it.
+// Only the hash of the token is stored.
+func (userObj *UserServiceImpl) RequestEmailChange(userID int, newEmail, currentPassword string) error {
+	user, err := userObj.repo.GetUserByUserID(userID)
+	if err != nil {
+		return err
+	}
+	if err := userObj.checkCurrentPassword(user, currentPassword); err != nil {
+		return err
+	}
+	newEmail = strings.TrimSpace(newEmail)
+	if err := userObj.isUserEmailValid(&models.User{Email: newEmail}); err != nil {
+		return err
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return errors.New("This is already your email")
+	}
+	if err := userObj.isEmailFree(newEmail); err != nil {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	change := &models.EmailChange{
+		TokenHash: hashToken(token),
+		UserID:    userID,
+		NewEmail:  newEmail,
+		ExpiresAt: time.Now().Add(emailChangeTTL),
+	}
+	if err := userObj.repo.SaveEmailChange(change); err != nil {
+		return err
+	}
+	return userObj.mail.send(newEmail, "email_change", map[string]interface{}{
+		"Username": user.Username,
+		"Email":    newEmail,
+		"Link":     userObj.mail.URL("/confirm_email/" + token),
+	})
+}
+
+// ConfirmEmailChange switches the account to the email the token was sent to.
+func (userObj *UserServiceImpl) ConfirmEmailChange(token string) error {
+	change, err := userObj.repo.GetEmailChangeByTokenHash(hashToken(token))
+	if err != nil {
+		return errors.New("Confirmation link is invalid")
+	}
+	if err := userObj.repo.DeleteEmailChange(change.UserID); err != nil {
+		return err
+	}
+	if time.Now().After(change.ExpiresAt) {
+		return errors.New("Confirmation link has expired")
+	}
+	// somebody may have registered with the address in the meantime
+	if err := userObj.isEmailFree(change.NewEmail); err != nil {
+		return err
+	}
+	return userObj.repo.UpdateUserEmail(change.UserID, change.NewEmail)
+}
+
+// GetPendingEmailChange returns the email change waiting for confirmation, or nil.
+func (userObj *UserServiceImpl) GetPendingEmailChange(userID int) (*models.EmailChange, error) {
+	change, err := userObj.repo.GetEmailChangeByUserID(userID)
+	if err != nil {
+		if err.Error() != errors.New("email change not found").Error() {
+			return nil, err
+		}
+		return nil, nil
+	}
+	if time.Now().After(change.ExpiresAt) {
+		return nil, nil
+	}
+	return change, nil
+}
+
+func (userObj *UserServiceImpl) ChangePassword(userID int, currentPassword, newPassword string) error {
+	user, err := userObj.repo.GetUserByUserID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Password == "" {
+		return errors.New("You do not have a password yet, set one instead")
+	}
+	if err := userObj.checkCurrentPassword(user, currentPassword); err != nil {
+		return err
+	}
+	if err := userObj.isPasswordValid(&models.User{Username: user.Username, Email: user.Email, Password: newPassword}); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return userObj.repo.UpdateUserPassword(userID, string(hash))
+}
+
+// RequestPasswordReset mails a link for setting a new password to the account with the email. It
+// does not tell whether there is one, so the form cannot be used to find out who is registered.
+// Only the hash of the token is stored.
+func (userObj *UserServiceImpl) RequestPasswordReset(email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return errors.New("Email is required.")
+	}
+	user, err := userObj.repo.GetUserByEmail(email)
+	if err != nil {
+		return nil
+	}
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	reset := &models.PasswordReset{
+		TokenHash: hashToken(token),
+		UserID:    user.UserUserID,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+	if err := userObj.repo.SavePasswordReset(reset); err != nil {
+		return err
+	}
+	return userObj.mail.send(user.Email, "password_reset", map[string]interface{}{
+		"Username": user.Username,
+		"Link":     userObj.mail.URL("/reset_password/" + token),
+		"Minutes":  int(passwordResetTTL.Minutes()),
+	})
+}
+
+// CheckPasswordReset tells whether the token can still be used, before the new password is asked for.
+func (userObj *UserServiceImpl) CheckPasswordReset(token string) error {
+	_, err := userObj.passwordReset(token)
+	return err
+}
+
+// ResetPassword sets the password of the account the token was mailed to. The password has to pass
+// the policy like at registration; the token stays valid until one does. Afterwards the sessions of
+// the account end and its lockout is lifted.
+func (userObj *UserServiceImpl) ResetPassword(token, newPassword string) error {
+	reset, err := userObj.passwordReset(token)
+	if err != nil {
+		return err
+	}
+	user, err := userObj.repo.GetUserByUserID(reset.UserID)
+	if err != nil {
+		return err
+	}
+	if err := userObj.isPasswordValid(&models.User{Username: user.Username, Email: user.Email, Password: newPassword}); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := userObj.repo.DeletePasswordReset(reset.UserID); err != nil {
+		return err
+	}
+	if err := userObj.repo.UpdateUserPassword(reset.UserID, string(hash)); err != nil {
+		return err
+	}
+	// whoever knew the old password is logged out
+	if err := userObj.repo.DeleteSessionByUserID(reset.UserID); err != nil {
+		return err
+	}
+	return userObj.failures.DeleteLoginFailure(models.LoginFailureAccount, strconv.Itoa(reset.UserID))
+}
+
+func (userObj *UserServiceImpl) passwordReset(token string) (*models.PasswordReset, error) {
+	reset, err := userObj.repo.GetPasswordResetByTokenHash(hashToken(token))
+	if err != nil {
+		return nil, errors.New("Password reset link is invalid")
+	}
+	if time.Now().After(reset.ExpiresAt) {
+		return nil, errors.New("Password reset link has expired")
+	}
+	return reset, nil
+}
+
+// checkCurrentPassword guards changes to the login details. Wrong guesses count towards the account
+// lockout like failed logins, so a hijacked session cannot be used to find the password.
+// Accounts without a password have nothing to check.
+func (userObj *UserServiceImpl) checkCurrentPassword(user *models.User, password string) error {
+	if user.Password == "" {
+		return nil
+	}
+	accountSubject := strconv.Itoa(user.UserUserID)
+	if err := userObj.checkLocked(models.LoginFailureAccount, accountSubject); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		userObj.recordAccountFailure(user)
+		return errors.New("Current password is incorrect")
+	}
+	return nil
+}
+
+// isUsernameFree reports whether userID (0 for a new account) may take the username: nobody has it
+// now and nobody else had it before.
+func (userObj *UserServiceImpl) isUsernameFree(username string, userID int) (bool, error) {
+	owner, err := userObj.repo.GetUserByUsername(username)
+	if err != nil && err.Error() != errors.New("element with USERNAME not found").Error() {
+		return false, err
+	}
+	if owner != nil {
+		return owner.UserUserID == userID, nil
+	}
+	formerOwner, err := userObj.repo.GetUserIDByOldUsername(username)
+	if err != nil {
+		if err.Error() != errors.New("old username not found").Error() {
+			return false, err
+		}
+		return true, nil
+	}
+	return formerOwner == userID, nil
+}
+
+func (userObj *UserServiceImpl) isEmailFree(email string) error {
+	owner, err := userObj.repo.GetUserByEmail(email)
+	if err != nil && err.Error() != errors.New("element with EMAIL not found").Error() {
+		return err
+	}
+	if owner != nil {
+		return errors.New("This email is already used by another account")
+	}
+	return nil
+}
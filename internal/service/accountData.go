@@ -0,0 +1,532 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/internal/database"
+	"forum/internal/models"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const (
+	dataExportDir      = "./data/exports"
+	dataExportTTL      = 7 * 24 * time.Hour
+	deletionCoolingOff = 7 * 24 * time.Hour
+	accountJobInterval = time.Minute
+)
+
+// AccountDataServiceImpl builds "download my data" archives and carries out account deletions once their
+// cooling-off period is over. Both run as jobs in the background, see RunJobs.
+type AccountDataServiceImpl struct {
+	repo     database.AccountDataRepoInterface
+	users    database.UserRepoInterface
+	posts    database.PostRepoInterface
+	comments database.CommentRepoInterface
+	userSrvc *UserServiceImpl
+	webhooks *WebhookServiceImpl
+	wake     chan struct{}
+}
+
+func CreateNewAccountDataService(repo *database.Repository, userSrvc *UserServiceImpl, webhooks *WebhookServiceImpl) *AccountDataServiceImpl {
+	return &AccountDataServiceImpl{
+		repo:     repo.AccountDataRepoInterface,
+		users:    repo.UserRepoInterface,
+		posts:    repo.PostRepoInterface,
+		comments: repo.CommentRepoInterface,
+		userSrvc: userSrvc,
+		webhooks: webhooks,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (accountObj *AccountDataServiceImpl) RequestDataExport(userID int) error {
+	exports, err := accountObj.repo.GetDataExportsByUserID(userID)
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if export.Status == models.DataExportPending {
+			return errors.New("Your data is already being prepared")
+		}
+	}
+	now := time.Now()
+	_, err = accountObj.repo.CreateDataExport(&models.DataExport{
+		UserID:      userID,
+		Status:      models.DataExportPending,
+		CreatedTime: now,
+		ExpiresAt:   now.Add(dataExportTTL),
+	})
+	if err != nil {
+		return err
+	}
+	accountObj.runSoon()
+	return nil
+}
+
+func (accountObj *AccountDataServiceImpl) GetDataExports(userID int) ([]*models.DataExport, error) {
+	return accountObj.repo.GetDataExportsByUserID(userID)
+}
+
+// GetDataExportFile returns where the finished archive of the user is stored.
+func (accountObj *AccountDataServiceImpl) GetDataExportFile(userID, exportID int) (string, error) {
+	export, err := accountObj.repo.GetDataExportByID(exportID)
+	if err != nil || export.UserID != userID {
+		return "", errors.New("Export not found")
+	}
+	if export.Status != models.DataExportReady || time.Now().After(export.ExpiresAt) {
+		return "", errors.New("Export is not available")
+	}
+	return export.FilePath, nil
+}
+
+// RequestAccountDeletion schedules the deletion after the cooling-off period; until then the owner can cancel it.
+func (accountObj *AccountDataServiceImpl) RequestAccountDeletion(userID int, mode, currentPassword string) (*models.AccountDeletion, error) {
+	if mode != models.DeletionAnonymize && mode != models.DeletionErase {
+		return nil, errors.New("Choose whether your posts and comments are anonymized or erased")
+	}
+	user, err := accountObj.users.GetUserByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	// so the forum cannot be left without an admin
+	if user.Role == models.RoleAdmin {
+		return nil, errors.New("Admins cannot delete their account, another admin has to take away the admin role first")
+	}
+	if err := accountObj.userSrvc.checkCurrentPassword(user, currentPassword); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	deletion := &models.AccountDeletion{
+		UserID:        userID,
+		Mode:          mode,
+		RequestedTime: now,
+		ScheduledTime: now.Add(deletionCoolingOff),
+	}
+	if err := accountObj.repo.SaveAccountDeletion(deletion); err != nil {
+		return nil, err
+	}
+	return deletion, nil
+}
+
+func (accountObj *AccountDataServiceImpl) CancelAccountDeletion(userID int) error {
+	return accountObj.repo.DeleteAccountDeletion(userID)
+}
+
+// GetAccountDeletion returns the deletion the user asked for, or nil.
+func (accountObj *AccountDataServiceImpl) GetAccountDeletion(userID int) (*models.AccountDeletion, error) {
+	deletion, err := accountObj.repo.GetAccountDeletion(userID)
+	if err != nil {
+		if err.Error() != errors.New("account deletion not found").Error() {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return deletion, nil
+}
+
+// RunJobs builds requested exports, removes expired ones and deletes the accounts that are due,
+// every accountJobInterval and whenever an export is requested, until ctx is cancelled.
+func (accountObj *AccountDataServiceImpl) RunJobs(ctx context.Context) {
+	ticker := time.NewTicker(accountJobInterval)
+	defer ticker.Stop()
+	for {
+		accountObj.runJobs(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-accountObj.wake:
+		}
+	}
+}
+
+func (accountObj *AccountDataServiceImpl) runSoon() {
+	select {
+	case accountObj.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (accountObj *AccountDataServiceImpl) runJobs(now time.Time) {
+	pending, err := accountObj.repo.GetPendingDataExports()
+	if err != nil {
+		log.Printf("RunJobs: GetPendingDataExports: %v", err)
+	}
+	for _, export := range pending {
+		if err := accountObj.buildDataExport(export); err != nil {
+			log.Printf("RunJobs: export %d of user %d failed: %v", export.ExportID, export.UserID, err)
+			export.Status = models.DataExportFailed
+			if err := accountObj.repo.UpdateDataExport(export); err != nil {
+				log.Printf("RunJobs: UpdateDataExport: %v", err)
+			}
+		}
+	}
+
+	expired, err := accountObj.repo.GetExpiredDataExports(now)
+	if err != nil {
+		log.Printf("RunJobs: GetExpiredDataExports: %v", err)
+	}
+	for _, export := range expired {
+		accountObj.removeDataExport(export)
+	}
+
+	due, err := accountObj.repo.GetDueAccountDeletions(now)
+	if err != nil {
+		log.Printf("RunJobs: GetDueAccountDeletions: %v", err)
+	}
+	for _, deletion := range due {
+		if err := accountObj.deleteAccount(deletion); err != nil {
+			log.Printf("RunJobs: deleting user %d failed: %v", deletion.UserID, err)
+		}
+	}
+}
+
+func (accountObj *AccountDataServiceImpl) removeDataExport(export *models.DataExport) {
+	if export.FilePath != "" {
+		if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("RunJobs: removing %s: %v", export.FilePath, err)
+			return
+		}
+	}
+	if err := accountObj.repo.DeleteDataExport(export.ExportID); err != nil {
+		log.Printf("RunJobs: DeleteDataExport: %v", err)
+	}
+}
+
+func (accountObj *AccountDataServiceImpl) deleteAccount(deletion *models.AccountDeletion) error {
+	exports, err := accountObj.repo.GetDataExportsByUserID(deletion.UserID)
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		accountObj.removeDataExport(export)
+	}
+
+	if deletion.Mode == models.DeletionErase {
+		// for the webhooks, the posts and their categories are read before they are gone
+		posts, err := accountObj.posts.GetPostsByUserId(deletion.UserID)
+		if err != nil {
+			return err
+		}
+		for _, post := range posts {
+			post.Categories, _ = accountObj.posts.GetCategoriesByPostID(post.PostID)
+		}
+		images, err := accountObj.repo.EraseUserContent(deletion.UserID)
+		if err != nil {
+			return err
+		}
+		for _, post := range posts {
+			accountObj.webhooks.postDeleted(post, deletion.UserID, "account deleted")
+		}
+		for _, image := range images {
+			if err := os.Remove(imageFile(image)); err != nil && !os.IsNotExist(err) {
+				log.Printf("RunJobs: removing image %s: %v", image, err)
+			}
+		}
+	} else if err := accountObj.repo.AnonymizeUserContent(deletion.UserID); err != nil {
+		return err
+	}
+	if err := accountObj.userSrvc.RemoveAvatar(deletion.UserID); err != nil {
+		return err
+	}
+	if err := accountObj.repo.DeleteUserAccount(deletion.UserID); err != nil {
+		return err
+	}
+	log.Printf("Deleted user %d (%s)", deletion.UserID, deletion.Mode)
+	return nil
+}
+
+// imageFile is where an uploaded image, stored in posts as /images/<name>, lives on disk.
+func imageFile(imagePath string) string {
+	return filepath.Join("./data/assets", filepath.FromSlash(path.Clean("/"+imagePath)))
+}
+
+// the JSON files of an export; field names are part of the archive format
+type exportManifest struct {
+	FormatVersion int                  `json:"format_version"`
+	GeneratedAt   time.Time            `json:"generated_at"`
+	UserID        int                  `json:"user_id"`
+	Files         []exportManifestFile `json:"files"`
+}
+
+type exportManifestFile struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Records     int    `json:"records"`
+}
+
+type exportProfile struct {
+	UserID          int                 `json:"user_id"`
+	Username        string              `json:"username"`
+	FormerUsernames []string            `json:"former_usernames"`
+	FirstName       string              `json:"first_name"`
+	SecondName      string              `json:"second_name"`
+	Email           string              `json:"email"`
+	Role            string              `json:"role"`
+	Bio             string              `json:"bio"`
+	JoinedAt        *time.Time          `json:"joined_at"`
+	Avatar          string              `json:"avatar,omitempty"` // path inside the archive
+	HasPassword     bool                `json:"has_password"`
+	ProfilePrivacy  map[string]bool     `json:"profile_privacy"`
+	LinkedAccounts  []exportLinkedLogin `json:"linked_accounts"`
+}
+
+type exportLinkedLogin struct {
+	Provider string    `json:"provider"`
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+type exportPost struct {
+	PostID      int       `json:"post_id"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	Categories  []string  `json:"categories"`
+	CreatedTime time.Time `json:"created_time"`
+	Likes       int       `json:"likes"`
+	Dislikes    int       `json:"dislikes"`
+	Approved    bool      `json:"approved"`
+	Image       string    `json:"image,omitempty"` // path inside the archive
+}
+
+type exportComment struct {
+	CommentID   int       `json:"comment_id"`
+	PostID      int       `json:"post_id"`
+	Content     string    `json:"content"`
+	CreatedTime time.Time `json:"created_time"`
+	Likes       int       `json:"likes"`
+	Dislikes    int       `json:"dislikes"`
+	Approved    bool      `json:"approved"`
+}
+
+type exportReaction struct {
+	PostID    int    `json:"post_id,omitempty"`
+	CommentID int    `json:"comment_id,omitempty"`
+	Reaction  string `json:"reaction"`
+}
+
+// buildDataExport writes the archive of one export: manifest.json, profile.json, posts.json,
+// comments.json, reactions.json, the uploaded images under images/ and the avatar.
+func (accountObj *AccountDataServiceImpl) buildDataExport(export *models.DataExport) error {
+	userID := export.UserID
+	user, err := accountObj.users.GetUserByUserID(userID)
+	if err != nil {
+		return err
+	}
+	formerUsernames, err := accountObj.repo.GetOldUsernamesByUserID(userID)
+	if err != nil {
+		return err
+	}
+	privacy, err := accountObj.users.GetProfilePrivacy(userID)
+	if err != nil {
+		return err
+	}
+	identities, err := accountObj.users.GetUserIdentitiesByUserID(userID)
+	if err != nil {
+		return err
+	}
+	userProfile, err := accountObj.users.GetUserProfile(userID)
+	if err != nil {
+		return err
+	}
+	profile := exportProfile{
+		UserID:          user.UserUserID,
+		Username:        user.Username,
+		FormerUsernames: formerUsernames,
+		FirstName:       user.FirstName,
+		SecondName:      user.SecondName,
+		Email:           user.Email,
+		Role:            user.Role,
+		HasPassword:     user.Password != "",
+		Bio:             userProfile.Bio,
+		ProfilePrivacy: map[string]bool{
+			"show_posts":     privacy.ShowPosts,
+			"show_comments":  privacy.ShowComments,
+			"show_reactions": privacy.ShowReactions,
+			"show_stats":     privacy.ShowStats,
+		},
+		LinkedAccounts: []exportLinkedLogin{},
+	}
+	if !userProfile.JoinedTime.IsZero() {
+		profile.JoinedAt = &userProfile.JoinedTime
+	}
+	var avatarFile string
+	if userProfile.AvatarPath != "" {
+		profile.Avatar = "avatar" + path.Ext(userProfile.AvatarPath)
+		avatarFile = imageFile(userProfile.AvatarPath)
+	}
+	for _, identity := range identities {
+		profile.LinkedAccounts = append(profile.LinkedAccounts, exportLinkedLogin{identity.Provider, identity.Email, identity.CreatedTime})
+	}
+
+	posts, err := accountObj.posts.GetPostsByUserId(userID)
+	if err != nil {
+		return err
+	}
+	exportPosts := []exportPost{}
+	images := map[string]string{} // name in the archive -> file on disk
+	for _, post := range posts {
+		categories, err := accountObj.posts.GetCategoriesByPostID(post.PostID)
+		if err != nil {
+			return err
+		}
+		item := exportPost{
+			PostID:      post.PostID,
+			Title:       post.Title,
+			Content:     post.Content,
+			Categories:  categories,
+			CreatedTime: post.CreatedTime,
+			Likes:       post.LikesCounter,
+			Dislikes:    post.DislikeCounter,
+			Approved:    post.IsApproved == 1,
+		}
+		if post.ImagePath != "" {
+			item.Image = "images/" + path.Base(post.ImagePath)
+			images[item.Image] = imageFile(post.ImagePath)
+		}
+		exportPosts = append(exportPosts, item)
+	}
+
+	comments, err := accountObj.comments.GetCommentByUserID(userID)
+	if err != nil {
+		return err
+	}
+	exportComments := []exportComment{}
+	for _, comment := range comments {
+		exportComments = append(exportComments, exportComment{
+			CommentID:   comment.CommentID,
+			PostID:      comment.PostID,
+			Content:     comment.Content,
+			CreatedTime: comment.CreatedTime,
+			Likes:       comment.LikesCounter,
+			Dislikes:    comment.DislikeCounter,
+			Approved:    comment.IsApproved == 1,
+		})
+	}
+
+	postReactions, err := accountObj.posts.GetMyReactedPosts(userID)
+	if err != nil {
+		return err
+	}
+	commentReactions, err := accountObj.comments.GetMyReactedComments(userID)
+	if err != nil {
+		return err
+	}
+	reactions := []exportReaction{}
+	for postID, reaction := range postReactions {
+		reactions = append(reactions, exportReaction{PostID: postID, Reaction: reactionName(reaction)})
+	}
+	for commentID, reaction := range commentReactions {
+		reactions = append(reactions, exportReaction{CommentID: commentID, Reaction: reactionName(reaction)})
+	}
+
+	if err := os.MkdirAll(dataExportDir, 0o700); err != nil {
+		return err
+	}
+	name, err := randomToken()
+	if err != nil {
+		return err
+	}
+	filePath := filepath.Join(dataExportDir, name+".zip")
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	archive := zip.NewWriter(file)
+
+	manifest := exportManifest{FormatVersion: 1, GeneratedAt: time.Now().UTC(), UserID: userID}
+	files := []struct {
+		name, description string
+		records           int
+		content           interface{}
+	}{
+		{"profile.json", "account details, public profile, linked login providers and privacy settings", 1, profile},
+		{"posts.json", "posts you wrote; images are in the images folder", len(exportPosts), exportPosts},
+		{"comments.json", "comments you wrote", len(exportComments), exportComments},
+		{"reactions.json", "your likes and dislikes on posts and comments", len(reactions), reactions},
+	}
+	for _, f := range files {
+		if err = writeZipJSON(archive, f.name, f.content); err != nil {
+			break
+		}
+		manifest.Files = append(manifest.Files, exportManifestFile{f.name, f.description, f.records})
+	}
+	for name, source := range images {
+		if err != nil {
+			break
+		}
+		var copied bool
+		if copied, err = copyIntoZip(archive, name, source); err == nil && copied {
+			manifest.Files = append(manifest.Files, exportManifestFile{name, "image attached to one of your posts", 1})
+		}
+	}
+	if err == nil && avatarFile != "" {
+		var copied bool
+		if copied, err = copyIntoZip(archive, profile.Avatar, avatarFile); err == nil && copied {
+			manifest.Files = append(manifest.Files, exportManifestFile{profile.Avatar, "your profile picture", 1})
+		}
+	}
+	if err == nil {
+		err = writeZipJSON(archive, "manifest.json", manifest)
+	}
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return err
+	}
+
+	export.Status = models.DataExportReady
+	export.FilePath = filePath
+	export.ExpiresAt = time.Now().Add(dataExportTTL)
+	return accountObj.repo.UpdateDataExport(export)
+}
+
+func writeZipJSON(archive *zip.Writer, name string, content interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(content)
+}
+
+// copyIntoZip adds the file to the archive. An image that is gone from disk is skipped.
+func copyIntoZip(archive *zip.Writer, name, source string) (bool, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+	w, err := archive.Create(name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		return false, fmt.Errorf("copying %s: %w", source, err)
+	}
+	return true, nil
+}
+
+func reactionName(reaction int) string {
+	if reaction == 1 {
+		return "like"
+	}
+	return "dislike"
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+	"forum/internal/models"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Erasing an account takes its mail out of the queue, the confirmation of a new address included,
+// and tells the webhooks about every post that goes with it.
+func TestEraseAccount(t *testing.T) {
+	srv, repo := newTestService(t)
+	user := lockoutUser(t, repo)
+	adminID, err := repo.UserRepoInterface.CreateUserRepo(&models.User{Username: "admin", Email: "admin@example.com", Role: models.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := newWebhookReceiver(t)
+	webhook, err := srv.WebhookServiceInterface.CreateWebhook(int(adminID), receiver.server.URL, []string{models.WebhookPostDeleted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postIDs := []int{}
+	for _, approved := range []int{1, 0} {
+		id, err := repo.PostRepoInterface.CreatePostRepo(&models.Post{
+			UserID: user.UserUserID, Title: "A post", Content: "Some content", CreatedTime: time.Now(), IsApproved: approved,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		postIDs = append(postIDs, int(id))
+	}
+	if err := srv.UserServiceInterface.RequestPasswordReset(user.Email); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.UserServiceInterface.RequestEmailChange(user.UserUserID, "new@example.com", "the right password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.UserServiceInterface.RequestPasswordReset("admin@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if mails := queuedMails(t, repo); len(mails) != 3 {
+		t.Fatalf("%d mails queued, want 3", len(mails))
+	}
+
+	accounts := srv.AccountDataServiceInterface.(*AccountDataServiceImpl)
+	if _, err := accounts.RequestAccountDeletion(user.UserUserID, models.DeletionErase, "the right password"); err != nil {
+		t.Fatal(err)
+	}
+	accounts.runJobs(time.Now().Add(deletionCoolingOff + time.Minute))
+	if _, err := repo.UserRepoInterface.GetUserByUserID(user.UserUserID); err == nil {
+		t.Fatal("the account is still there")
+	}
+
+	if mails := queuedMails(t, repo); len(mails) != 1 || mails[0].To != "admin@example.com" {
+		t.Errorf("mails left %+v", mails)
+	}
+
+	deliveries, err := srv.WebhookServiceInterface.GetWebhookDeliveries(webhook.WebhookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted := []int{}
+	for _, delivery := range deliveries {
+		var payload struct {
+			Event string `json:"event"`
+			Data  struct {
+				Post struct {
+					ID int `json:"id"`
+				} `json:"post"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.Event != models.WebhookPostDeleted {
+			t.Errorf("event %q", payload.Event)
+		}
+		deleted = append(deleted, payload.Data.Post.ID)
+	}
+	sort.Ints(deleted)
+	if len(deleted) != len(postIDs) || deleted[0] != postIDs[0] || deleted[1] != postIDs[1] {
+		t.Errorf("post_deleted for %v, want %v", deleted, postIDs)
+	}
+}
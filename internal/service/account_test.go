@@ -0,0 +1,222 @@
+package service
+
+import (
+	"forum/internal/database"
+	"forum/internal/models"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// mailedToken returns the token of the last link to path mailed to the address.
+func mailedToken(t *testing.T, repo *database.Repository, to, path string) string {
+	t.Helper()
+	link := regexp.MustCompile(regexp.QuoteMeta(path) + `([0-9a-f]+)`)
+	token := ""
+	for _, mail := range queuedMails(t, repo) {
+		if match := link.FindStringSubmatch(mail.Text); mail.To == to && match != nil {
+			token = match[1]
+		}
+	}
+	if token == "" {
+		t.Fatalf("no link to %s mailed to %s", path, to)
+	}
+	return token
+}
+
+func TestPasswordReset(t *testing.T) {
+	srv, repo := newTestService(t)
+	users := srv.UserServiceInterface.(*UserServiceImpl)
+	user := lockoutUser(t, repo)
+	session := &models.Session{UserID: user.UserUserID, Token: uuid.NewString(), ExpTime: time.Now().Add(time.Hour)}
+	if err := repo.UserRepoInterface.CreateSession(session); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < accountLockThreshold; i++ {
+		users.recordAccountFailure(user)
+	}
+
+	// nobody learns whether an address is registered
+	if err := users.RequestPasswordReset("nobody@example.com"); err != nil {
+		t.Errorf("unknown address: %v", err)
+	}
+	if err := users.RequestPasswordReset(user.Email); err != nil {
+		t.Fatal(err)
+	}
+	token := mailedToken(t, repo, user.Email, "/reset_password/")
+	if err := users.CheckPasswordReset(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// the policy applies, and a refused password leaves the link working
+	if err := users.ResetPassword(token, "short"); err == nil {
+		t.Error("password shorter than the policy allows accepted")
+	}
+	if err := users.ResetPassword(token, "owner-forgot-it"); err == nil {
+		t.Error("password containing the username accepted")
+	}
+	if err := users.ResetPassword(token, "a new long passphrase"); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := repo.UserRepoInterface.GetUserByUserID(user.UserUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(changed.Password), []byte("a new long passphrase")) != nil {
+		t.Error("password not changed")
+	}
+	if _, err := repo.UserRepoInterface.GetSessionByToken(session.Token); err == nil {
+		t.Error("session survived the reset")
+	}
+	if err := users.checkLocked(models.LoginFailureAccount, strconv.Itoa(user.UserUserID)); err != nil {
+		t.Errorf("still locked: %v", err)
+	}
+	if err := users.ResetPassword(token, "yet another passphrase"); err == nil {
+		t.Error("token used twice")
+	}
+}
+
+func TestPasswordResetExpires(t *testing.T) {
+	srv, repo := newTestService(t)
+	users := srv.UserServiceInterface.(*UserServiceImpl)
+	user := lockoutUser(t, repo)
+	err := repo.UserRepoInterface.SavePasswordReset(&models.PasswordReset{
+		TokenHash: hashToken("expired"),
+		UserID:    user.UserUserID,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.ResetPassword("expired", "a new long passphrase"); err == nil || err.Error() != "Password reset link has expired" {
+		t.Errorf("expired token: %v", err)
+	}
+	if err := users.CheckPasswordReset("never mailed"); err == nil {
+		t.Error("unknown token accepted")
+	}
+}
+
+// A username stays with its account after a rename: nobody else can take it, it still finds the
+// account, and only the account itself can take it back.
+func TestChangeUsername(t *testing.T) {
+	srv, repo := newTestService(t)
+	users := srv.UserServiceInterface.(*UserServiceImpl)
+	owner := lockoutUser(t, repo)
+	otherID, err := repo.UserRepoInterface.CreateUserRepo(&models.User{Username: "other", Email: "other@example.com", Role: models.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := int(otherID)
+
+	if err := users.ChangeUsername(owner.UserUserID, "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if user, err := users.GetUserByUsername("renamed"); err != nil || user.UserUserID != owner.UserUserID {
+		t.Errorf("GetUserByUsername(renamed) = %+v, %v", user, err)
+	}
+	if user, err := users.GetUserByFormerUsername("owner"); err != nil || user.UserUserID != owner.UserUserID {
+		t.Errorf("GetUserByFormerUsername(owner) = %+v, %v", user, err)
+	}
+	if _, err := users.GetUserByFormerUsername("other"); err == nil {
+		t.Error("a current username found as a former one")
+	}
+
+	for _, username := range []string{"owner", "renamed"} {
+		if err := users.ChangeUsername(other, username); err == nil || err.Error() != "This username is already taken" {
+			t.Errorf("renaming another account to %s: %v", username, err)
+		}
+		if free, err := users.isUsernameFree(username, 0); err != nil || free {
+			t.Errorf("isUsernameFree(%s) for a new account = %t, %v", username, free, err)
+		}
+	}
+	if free, err := users.isUsernameFree("nobody", 0); err != nil || !free {
+		t.Errorf("isUsernameFree(nobody) = %t, %v", free, err)
+	}
+
+	// the owner may go back to the old name, after which the other one is held for them
+	if err := users.ChangeUsername(owner.UserUserID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.ChangeUsername(other, "renamed"); err == nil {
+		t.Error("another account took the name given up")
+	}
+	if user, err := users.GetUserByUserID(owner.UserUserID); err != nil || user.Username != "owner" {
+		t.Errorf("user %+v, %v", user, err)
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	srv, repo := newTestService(t)
+	users := srv.UserServiceInterface.(*UserServiceImpl)
+	owner := lockoutUser(t, repo)
+	if _, err := repo.UserRepoInterface.CreateUserRepo(&models.User{Username: "other", Email: "other@example.com", Role: models.RoleUser}); err != nil {
+		t.Fatal(err)
+	}
+	email := func() string {
+		t.Helper()
+		user, err := users.GetUserByUserID(owner.UserUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.Email
+	}
+
+	if err := users.RequestEmailChange(owner.UserUserID, "new@example.com", "a guess"); err == nil {
+		t.Error("changed without the current password")
+	}
+	if err := users.RequestEmailChange(owner.UserUserID, "other@example.com", "the right password"); err == nil {
+		t.Error("asked for the address of another account")
+	}
+	if err := users.RequestEmailChange(owner.UserUserID, "new@example.com", "the right password"); err != nil {
+		t.Fatal(err)
+	}
+	if email() != owner.Email {
+		t.Fatal("the address changed before it was confirmed")
+	}
+	token := mailedToken(t, repo, "new@example.com", "/confirm_email/")
+	if err := users.ConfirmEmailChange(token); err != nil {
+		t.Fatal(err)
+	}
+	if email() != "new@example.com" {
+		t.Errorf("address %s after the confirmation", email())
+	}
+	if err := users.ConfirmEmailChange(token); err == nil || err.Error() != "Confirmation link is invalid" {
+		t.Errorf("reused token: %v", err)
+	}
+
+	err := repo.UserRepoInterface.SaveEmailChange(&models.EmailChange{
+		TokenHash: hashToken("expired"),
+		UserID:    owner.UserUserID,
+		NewEmail:  "late@example.com",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.ConfirmEmailChange("expired"); err == nil || err.Error() != "Confirmation link has expired" {
+		t.Errorf("expired token: %v", err)
+	}
+	if err := users.ConfirmEmailChange("expired"); err == nil || err.Error() != "Confirmation link is invalid" {
+		t.Errorf("expired token used again: %v", err)
+	}
+
+	// somebody registers with the address before it is confirmed
+	if err := users.RequestEmailChange(owner.UserUserID, "claimed@example.com", "the right password"); err != nil {
+		t.Fatal(err)
+	}
+	token = mailedToken(t, repo, "claimed@example.com", "/confirm_email/")
+	if _, err := repo.UserRepoInterface.CreateUserRepo(&models.User{Username: "claimer", Email: "claimed@example.com", Role: models.RoleUser}); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.ConfirmEmailChange(token); err == nil || err.Error() != "This email is already used by another account" {
+		t.Errorf("claimed address: %v", err)
+	}
+	if email() != "new@example.com" {
+		t.Errorf("address %s after confirming a claimed one", email())
+	}
+}
@@ -9,11 +9,14 @@ import (
 )
 
 type CommentServiceImpl struct {
-	repo database.CommentRepoInterface
+	repo          database.CommentRepoInterface
+	policy        *PolicyServiceImpl
+	notifications *NotificationServiceImpl
+	webhooks      *WebhookServiceImpl
 }
 
-func CreateNewCommentService(repo database.CommentRepoInterface) *CommentServiceImpl {
-	commentService := CommentServiceImpl{repo: repo}
+func CreateNewCommentService(repo database.CommentRepoInterface, policy *PolicyServiceImpl, notifications *NotificationServiceImpl, webhooks *WebhookServiceImpl) *CommentServiceImpl {
+	commentService := CommentServiceImpl{repo: repo, policy: policy, notifications: notifications, webhooks: webhooks}
 	return &commentService
 }
 
@@ -26,7 +29,7 @@ func (cmtObj *CommentServiceImpl) CreateComment(comment *models.Comment, userRol
 	comment.DislikeCounter = 0
 	comment.ReportStatus = 0
 
-	if userRole == "admin" || userRole == "moderator" {
+	if models.RoleHasPermission(userRole, models.PermSkipApproval) {
 		comment.IsApproved = 1
 	} else {
 		comment.IsApproved = 0
@@ -39,6 +42,8 @@ func (cmtObj *CommentServiceImpl) CreateComment(comment *models.Comment, userRol
 		return http.StatusInternalServerError, -1, err
 	}
 	comment.CommentID = int(id)
+	cmtObj.notifications.comment(comment.CommentID)
+	cmtObj.webhooks.commentCreated(comment)
 	return http.StatusOK, int(id), nil
 }
 
@@ -86,6 +91,9 @@ func (cmtObj *CommentServiceImpl) UpdateReaction(currReaction, commentID, userID
 			cmtObj.repo.UpdateDislikesCounter(commentID, 1)
 		}
 	}
+	if err == nil && prevReaction != currReaction {
+		cmtObj.notifications.commentReaction(commentID, userID, currReaction)
+	}
 	return err
 }
 
@@ -113,23 +121,51 @@ func (cmtObj *CommentServiceImpl) DeleteAllCommentVotesByCommentID(commentID int
 	return nil
 }
 
-func (cmtObj *CommentServiceImpl) DeleteCommentByCommentID(commentID int) error {
-	err := cmtObj.repo.DeleteCommentByCommentID(commentID)
+// DeleteCommentByCommentID deletes a comment. When a moderator deletes the comment of somebody else
+// the author is told, with the reason if one is given.
+func (cmtObj *CommentServiceImpl) DeleteCommentByCommentID(userID int, scope models.TokenScope, commentID int, reason string) error {
+	if err := cmtObj.policy.Authorize(userID, scope, models.ActionDelete, models.ResourceComment, commentID); err != nil {
+		return err
+	}
+	comment, err := cmtObj.repo.GetCommentByID(commentID)
+	if err != nil {
+		return err
+	}
+	err = cmtObj.repo.DeleteCommentByCommentID(commentID)
 	if err != nil {
 		return err
 	}
+	if comment.IsApproved == 1 {
+		cmtObj.notifications.commentModerated(models.NotificationDeleted, userID, comment, reason)
+	} else {
+		cmtObj.notifications.commentModerated(models.NotificationRejected, userID, comment, reason)
+	}
 	return nil
 }
 
-func (cmtObj *CommentServiceImpl) ApproveComment(commentID int) error {
-	err := cmtObj.repo.UpdateIsApproveCommentStatus(commentID)
+func (cmtObj *CommentServiceImpl) ApproveComment(userID int, scope models.TokenScope, commentID int) error {
+	if err := cmtObj.policy.Authorize(userID, scope, models.ActionApprove, models.ResourceComment, commentID); err != nil {
+		return err
+	}
+	comment, err := cmtObj.repo.GetCommentByID(commentID)
+	if err != nil {
+		return err
+	}
+	err = cmtObj.repo.UpdateIsApproveCommentStatus(commentID)
 	if err != nil {
 		return err
 	}
+	if comment.IsApproved != 1 {
+		cmtObj.notifications.commentModerated(models.NotificationApproved, userID, comment, "")
+		cmtObj.notifications.comment(commentID)
+	}
 	return nil
 }
 
-func (cmtObj *CommentServiceImpl) UpdateCommentContentByPostID(intCommentID int, content string) error {
+func (cmtObj *CommentServiceImpl) UpdateCommentContentByPostID(userID int, scope models.TokenScope, intCommentID int, content string) error {
+	if err := cmtObj.policy.Authorize(userID, scope, models.ActionEdit, models.ResourceComment, intCommentID); err != nil {
+		return err
+	}
 	err := cmtObj.repo.UpdateCommentContentByPostID(intCommentID, content)
 	if err != nil {
 		return err
@@ -160,3 +196,7 @@ func(cmtObj *CommentServiceImpl) GetCommentByUserID(userID int) ([]*models.Comme
 	}
 	return comments,nil
 }
+
+func (cmtObj *CommentServiceImpl) GetUnapprovedComments() ([]*models.Comment, error) {
+	return cmtObj.repo.GetUnapprovedComments()
+}
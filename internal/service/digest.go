@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"forum/internal/database"
+	"forum/internal/models"
+	"log"
+	"time"
+)
+
+const (
+	digestJobInterval       = time.Hour
+	digestNotificationLimit = 30
+	digestNewPostLimit      = 10
+	digestTopPostLimit      = 5
+	digestExcerptLength     = 200
+	digestItemRetention     = 180 * 24 * time.Hour // as long as unread notifications are kept
+)
+
+// DigestServiceImpl sends the daily and weekly digest e-mails users opt in to: their unread
+// notifications of the types they want in the digest, new posts of the categories they follow and the
+// top posts of the period. What a digest contained is recorded and never sent again.
+type DigestServiceImpl struct {
+	repo          database.DigestRepoInterface
+	notifications database.NotificationRepoInterface
+	users         database.UserRepoInterface
+	posts         database.PostRepoInterface
+	mail          *MailServiceImpl
+}
+
+func CreateNewDigestService(repo *database.Repository, mail *MailServiceImpl) *DigestServiceImpl {
+	return &DigestServiceImpl{
+		repo:          repo.DigestRepoInterface,
+		notifications: repo.NotificationRepoInterface,
+		users:         repo.UserRepoInterface,
+		posts:         repo.PostRepoInterface,
+		mail:          mail,
+	}
+}
+
+func (digestObj *DigestServiceImpl) GetDigestSettings(userID int) (*models.DigestSettings, error) {
+	return digestObj.repo.GetDigestSettings(userID)
+}
+
+func (digestObj *DigestServiceImpl) UpdateDigestSettings(settings *models.DigestSettings) error {
+	if models.DigestPeriod(settings.Frequency) == 0 && settings.Frequency != models.DigestOff {
+		return errors.New("Choose daily, weekly or no digest")
+	}
+	categories, err := digestObj.posts.GetAllCategories()
+	if err != nil {
+		return err
+	}
+	for _, categoryID := range settings.CategoryIDs {
+		found := false
+		for _, category := range categories {
+			found = found || category.CategoryID == categoryID
+		}
+		if !found {
+			return errors.New("Category does not exist")
+		}
+	}
+	return digestObj.repo.SaveDigestSettings(settings, time.Now())
+}
+
+// RunDigestJobs sends the digests that are due every digestJobInterval until ctx is cancelled.
+func (digestObj *DigestServiceImpl) RunDigestJobs(ctx context.Context) {
+	ticker := time.NewTicker(digestJobInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		due, err := digestObj.repo.GetDueDigests(now)
+		if err != nil {
+			log.Printf("RunDigestJobs: GetDueDigests: %v", err)
+		}
+		for _, settings := range due {
+			if err := digestObj.sendDigest(settings, now); err != nil {
+				log.Printf("RunDigestJobs: digest of user %d: %v", settings.UserID, err)
+			}
+		}
+		if _, err := digestObj.repo.DeleteOldDigestItems(now.Add(-digestItemRetention)); err != nil {
+			log.Printf("RunDigestJobs: DeleteOldDigestItems: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDigest queues the digest of one user. Empty digests are not sent, the next period starts anyway.
+func (digestObj *DigestServiceImpl) sendDigest(settings *models.DigestSettings, now time.Time) error {
+	digest, err := digestObj.buildDigest(settings)
+	if err != nil {
+		return err
+	}
+	user, err := digestObj.users.GetUserByUserID(settings.UserID)
+	if err != nil {
+		return err
+	}
+	if !digest.Empty() && user.Email != "" {
+		notifications := []digestNotification{}
+		for _, notification := range digest.Notifications {
+			item := digestNotification{Message: notification.Message()}
+			if path := notification.Link(); path != "" {
+				item.Link = digestObj.mail.URL(path)
+			}
+			notifications = append(notifications, item)
+		}
+		err := digestObj.mail.send(user.Email, "digest", map[string]interface{}{
+			"Username":      user.Username,
+			"Frequency":     settings.Frequency,
+			"Notifications": notifications,
+			"NewPosts":      digestObj.digestPosts(digest.NewPosts),
+			"TopPosts":      digestObj.digestPosts(digest.TopPosts),
+			"SettingsLink":  digestObj.mail.URL("/notification_settings"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return digestObj.repo.MarkDigestSent(digest, now)
+}
+
+func (digestObj *DigestServiceImpl) buildDigest(settings *models.DigestSettings) (*models.Digest, error) {
+	digest := &models.Digest{Settings: settings, Since: settings.LastSentTime}
+
+	preferences, err := digestObj.notifications.GetNotificationPreferences(settings.UserID)
+	if err != nil {
+		return nil, err
+	}
+	types := []string{}
+	for _, kind := range models.NotificationTypes {
+		if preferences.Delivery(kind.Type) == models.DeliveryEmailDigest {
+			types = append(types, kind.Type)
+		}
+	}
+	if digest.Notifications, err = digestObj.repo.GetDigestNotifications(settings.UserID, types, digestNotificationLimit); err != nil {
+		return nil, err
+	}
+	if digest.NewPosts, err = digestObj.repo.GetDigestNewPosts(settings.UserID, digest.Since, digestNewPostLimit); err != nil {
+		return nil, err
+	}
+	topPosts, err := digestObj.repo.GetDigestTopPosts(settings.UserID, digest.Since, digestTopPostLimit+len(digest.NewPosts))
+	if err != nil {
+		return nil, err
+	}
+	// a new post that is also a top post is told about once, among the top posts
+	isTop := map[int]bool{}
+	for _, post := range topPosts {
+		if len(digest.TopPosts) < digestTopPostLimit {
+			digest.TopPosts = append(digest.TopPosts, post)
+			isTop[post.PostID] = true
+		}
+	}
+	newPosts := []*models.Post{}
+	for _, post := range digest.NewPosts {
+		if !isTop[post.PostID] {
+			newPosts = append(newPosts, post)
+		}
+	}
+	digest.NewPosts = newPosts
+	return digest, nil
+}
+
+// digestNotification and digestPost are the items of the digest template.
+type digestNotification struct {
+	Message string
+	Link    string
+}
+
+type digestPost struct {
+	Title    string
+	Author   string
+	Excerpt  string
+	Link     string
+	Likes    int
+	Dislikes int
+}
+
+func (digestObj *DigestServiceImpl) digestPosts(posts []*models.Post) []digestPost {
+	items := []digestPost{}
+	for _, post := range posts {
+		items = append(items, digestPost{
+			Title:    post.Title,
+			Author:   post.Username,
+			Excerpt:  post.Excerpt(digestExcerptLength),
+			Link:     digestObj.mail.URL(post.Permalink()),
+			Likes:    post.LikesCounter,
+			Dislikes: post.DislikeCounter,
+		})
+	}
+	return items
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"forum/internal/database"
+	"forum/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addDigestPost adds an approved post of the author in the category, with likes to make it a top post.
+func addDigestPost(t *testing.T, repo *database.Repository, authorID int, title, category string, likes int) {
+	t.Helper()
+	id, err := repo.PostRepoInterface.CreatePostRepo(&models.Post{
+		UserID: authorID, Title: title, Content: "About " + title, CreatedTime: time.Now(), IsApproved: 1, LikesCounter: likes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.PostRepoInterface.CreatePostCategory([]string{category}, int(id)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// notifyComment adds an unread notification of a comment on the reader's post.
+func notifyComment(t *testing.T, repo *database.Repository, userID int, postTitle string) {
+	t.Helper()
+	_, err := repo.NotificationRepoInterface.CreateNotification(&models.Notification{
+		UserID: userID, Type: models.NotificationPostComment, TargetType: models.ResourcePost,
+		Payload: models.NotificationPayload{PostTitle: postTitle}, CreatedTime: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A digest tells about an item once: a second run right after the first sends nothing, a later one
+// only what is new. Runs without anything to send still start the next period.
+func TestDigestSendsEveryItemOnce(t *testing.T) {
+	srv, repo := newTestService(t)
+	digests := srv.DigestServiceInterface.(*DigestServiceImpl)
+	reader := lockoutUser(t, repo)
+	authorID, err := repo.UserRepoInterface.CreateUserRepo(&models.User{Username: "author", Email: "author@example.com", Role: models.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	categoryID, err := repo.PostRepoInterface.CreateCategory("tea")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = digests.UpdateDigestSettings(&models.DigestSettings{UserID: reader.UserUserID, Frequency: models.DigestDaily, CategoryIDs: []int{int(categoryID)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.NotificationRepoInterface.UpdateNotificationPreferences(&models.NotificationPreferences{
+		UserID: reader.UserUserID, Deliveries: map[string]string{models.NotificationPostComment: models.DeliveryEmailDigest},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// run sends the digest that is due at now and returns the text of the mail it queued, "" for none
+	sent := 0
+	run := func(now time.Time) string {
+		t.Helper()
+		settings, err := digests.GetDigestSettings(reader.UserUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := digests.sendDigest(settings, now); err != nil {
+			t.Fatal(err)
+		}
+		if settings, err = digests.GetDigestSettings(reader.UserUserID); err != nil {
+			t.Fatal(err)
+		}
+		if !settings.LastSentTime.Equal(now) {
+			t.Errorf("last sent at %v, want %v", settings.LastSentTime, now)
+		}
+		mails := queuedMails(t, repo)
+		if len(mails) == sent {
+			return ""
+		}
+		sent = len(mails)
+		return mails[len(mails)-1].Text // the queue is in the order of sending
+	}
+
+	addDigestPost(t, repo, int(authorID), "Green tea", "tea", 0)
+	addDigestPost(t, repo, int(authorID), "Oolong", "tea", 3)
+	notifyComment(t, repo, reader.UserUserID, "Darjeeling")
+	first := time.Now().Round(0)
+	text := run(first)
+	if !strings.Contains(text, "Green tea") || !strings.Contains(text, "Oolong") || !strings.Contains(text, "Darjeeling") {
+		t.Fatalf("first digest %q", text)
+	}
+
+	second := time.Now().Round(0)
+	if text := run(second); text != "" {
+		t.Errorf("second digest %q, want none", text)
+	}
+	due, err := digests.repo.GetDueDigests(second.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Errorf("due again an hour after an empty digest: %+v", due[0])
+	}
+
+	time.Sleep(10 * time.Millisecond) // so the new post is not older than the second run
+	addDigestPost(t, repo, int(authorID), "Black tea", "tea", 0)
+	notifyComment(t, repo, reader.UserUserID, "Assam")
+	text = run(time.Now().Round(0))
+	if !strings.Contains(text, "Black tea") || !strings.Contains(text, "Assam") {
+		t.Errorf("third digest %q", text)
+	}
+	if strings.Contains(text, "Green tea") || strings.Contains(text, "Oolong") || strings.Contains(text, "Darjeeling") {
+		t.Errorf("third digest %q", text)
+	}
+}
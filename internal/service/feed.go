@@ -0,0 +1,153 @@
+package service
+
+import (
+	"errors"
+	"forum/internal/database"
+	"forum/internal/models"
+	"html"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const feedLength = 20 // entries per feed
+
+// ErrFeedNotFound is returned for feeds of categories and users that do not exist, and of users who
+// keep their posts off their profile.
+var ErrFeedNotFound = errors.New("feed not found")
+
+// FeedServiceImpl builds the Atom and RSS feeds of approved posts. Which format is sent is up to the
+// handler, both are built from the same models.Feed.
+type FeedServiceImpl struct {
+	repo     database.FeedRepoInterface
+	userRepo database.UserRepoInterface
+	postRepo database.PostRepoInterface
+	baseURL  string
+}
+
+func CreateNewFeedService(repo *database.Repository, baseURL string) *FeedServiceImpl {
+	return &FeedServiceImpl{
+		repo:     repo.FeedRepoInterface,
+		userRepo: repo.UserRepoInterface,
+		postRepo: repo.PostRepoInterface,
+		baseURL:  baseURL,
+	}
+}
+
+func (feedObj *FeedServiceImpl) GetFrontPageFeed() (*models.Feed, error) {
+	posts, err := feedObj.repo.GetFeedPosts("", 0, feedLength)
+	if err != nil {
+		return nil, err
+	}
+	return feedObj.feed("Forum", "The latest posts", "/", "", posts), nil
+}
+
+func (feedObj *FeedServiceImpl) GetCategoryFeed(category string) (*models.Feed, error) {
+	categories, err := feedObj.postRepo.GetAllCategories()
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, existing := range categories {
+		found = found || existing.Category == category
+	}
+	if !found {
+		return nil, ErrFeedNotFound
+	}
+	posts, err := feedObj.repo.GetFeedPosts(category, 0, feedLength)
+	if err != nil {
+		return nil, err
+	}
+	return feedObj.feed("Forum: "+category, "The latest posts in "+category,
+		"/filter/"+url.PathEscape(category), "/feeds/categories/"+url.PathEscape(category), posts), nil
+}
+
+func (feedObj *FeedServiceImpl) GetUserFeed(username string) (*models.Feed, error) {
+	user, err := feedObj.userRepo.GetUserByUsername(username)
+	if err != nil || user.Role == models.RoleDeleted {
+		return nil, ErrFeedNotFound
+	}
+	// the feed shows no more than the public profile does
+	privacy, err := feedObj.userRepo.GetProfilePrivacy(user.UserUserID)
+	if err != nil {
+		return nil, err
+	}
+	if !privacy.ShowPosts {
+		return nil, ErrFeedNotFound
+	}
+	posts, err := feedObj.repo.GetFeedPosts("", user.UserUserID, feedLength)
+	if err != nil {
+		return nil, err
+	}
+	return feedObj.feed("Forum: posts by "+user.Username, "The latest posts by "+user.Username,
+		"/u/"+url.PathEscape(user.Username), "/feeds/users/"+url.PathEscape(user.Username), posts), nil
+}
+
+// feed turns posts into a feed. feedPath is where feed.xml and rss.xml of the feed are, "" for the root.
+func (feedObj *FeedServiceImpl) feed(title, subtitle, pagePath, feedPath string, posts []*models.Post) *models.Feed {
+	feed := &models.Feed{
+		Title:    title,
+		Subtitle: subtitle,
+		Link:     feedObj.baseURL + pagePath,
+		AtomURL:  feedObj.baseURL + feedPath + "/feed.xml",
+		RSSURL:   feedObj.baseURL + feedPath + "/rss.xml",
+		Entries:  []*models.FeedEntry{},
+	}
+	for _, post := range posts {
+		entry := &models.FeedEntry{
+			Title:      post.Title,
+			ID:         feedObj.baseURL + "/p/" + strconv.Itoa(post.PostID),
+			Link:       feedObj.baseURL + post.Permalink(),
+			Author:     post.Username,
+			AuthorLink: feedObj.baseURL + "/u/" + url.PathEscape(post.Username),
+			Categories: post.Categories,
+			Published:  post.CreatedTime,
+			Image:      feedObj.image(post.ImagePath),
+		}
+		entry.ContentHTML = renderFeedContent(post.Content, entry.Image)
+		if post.CreatedTime.After(feed.Updated) {
+			feed.Updated = post.CreatedTime
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+// image describes the uploaded image of a post, nil when there is none or it is missing on disk.
+func (feedObj *FeedServiceImpl) image(imagePath string) *models.FeedImage {
+	if !strings.HasPrefix(imagePath, "/images/") {
+		return nil
+	}
+	info, err := os.Stat("./data/assets" + imagePath)
+	if err != nil {
+		return nil
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(imagePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// names of images uploaded long ago contain characters that need escaping
+	imageURL := feedObj.baseURL + (&url.URL{Path: imagePath}).EscapedPath()
+	return &models.FeedImage{URL: imageURL, Type: contentType, Length: info.Size()}
+}
+
+// renderFeedContent renders a post the way its page does: the text as written, in paragraphs, and the image below.
+func renderFeedContent(content string, image *models.FeedImage) string {
+	var b strings.Builder
+	for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>"))
+		b.WriteString("</p>")
+	}
+	if image != nil {
+		b.WriteString(`<p><img src="` + html.EscapeString(image.URL) + `" alt="Post image"></p>`)
+	}
+	return b.String()
+}
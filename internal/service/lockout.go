@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fmt"
+	"forum/internal/models"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	accountLockThreshold = 5              // failed passwords before an account is locked
+	ipLockThreshold      = 20             // failed logins before a client address is locked, across all accounts
+	lockoutBase          = time.Minute    // first lockout, doubled with every further failure
+	lockoutMax           = time.Hour      // longest lockout
+	failureWindow        = 24 * time.Hour // failures older than this are forgotten
+	loginAlertThreshold  = 3              // failed passwords the owner is warned about at the next login
+)
+
+// LockedOutError is returned by Login while an account or client address is locked.
+type LockedOutError struct {
+	Until time.Time
+}
+
+func (e *LockedOutError) Error() string {
+	minutes := int(math.Ceil(time.Until(e.Until).Minutes()))
+	return fmt.Sprintf("Too many failed login attempts. Try again in %d minute(s)", minutes)
+}
+
+// checkLocked returns a LockedOutError if kind/subject is locked at the moment.
+func (userObj *UserServiceImpl) checkLocked(kind, subject string) error {
+	failure, err := userObj.failures.GetLoginFailure(kind, subject)
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(failure.LockedUntil) {
+		return &LockedOutError{Until: failure.LockedUntil}
+	}
+	return nil
+}
+
+// recordFailure counts a failed login and locks kind/subject once threshold is reached,
+// doubling the lockout with each failure after that. It returns the record, nil if it failed.
+func (userObj *UserServiceImpl) recordFailure(kind, subject string, threshold int) *models.LoginFailure {
+	now := time.Now()
+	failure, err := userObj.failures.AddLoginFailure(kind, subject, now, now.Add(-failureWindow))
+	if err != nil {
+		log.Printf("recordFailure: %v", err)
+		return nil
+	}
+	if failure.Failures >= threshold {
+		lockFor := lockoutMax
+		if shift := failure.Failures - threshold; shift < 7 {
+			lockFor = lockoutBase << shift
+		}
+		if lockFor > lockoutMax {
+			lockFor = lockoutMax
+		}
+		failure.LockedUntil = now.Add(lockFor)
+		if err := userObj.failures.LockLoginFailure(kind, subject, failure.Failures, failure.LockedUntil); err != nil {
+			log.Printf("recordFailure: %v", err)
+		}
+	}
+	return failure
+}
+
+// recordAccountFailure counts a wrong password for the account of user. The owner is e-mailed when
+// it gets the account locked: other failures wait for the next login, but a lockout means somebody
+// keeps guessing the password.
+func (userObj *UserServiceImpl) recordAccountFailure(user *models.User) {
+	failure := userObj.recordFailure(models.LoginFailureAccount, strconv.Itoa(user.UserUserID), accountLockThreshold)
+	if failure == nil || failure.Failures != accountLockThreshold || user.Email == "" {
+		return
+	}
+	err := userObj.mail.send(user.Email, "account_locked", map[string]interface{}{
+		"Username": user.Username,
+		"Failures": failure.Failures,
+		"Minutes":  int(math.Ceil(time.Until(failure.LockedUntil).Minutes())),
+		"Link":     userObj.mail.URL("/account"),
+	})
+	if err != nil {
+		log.Printf("recordAccountFailure: user %d: %v", user.UserUserID, err)
+	}
+}
+
+// clearAccountFailures forgets the failures of an account after a successful login
+// and returns how many failed attempts the owner should be warned about, which are also
+// kept as a notification.
+func (userObj *UserServiceImpl) clearAccountFailures(userID int) int {
+	subject := strconv.Itoa(userID)
+	failure, err := userObj.failures.GetLoginFailure(models.LoginFailureAccount, subject)
+	if err != nil {
+		log.Printf("clearAccountFailures: %v", err)
+		return 0
+	}
+	if failure.LastFailure.IsZero() {
+		return 0
+	}
+	if err := userObj.failures.DeleteLoginFailure(models.LoginFailureAccount, subject); err != nil {
+		log.Printf("clearAccountFailures: %v", err)
+	}
+	if failure.UnnotifiedFailures < loginAlertThreshold {
+		return 0
+	}
+	userObj.notifications.loginFailures(userID, failure.UnnotifiedFailures)
+	return failure.UnnotifiedFailures
+}
+
+func (userObj *UserServiceImpl) GetLockedLogins() ([]*models.LoginFailure, error) {
+	failures, err := userObj.failures.GetLockedLoginFailures(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+// UnlockLogin lifts the lockout of an account or client address.
+func (userObj *UserServiceImpl) UnlockLogin(kind, subject string) error {
+	failure, err := userObj.failures.GetLoginFailure(kind, subject)
+	if err != nil {
+		return err
+	}
+	failure.Failures = 0
+	failure.LockedUntil = time.Time{}
+	return userObj.failures.SaveLoginFailure(failure)
+}
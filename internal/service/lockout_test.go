@@ -0,0 +1,119 @@
+package service
+
+import (
+	"errors"
+	"forum/internal/database"
+	"forum/internal/models"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func lockoutUser(t *testing.T, repo *database.Repository) *models.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("the right password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Username: "owner", Email: "owner@example.com", Password: string(hash), Role: models.RoleUser}
+	id, err := repo.UserRepoInterface.CreateUserRepo(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.UserUserID = int(id)
+	return user
+}
+
+func queuedMails(t *testing.T, repo *database.Repository) []*models.Mail {
+	t.Helper()
+	mails, err := repo.MailRepoInterface.GetDueMails(time.Now().Add(time.Minute), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mails
+}
+
+// The owner is e-mailed once, when the account gets locked.
+func TestLockoutMailsTheOwner(t *testing.T) {
+	srv, repo := newTestService(t)
+	users := srv.UserServiceInterface.(*UserServiceImpl)
+	user := lockoutUser(t, repo)
+
+	for i := 1; i < accountLockThreshold; i++ {
+		if _, _, err := users.Login(user.Email, "a guess", false, "203.0.113.1"); err == nil {
+			t.Fatal("wrong password accepted")
+		}
+	}
+	if mails := queuedMails(t, repo); len(mails) != 0 {
+		t.Fatalf("%d mails before the lockout", len(mails))
+	}
+	users.Login(user.Email, "another guess", false, "203.0.113.1")
+	mails := queuedMails(t, repo)
+	if len(mails) != 1 || mails[0].To != user.Email || mails[0].Subject != "Your forum account was locked" {
+		t.Fatalf("mails %+v", mails)
+	}
+
+	var locked *LockedOutError
+	if _, _, err := users.Login(user.Email, "the right password", false, "203.0.113.2"); !errors.As(err, &locked) {
+		t.Errorf("login while locked: %v", err)
+	}
+	// a longer lockout is not mailed again
+	users.recordAccountFailure(user)
+	if mails := queuedMails(t, repo); len(mails) != 1 {
+		t.Errorf("%d mails after a further failure", len(mails))
+	}
+}
+
+// Failures at the same time are all counted, the lockout is that of the last one.
+func TestConcurrentFailuresAllCount(t *testing.T) {
+	srv, repo := newTestService(t)
+	users := srv.UserServiceInterface.(*UserServiceImpl)
+	const attempts = 30
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			users.recordFailure(models.LoginFailureIP, "203.0.113.1", ipLockThreshold)
+		}()
+	}
+	wg.Wait()
+
+	failure, err := repo.LoginFailureRepoInterface.GetLoginFailure(models.LoginFailureIP, "203.0.113.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failure.Failures != attempts || failure.UnnotifiedFailures != attempts {
+		t.Errorf("%d failures, %d unnotified, want %d", failure.Failures, failure.UnnotifiedFailures, attempts)
+	}
+	if until := time.Until(failure.LockedUntil); until < lockoutMax-time.Minute {
+		t.Errorf("locked for %v, want %v", until.Round(time.Second), lockoutMax)
+	}
+}
+
+func TestOldFailuresAreForgotten(t *testing.T) {
+	srv, repo := newTestService(t)
+	users := srv.UserServiceInterface.(*UserServiceImpl)
+	user := lockoutUser(t, repo)
+	subject := strconv.Itoa(user.UserUserID)
+	err := repo.LoginFailureRepoInterface.SaveLoginFailure(&models.LoginFailure{
+		Kind:        models.LoginFailureAccount,
+		Subject:     subject,
+		Failures:    accountLockThreshold - 1,
+		LastFailure: time.Now().Add(-failureWindow - time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users.recordAccountFailure(user)
+	failure, err := repo.LoginFailureRepoInterface.GetLoginFailure(models.LoginFailureAccount, subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failure.Failures != 1 || !failure.LockedUntil.IsZero() {
+		t.Errorf("failure %+v", failure)
+	}
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"forum/internal/database"
+	"forum/internal/mail"
+	"forum/internal/models"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	mailJobInterval   = 30 * time.Second
+	mailBatchSize     = 50
+	mailSendTimeout   = 2 * time.Minute
+	mailMaxAttempts   = 10          // retries for about eight and a half hours
+	mailRetryDelay    = time.Minute // doubled after every failed attempt
+	mailMaxRetryDelay = 6 * time.Hour
+	mailRetention     = 30 * 24 * time.Hour // sent and failed mails are deleted after this
+)
+
+// MailServiceImpl renders e-mails and puts them in the outbound queue. RunMailJobs sends them, so a
+// mail server that is down delays mail instead of failing the request that caused it.
+type MailServiceImpl struct {
+	repo    database.MailRepoInterface
+	mailer  mail.Mailer
+	from    string
+	baseURL string
+	wake    chan struct{}
+}
+
+func CreateNewMailService(repo database.MailRepoInterface, mailer mail.Mailer, config mail.Config) *MailServiceImpl {
+	baseURL := strings.TrimRight(config.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = "https://localhost:8080"
+	}
+	from := config.From
+	if from == "" {
+		from = "Forum <forum@localhost>"
+	}
+	return &MailServiceImpl{
+		repo:    repo,
+		mailer:  mailer,
+		from:    from,
+		baseURL: baseURL,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// URL makes an absolute link of a path on the forum, for use in e-mails.
+func (mailObj *MailServiceImpl) URL(path string) string {
+	return mailObj.baseURL + path
+}
+
+// send renders the template called name for the recipient and queues the result. Every template gets
+// BaseURL next to the fields of data.
+func (mailObj *MailServiceImpl) send(to, name string, data map[string]interface{}) error {
+	data["BaseURL"] = mailObj.baseURL
+	message, err := mail.Render(name, data)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = mailObj.repo.EnqueueMail(&models.Mail{
+		To:              to,
+		Subject:         message.Subject,
+		Text:            message.Text,
+		HTML:            message.HTML,
+		NextAttemptTime: now,
+		CreatedTime:     now,
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case mailObj.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// RunMailJobs sends the queued mails that are due, every mailJobInterval and whenever a mail is queued,
+// until ctx is cancelled.
+func (mailObj *MailServiceImpl) RunMailJobs(ctx context.Context) {
+	ticker := time.NewTicker(mailJobInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		now := time.Now()
+		mailObj.sendDueMails(ctx, now)
+		if now.Sub(lastCleanup) > time.Hour {
+			if deleted, err := mailObj.repo.DeleteOldMails(now.Add(-mailRetention)); err != nil {
+				log.Printf("RunMailJobs: DeleteOldMails: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Deleted %d old mails", deleted)
+			}
+			lastCleanup = now
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-mailObj.wake:
+		}
+	}
+}
+
+func (mailObj *MailServiceImpl) sendDueMails(ctx context.Context, now time.Time) {
+	due, err := mailObj.repo.GetDueMails(now, mailBatchSize)
+	if err != nil {
+		log.Printf("RunMailJobs: GetDueMails: %v", err)
+		return
+	}
+	for _, queued := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, mailSendTimeout)
+		err := mailObj.mailer.Send(sendCtx, &mail.Message{
+			From:    mailObj.from,
+			To:      queued.To,
+			Subject: queued.Subject,
+			Text:    queued.Text,
+			HTML:    queued.HTML,
+		})
+		cancel()
+		if err == nil {
+			err = mailObj.repo.MarkMailSent(queued.MailID, time.Now())
+		} else if queued.Attempts+1 >= mailMaxAttempts {
+			log.Printf("RunMailJobs: giving up on mail %d to %s: %v", queued.MailID, queued.To, err)
+			err = mailObj.repo.MarkMailFailed(queued.MailID, err.Error())
+		} else {
+			log.Printf("RunMailJobs: mail %d to %s: %v", queued.MailID, queued.To, err)
+			err = mailObj.repo.RetryMail(queued.MailID, time.Now().Add(retryDelay(queued.Attempts, mailRetryDelay, mailMaxRetryDelay)), err.Error())
+		}
+		if err != nil {
+			log.Printf("RunMailJobs: %v", err)
+		}
+	}
+}
+
+// retryDelay is how long to wait after the attempt with the given number of earlier attempts failed:
+// first, doubled for every earlier attempt, but never more than limit.
+func retryDelay(attempts int, first, limit time.Duration) time.Duration {
+	delay := first
+	for i := 0; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// emailChannel sends notifications to the e-mail address of the account right away.
+type emailChannel struct {
+	mail  *MailServiceImpl
+	users database.UserRepoInterface
+}
+
+func (channel *emailChannel) Deliver(notification *models.Notification) error {
+	user, err := channel.users.GetUserByUserID(notification.UserID)
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return nil
+	}
+	link := ""
+	if path := notification.Link(); path != "" {
+		link = channel.mail.URL(path)
+	}
+	return channel.mail.send(user.Email, "notification", map[string]interface{}{
+		"Username":     user.Username,
+		"Message":      notification.Message(),
+		"Link":         link,
+		"SettingsLink": channel.mail.URL("/notification_settings"),
+	})
+}
@@ -0,0 +1,420 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"forum/internal/database"
+	"forum/internal/events"
+	"forum/internal/models"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	notificationReadRetention = 30 * 24 * time.Hour  // read notifications are deleted after this
+	notificationRetention     = 180 * 24 * time.Hour // and unread ones after this
+	notificationJobInterval   = time.Hour
+)
+
+// NotificationServiceImpl works out who is told about what happens to content and accounts, and
+// hands the notifications to the channels the preferences of each user pick. Notifying never fails
+// the action that caused it, errors are only logged.
+type NotificationServiceImpl struct {
+	repo        database.NotificationRepoInterface
+	userRepo    database.UserRepoInterface
+	postRepo    database.PostRepoInterface
+	commentRepo database.CommentRepoInterface
+	channels    map[string]NotificationChannel
+}
+
+// CreateNewNotificationService returns the service with the in-app channel. Other channels are added
+// with RegisterChannel.
+func CreateNewNotificationService(repo *database.Repository, broker *events.Broker) *NotificationServiceImpl {
+	notificationObj := &NotificationServiceImpl{
+		repo:        repo.NotificationRepoInterface,
+		userRepo:    repo.UserRepoInterface,
+		postRepo:    repo.PostRepoInterface,
+		commentRepo: repo.CommentRepoInterface,
+		channels:    map[string]NotificationChannel{},
+	}
+	notificationObj.RegisterChannel(ChannelInApp, &inAppChannel{repo: repo.NotificationRepoInterface, broker: broker})
+	return notificationObj
+}
+
+// RegisterChannel makes notifications go through channel wherever preferences name it. It is meant to
+// be called while the service is set up, before any notification is sent.
+func (notificationObj *NotificationServiceImpl) RegisterChannel(name string, channel NotificationChannel) {
+	notificationObj.channels[name] = channel
+}
+
+// HasNotificationChannel tells whether the channel is set up, e-mail needs a mail server.
+func (notificationObj *NotificationServiceImpl) HasNotificationChannel(name string) bool {
+	return notificationObj.channels[name] != nil
+}
+
+// NotificationEvent is the data of the "notification" events the broker sends.
+type NotificationEvent struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	Link      string    `json:"link,omitempty"`
+	PostID    int       `json:"post_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Unread    int       `json:"unread"` // unread notifications of the user, this one included
+}
+
+// GetNotifications returns notifications of a user, newest first, and how many the user has in all.
+func (notificationObj *NotificationServiceImpl) GetNotifications(userID, limit, offset int) ([]*models.Notification, int, error) {
+	total, err := notificationObj.repo.CountNotifications(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	notifications, err := notificationObj.repo.GetNotificationsByUserID(userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return notifications, total, nil
+}
+
+func (notificationObj *NotificationServiceImpl) CountUnreadNotifications(userID int) (int, error) {
+	return notificationObj.repo.CountUnreadNotifications(userID)
+}
+
+// MarkNotificationRead returns sql.ErrNoRows when the notification does not belong to userID.
+func (notificationObj *NotificationServiceImpl) MarkNotificationRead(userID, notificationID int) error {
+	return notificationObj.repo.MarkNotificationRead(userID, notificationID, time.Now())
+}
+
+func (notificationObj *NotificationServiceImpl) MarkAllNotificationsRead(userID int) error {
+	return notificationObj.repo.MarkAllNotificationsRead(userID, time.Now())
+}
+
+func (notificationObj *NotificationServiceImpl) GetNotificationPreferences(userID int) (*models.NotificationPreferences, error) {
+	return notificationObj.repo.GetNotificationPreferences(userID)
+}
+
+// UpdateNotificationPreferences stores how each type of notification reaches the user. Types that are
+// left out go back to the default.
+func (notificationObj *NotificationServiceImpl) UpdateNotificationPreferences(preferences *models.NotificationPreferences) error {
+	for notificationType, delivery := range preferences.Deliveries {
+		if !models.IsNotificationType(notificationType) {
+			return fmt.Errorf("Unknown notification type %q", notificationType)
+		}
+		if !models.IsNotificationDelivery(delivery) {
+			return fmt.Errorf("Unknown delivery %q", delivery)
+		}
+	}
+	return notificationObj.repo.UpdateNotificationPreferences(preferences)
+}
+
+// MuteThread stops the notifications about a post and its comments, except what moderators decide.
+func (notificationObj *NotificationServiceImpl) MuteThread(userID, postID int) error {
+	if _, err := notificationObj.postRepo.GetPostByID(postID); err != nil {
+		return errors.New("Post not found")
+	}
+	return notificationObj.repo.AddNotificationMute(&models.NotificationMute{
+		UserID: userID, TargetType: models.MuteThread, TargetID: postID, CreatedTime: time.Now()})
+}
+
+// MuteUser stops the notifications about what another user does.
+func (notificationObj *NotificationServiceImpl) MuteUser(userID, mutedUserID int) error {
+	if userID == mutedUserID {
+		return errors.New("You cannot mute yourself")
+	}
+	if _, err := notificationObj.userRepo.GetUserByUserID(mutedUserID); err != nil {
+		return errors.New("User not found")
+	}
+	return notificationObj.repo.AddNotificationMute(&models.NotificationMute{
+		UserID: userID, TargetType: models.MuteUser, TargetID: mutedUserID, CreatedTime: time.Now()})
+}
+
+// Unmute removes a mute, targetType is models.MuteThread or models.MuteUser.
+func (notificationObj *NotificationServiceImpl) Unmute(userID int, targetType string, targetID int) error {
+	return notificationObj.repo.DeleteNotificationMute(userID, targetType, targetID)
+}
+
+func (notificationObj *NotificationServiceImpl) GetNotificationMutes(userID int) ([]*models.NotificationMute, error) {
+	return notificationObj.repo.GetNotificationMutes(userID)
+}
+
+func (notificationObj *NotificationServiceImpl) IsThreadMuted(userID, postID int) (bool, error) {
+	return notificationObj.repo.IsNotificationMuted(userID, postID, 0)
+}
+
+func (notificationObj *NotificationServiceImpl) IsUserMuted(userID, mutedUserID int) (bool, error) {
+	return notificationObj.repo.IsNotificationMuted(userID, 0, mutedUserID)
+}
+
+// RunNotificationJobs deletes old notifications until ctx is cancelled.
+func (notificationObj *NotificationServiceImpl) RunNotificationJobs(ctx context.Context) {
+	ticker := time.NewTicker(notificationJobInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		deleted, err := notificationObj.repo.DeleteOldNotifications(now.Add(-notificationReadRetention), now.Add(-notificationRetention))
+		if err != nil {
+			log.Printf("RunNotificationJobs: DeleteOldNotifications: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d old notifications", deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func reactionString(reaction int) string {
+	if reaction == 1 {
+		return "like"
+	}
+	return "dislike"
+}
+
+func (notificationObj *NotificationServiceImpl) postReaction(postID, actorID, reaction int) {
+	post, err := notificationObj.postRepo.GetPostByID(postID)
+	if err != nil {
+		log.Printf("notifications: post %d: %v", postID, err)
+		return
+	}
+	notificationObj.notify(&models.Notification{
+		UserID:     post.UserID,
+		Type:       models.NotificationPostReaction,
+		ActorID:    actorID,
+		TargetType: models.ResourcePost,
+		TargetID:   postID,
+		Payload:    models.NotificationPayload{PostID: postID, PostTitle: post.Title, Reaction: reactionString(reaction)},
+	})
+}
+
+// comment tells the author of the post, the others who commented on it and the users it mentions,
+// once the comment is approved. Before that only moderators see it.
+func (notificationObj *NotificationServiceImpl) comment(commentID int) {
+	comment, err := notificationObj.commentRepo.GetCommentByID(commentID)
+	if err != nil {
+		log.Printf("notifications: comment %d: %v", commentID, err)
+		return
+	}
+	if comment.IsApproved != 1 {
+		return
+	}
+	post, err := notificationObj.postRepo.GetPostByID(comment.PostID)
+	if err != nil {
+		log.Printf("notifications: post %d: %v", comment.PostID, err)
+		return
+	}
+	payload := models.NotificationPayload{PostID: post.PostID, PostTitle: post.Title, CommentID: commentID}
+	notificationObj.notify(&models.Notification{
+		UserID:     post.UserID,
+		Type:       models.NotificationPostComment,
+		ActorID:    comment.UserID,
+		TargetType: models.ResourceComment,
+		TargetID:   commentID,
+		Payload:    payload,
+	})
+
+	// everybody is told once, even when they commented several times or are also mentioned
+	told := map[int]bool{post.UserID: true, comment.UserID: true}
+	comments, err := notificationObj.commentRepo.GetAlCommentsForPost(post.PostID)
+	if err != nil {
+		log.Printf("notifications: comments of post %d: %v", post.PostID, err)
+	}
+	for _, other := range comments {
+		if other.IsApproved != 1 || told[other.UserID] {
+			continue
+		}
+		told[other.UserID] = true
+		notificationObj.notify(&models.Notification{
+			UserID:     other.UserID,
+			Type:       models.NotificationThreadComment,
+			ActorID:    comment.UserID,
+			TargetType: models.ResourceComment,
+			TargetID:   commentID,
+			Payload:    payload,
+		})
+	}
+	notificationObj.mentions(comment.Content, comment.UserID, models.ResourceComment, commentID, payload, told)
+}
+
+// post tells the users an approved post mentions.
+func (notificationObj *NotificationServiceImpl) post(postID int) {
+	post, err := notificationObj.postRepo.GetPostByID(postID)
+	if err != nil {
+		log.Printf("notifications: post %d: %v", postID, err)
+		return
+	}
+	if post.IsApproved != 1 {
+		return
+	}
+	payload := models.NotificationPayload{PostID: post.PostID, PostTitle: post.Title}
+	notificationObj.mentions(post.Title+"\n"+post.Content, post.UserID, models.ResourcePost, postID, payload, map[int]bool{post.UserID: true})
+}
+
+// mentionPattern finds @username in text. Usernames only exclude a few characters, a mention ends at
+// the first character that is not a letter, a digit, "_", "." or "-", and trailing dots are dropped.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\p{L}\p{N}_.\-]+)`)
+
+const maxMentions = 10 // per post or comment, more are ignored
+
+// mentions tells the users mentioned in text, except those in told, and adds them to told.
+func (notificationObj *NotificationServiceImpl) mentions(text string, actorID int, targetType string, targetID int, payload models.NotificationPayload, told map[int]bool) {
+	looked := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		username := strings.TrimRight(match[1], ".-")
+		if username == "" || looked[username] {
+			continue
+		}
+		if len(looked) == maxMentions {
+			return
+		}
+		looked[username] = true
+		user, err := notificationObj.userRepo.GetUserByUsername(username)
+		if err != nil || told[user.UserUserID] {
+			continue // not a user, or already told
+		}
+		told[user.UserUserID] = true
+		notificationObj.notify(&models.Notification{
+			UserID:     user.UserUserID,
+			Type:       models.NotificationMention,
+			ActorID:    actorID,
+			TargetType: targetType,
+			TargetID:   targetID,
+			Payload:    payload,
+		})
+	}
+}
+
+// postModerated tells the author of a post what a moderator did with it: notificationType is
+// NotificationApproved, NotificationRejected or NotificationDeleted. post is as it was before.
+func (notificationObj *NotificationServiceImpl) postModerated(notificationType string, moderatorID int, post *models.Post, reason string) {
+	reason = moderationReason(reason)
+	notificationObj.notify(&models.Notification{
+		UserID:     post.UserID,
+		Type:       notificationType,
+		ActorID:    moderatorID,
+		TargetType: models.ResourcePost,
+		TargetID:   post.PostID,
+		Payload:    models.NotificationPayload{PostID: post.PostID, PostTitle: post.Title, Reason: reason},
+	})
+}
+
+// commentModerated is postModerated for comments.
+func (notificationObj *NotificationServiceImpl) commentModerated(notificationType string, moderatorID int, comment *models.Comment, reason string) {
+	reason = moderationReason(reason)
+	post, err := notificationObj.postRepo.GetPostByID(comment.PostID)
+	if err != nil {
+		log.Printf("notifications: post %d: %v", comment.PostID, err)
+		return
+	}
+	notificationObj.notify(&models.Notification{
+		UserID:     comment.UserID,
+		Type:       notificationType,
+		ActorID:    moderatorID,
+		TargetType: models.ResourceComment,
+		TargetID:   comment.CommentID,
+		Payload:    models.NotificationPayload{PostID: post.PostID, PostTitle: post.Title, CommentID: comment.CommentID, Reason: reason},
+	})
+}
+
+const maxReasonLength = 200 // characters, longer reasons are cut
+
+func moderationReason(reason string) string {
+	reason = strings.Join(strings.Fields(reason), " ")
+	if runes := []rune(reason); len(runes) > maxReasonLength {
+		reason = string(runes[:maxReasonLength-1]) + "…"
+	}
+	return reason
+}
+
+// roleChanged tells a user that their role changed. Leaving the pending role answers a request to
+// become a moderator; asking for it is the user's own doing and is not notified.
+func (notificationObj *NotificationServiceImpl) roleChanged(userID int, oldRole, newRole string) {
+	switch {
+	case oldRole == newRole || newRole == models.RolePending:
+		return
+	case oldRole == models.RolePending:
+		notificationObj.notify(&models.Notification{
+			UserID:  userID,
+			Type:    models.NotificationModeratorRequest,
+			Payload: models.NotificationPayload{Approved: newRole == models.RoleModerator, OldRole: oldRole, NewRole: newRole},
+		})
+	default:
+		notificationObj.notify(&models.Notification{
+			UserID:  userID,
+			Type:    models.NotificationRoleChange,
+			Payload: models.NotificationPayload{OldRole: oldRole, NewRole: newRole},
+		})
+	}
+}
+
+func (notificationObj *NotificationServiceImpl) commentReaction(commentID, actorID, reaction int) {
+	comment, err := notificationObj.commentRepo.GetCommentByID(commentID)
+	if err != nil {
+		log.Printf("notifications: comment %d: %v", commentID, err)
+		return
+	}
+	post, err := notificationObj.postRepo.GetPostByID(comment.PostID)
+	if err != nil {
+		log.Printf("notifications: post %d: %v", comment.PostID, err)
+		return
+	}
+	notificationObj.notify(&models.Notification{
+		UserID:     comment.UserID,
+		Type:       models.NotificationCommentReaction,
+		ActorID:    actorID,
+		TargetType: models.ResourceComment,
+		TargetID:   commentID,
+		Payload:    models.NotificationPayload{PostID: post.PostID, PostTitle: post.Title, CommentID: commentID, Reaction: reactionString(reaction)},
+	})
+}
+
+func (notificationObj *NotificationServiceImpl) loginFailures(userID, count int) {
+	notificationObj.notify(&models.Notification{
+		UserID:  userID,
+		Type:    models.NotificationLoginFailures,
+		Payload: models.NotificationPayload{Count: count},
+	})
+}
+
+// notify hands the notification to the channels the preferences of the user pick for its type,
+// unless the user did it themselves or muted the thread or the user who did.
+func (notificationObj *NotificationServiceImpl) notify(notification *models.Notification) {
+	if notification.ActorID == notification.UserID {
+		return
+	}
+	if notification.Mutable() {
+		muted, err := notificationObj.repo.IsNotificationMuted(notification.UserID, notification.Payload.PostID, notification.ActorID)
+		if err != nil {
+			log.Printf("notifications: mutes of user %d: %v", notification.UserID, err)
+		} else if muted {
+			return
+		}
+	}
+	delivery := models.DeliveryInApp
+	preferences, err := notificationObj.repo.GetNotificationPreferences(notification.UserID)
+	if err != nil {
+		log.Printf("notifications: preferences of user %d: %v", notification.UserID, err)
+	} else {
+		delivery = preferences.Delivery(notification.Type)
+	}
+
+	notification.CreatedTime = time.Now()
+	if notification.ActorID != 0 {
+		if actor, err := notificationObj.userRepo.GetUserByUserID(notification.ActorID); err == nil {
+			notification.ActorUsername = actor.Username
+		}
+	}
+	for _, name := range deliveryChannels[delivery] {
+		channel, ok := notificationObj.channels[name]
+		if !ok {
+			continue // not set up on this forum
+		}
+		if err := channel.Deliver(notification); err != nil {
+			log.Printf("notifications: %s for user %d through %s: %v", notification.Type, notification.UserID, name, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"forum/internal/database"
+	"forum/internal/events"
+	"forum/internal/models"
+	"log"
+)
+
+// NotificationChannel delivers notifications to users one way. Channels are registered on the
+// notification service by name, and the preferences of each user decide which ones a notification
+// takes. Producers of notifications do not know about them.
+type NotificationChannel interface {
+	Deliver(notification *models.Notification) error
+}
+
+// names of the channels
+const (
+	ChannelInApp  = "in_app"
+	ChannelEmail  = "email"
+	ChannelDigest = "digest"
+)
+
+// deliveryChannels are the channels a delivery preference sends through, in order. The in-app channel
+// comes first, it gives the notification its ID.
+var deliveryChannels = map[string][]string{
+	models.DeliveryInApp:       {ChannelInApp},
+	models.DeliveryEmailDigest: {ChannelInApp, ChannelDigest},
+	models.DeliveryEmail:       {ChannelInApp, ChannelEmail},
+	models.DeliveryOff:         nil,
+}
+
+// inAppChannel stores notifications for the notifications page and passes them to the open pages of
+// the user through the event broker.
+type inAppChannel struct {
+	repo   database.NotificationRepoInterface
+	broker *events.Broker
+}
+
+func (channel *inAppChannel) Deliver(notification *models.Notification) error {
+	id, err := channel.repo.CreateNotification(notification)
+	if err != nil {
+		return err
+	}
+	notification.NotificationID = int(id)
+	unread, err := channel.repo.CountUnreadNotifications(notification.UserID)
+	if err != nil {
+		log.Printf("notifications: %v", err)
+	}
+	channel.broker.Publish(notification.UserID, "notification", NotificationEvent{
+		ID:        notification.NotificationID,
+		Type:      notification.Type,
+		Message:   notification.Message(),
+		Link:      notification.Link(),
+		PostID:    notification.Payload.PostID,
+		CreatedAt: notification.CreatedTime,
+		Unread:    unread,
+	})
+	return nil
+}
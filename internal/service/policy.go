@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/database"
+	"forum/internal/models"
+	"time"
+)
+
+var ErrForbidden = errors.New("you are not allowed to do this")
+
+type PolicyServiceImpl struct {
+	userRepo    database.UserRepoInterface
+	postRepo    database.PostRepoInterface
+	commentRepo database.CommentRepoInterface
+	auditRepo   database.AuditRepoInterface
+}
+
+func CreateNewPolicyService(repo *database.Repository) *PolicyServiceImpl {
+	policyService := PolicyServiceImpl{
+		userRepo:    repo.UserRepoInterface,
+		postRepo:    repo.PostRepoInterface,
+		commentRepo: repo.CommentRepoInterface,
+		auditRepo:   repo.AuditRepoInterface,
+	}
+	return &policyService
+}
+
+// Can answers whether userID, acting with scope, may perform action on the given post or comment.
+// Authors may edit and delete their own content; everything else depends on the role. A personal
+// access token only uses the parts of either its scope allows, see models.PermissionScopes; browser
+// sessions act with models.SessionScope.
+func (policyObj *PolicyServiceImpl) Can(userID int, scope models.TokenScope, action models.Action, resourceType string, resourceID int) (bool, error) {
+	ownerID, err := policyObj.getOwnerID(resourceType, resourceID)
+	if err != nil {
+		return false, err
+	}
+	role, err := policyObj.userRepo.GetUserRole(userID)
+	if err != nil {
+		return false, err
+	}
+	return canAct(role, scope, userID == ownerID, action), nil
+}
+
+// Authorize is like Can but returns ErrForbidden on refusal, and records an
+// audit entry when a staff member acts on someone else's content.
+func (policyObj *PolicyServiceImpl) Authorize(userID int, scope models.TokenScope, action models.Action, resourceType string, resourceID int) error {
+	ownerID, err := policyObj.getOwnerID(resourceType, resourceID)
+	if err != nil {
+		return err
+	}
+	role, err := policyObj.userRepo.GetUserRole(userID)
+	if err != nil {
+		return err
+	}
+	isOwner := userID == ownerID
+	if !canAct(role, scope, isOwner, action) {
+		return ErrForbidden
+	}
+	if !isOwner {
+		entry := &models.AuditEntry{
+			ActorID:      userID,
+			Action:       action,
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			OwnerID:      ownerID,
+			CreatedTime:  time.Now(),
+		}
+		if _, err := policyObj.auditRepo.CreateAuditEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func canAct(role string, scope models.TokenScope, isOwner bool, action models.Action) bool {
+	ownContent := isOwner && models.ScopeIncludes(scope, models.ScopeWrite)
+	switch action {
+	case models.ActionEdit:
+		return ownContent || usesPermission(role, scope, models.PermEditAnyContent)
+	case models.ActionDelete:
+		return ownContent || usesPermission(role, scope, models.PermDeleteAnyContent)
+	case models.ActionApprove:
+		return usesPermission(role, scope, models.PermApproveContent)
+	}
+	return false
+}
+
+// usesPermission tells whether the role grants perm and the scope is enough to use it.
+func usesPermission(role string, scope models.TokenScope, perm models.Permission) bool {
+	return models.RoleHasPermission(role, perm) && models.ScopeIncludes(scope, models.PermissionScopes[perm])
+}
+
+func (policyObj *PolicyServiceImpl) getOwnerID(resourceType string, resourceID int) (int, error) {
+	switch resourceType {
+	case models.ResourcePost:
+		post, err := policyObj.postRepo.GetPostByID(resourceID)
+		if err != nil {
+			return -1, err
+		}
+		return post.UserID, nil
+	case models.ResourceComment:
+		comment, err := policyObj.commentRepo.GetCommentByID(resourceID)
+		if err != nil {
+			return -1, err
+		}
+		return comment.UserID, nil
+	}
+	return -1, fmt.Errorf("unknown resource type: %s", resourceType)
+}
@@ -17,11 +17,14 @@ import (
 )
 
 type PostServiceImpl struct {
-	repo database.PostRepoInterface
+	repo          database.PostRepoInterface
+	policy        *PolicyServiceImpl
+	notifications *NotificationServiceImpl
+	webhooks      *WebhookServiceImpl
 }
 
-func CreateNewPostService(repo database.PostRepoInterface) *PostServiceImpl {
-	postService := PostServiceImpl{repo: repo}
+func CreateNewPostService(repo database.PostRepoInterface, policy *PolicyServiceImpl, notifications *NotificationServiceImpl, webhooks *WebhookServiceImpl) *PostServiceImpl {
+	postService := PostServiceImpl{repo: repo, policy: policy, notifications: notifications, webhooks: webhooks}
 	return &postService
 }
 
@@ -36,7 +39,7 @@ func (postObj *PostServiceImpl) CreatePost(post *models.Post, userRole string) (
 	post.ReportStatus = 0
 	post.ReportCategories = "normal"
 
-	if userRole == "admin" || userRole == "moderator" {
+	if models.RoleHasPermission(userRole, models.PermSkipApproval) {
 		post.IsApproved = 1
 	} else {
 		post.IsApproved = 0
@@ -52,6 +55,8 @@ func (postObj *PostServiceImpl) CreatePost(post *models.Post, userRole string) (
 	if err != nil {
 		return http.StatusInternalServerError, -1, err
 	}
+	postObj.notifications.post(post.PostID)
+	postObj.webhooks.postCreated(post)
 	return http.StatusOK, int(id), nil
 }
 
@@ -64,6 +69,10 @@ func (postObj *PostServiceImpl) GetAllPosts() ([]*models.Post, error) {
 	return posts, nil
 }
 
+func (postObj *PostServiceImpl) QueryPosts(query *models.PostQuery) ([]*models.Post, int, error) {
+	return postObj.repo.QueryPosts(query)
+}
+
 func (postObg *PostServiceImpl) isPostParamsValid(post *models.Post) error {
 	if len(post.Title) < 2 {
 		return errors.New("The title must be at least 2 characters")
@@ -78,6 +87,10 @@ func (postObg *PostServiceImpl) isPostParamsValid(post *models.Post) error {
 	if len(post.Categories) == 0 {
 		return errors.New("Didn't select the categories you want")
 	}
+	// checked before the post is stored, so a bad category does not leave a post without categories
+	if err := postObg.isCategoryValid(post.Categories); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -157,6 +170,10 @@ func (postObj *PostServiceImpl) UpdateReaction(currReaction int, postID int, use
 			postObj.repo.UpdateDislikesCounter(postID, 1)
 		}
 	}
+	// taking a reaction back is not news
+	if err == nil && prevReaction != currReaction {
+		postObj.notifications.postReaction(postID, userID, currReaction)
+	}
 	return err
 }
 
@@ -225,7 +242,7 @@ func (postObj *PostServiceImpl) AddImagesToPost(files *multipart.FileHeader) (st
 	}
 
 	imageName := uuid.New().String()
-	imageDest := fmt.Sprintf("/images/%d%s", imageName, filepath.Ext(files.Filename))
+	imageDest := fmt.Sprintf("/images/%s%s", imageName, filepath.Ext(files.Filename))
 
 	// creates a new file at the destination path. If an error occurs, it returns the error.
 	dst, err := os.Create("./data/assets" + imageDest)
@@ -241,12 +258,31 @@ func (postObj *PostServiceImpl) AddImagesToPost(files *multipart.FileHeader) (st
 	return imageDest, nil
 }
 
-func (postObj *PostServiceImpl) DeletePost(postID int) error {
-	// fmt.Println(postID)
-	err := postObj.repo.DeletePostByID(postID)
+// DeletePost deletes a post. When a moderator deletes the post of somebody else the author is told,
+// with the reason if one is given, or the report that led to it.
+func (postObj *PostServiceImpl) DeletePost(userID int, scope models.TokenScope, postID int, reason string) error {
+	if err := postObj.policy.Authorize(userID, scope, models.ActionDelete, models.ResourcePost, postID); err != nil {
+		return err
+	}
+	post, err := postObj.repo.GetPostByID(postID)
 	if err != nil {
 		return err
 	}
+	// for the webhooks, the categories may be gone with the post
+	post.Categories, _ = postObj.repo.GetCategoriesByPostID(postID)
+	err = postObj.repo.DeletePostByID(postID)
+	if err != nil {
+		return err
+	}
+	if reason == "" && post.ReportStatus == 1 && post.ReportCategories != "" && post.ReportCategories != "normal" {
+		reason = "reported as " + post.ReportCategories
+	}
+	if post.IsApproved == 1 {
+		postObj.notifications.postModerated(models.NotificationDeleted, userID, post, reason)
+	} else {
+		postObj.notifications.postModerated(models.NotificationRejected, userID, post, reason)
+	}
+	postObj.webhooks.postDeleted(post, userID, reason)
 	return nil
 }
 
@@ -266,11 +302,24 @@ func (postObj *PostServiceImpl) DeleteAllPostVotesByPostID(postID int) error {
 	return nil
 }
 
-func (postObj *PostServiceImpl) ApprovePost(postID int) error {
-	err := postObj.repo.UpdateIsApprovePostStatus(postID)
+func (postObj *PostServiceImpl) ApprovePost(userID int, scope models.TokenScope, postID int) error {
+	if err := postObj.policy.Authorize(userID, scope, models.ActionApprove, models.ResourcePost, postID); err != nil {
+		return err
+	}
+	post, err := postObj.repo.GetPostByID(postID)
 	if err != nil {
 		return err
 	}
+	err = postObj.repo.UpdateIsApprovePostStatus(postID)
+	if err != nil {
+		return err
+	}
+	// keeping a reported post approves it again, that is not news to the author
+	if post.IsApproved != 1 {
+		postObj.notifications.postModerated(models.NotificationApproved, userID, post, "")
+		postObj.notifications.post(postID)
+		postObj.webhooks.postApproved(post, userID)
+	}
 	return nil
 }
 
@@ -287,6 +336,7 @@ func (postObj *PostServiceImpl) AddPostReportCategory(postID int, reportCategory
 	if err != nil {
 		return err
 	}
+	postObj.webhooks.reportFiled(postID, reportCategory)
 	return nil
 }
 
@@ -314,7 +364,10 @@ func (postObj *PostServiceImpl) CreateCategory(CategoryName string) (int, int, e
 	return http.StatusOK, int(id), err
 }
 
-func (postObj *PostServiceImpl) UpdatePostContentByPostID(postID int, content string) error {
+func (postObj *PostServiceImpl) UpdatePostContentByPostID(userID int, scope models.TokenScope, postID int, content string) error {
+	if err := postObj.policy.Authorize(userID, scope, models.ActionEdit, models.ResourcePost, postID); err != nil {
+		return err
+	}
 	err := postObj.repo.UpdatePostContentByPostID(postID, content)
 	if err != nil {
 		return err
@@ -337,27 +390,3 @@ func (postObj *PostServiceImpl) GetMyReactedPosts(userID int) (map[int]int, erro
 	}
 	return mapa, nil
 }
-
-func (postObj *PostServiceImpl) GetAllMyPostsLikedByOtherUsers(userID int) ([]*models.PostVotes, error) {
-	postVotes, err := postObj.repo.GetAllMyPostsLikedByOtherUsers(userID)
-	if err != nil {
-		return nil, err
-	}
-	return postVotes, nil
-}
-
-func (postObj *PostServiceImpl) GetAllMyPostsCommentedByOtherUsers(userID int) ([]*models.PostVotes, error) {
-	postVotes, err := postObj.repo.GetAllMyPostsCommentedByOtherUsers(userID)
-	if err != nil {
-		return nil, err
-	}
-	return postVotes, nil
-}
-
-func (p *PostServiceImpl) CountUnseenNotifications(userID int) (int, error) {
-	return p.repo.CountUnseenNotifications(userID)
-}
-
-func (p *PostServiceImpl) MarkNotificationAsSeen(notificationID int) error {
-	return p.repo.MarkNotificationAsSeen(notificationID)
-}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxBioLength  = 500
+	maxAvatarSize = 1 << 20
+)
+
+var avatarExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+func (userObj *UserServiceImpl) GetUserProfile(userID int) (*models.UserProfile, error) {
+	return userObj.repo.GetUserProfile(userID)
+}
+
+func (userObj *UserServiceImpl) UpdateBio(userID int, bio string) error {
+	bio = strings.TrimSpace(bio)
+	if utf8.RuneCountInString(bio) > maxBioLength {
+		return fmt.Errorf("Bio cannot be longer than %d characters", maxBioLength)
+	}
+	return userObj.repo.UpdateUserBio(userID, bio)
+}
+
+// UpdateAvatar stores the uploaded picture under data/assets/avatars and replaces the previous one.
+func (userObj *UserServiceImpl) UpdateAvatar(userID int, file *multipart.FileHeader) error {
+	if file.Size > maxAvatarSize {
+		return errors.New("Avatar cannot be bigger than 1 MB")
+	}
+	openedfile, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer openedfile.Close()
+
+	buff := make([]byte, 512)
+	n, err := openedfile.Read(buff)
+	if err != nil {
+		return errors.New("Failed in reading the file")
+	}
+	extension, ok := avatarExtensions[http.DetectContentType(buff[:n])]
+	if !ok {
+		return errors.New("Avatar has to be a JPEG, PNG or GIF image")
+	}
+	if _, err := openedfile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll("./data/assets/avatars", os.ModePerm); err != nil {
+		return err
+	}
+	avatarPath := "/avatars/" + uuid.New().String() + extension
+	dst, err := os.Create(imageFile(avatarPath))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, openedfile); err != nil {
+		dst.Close()
+		os.Remove(imageFile(avatarPath))
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return userObj.setAvatar(userID, avatarPath)
+}
+
+func (userObj *UserServiceImpl) RemoveAvatar(userID int) error {
+	return userObj.setAvatar(userID, "")
+}
+
+func (userObj *UserServiceImpl) setAvatar(userID int, avatarPath string) error {
+	profile, err := userObj.repo.GetUserProfile(userID)
+	if err != nil {
+		return err
+	}
+	if err := userObj.repo.UpdateUserAvatar(userID, avatarPath); err != nil {
+		return err
+	}
+	if profile.AvatarPath != "" {
+		os.Remove(imageFile(profile.AvatarPath))
+	}
+	return nil
+}
+
+// GetAvatarFile returns where the uploaded avatar of the user is on disk, or "" when they have none.
+func (userObj *UserServiceImpl) GetAvatarFile(userID int) (string, error) {
+	profile, err := userObj.repo.GetUserProfile(userID)
+	if err != nil {
+		return "", err
+	}
+	if profile.AvatarPath == "" {
+		return "", nil
+	}
+	return imageFile(profile.AvatarPath), nil
+}
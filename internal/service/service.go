@@ -1,8 +1,12 @@
 package service
 
 import (
+	"context"
 	"forum/internal/database"
+	"forum/internal/events"
+	"forum/internal/mail"
 	"forum/internal/models"
+	"forum/internal/password"
 	"mime/multipart"
 	"net/http"
 	"time"
@@ -10,21 +14,50 @@ import (
 
 type UserServiceInterface interface {
 	CreateUser(*models.User) (int, int, error)
-	Login(string, string, bool) (*models.Session, error)
+	Login(string, string, bool, string) (*models.Session, int, error)
 	IsUserLoggedIn(*http.Request) bool
 	Logout(string) error
 	IsTokenExist(string) bool
 	GetUserByUserID(int) (*models.User, error)
 	GetSession(string) (*models.Session, error)
 	ExtendSessionTimeout(string) (time.Time, error)
-	GoogleAuthorization(*models.GoogleLoginUserData) (*models.Session, error)
-	GitHubAuthorization(*models.GitHubLoginUserData) (*models.Session, error)
+	ExternalAuthorization(*models.ExternalIdentity) (*models.Session, error)
 	ChangeUserRole(string, int) error
 	GetUsersByRole(string) ([]*models.User, error)
+	HasPermission(int, models.Permission) (bool, error)
+	GetUserByUsername(string) (*models.User, error)
+	GetProfilePrivacy(int) (*models.ProfilePrivacy, error)
+	UpdateProfilePrivacy(*models.ProfilePrivacy) error
+	CreateInvitation(int, string) (string, error)
+	GetInvitation(string) (*models.Invitation, error)
+	GetAllInvitations() ([]*models.Invitation, error)
+	AcceptInvitation(string, *models.User) (int, int, error)
+	LinkIdentity(int, *models.ExternalIdentity) error
+	UnlinkIdentity(int, int) error
+	GetUserIdentities(int) ([]*models.UserIdentity, error)
+	SetPassword(int, string) error
+	GetLockedLogins() ([]*models.LoginFailure, error)
+	UnlockLogin(string, string) error
+	UpdateNames(int, string, string) error
+	ChangeUsername(int, string) error
+	GetUserByFormerUsername(string) (*models.User, error)
+	RequestEmailChange(int, string, string) error
+	ConfirmEmailChange(string) error
+	GetPendingEmailChange(int) (*models.EmailChange, error)
+	ChangePassword(int, string, string) error
+	RequestPasswordReset(string) error
+	CheckPasswordReset(string) error
+	ResetPassword(string, string) error
+	GetUserProfile(int) (*models.UserProfile, error)
+	UpdateBio(int, string) error
+	UpdateAvatar(int, *multipart.FileHeader) error
+	RemoveAvatar(int) error
+	GetAvatarFile(int) (string, error)
 }
 
 type PostServiceInterface interface {
 	GetAllPosts() ([]*models.Post, error)
+	QueryPosts(*models.PostQuery) ([]*models.Post, int, error)
 	GetPostByID(int) (*models.Post, error)
 	CreatePost(*models.Post, string) (int, int, error)
 	GetCategories(int) ([]string, error)
@@ -32,21 +65,17 @@ type PostServiceInterface interface {
 	UpdateReaction(int, int, int) error
 	Filter(string, int) ([]*models.Post, error)
 	AddImagesToPost(*multipart.FileHeader) (string, error)
-	DeletePost(int) error
+	DeletePost(int, models.TokenScope, int, string) error
 	DeletePostCategoryByPostID(int) error
 	DeleteAllPostVotesByPostID(int) error
-	ApprovePost(int) error
+	ApprovePost(int, models.TokenScope, int) error
 	ChangeReportStatusOfPostbyPostID(int, int) error
 	AddPostReportCategory(int, string) error
 	GetAllCategories() ([]*models.Category, error)
 	DeletePostCategory(int) error
 	CreateCategory(string) (int, int, error)
-	UpdatePostContentByPostID(int, string) error
+	UpdatePostContentByPostID(int, models.TokenScope, int, string) error
 	GetMyReactedPosts(int) (map[int]int, error)
-	GetAllMyPostsLikedByOtherUsers(int) ([]*models.PostVotes, error)
-	GetAllMyPostsCommentedByOtherUsers(int) ([]*models.PostVotes, error)
-	CountUnseenNotifications(userID int) (int, error)
-	MarkNotificationAsSeen(notificationID int) error
 }
 
 type CommentServiceInterface interface {
@@ -56,25 +85,122 @@ type CommentServiceInterface interface {
 	DeleteAllCommentsByPostID(int) error
 	DeleteAllCommentVotesByPostID(int) error
 	DeleteAllCommentVotesByCommentID(int) error
-	DeleteCommentByCommentID(int) error
-	ApproveComment(int) error
-	UpdateCommentContentByPostID(int, string) error
+	DeleteCommentByCommentID(int, models.TokenScope, int, string) error
+	ApproveComment(int, models.TokenScope, int) error
+	UpdateCommentContentByPostID(int, models.TokenScope, int, string) error
 	GetMyReactedComments(int) (map[int]int, error)
 	GetCommentByID(int) (*models.Comment, error)
 	GetCommentByUserID(int) ([]*models.Comment, error)
+	GetUnapprovedComments() ([]*models.Comment, error)
+}
+
+type PolicyServiceInterface interface {
+	Can(int, models.TokenScope, models.Action, string, int) (bool, error)
+	Authorize(int, models.TokenScope, models.Action, string, int) error
+}
+
+type TokenServiceInterface interface {
+	CreateAccessToken(int, string, models.TokenScope, time.Duration) (string, error)
+	GetAccessTokens(int) ([]*models.AccessToken, error)
+	RevokeAccessToken(int, int) error
+	AuthenticateToken(string) (*models.AccessToken, error)
+}
+
+type AccountDataServiceInterface interface {
+	RequestDataExport(int) error
+	GetDataExports(int) ([]*models.DataExport, error)
+	GetDataExportFile(int, int) (string, error)
+	RequestAccountDeletion(int, string, string) (*models.AccountDeletion, error)
+	CancelAccountDeletion(int) error
+	GetAccountDeletion(int) (*models.AccountDeletion, error)
+	RunJobs(context.Context)
+}
+
+type NotificationServiceInterface interface {
+	GetNotifications(int, int, int) ([]*models.Notification, int, error)
+	CountUnreadNotifications(int) (int, error)
+	MarkNotificationRead(int, int) error
+	MarkAllNotificationsRead(int) error
+	RunNotificationJobs(context.Context)
+	HasNotificationChannel(string) bool
+	GetNotificationPreferences(int) (*models.NotificationPreferences, error)
+	UpdateNotificationPreferences(*models.NotificationPreferences) error
+	MuteThread(int, int) error
+	MuteUser(int, int) error
+	Unmute(int, string, int) error
+	GetNotificationMutes(int) ([]*models.NotificationMute, error)
+	IsThreadMuted(int, int) (bool, error)
+	IsUserMuted(int, int) (bool, error)
+}
+
+type WebhookServiceInterface interface {
+	GetWebhooks() ([]*models.Webhook, error)
+	CreateWebhook(int, string, []string) (*models.Webhook, error)
+	SetWebhookActive(int, bool) error
+	DeleteWebhook(int) error
+	GetWebhookDeliveries(int) ([]*models.WebhookDelivery, error)
+	SendTestEvent(int, int) error
+	RunWebhookJobs(context.Context)
+}
+
+type FeedServiceInterface interface {
+	GetFrontPageFeed() (*models.Feed, error)
+	GetCategoryFeed(string) (*models.Feed, error)
+	GetUserFeed(string) (*models.Feed, error)
+}
+
+type DigestServiceInterface interface {
+	GetDigestSettings(int) (*models.DigestSettings, error)
+	UpdateDigestSettings(*models.DigestSettings) error
+	RunDigestJobs(context.Context)
+}
+
+type MailServiceInterface interface {
+	RunMailJobs(context.Context)
 }
 
 type Service struct {
 	UserServiceInterface // interface
 	PostServiceInterface
 	CommentServiceInterface
+	PolicyServiceInterface
+	TokenServiceInterface
+	AccountDataServiceInterface
+	NotificationServiceInterface
+	DigestServiceInterface
+	WebhookServiceInterface
+	FeedServiceInterface
+	MailServiceInterface
+	Events  *events.Broker // notifications, for the users who are online
+	BaseURL string         // where the forum is reached from outside, for links shared elsewhere
 }
 
-func NewService(repo *database.Repository) *Service {
+// NewService wires the services together. Mail goes through mailer; notifications can be sent by
+// e-mail only when the config names a driver, the log mailer is not meant for them.
+func NewService(repo *database.Repository, passwords *password.Policy, mailer mail.Mailer, mailConfig mail.Config) *Service {
+	policy := CreateNewPolicyService(repo)
+	broker := events.NewBroker(1000)
+	mails := CreateNewMailService(repo.MailRepoInterface, mailer, mailConfig)
+	webhooks := CreateNewWebhookService(repo, mails.baseURL)
+	notifications := CreateNewNotificationService(repo, broker)
+	if mailConfig.Driver != "" {
+		notifications.RegisterChannel(ChannelEmail, &emailChannel{mail: mails, users: repo.UserRepoInterface})
+	}
+	users := CreateNewUserService(repo.UserRepoInterface, repo.LoginFailureRepoInterface, passwords, notifications, mails, webhooks)
 	serviceObj := Service{
-		UserServiceInterface:    CreateNewUserService(repo.UserRepoInterface),
-		PostServiceInterface:    CreateNewPostService(repo.PostRepoInterface),
-		CommentServiceInterface: CreateNewCommentService(repo.CommentRepoInterface),
+		UserServiceInterface:         users,
+		PostServiceInterface:         CreateNewPostService(repo.PostRepoInterface, policy, notifications, webhooks),
+		CommentServiceInterface:      CreateNewCommentService(repo.CommentRepoInterface, policy, notifications, webhooks),
+		NotificationServiceInterface: notifications,
+		DigestServiceInterface:       CreateNewDigestService(repo, mails),
+		WebhookServiceInterface:      webhooks,
+		FeedServiceInterface:         CreateNewFeedService(repo, mails.baseURL),
+		MailServiceInterface:         mails,
+		PolicyServiceInterface:       policy,
+		TokenServiceInterface:        CreateNewTokenService(repo.TokenRepoInterface),
+		AccountDataServiceInterface:  CreateNewAccountDataService(repo, users, webhooks),
+		Events:                       broker,
+		BaseURL:                      mails.baseURL,
 	}
 	return &serviceObj
 }
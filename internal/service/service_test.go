@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"forum/internal/database"
+	"forum/internal/database/migration"
+	"forum/internal/mail"
+	"forum/internal/password"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// the mail templates are loaded by paths relative to the root of the repository
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestService returns the services on a database of their own.
+func newTestService(t *testing.T) (*Service, *database.Repository) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := migration.CreateAllTables(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	repo := database.NewRepository(db)
+	mailer, err := mail.New(mail.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewService(repo, password.NewPolicy(password.Config{}), mailer, mail.Config{BaseURL: "https://forum.test"}), repo
+}
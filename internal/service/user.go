@@ -1,15 +1,22 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"forum/internal/database"
 	"forum/internal/models"
+	"forum/internal/password"
 	"forum/internal/web/handlers/helpers"
 	"log"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -17,11 +24,16 @@ import (
 )
 
 type UserServiceImpl struct {
-	repo database.UserRepoInterface
+	repo          database.UserRepoInterface
+	failures      database.LoginFailureRepoInterface
+	passwords     *password.Policy
+	notifications *NotificationServiceImpl
+	mail          *MailServiceImpl
+	webhooks      *WebhookServiceImpl
 }
 
-func CreateNewUserService(repo database.UserRepoInterface) *UserServiceImpl {
-	usrSrvc := UserServiceImpl{repo: repo}
+func CreateNewUserService(repo database.UserRepoInterface, failures database.LoginFailureRepoInterface, passwords *password.Policy, notifications *NotificationServiceImpl, mail *MailServiceImpl, webhooks *WebhookServiceImpl) *UserServiceImpl {
+	usrSrvc := UserServiceImpl{repo: repo, failures: failures, passwords: passwords, notifications: notifications, mail: mail, webhooks: webhooks}
 	return &usrSrvc
 }
 
@@ -38,70 +50,80 @@ func (userObj *UserServiceImpl) CreateUser(user *models.User) (int, int, error)
 		}
 	}
 
-	accUser, err := userObj.repo.GetUserByUsername(user.Username)
+	usernameFree, err := userObj.isUsernameFree(user.Username, 0)
 	if err != nil {
-		if err.Error() != errors.New("element with USERNAME not found").Error() {
-			return http.StatusInternalServerError, -1, err
-		}
+		return http.StatusInternalServerError, -1, err
 	}
 
-	if emailUser != nil || accUser != nil {
+	if emailUser != nil || !usernameFree {
 		return http.StatusBadRequest, -1, errors.New("username or email was already used")
 	} else {
+		// the password is checked against the policy above, only its hash is stored
+		hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return http.StatusInternalServerError, -1, err
+		}
+		user.Password = string(hash)
 		id, err = userObj.repo.CreateUserRepo(user)
 		if err != nil {
 			return http.StatusBadRequest, -1, err
 		}
 	}
+	userObj.webhooks.userRegistered(int(id))
 	return http.StatusOK, int(id), nil
 }
 
-func (userObj *UserServiceImpl) Login(email, password string, admin bool) (*models.Session, error) {
+// Login checks the password of the account and starts a session. Failed attempts are counted per account
+// and per client address, and both get locked out for a while after too many of them.
+// On success it also returns how many failed attempts the owner should be warned about.
+func (userObj *UserServiceImpl) Login(email, password string, admin bool, clientIP string) (*models.Session, int, error) {
 	// fmt.Println("Logining...: ", admin)
 	user := &models.User{}
 	var err error
 
+	if err := userObj.checkLocked(models.LoginFailureIP, clientIP); err != nil {
+		return nil, 0, err
+	}
+
 	if user, err = userObj.repo.GetUserByEmail(email); err != nil {
 		log.Printf("Login: GetUserByEmail: %v", err)
-		return nil, errors.New("Provided Email is Incorrect or doesn't exist")
+		userObj.recordFailure(models.LoginFailureIP, clientIP, ipLockThreshold)
+		return nil, 0, errors.New("Provided Email is Incorrect or doesn't exist")
+	}
+
+	accountSubject := strconv.Itoa(user.UserUserID)
+	if err := userObj.checkLocked(models.LoginFailureAccount, accountSubject); err != nil {
+		return nil, 0, err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, errors.New("Provided Password is Incorrect")
+		userObj.recordAccountFailure(user)
+		userObj.recordFailure(models.LoginFailureIP, clientIP, ipLockThreshold)
+		return nil, 0, errors.New("Provided Password is Incorrect")
 	}
 
 	role, err := userObj.repo.GetUserRole(user.UserUserID)
 	// fmt.Println("USER ID: ", user.UserID, "  role:  ", role)
 	if err != nil {
-		return nil, errors.New("Some error with query to get user role")
+		return nil, 0, errors.New("Some error with query to get user role")
 	}
 
 	if admin {
-		if role != "admin" {
-			return nil, errors.New("You do not have Admin access!")
+		if role != models.RoleAdmin {
+			return nil, 0, errors.New("You do not have Admin access!")
 		}
 	} else {
-		if role == "admin" {
-			return nil, errors.New("You should select the admin role when logining")
+		if role == models.RoleAdmin {
+			return nil, 0, errors.New("You should select the admin role when logining")
 		}
 	}
 
-	session := &models.Session{
-		UserID:  user.UserUserID,
-		Token:   uuid.New().String(),
-		ExpTime: time.Now().Add(10 * time.Minute),
-	}
-
-	if err := userObj.repo.DeleteSessionByUserID(user.UserUserID); err != nil {
-		return nil, errors.New("Error deleting the Session by USER ID")
-	}
-
-	err = userObj.repo.CreateSession(session)
+	// fmt.Println("Reaching the end of the Login")
+	session, err := userObj.startSession(user.UserUserID)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	// fmt.Println("Reaching the end of the Login")
-	return session, nil
+	return session, userObj.clearAccountFailures(user.UserUserID), nil
 }
 
 func (userObj *UserServiceImpl) isUserParamsValid(user *models.User) error {
@@ -130,14 +152,16 @@ func (userObj *UserServiceImpl) isUserNameValid(user *models.User) error {
 	if user.Username == "" || len(user.Username) < 2 {
 		return errors.New("Invalid Username")
 	}
+	// the username is part of the profile URL /u/{username}
+	if strings.ContainsAny(user.Username, "/?#% ") {
+		return errors.New("Username cannot contain spaces or any of / ? # %")
+	}
 	return nil
 }
 
+// isPasswordValid checks the plain text password of the user against the password policy.
 func (userObj *UserServiceImpl) isPasswordValid(user *models.User) error {
-	if len(user.Password) < 2 {
-		return errors.New("Weak Password (length cannot less than 5)")
-	}
-	return nil
+	return userObj.passwords.Check(user.Password, user.Username, user.Email)
 }
 
 func (userObj *UserServiceImpl) IsUserLoggedIn(r *http.Request) bool {
@@ -189,82 +213,198 @@ func (userObj *UserServiceImpl) GetUserByUserID(userID int) (*models.User, error
 	return user, nil
 }
 
-func (userObj *UserServiceImpl) GoogleAuthorization(googleUser *models.GoogleLoginUserData) (*models.Session, error) {
-	user, err := userObj.repo.GetUserByEmail(googleUser.Email)
-	// var userID int
+// ExternalAuthorization logs in the user linked to the provider account, creating a new user on first login.
+// A provider email only leads to an existing account when the provider has verified it.
+func (userObj *UserServiceImpl) ExternalAuthorization(identity *models.ExternalIdentity) (*models.Session, error) {
+	if identity.Provider == "" || identity.Subject == "" {
+		return nil, errors.New("The provider did not identify the user")
+	}
+	linked, err := userObj.repo.GetUserIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		return userObj.startSession(linked.UserID)
+	}
+	if err.Error() != errors.New("identity not found").Error() {
+		return nil, err
+	}
+
+	var userID int
+	var emailUser *models.User
+	if identity.Email != "" {
+		emailUser, _ = userObj.repo.GetUserByEmail(identity.Email)
+	}
+	switch {
+	case emailUser != nil && identity.EmailVerified:
+		userID = emailUser.UserUserID
+	case emailUser != nil:
+		return nil, errors.New("An account with this email already exists. Log in to it and link the provider from Account Settings")
+	default:
+		if userID, err = userObj.createExternalUser(identity); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := userObj.LinkIdentity(userID, identity); err != nil {
+		return nil, err
+	}
+	return userObj.startSession(userID)
+}
+
+// createExternalUser registers a user without a local password for a first provider login.
+func (userObj *UserServiceImpl) createExternalUser(identity *models.ExternalIdentity) (int, error) {
+	// names from the provider follow its rules, not ours
+	base := sanitizeUsername(identity.Username)
+	if userObj.isUserNameValid(&models.User{Username: base}) != nil {
+		base = sanitizeUsername(identity.Provider + "_" + identity.Subject)
+	}
+	username, err := userObj.availableUsername(base)
 	if err != nil {
-		// If the user does not exist, create a new user record
-		user = &models.User{
-			Username: googleUser.Email,
-			Email:    googleUser.Email,
-			Password: "dummypassword",
-			Role:     "user",
+		return -1, err
+	}
+	user := &models.User{
+		FirstName:  identity.FirstName,
+		SecondName: identity.SecondName,
+		Username:   username,
+		Role:       models.RoleUser,
+	}
+	// an unverified address could belong to somebody else, who would then be unable to register with it
+	if identity.EmailVerified {
+		user.Email = identity.Email
+	}
+	id, err := userObj.repo.CreateUserRepo(user)
+	if err != nil {
+		return -1, err
+	}
+	userObj.webhooks.userRegistered(int(id))
+	return int(id), nil
+}
+
+// sanitizeUsername makes a name acceptable to isUserNameValid by replacing the characters it refuses,
+// and control characters, with underscores.
+func sanitizeUsername(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune("/?#%", r) {
+			return '_'
 		}
-		_, user.UserUserID, err = userObj.CreateUser(user)
+		return r
+	}, strings.TrimSpace(name))
+}
 
-		if err != nil && err.Error() != errors.New("element with EMAIL not found").Error() {
-			return nil, err
+// availableUsername returns base, or base with a number appended if base is taken.
+func (userObj *UserServiceImpl) availableUsername(base string) (string, error) {
+	candidate := base
+	for i := 2; i < 100; i++ {
+		if err := userObj.isUserNameValid(&models.User{Username: candidate}); err != nil {
+			return "", err
 		}
+		free, err := userObj.isUsernameFree(candidate, 0)
+		if err != nil {
+			return "", err
+		}
+		if free {
+			return candidate, nil
+		}
+		candidate = base + strconv.Itoa(i)
 	}
+	return "", errors.New("Could not find a free username")
+}
 
-	session := &models.Session{
-		UserID:  user.UserUserID,
-		Token:   uuid.New().String(),
-		ExpTime: time.Now().Add(20 * time.Minute),
+// LinkIdentity connects a provider account to userID. A provider account can belong to one user only.
+func (userObj *UserServiceImpl) LinkIdentity(userID int, identity *models.ExternalIdentity) error {
+	linked, err := userObj.repo.GetUserIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		if linked.UserID == userID {
+			return nil
+		}
+		return fmt.Errorf("This %s account is already linked to another user", identity.Provider)
+	}
+	_, err = userObj.repo.CreateUserIdentity(&models.UserIdentity{
+		UserID:      userID,
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		CreatedTime: time.Now(),
+	})
+	return err
+}
+
+// UnlinkIdentity removes a linked provider account, unless it is the user's last way to log in.
+func (userObj *UserServiceImpl) UnlinkIdentity(userID, identityID int) error {
+	user, err := userObj.repo.GetUserByUserID(userID)
+	if err != nil {
+		return err
 	}
-	if err := userObj.repo.DeleteSessionByUserID(user.UserUserID); err != nil {
-		return nil, errors.New("Error deleting the Session by USER ID")
+	identities, err := userObj.repo.GetUserIdentitiesByUserID(userID)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, identity := range identities {
+		if identity.IdentityID == identityID {
+			found = true
+		}
+	}
+	if !found {
+		return errors.New("Linked account not found")
 	}
+	if user.Password == "" && len(identities) == 1 {
+		return errors.New("Set a password or link another provider before unlinking your last one")
+	}
+	return userObj.repo.DeleteUserIdentity(identityID, userID)
+}
 
-	err = userObj.repo.CreateSession(session)
+func (userObj *UserServiceImpl) GetUserIdentities(userID int) ([]*models.UserIdentity, error) {
+	identities, err := userObj.repo.GetUserIdentitiesByUserID(userID)
 	if err != nil {
 		return nil, err
 	}
-
-	return session, nil
+	return identities, nil
 }
 
-func (userObj *UserServiceImpl) GitHubAuthorization(githubUser *models.GitHubLoginUserData) (*models.Session, error) {
-	if githubUser.Login == "" {
-		githubUser.Login = githubUser.Email
-	} else if githubUser.Email == "" {
-		githubUser.Email = githubUser.Login + "@gmail.com"
+// SetPassword gives a user who only logged in through providers a local password.
+func (userObj *UserServiceImpl) SetPassword(userID int, password string) error {
+	user, err := userObj.repo.GetUserByUserID(userID)
+	if err != nil {
+		return err
 	}
-	user, err := userObj.repo.GetUserByEmail(githubUser.Email)
-	// var userID int
+	if user.Password != "" {
+		return errors.New("You already have a password")
+	}
+	if err := userObj.isPasswordValid(&models.User{Username: user.Username, Email: user.Email, Password: password}); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		// If the user does not exist, create a new user record
-		user = &models.User{
-			Username: githubUser.Login,
-			Email:    githubUser.Email,
-			Password: "dummypassword",
-			Role:     "user",
-		}
-		_, user.UserUserID, err = userObj.CreateUser(user)
-		if err != nil && err.Error() != errors.New("element with EMAIL not found").Error() {
-			return nil, err
-		}
+		return err
 	}
+	return userObj.repo.UpdateUserPassword(userID, string(hash))
+}
+
+// startSession replaces any session of the user with a new one.
+func (userObj *UserServiceImpl) startSession(userID int) (*models.Session, error) {
 	session := &models.Session{
-		UserID:  user.UserUserID,
+		UserID:  userID,
 		Token:   uuid.New().String(),
 		ExpTime: time.Now().Add(10 * time.Minute),
 	}
-	if err := userObj.repo.DeleteSessionByUserID(user.UserUserID); err != nil {
+	if err := userObj.repo.DeleteSessionByUserID(userID); err != nil {
 		return nil, errors.New("Error deleting the Session by USER ID")
 	}
-	err = userObj.repo.CreateSession(session)
-	if err != nil {
+	if err := userObj.repo.CreateSession(session); err != nil {
 		return nil, err
 	}
 	return session, nil
 }
 
 func (userObj *UserServiceImpl) ChangeUserRole(newRole string, userID int) error {
-	err := userObj.repo.ChangeUserRole(newRole, userID)
+	oldRole, err := userObj.repo.GetUserRole(userID)
 	if err != nil {
 		return err
 	}
+	err = userObj.repo.ChangeUserRole(newRole, userID)
+	if err != nil {
+		return err
+	}
+	userObj.notifications.roleChanged(userID, oldRole, newRole)
 	return nil
 }
 
@@ -275,3 +415,118 @@ func (userObj *UserServiceImpl) GetUsersByRole(role string) ([]*models.User, err
 	}
 	return users, nil
 }
+
+func (userObj *UserServiceImpl) HasPermission(userID int, perm models.Permission) (bool, error) {
+	role, err := userObj.repo.GetUserRole(userID)
+	if err != nil {
+		return false, err
+	}
+	return models.RoleHasPermission(role, perm), nil
+}
+
+func (userObj *UserServiceImpl) GetUserByUsername(username string) (*models.User, error) {
+	user, err := userObj.repo.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (userObj *UserServiceImpl) GetProfilePrivacy(userID int) (*models.ProfilePrivacy, error) {
+	privacy, err := userObj.repo.GetProfilePrivacy(userID)
+	if err != nil {
+		return nil, err
+	}
+	return privacy, nil
+}
+
+func (userObj *UserServiceImpl) UpdateProfilePrivacy(privacy *models.ProfilePrivacy) error {
+	return userObj.repo.UpdateProfilePrivacy(privacy)
+}
+
+const invitationTTL = 72 * time.Hour
+
+// CreateInvitation issues a single-use link token for a new moderator or admin.
+// The token is returned once and only its hash is stored.
+func (userObj *UserServiceImpl) CreateInvitation(createdBy int, role string) (string, error) {
+	if role != models.RoleModerator && role != models.RoleAdmin {
+		return "", errors.New("Invitations can only be issued for moderators or admins")
+	}
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	invitation := &models.Invitation{
+		TokenHash: hashToken(token),
+		Role:      role,
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(invitationTTL),
+	}
+	if _, err := userObj.repo.CreateInvitation(invitation); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (userObj *UserServiceImpl) GetInvitation(token string) (*models.Invitation, error) {
+	invitation, err := userObj.repo.GetInvitationByTokenHash(hashToken(token))
+	if err != nil {
+		return nil, errors.New("Invitation link is invalid")
+	}
+	if invitation.UsedBy != 0 {
+		return nil, errors.New("Invitation link was already used")
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return nil, errors.New("Invitation link has expired")
+	}
+	return invitation, nil
+}
+
+func (userObj *UserServiceImpl) GetAllInvitations() ([]*models.Invitation, error) {
+	invitations, err := userObj.repo.GetAllInvitations()
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// AcceptInvitation registers user with the role of the invitation and uses the invitation up.
+func (userObj *UserServiceImpl) AcceptInvitation(token string, user *models.User) (int, int, error) {
+	invitation, err := userObj.GetInvitation(token)
+	if err != nil {
+		return http.StatusBadRequest, -1, err
+	}
+	claimed, err := userObj.repo.ClaimInvitation(invitation.TokenHash, time.Now())
+	if err != nil {
+		return http.StatusInternalServerError, -1, err
+	}
+	if !claimed {
+		return http.StatusBadRequest, -1, errors.New("Invitation link was already used")
+	}
+
+	user.Role = invitation.Role
+	statusCode, id, err := userObj.CreateUser(user)
+	if err != nil {
+		if releaseErr := userObj.repo.ReleaseInvitation(invitation.TokenHash); releaseErr != nil {
+			log.Printf("AcceptInvitation: ReleaseInvitation: %v", releaseErr)
+		}
+		return statusCode, -1, err
+	}
+	if err := userObj.repo.SetInvitationUser(invitation.TokenHash, id); err != nil {
+		return http.StatusInternalServerError, -1, err
+	}
+	return http.StatusOK, id, nil
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/internal/database"
+	"forum/internal/models"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	webhookJobInterval       = 30 * time.Second
+	webhookBatchSize         = 50
+	webhookTimeout           = 10 * time.Second
+	webhookMaxAttempts       = 8           // retries for about two hours
+	webhookRetryDelay        = time.Minute // doubled after every failed attempt
+	webhookMaxRetryDelay     = time.Hour
+	webhookResponseLimit     = 1024                // bytes of the response kept in the log
+	webhookDeliveryLog       = 20                  // deliveries shown per webhook
+	webhookDeliveryRetention = 30 * 24 * time.Hour // delivered and failed deliveries are deleted after this
+)
+
+// WebhookServiceImpl POSTs forum events to the webhooks admins set up. Every event is stored as a
+// delivery for each subscribed webhook and sent by RunWebhookJobs, so a receiver that is down gets it
+// later. Like notifications, events never fail the action that caused them, errors are only logged.
+type WebhookServiceImpl struct {
+	repo     database.WebhookRepoInterface
+	userRepo database.UserRepoInterface
+	postRepo database.PostRepoInterface
+	baseURL  string
+	client   *http.Client
+	wake     chan struct{}
+}
+
+func CreateNewWebhookService(repo *database.Repository, baseURL string) *WebhookServiceImpl {
+	return &WebhookServiceImpl{
+		repo:     repo.WebhookRepoInterface,
+		userRepo: repo.UserRepoInterface,
+		postRepo: repo.PostRepoInterface,
+		baseURL:  baseURL,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			// a redirect is an answer like any other, receivers are set up with their final URL
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// WebhookPayload is the JSON body of every request: ID is the same for all webhooks told about one event.
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type webhookUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+type webhookPost struct {
+	ID         int         `json:"id"`
+	Title      string      `json:"title"`
+	Content    string      `json:"content"`
+	Author     webhookUser `json:"author"`
+	Categories []string    `json:"categories"`
+	Approved   bool        `json:"approved"`
+	CreatedAt  time.Time   `json:"created_at"`
+	URL        string      `json:"url"`
+}
+
+type webhookComment struct {
+	ID        int         `json:"id"`
+	PostID    int         `json:"post_id"`
+	Content   string      `json:"content"`
+	Author    webhookUser `json:"author"`
+	Approved  bool        `json:"approved"`
+	CreatedAt time.Time   `json:"created_at"`
+	URL       string      `json:"url"`
+}
+
+func (webhookObj *WebhookServiceImpl) GetWebhooks() ([]*models.Webhook, error) {
+	return webhookObj.repo.GetWebhooks()
+}
+
+// CreateWebhook subscribes targetURL to the events. The secret the requests are signed with is generated.
+func (webhookObj *WebhookServiceImpl) CreateWebhook(userID int, targetURL string, events []string) (*models.Webhook, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, errors.New("The URL must start with http:// or https://")
+	}
+	if len(events) == 0 {
+		return nil, errors.New("Choose at least one event")
+	}
+	for _, event := range events {
+		if !models.IsWebhookEvent(event) {
+			return nil, fmt.Errorf("Unknown event %q", event)
+		}
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	webhook := &models.Webhook{
+		URL:         targetURL,
+		Secret:      "whsec_" + hex.EncodeToString(secret),
+		Events:      events,
+		Active:      true,
+		CreatedBy:   userID,
+		CreatedTime: time.Now(),
+	}
+	id, err := webhookObj.repo.CreateWebhook(webhook)
+	if err != nil {
+		return nil, err
+	}
+	webhook.WebhookID = int(id)
+	return webhook, nil
+}
+
+func (webhookObj *WebhookServiceImpl) SetWebhookActive(webhookID int, active bool) error {
+	if _, err := webhookObj.repo.GetWebhookByID(webhookID); err != nil {
+		return err
+	}
+	return webhookObj.repo.SetWebhookActive(webhookID, active)
+}
+
+func (webhookObj *WebhookServiceImpl) DeleteWebhook(webhookID int) error {
+	return webhookObj.repo.DeleteWebhook(webhookID)
+}
+
+func (webhookObj *WebhookServiceImpl) GetWebhookDeliveries(webhookID int) ([]*models.WebhookDelivery, error) {
+	return webhookObj.repo.GetWebhookDeliveries(webhookID, webhookDeliveryLog)
+}
+
+// SendTestEvent sends a "ping" event to one webhook, whether it is active or not.
+func (webhookObj *WebhookServiceImpl) SendTestEvent(userID, webhookID int) error {
+	webhook, err := webhookObj.repo.GetWebhookByID(webhookID)
+	if err != nil {
+		return err
+	}
+	payload := webhookObj.payload(models.WebhookPing, map[string]interface{}{
+		"webhook_id": webhook.WebhookID,
+		"sent_by":    webhookObj.user(userID),
+		"message":    "This is a test event from the forum.",
+	})
+	return webhookObj.enqueue(webhook, payload)
+}
+
+// emit queues the event for every active webhook subscribed to it.
+func (webhookObj *WebhookServiceImpl) emit(event string, data interface{}) {
+	webhooks, err := webhookObj.repo.GetWebhooks()
+	if err != nil {
+		log.Printf("webhooks: %s: %v", event, err)
+		return
+	}
+	payload := webhookObj.payload(event, data)
+	for _, webhook := range webhooks {
+		if !webhook.Active || !webhook.Subscribes(event) {
+			continue
+		}
+		if err := webhookObj.enqueue(webhook, payload); err != nil {
+			log.Printf("webhooks: %s for webhook %d: %v", event, webhook.WebhookID, err)
+		}
+	}
+}
+
+func (webhookObj *WebhookServiceImpl) payload(event string, data interface{}) *WebhookPayload {
+	return &WebhookPayload{ID: uuid.NewString(), Event: event, CreatedAt: time.Now().UTC(), Data: data}
+}
+
+func (webhookObj *WebhookServiceImpl) enqueue(webhook *models.Webhook, payload *WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = webhookObj.repo.CreateWebhookDelivery(&models.WebhookDelivery{
+		WebhookID:       webhook.WebhookID,
+		Event:           payload.Event,
+		Payload:         string(body),
+		NextAttemptTime: now,
+		CreatedTime:     now,
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case webhookObj.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (webhookObj *WebhookServiceImpl) user(userID int) webhookUser {
+	user := webhookUser{ID: userID}
+	if found, err := webhookObj.userRepo.GetUserByUserID(userID); err == nil {
+		user.Username = found.Username
+	}
+	return user
+}
+
+func (webhookObj *WebhookServiceImpl) post(post *models.Post) webhookPost {
+	categories := post.Categories
+	if len(categories) == 0 {
+		categories, _ = webhookObj.postRepo.GetCategoriesByPostID(post.PostID)
+	}
+	if categories == nil {
+		categories = []string{}
+	}
+	return webhookPost{
+		ID:         post.PostID,
+		Title:      post.Title,
+		Content:    post.Content,
+		Author:     webhookObj.user(post.UserID),
+		Categories: categories,
+		Approved:   post.IsApproved == 1,
+		CreatedAt:  post.CreatedTime,
+		URL:        webhookObj.baseURL + post.Permalink(),
+	}
+}
+
+// postURL is the address of a post the payload only has the ID of.
+func (webhookObj *WebhookServiceImpl) postURL(postID int) string {
+	post, err := webhookObj.postRepo.GetPostByID(postID)
+	if err != nil {
+		return webhookObj.baseURL + "/p/" + strconv.Itoa(postID) // redirected to the canonical address
+	}
+	return webhookObj.baseURL + post.Permalink()
+}
+
+func (webhookObj *WebhookServiceImpl) postCreated(post *models.Post) {
+	webhookObj.emit(models.WebhookPostCreated, map[string]interface{}{"post": webhookObj.post(post)})
+}
+
+func (webhookObj *WebhookServiceImpl) postApproved(post *models.Post, moderatorID int) {
+	post.IsApproved = 1
+	webhookObj.emit(models.WebhookPostApproved, map[string]interface{}{
+		"post":        webhookObj.post(post),
+		"approved_by": webhookObj.user(moderatorID),
+	})
+}
+
+func (webhookObj *WebhookServiceImpl) postDeleted(post *models.Post, userID int, reason string) {
+	webhookObj.emit(models.WebhookPostDeleted, map[string]interface{}{
+		"post":       webhookObj.post(post),
+		"deleted_by": webhookObj.user(userID),
+		"reason":     reason,
+	})
+}
+
+func (webhookObj *WebhookServiceImpl) commentCreated(comment *models.Comment) {
+	webhookObj.emit(models.WebhookCommentCreated, map[string]interface{}{"comment": webhookComment{
+		ID:        comment.CommentID,
+		PostID:    comment.PostID,
+		Content:   comment.Content,
+		Author:    webhookObj.user(comment.UserID),
+		Approved:  comment.IsApproved == 1,
+		CreatedAt: comment.CreatedTime,
+		URL:       webhookObj.postURL(comment.PostID) + "#comment-" + strconv.Itoa(comment.CommentID),
+	}})
+}
+
+func (webhookObj *WebhookServiceImpl) reportFiled(postID int, category string) {
+	post, err := webhookObj.postRepo.GetPostByID(postID)
+	if err != nil {
+		log.Printf("webhooks: report of post %d: %v", postID, err)
+		return
+	}
+	webhookObj.emit(models.WebhookReportFiled, map[string]interface{}{
+		"post":     webhookObj.post(post),
+		"category": category,
+	})
+}
+
+func (webhookObj *WebhookServiceImpl) userRegistered(userID int) {
+	user, err := webhookObj.userRepo.GetUserByUserID(userID)
+	if err != nil {
+		log.Printf("webhooks: user %d: %v", userID, err)
+		return
+	}
+	webhookObj.emit(models.WebhookUserRegistered, map[string]interface{}{"user": map[string]interface{}{
+		"id":       user.UserUserID,
+		"username": user.Username,
+		"role":     user.Role,
+		"url":      webhookObj.baseURL + "/u/" + url.PathEscape(user.Username),
+	}})
+}
+
+// RunWebhookJobs sends the deliveries that are due, every webhookJobInterval and whenever an event is
+// queued, until ctx is cancelled.
+func (webhookObj *WebhookServiceImpl) RunWebhookJobs(ctx context.Context) {
+	ticker := time.NewTicker(webhookJobInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		now := time.Now()
+		webhookObj.sendDueDeliveries(ctx, now)
+		if now.Sub(lastCleanup) > time.Hour {
+			if _, err := webhookObj.repo.DeleteOldWebhookDeliveries(now.Add(-webhookDeliveryRetention)); err != nil {
+				log.Printf("RunWebhookJobs: DeleteOldWebhookDeliveries: %v", err)
+			}
+			lastCleanup = now
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-webhookObj.wake:
+		}
+	}
+}
+
+func (webhookObj *WebhookServiceImpl) sendDueDeliveries(ctx context.Context, now time.Time) {
+	due, err := webhookObj.repo.GetDueWebhookDeliveries(now, webhookBatchSize)
+	if err != nil {
+		log.Printf("RunWebhookJobs: GetDueWebhookDeliveries: %v", err)
+		return
+	}
+	webhooks := map[int]*models.Webhook{}
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			if webhook, err = webhookObj.repo.GetWebhookByID(delivery.WebhookID); err != nil {
+				log.Printf("RunWebhookJobs: webhook %d: %v", delivery.WebhookID, err)
+				continue
+			}
+			webhooks[delivery.WebhookID] = webhook
+		}
+
+		err := webhookObj.deliver(ctx, webhook, delivery)
+		delivery.Attempts++
+		switch {
+		case err == nil:
+			delivered := time.Now()
+			delivery.Status = models.WebhookDeliveryDelivered
+			delivery.LastError = ""
+			delivery.DeliveredTime = &delivered
+		case delivery.Attempts >= webhookMaxAttempts:
+			delivery.Status = models.WebhookDeliveryFailed
+			delivery.LastError = err.Error()
+		default:
+			delivery.LastError = err.Error()
+			delivery.NextAttemptTime = time.Now().Add(retryDelay(delivery.Attempts-1, webhookRetryDelay, webhookMaxRetryDelay))
+		}
+		if err := webhookObj.repo.UpdateWebhookDelivery(delivery); err != nil {
+			log.Printf("RunWebhookJobs: UpdateWebhookDelivery: %v", err)
+		}
+	}
+}
+
+// deliver makes one attempt and records the response in delivery. Receivers check the request with
+// X-Forum-Signature, the hex HMAC-SHA256 of "<X-Forum-Timestamp>.<body>" under the secret of the webhook.
+func (webhookObj *WebhookServiceImpl) deliver(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) error {
+	delivery.ResponseStatus = 0
+	delivery.ResponseBody = ""
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(timestamp + "." + delivery.Payload))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "forum-webhooks")
+	req.Header.Set("X-Forum-Event", delivery.Event)
+	req.Header.Set("X-Forum-Delivery", strconv.Itoa(delivery.DeliveryID))
+	req.Header.Set("X-Forum-Timestamp", timestamp)
+	req.Header.Set("X-Forum-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := webhookObj.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	delivery.ResponseStatus = resp.StatusCode
+	delivery.ResponseBody = string(body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the receiver answered %s", resp.Status)
+	}
+	return nil
+}
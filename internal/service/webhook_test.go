@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"forum/internal/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver checks requests the way the documentation tells receivers to, with its own copy of
+// the secret, and answers with the statuses it is given, one per request and then 204.
+type webhookReceiver struct {
+	t        *testing.T
+	server   *httptest.Server
+	secret   string
+	statuses []int
+
+	mu       sync.Mutex
+	received []*WebhookPayload // the requests with a good signature
+	refused  int
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	receiver := &webhookReceiver{t: t, statuses: statuses}
+	receiver.server = httptest.NewServer(http.HandlerFunc(receiver.serve))
+	t.Cleanup(receiver.server.Close)
+	return receiver
+}
+
+func (receiver *webhookReceiver) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		receiver.t.Error(err)
+		return
+	}
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	timestamp, err := strconv.ParseInt(r.Header.Get("X-Forum-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)) > 5*time.Minute {
+		receiver.refused++
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(receiver.secret))
+	mac.Write([]byte(r.Header.Get("X-Forum-Timestamp") + "." + string(body)))
+	if !hmac.Equal([]byte(r.Header.Get("X-Forum-Signature")), []byte("sha256="+hex.EncodeToString(mac.Sum(nil)))) {
+		receiver.refused++
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Event != r.Header.Get("X-Forum-Event") {
+		receiver.t.Errorf("payload %s for event %q", body, r.Header.Get("X-Forum-Event"))
+	}
+	receiver.received = append(receiver.received, &payload)
+
+	status := http.StatusNoContent
+	if len(receiver.statuses) > 0 {
+		status, receiver.statuses = receiver.statuses[0], receiver.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (receiver *webhookReceiver) counts() (received, refused int) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return len(receiver.received), receiver.refused
+}
+
+// newTestWebhooks returns the webhook service on a database of its own, with a webhook for receiver
+// that receiver knows the secret of.
+func newTestWebhooks(t *testing.T, receiver *webhookReceiver) (*WebhookServiceImpl, *models.Webhook) {
+	_, repo := newTestService(t)
+	userID, err := repo.UserRepoInterface.CreateUserRepo(&models.User{Username: "admin", Email: "admin@example.com", Role: models.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhooks := CreateNewWebhookService(repo, "https://forum.test")
+	webhook, err := webhooks.CreateWebhook(int(userID), receiver.server.URL, []string{models.WebhookPostCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver.secret = webhook.Secret
+	return webhooks, webhook
+}
+
+func (webhookObj *WebhookServiceImpl) onlyDelivery(t *testing.T, webhookID int) *models.WebhookDelivery {
+	t.Helper()
+	deliveries, err := webhookObj.GetWebhookDeliveries(webhookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("%d deliveries, want 1", len(deliveries))
+	}
+	return deliveries[0]
+}
+
+func TestWebhookSignedDelivery(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	webhooks, webhook := newTestWebhooks(t, receiver)
+	if err := webhooks.SendTestEvent(webhook.CreatedBy, webhook.WebhookID); err != nil {
+		t.Fatal(err)
+	}
+	webhooks.sendDueDeliveries(context.Background(), time.Now())
+
+	if received, refused := receiver.counts(); received != 1 || refused != 0 {
+		t.Fatalf("received %d, refused %d", received, refused)
+	}
+	if receiver.received[0].Event != models.WebhookPing {
+		t.Errorf("event %q", receiver.received[0].Event)
+	}
+	delivery := webhooks.onlyDelivery(t, webhook.WebhookID)
+	if delivery.Status != models.WebhookDeliveryDelivered || delivery.Attempts != 1 || delivery.ResponseStatus != http.StatusNoContent {
+		t.Errorf("delivery %+v", delivery)
+	}
+}
+
+// A receiver with another secret refuses the request, and the forum keeps the delivery to retry it.
+func TestWebhookWrongSecretIsRefused(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	webhooks, webhook := newTestWebhooks(t, receiver)
+	receiver.secret = "whsec_not_the_secret"
+	if err := webhooks.SendTestEvent(webhook.CreatedBy, webhook.WebhookID); err != nil {
+		t.Fatal(err)
+	}
+	webhooks.sendDueDeliveries(context.Background(), time.Now())
+
+	if received, refused := receiver.counts(); received != 0 || refused != 1 {
+		t.Fatalf("received %d, refused %d", received, refused)
+	}
+	delivery := webhooks.onlyDelivery(t, webhook.WebhookID)
+	if delivery.Status != models.WebhookDeliveryPending || delivery.ResponseStatus != http.StatusUnauthorized || delivery.LastError == "" {
+		t.Errorf("delivery %+v", delivery)
+	}
+}
+
+// Failed attempts are retried after webhookRetryDelay, doubled every time, until the receiver answers
+// with a 2xx or webhookMaxAttempts were made.
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusBadGateway)
+	webhooks, webhook := newTestWebhooks(t, receiver)
+	if err := webhooks.SendTestEvent(webhook.CreatedBy, webhook.WebhookID); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for attempt, wait := range []time.Duration{webhookRetryDelay, 2 * webhookRetryDelay, 4 * webhookRetryDelay} {
+		webhooks.sendDueDeliveries(context.Background(), now)
+		delivery := webhooks.onlyDelivery(t, webhook.WebhookID)
+		if delivery.Status != models.WebhookDeliveryPending || delivery.Attempts != attempt+1 || delivery.ResponseStatus < 500 {
+			t.Fatalf("after attempt %d: delivery %+v", attempt+1, delivery)
+		}
+		if next := time.Until(delivery.NextAttemptTime); next < wait-time.Minute/2 || next > wait {
+			t.Errorf("after attempt %d: next attempt in %v, want %v", attempt+1, next.Round(time.Second), wait)
+		}
+		// nothing is sent before it is due
+		webhooks.sendDueDeliveries(context.Background(), delivery.NextAttemptTime.Add(-time.Second))
+		if received, _ := receiver.counts(); received != attempt+1 {
+			t.Fatalf("%d requests after %d attempts", received, attempt+1)
+		}
+		now = delivery.NextAttemptTime
+	}
+
+	webhooks.sendDueDeliveries(context.Background(), now)
+	delivery := webhooks.onlyDelivery(t, webhook.WebhookID)
+	if delivery.Status != models.WebhookDeliveryDelivered || delivery.Attempts != 4 || delivery.LastError != "" {
+		t.Errorf("delivery %+v", delivery)
+	}
+
+	// a receiver that never recovers is given up on
+	failing := newWebhookReceiver(t, http.StatusServiceUnavailable)
+	webhooks, webhook = newTestWebhooks(t, failing)
+	if err := webhooks.SendTestEvent(webhook.CreatedBy, webhook.WebhookID); err != nil {
+		t.Fatal(err)
+	}
+	delivery = webhooks.onlyDelivery(t, webhook.WebhookID)
+	delivery.Attempts = webhookMaxAttempts - 1
+	if err := webhooks.repo.UpdateWebhookDelivery(delivery); err != nil {
+		t.Fatal(err)
+	}
+	webhooks.sendDueDeliveries(context.Background(), time.Now())
+	if delivery = webhooks.onlyDelivery(t, webhook.WebhookID); delivery.Status != models.WebhookDeliveryFailed {
+		t.Errorf("delivery %+v after %d attempts", delivery, webhookMaxAttempts)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"forum/internal/models"
+	"forum/internal/service"
+	"forum/internal/web/handlers/helpers"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) RequestDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Request Data Export Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err := h.service.AccountDataServiceInterface.RequestDataExport(userID); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func (h *Handler) DownloadDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Download Data Export Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	exportID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Invalid export ID"))
+		return
+	}
+	filePath, err := h.service.AccountDataServiceInterface.GetDataExportFile(userID, exportID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusNotFound, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="forum-data-`+strconv.Itoa(exportID)+`.zip"`)
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeFile(w, r, filePath)
+}
+
+func (h *Handler) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Delete Account Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	_, err = h.service.AccountDataServiceInterface.RequestAccountDeletion(userID, r.FormValue("mode"), r.FormValue("current_password"))
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		var lockedOut *service.LockedOutError
+		if errors.As(err, &lockedOut) {
+			statusCode = http.StatusTooManyRequests
+		}
+		helpers.ErrorHandler(w, statusCode, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func (h *Handler) CancelAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Cancel Account Deletion Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err := h.service.AccountDataServiceInterface.CancelAccountDeletion(userID); err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// accountDataRows prepares the exports and the pending deletion of the user for the account page.
+func (h *Handler) accountDataRows(userID int) ([]dataExportRow, *models.AccountDeletion, string, error) {
+	exports, err := h.service.AccountDataServiceInterface.GetDataExports(userID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	rows := []dataExportRow{}
+	for _, export := range exports {
+		rows = append(rows, dataExportRow{
+			DataExport:        export,
+			CreatedTimeString: export.CreatedTime.Format("Jan 2, 2006 at 15:04"),
+			ExpiresAtString:   export.ExpiresAt.Format("Jan 2, 2006 at 15:04"),
+		})
+	}
+	deletion, err := h.service.AccountDataServiceInterface.GetAccountDeletion(userID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	scheduled := ""
+	if deletion != nil {
+		scheduled = deletion.ScheduledTime.Format("Jan 2, 2006 at 15:04")
+	}
+	return rows, deletion, scheduled, nil
+}
+
+type dataExportRow struct {
+	*models.DataExport
+	CreatedTimeString string
+	ExpiresAtString   string
+}
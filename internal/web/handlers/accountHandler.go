@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"forum/internal/models"
+	"forum/internal/oauth"
+	"forum/internal/service"
+	"forum/internal/web/handlers/helpers"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) AccountHandler(w http.ResponseWriter, r *http.Request) {
+	accountPath := "internal/web/templates/account.html"
+
+	type identityRow struct {
+		*models.UserIdentity
+		DisplayName       string
+		CreatedTimeString string
+	}
+	type templateData struct {
+		User         *models.User
+		HasPassword  bool
+		PendingEmail string
+		Bio          string
+		HasAvatar    bool
+		Identities   []identityRow
+		Unlinked     []oauth.ProviderInfo
+		Exports      []dataExportRow
+		Deletion     *models.AccountDeletion
+		DeletionDate string
+	}
+
+	if r.Method != "GET" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Account Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	user, err := h.service.UserServiceInterface.GetUserByUserID(userID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	identities, err := h.service.UserServiceInterface.GetUserIdentities(userID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	profile, err := h.service.UserServiceInterface.GetUserProfile(userID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	pending, err := h.service.UserServiceInterface.GetPendingEmailChange(userID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	exports, deletion, deletionDate, err := h.accountDataRows(userID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := templateData{User: user, HasPassword: user.Password != "", Exports: exports, Deletion: deletion, DeletionDate: deletionDate,
+		Bio: profile.Bio, HasAvatar: profile.AvatarPath != ""}
+	if pending != nil {
+		data.PendingEmail = pending.NewEmail
+	}
+	linked := map[string]bool{}
+	for _, identity := range identities {
+		displayName := identity.Provider
+		if provider, ok := h.oauth.Get(identity.Provider); ok {
+			displayName = provider.Info().DisplayName
+		}
+		data.Identities = append(data.Identities, identityRow{
+			UserIdentity:      identity,
+			DisplayName:       displayName,
+			CreatedTimeString: identity.CreatedTime.Format("Jan 2, 2006 at 15:04"),
+		})
+		linked[identity.Provider] = true
+	}
+	for _, provider := range h.oauth.List() {
+		if !linked[provider.Name] {
+			data.Unlinked = append(data.Unlinked, provider)
+		}
+	}
+	helpers.RenderTemplate(w, accountPath, data)
+}
+
+func (h *Handler) UnlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Unlink Identity Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	identityID, err := strconv.Atoi(r.FormValue("identity_id"))
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Invalid linked account ID"))
+		return
+	}
+	if err := h.service.UserServiceInterface.UnlinkIdentity(userID, identityID); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func (h *Handler) SetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Set Password Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err := h.service.UserServiceInterface.SetPassword(userID, r.FormValue("password")); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func (h *Handler) UpdateNamesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Update Names Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err := h.service.UserServiceInterface.UpdateNames(userID, r.FormValue("firstName"), r.FormValue("secondName")); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func (h *Handler) ChangeUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Change Username Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err := h.service.UserServiceInterface.ChangeUsername(userID, r.FormValue("username")); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// ChangeEmailHandler starts an email change; the account keeps its old email until the link sent
+// to the new one is opened.
+func (h *Handler) ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Change Email Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err := h.service.UserServiceInterface.RequestEmailChange(userID, r.FormValue("email"), r.FormValue("current_password")); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func (h *Handler) ConfirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Confirm Email Handler"))
+		return
+	}
+	token := pathParam(r, "token")
+	if err := h.service.UserServiceInterface.ConfirmEmailChange(token); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, err := h.sessionUserID(r); err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func (h *Handler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Change Password Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	err = h.service.UserServiceInterface.ChangePassword(userID, r.FormValue("current_password"), r.FormValue("password"))
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		var lockedOut *service.LockedOutError
+		if errors.As(err, &lockedOut) {
+			statusCode = http.StatusTooManyRequests
+		}
+		helpers.ErrorHandler(w, statusCode, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
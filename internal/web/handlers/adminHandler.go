@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"database/sql"
 	"errors"
 	"forum/internal/models"
 	"forum/internal/web/handlers/helpers"
@@ -17,46 +18,15 @@ func (h *Handler) AdminMainPageHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "GET":
-		// Retrieve session from cookie
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Unauthorized access. Please log in."))
-			return
-		}
-
-		// Get user session from the database
-		session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
+		// Retrieve and extend the session
+		_, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Session expired or invalid. Please log in again."))
-			return
-		}
-
-		// Check if the user has admin role
-		user, err := h.service.UserServiceInterface.GetUserByUserID(session.UserID)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("User not found."))
-			return
-		}
-
-		if user.Role != "admin" {
-			helpers.ErrorHandler(w, http.StatusForbidden, errors.New("Access denied. Admins only."))
-			return
-		}
-
-		// Extend session timeout
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Session could not be extended"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
 		// Fetch users with "pending" role to be approved
-		pendingUsers, err := h.service.UserServiceInterface.GetUsersByRole("pending")
+		pendingUsers, err := h.service.UserServiceInterface.GetUsersByRole(models.RolePending)
 		if err != nil {
 			helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("PENDING USERS were not found"))
 			return
@@ -78,20 +48,9 @@ func (h *Handler) AdminMainPageHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ApproveRejectModeratorHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie cannot be reseived in Admin Side for Approval Rejecting the Moderator Request"))
-			return
-		}
-
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+		_, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -107,14 +66,14 @@ func (h *Handler) ApproveRejectModeratorHandler(w http.ResponseWriter, r *http.R
 		}
 		// changing role to pending from user
 		if typeOfButton == "approve" {
-			err = h.service.ChangeUserRole("moderator", intUserID)
+			err = h.service.ChangeUserRole(models.RoleModerator, intUserID)
 			if err != nil {
 				helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 				return
 			}
 		} else {
 			// fmt.Println("WHEN REJECTED")
-			err = h.service.ChangeUserRole("user", intUserID)
+			err = h.service.ChangeUserRole(models.RoleUser, intUserID)
 			if err != nil {
 				helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 				return
@@ -142,44 +101,15 @@ func (h *Handler) ManageModeratorsHandler(w http.ResponseWriter, r *http.Request
 
 	switch r.Method {
 	case "GET":
-		// Validate session and admin role
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("unauthorized: missing session cookie"))
-			return
-		}
-
-		session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("unauthorized: invalid session"))
-			return
-		}
-
-		user, err := h.service.UserServiceInterface.GetUserByUserID(session.UserID)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("unauthorized: user not found"))
-			return
-		}
-
-		if user.Role != "admin" {
-			helpers.ErrorHandler(w, http.StatusForbidden, errors.New("access denied: only admins can manage moderators"))
-			return
-		}
-
-		// Extend session timeout
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("failed to extend session timeout"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
+		// Validate session
+		_, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
 		// Fetch moderators
-		moderatorUsers, err := h.service.UserServiceInterface.GetUsersByRole("moderator")
+		moderatorUsers, err := h.service.UserServiceInterface.GetUsersByRole(models.RoleModerator)
 		if err != nil {
 			helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("moderators were not found"))
 			return
@@ -200,22 +130,12 @@ func (h *Handler) ManageModeratorsHandler(w http.ResponseWriter, r *http.Request
 func (h *Handler) DeleteModeratorHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie cannot be reseived in Admin Side for Approval Rejecting the Moderator Request"))
-			return
-		}
-
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+		_, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
+
 		userID := r.FormValue("userId")
 		// fmt.Println("1 USER ID: ", userID)
 		intUserID, err := strconv.Atoi(userID)
@@ -223,7 +143,7 @@ func (h *Handler) DeleteModeratorHandler(w http.ResponseWriter, r *http.Request)
 			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 			return
 		}
-		err = h.service.UserServiceInterface.ChangeUserRole("user", intUserID)
+		err = h.service.UserServiceInterface.ChangeUserRole(models.RoleUser, intUserID)
 		if err != nil {
 			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 			return
@@ -246,39 +166,10 @@ func (h *Handler) AdminDisplayCategoriesHandler(w http.ResponseWriter, r *http.R
 	switch r.Method {
 	case "GET":
 
-		// Validate session and admin role
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("unauthorized: missing session cookie"))
-			return
-		}
-
-		session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("unauthorized: invalid session"))
-			return
-		}
-
-		user, err := h.service.UserServiceInterface.GetUserByUserID(session.UserID)
+		// Validate session
+		_, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("unauthorized: user not found"))
-			return
-		}
-
-		if user.Role != "admin" {
-			helpers.ErrorHandler(w, http.StatusForbidden, errors.New("access denied: only admins can manage categories"))
-			return
-		}
-
-		// Extend session timeout
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("failed to extend session timeout"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -302,20 +193,9 @@ func (h *Handler) AdminDisplayCategoriesHandler(w http.ResponseWriter, r *http.R
 func (h *Handler) AdminDeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie cannot be reseived in Admin Side for Approval Rejecting the Moderator Request"))
-			return
-		}
-
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+		_, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -342,39 +222,197 @@ func (h *Handler) AdminDeleteCategoryHandler(w http.ResponseWriter, r *http.Requ
 func (h *Handler) AdminAddCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie cannot be reseived in Admin Side for Approval Rejecting the Moderator Request"))
+		_, err := h.currentSession(w, r)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+		categoryName := r.FormValue("category_name")
+		// fmt.Println(categoryName)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended"))
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 			return
 		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
+
+		_, _, err = h.service.PostServiceInterface.CreateCategory(categoryName)
 		if err != nil {
 			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 			return
 		}
+		http.Redirect(w, r, "/create_categories", http.StatusSeeOther)
+		return
+	default:
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("in Admin Page Handler"))
+		return
+	}
+}
 
-		categoryName := r.FormValue("category_name")
-		// fmt.Println(categoryName)
+func (h *Handler) AdminInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	invitationsPath := "internal/web/templates/invitations.html"
+
+	type templateData struct {
+		AllInvitations []*models.Invitation
+		NewLink        string
+	}
+
+	var data templateData
+	switch r.Method {
+	case "GET":
+	case "POST":
+		userID, err := h.sessionUserID(r)
 		if err != nil {
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+			return
+		}
+		token, err := h.service.UserServiceInterface.CreateInvitation(userID, r.FormValue("role"))
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusBadRequest, err)
+			return
+		}
+		data.NewLink = "https://" + r.Host + "/invite/" + token
+	default:
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("in Admin Invitations Handler"))
+		return
+	}
+
+	invitations, err := h.service.UserServiceInterface.GetAllInvitations()
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	data.AllInvitations = invitations
+	helpers.RenderTemplate(w, invitationsPath, data)
+}
+
+// AdminLockedLoginsHandler lists the accounts and client addresses locked out after failed logins
+// and lets an admin lift a lockout.
+func (h *Handler) AdminLockedLoginsHandler(w http.ResponseWriter, r *http.Request) {
+	lockedPath := "internal/web/templates/lockedLogins.html"
+
+	type lockedRow struct {
+		*models.LoginFailure
+		Username string
+	}
+	type templateData struct {
+		LockedAccounts []lockedRow
+		LockedIPs      []lockedRow
+	}
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		if err := h.service.UserServiceInterface.UnlockLogin(r.FormValue("kind"), r.FormValue("subject")); err != nil {
 			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 			return
 		}
+		http.Redirect(w, r, "/locked_logins", http.StatusSeeOther)
+		return
+	default:
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("in Admin Locked Logins Handler"))
+		return
+	}
 
-		_, _, err = h.service.PostServiceInterface.CreateCategory(categoryName)
+	failures, err := h.service.UserServiceInterface.GetLockedLogins()
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	var data templateData
+	for _, failure := range failures {
+		row := lockedRow{LoginFailure: failure}
+		if failure.Kind == models.LoginFailureIP {
+			data.LockedIPs = append(data.LockedIPs, row)
+			continue
+		}
+		if userID, err := strconv.Atoi(failure.Subject); err == nil {
+			if user, err := h.service.UserServiceInterface.GetUserByUserID(userID); err == nil {
+				row.Username = user.Username
+			}
+		}
+		data.LockedAccounts = append(data.LockedAccounts, row)
+	}
+	helpers.RenderTemplate(w, lockedPath, data)
+}
+
+// AdminWebhooksHandler lists the webhooks with their latest deliveries, and creates, turns on and off,
+// deletes and tests them; the "action" of the form says which.
+func (h *Handler) AdminWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooksPath := "internal/web/templates/webhooks.html"
+
+	type webhookRow struct {
+		*models.Webhook
+		Deliveries []*models.WebhookDelivery
+	}
+	type templateData struct {
+		Webhooks []webhookRow
+		Events   []struct {
+			Event string
+			Label string
+		}
+	}
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		userID, err := h.sessionUserID(r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
-		http.Redirect(w, r, "/create_categories", http.StatusSeeOther)
+		if err := r.ParseForm(); err != nil {
+			helpers.ErrorHandler(w, http.StatusBadRequest, err)
+			return
+		}
+		if r.FormValue("action") == "create" {
+			_, err = h.service.WebhookServiceInterface.CreateWebhook(userID, r.FormValue("url"), r.Form["event"])
+		} else {
+			webhookID, convErr := strconv.Atoi(r.FormValue("webhook_id"))
+			if convErr != nil {
+				helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Invalid webhook"))
+				return
+			}
+			switch r.FormValue("action") {
+			case "enable":
+				err = h.service.WebhookServiceInterface.SetWebhookActive(webhookID, true)
+			case "disable":
+				err = h.service.WebhookServiceInterface.SetWebhookActive(webhookID, false)
+			case "delete":
+				err = h.service.WebhookServiceInterface.DeleteWebhook(webhookID)
+			case "test":
+				err = h.service.WebhookServiceInterface.SendTestEvent(userID, webhookID)
+			default:
+				err = errors.New("Unknown action")
+			}
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			helpers.ErrorHandler(w, http.StatusNotFound, errors.New("Webhook not found"))
+			return
+		}
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusBadRequest, err)
+			return
+		}
+		http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
 		return
 	default:
-		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("in Admin Page Handler"))
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("in Admin Webhooks Handler"))
+		return
+	}
+
+	webhooks, err := h.service.WebhookServiceInterface.GetWebhooks()
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 		return
 	}
+	data := templateData{Events: models.WebhookEvents}
+	for _, webhook := range webhooks {
+		deliveries, err := h.service.WebhookServiceInterface.GetWebhookDeliveries(webhook.WebhookID)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+		data.Webhooks = append(data.Webhooks, webhookRow{Webhook: webhook, Deliveries: deliveries})
+	}
+	helpers.RenderTemplate(w, webhooksPath, data)
 }
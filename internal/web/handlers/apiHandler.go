@@ -0,0 +1,609 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/internal/models"
+	"forum/internal/service"
+	"forum/internal/web/handlers/helpers"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The JSON API lives under /api/v1. Every response is a JSON object: {"data": ...} on success, with
+// "pagination" next to it for lists, and {"error": {"code": ..., "message": ...}} on failure.
+// Clients authenticate with a personal access token or the session cookie, like the HTML pages.
+
+const (
+	apiPrefix         = "/api/v1/"
+	apiDefaultPerPage = 20
+	apiMaxPerPage     = 100
+	apiMaxBodySize    = 1 << 20
+)
+
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (err *apiError) Error() string {
+	return err.message
+}
+
+func newAPIError(status int, code, message string) *apiError {
+	return &apiError{status: status, code: code, message: message}
+}
+
+var (
+	errAPIUnauthorized = newAPIError(http.StatusUnauthorized, "unauthorized", "You need to log in or send an access token")
+	errAPINotFound     = newAPIError(http.StatusNotFound, "not_found", "Not found")
+)
+
+type apiErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiPagination struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+// apiRequest is what the handlers of one endpoint get: the caller, if any, and the IDs from the path.
+type apiRequest struct {
+	*http.Request
+	userID int                 // 0 when nobody is logged in
+	token  *models.AccessToken // nil for session cookies
+	ids    []int
+}
+
+type apiRoute struct {
+	method  string
+	pattern string // segments after /api/v1/, "{id}" matches a number
+	handle  func(*apiRequest) (int, interface{}, error)
+	doc     apiDoc
+}
+
+// apiDoc describes an endpoint for the OpenAPI document, which is built from the routes below so the
+// two cannot disagree. body and response are zero values of the types sent and returned.
+type apiDoc struct {
+	summary  string
+	auth     bool // needs a logged in user
+	query    []apiParam
+	body     interface{}
+	response interface{} // nil for 204 No Content
+	list     bool        // response is a page of them
+	action   bool        // a POST that acts on something instead of creating it, answered with 200
+}
+
+type apiParam struct {
+	name, description string
+}
+
+var apiPageParams = []apiParam{
+	{"page", "page number, from 1"},
+	{"per_page", "items per page, 1 to 100, 20 by default"},
+}
+
+var apiReasonParams = []apiParam{
+	{"reason", "why a moderator removes somebody else's content, sent to the author"},
+}
+
+func (h *Handler) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{"GET", "me", h.apiGetMe, apiDoc{summary: "The calling user", auth: true, response: apiMe{}}},
+		{"GET", "categories", h.apiListCategories, apiDoc{summary: "All categories", response: []apiCategory{}}},
+		{"GET", "notifications", h.apiListNotifications, apiDoc{summary: "Notifications of the caller, newest first",
+			auth: true, query: apiPageParams, response: apiNotification{}, list: true}},
+		{"POST", "notifications/{id}/read", h.apiMarkNotificationRead, apiDoc{summary: "Mark a notification as read", auth: true}},
+		{"POST", "notifications/read-all", h.apiMarkAllNotificationsRead, apiDoc{summary: "Mark all notifications of the caller as read", auth: true}},
+		{"GET", "notifications/preferences", h.apiGetNotificationPreferences, apiDoc{summary: "How each type of notification reaches the caller",
+			auth: true, response: apiNotificationPreferences{}}},
+		{"PATCH", "notifications/preferences", h.apiUpdateNotificationPreferences, apiDoc{summary: "Change how some types of notifications reach the caller",
+			auth: true, body: apiNotificationPreferences{}, response: apiNotificationPreferences{}}},
+		{"GET", "posts", h.apiListPosts, apiDoc{summary: "Posts, newest first", response: apiPost{}, list: true,
+			query: append([]apiParam{{"category", "only posts in this category"}, {"author", "only posts by this username"},
+				{"q", "only posts with this text in the title or content"}}, apiPageParams...)}},
+		{"POST", "posts", h.apiCreatePost, apiDoc{summary: "Create a post", auth: true, body: apiCreatePostBody{}, response: apiPost{}}},
+		{"GET", "posts/{id}", h.apiGetPost, apiDoc{summary: "One post", response: apiPost{}}},
+		{"PATCH", "posts/{id}", h.apiUpdatePost, apiDoc{summary: "Change the content of a post", auth: true, body: apiContentBody{}, response: apiPost{}}},
+		{"DELETE", "posts/{id}", h.apiDeletePost, apiDoc{summary: "Delete a post with its comments", auth: true, query: apiReasonParams}},
+		{"PUT", "posts/{id}/reaction", h.apiReactOnPost, apiDoc{summary: "Set the caller's reaction to a post", auth: true, body: apiReactionBody{}, response: apiPost{}}},
+		{"GET", "posts/{id}/comments", h.apiListComments, apiDoc{summary: "Comments on a post, oldest first", query: apiPageParams, response: apiComment{}, list: true}},
+		{"POST", "posts/{id}/comments", h.apiCreateComment, apiDoc{summary: "Comment on a post", auth: true, body: apiContentBody{}, response: apiComment{}}},
+		{"GET", "comments/{id}", h.apiGetComment, apiDoc{summary: "One comment", response: apiComment{}}},
+		{"PATCH", "comments/{id}", h.apiUpdateComment, apiDoc{summary: "Change the content of a comment", auth: true, body: apiContentBody{}, response: apiComment{}}},
+		{"DELETE", "comments/{id}", h.apiDeleteComment, apiDoc{summary: "Delete a comment", auth: true, query: apiReasonParams}},
+		{"PUT", "comments/{id}/reaction", h.apiReactOnComment, apiDoc{summary: "Set the caller's reaction to a comment", auth: true, body: apiReactionBody{}, response: apiComment{}}},
+		{"GET", "moderation/queue", h.apiModerationQueue, apiDoc{summary: "Content waiting for a moderator, oldest first", auth: true, query: apiPageParams, response: apiQueueItem{}, list: true}},
+		{"POST", "posts/{id}/approve", h.apiApprovePost, apiDoc{summary: "Approve a post", auth: true, response: apiPost{}, action: true}},
+		{"POST", "posts/{id}/report", h.apiReportPost, apiDoc{summary: "Report a post to the administrators", auth: true, body: apiReportBody{}, response: apiPost{}, action: true}},
+		{"POST", "posts/{id}/resolve", h.apiResolveReport, apiDoc{summary: "Answer the report on a post: keep or remove the post", auth: true, body: apiResolveBody{}}},
+		{"POST", "comments/{id}/approve", h.apiApproveComment, apiDoc{summary: "Approve a comment", auth: true, response: apiComment{}, action: true}},
+	}
+}
+
+// APIHandler serves every /api/v1 endpoint. Like the router of the HTML pages it serves HEAD with the
+// GET endpoint, answers OPTIONS with the methods of the path and a wrong method with 405, only in JSON.
+func (h *Handler) APIHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/")
+	methods := map[string]bool{}
+	for _, route := range h.apiRoutes() {
+		ids, ok := matchAPIRoute(route.pattern, path)
+		if !ok {
+			continue
+		}
+		methods[route.method] = true
+		if route.method != r.Method && (r.Method != "HEAD" || route.method != "GET") {
+			continue
+		}
+		if r.Method == "HEAD" {
+			// the server leaves the body out of the response
+			r = r.WithContext(r.Context())
+			r.Method = "GET"
+		}
+		req, err := h.apiAuthenticate(r)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		req.ids = ids
+		status, data, err := route.handle(req)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeAPIData(w, status, data)
+		return
+	}
+	if len(methods) != 0 {
+		w.Header().Set("Allow", allowHeader(methods))
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeAPIError(w, newAPIError(http.StatusMethodNotAllowed, "method_not_allowed", r.Method+" is not supported here"))
+		return
+	}
+	writeAPIError(w, errAPINotFound)
+}
+
+func matchAPIRoute(pattern, path string) ([]int, bool) {
+	patternParts, pathParts := strings.Split(pattern, "/"), strings.Split(path, "/")
+	if len(patternParts) != len(pathParts) {
+		return nil, false
+	}
+	var ids []int
+	for i, part := range patternParts {
+		if part != "{id}" {
+			if part != pathParts[i] {
+				return nil, false
+			}
+			continue
+		}
+		id, err := strconv.Atoi(pathParts[i])
+		if err != nil || id < 1 {
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// apiAuthenticate works out who is calling. Anonymous requests are let through, the endpoints that
+// need a user ask for one with requireUser. Unlike the HTML pages, a bad token is always an error.
+// Browsers send the session cookie with requests other sites make, so changes made with it have to be
+// sent as JSON: a page on another site cannot send that without the permission of a CORS preflight,
+// which the API never gives, while forms and simple requests can reach the endpoints without a body.
+func (h *Handler) apiAuthenticate(r *http.Request) (*apiRequest, error) {
+	req := &apiRequest{Request: r}
+	if header := r.Header.Get("Authorization"); header != "" {
+		bearer, found := strings.CutPrefix(header, "Bearer ")
+		if !found {
+			return nil, newAPIError(http.StatusUnauthorized, "unauthorized", "Only Bearer authorization is supported")
+		}
+		token, err := h.service.TokenServiceInterface.AuthenticateToken(strings.TrimSpace(bearer))
+		if err != nil {
+			return nil, newAPIError(http.StatusUnauthorized, "invalid_token", err.Error())
+		}
+		req.userID, req.token = token.UserID, token
+		return req, nil
+	}
+	if cookie := helpers.SessionCookieGet(r); cookie != nil {
+		if session, err := h.service.UserServiceInterface.GetSession(cookie.Value); err == nil {
+			if !isSafeMethod(r.Method) && !isJSONRequest(r) {
+				return nil, newAPIError(http.StatusForbidden, "json_required",
+					"Changes made with the session cookie must be sent with Content-Type: application/json")
+			}
+			req.userID = session.UserID
+		}
+	}
+	return req, nil
+}
+
+func (req *apiRequest) requireUser() error {
+	if req.userID == 0 {
+		return errAPIUnauthorized
+	}
+	return nil
+}
+
+// apiRequirePermission checks the role of the caller and, for access tokens, the scope the permission needs.
+func (h *Handler) apiRequirePermission(req *apiRequest, perm models.Permission) error {
+	if err := req.requireUser(); err != nil {
+		return err
+	}
+	allowed, err := h.service.UserServiceInterface.HasPermission(req.userID, perm)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return newAPIError(http.StatusForbidden, "forbidden", "You do not have permission to do this")
+	}
+	return req.requireScope(models.PermissionScopes[perm])
+}
+
+// scope is what the request may do with the user's role, see requestScope.
+func (req *apiRequest) scope() models.TokenScope {
+	if req.token != nil {
+		return req.token.Scope
+	}
+	return models.SessionScope
+}
+
+func (req *apiRequest) requireScope(scope models.TokenScope) error {
+	if req.token != nil && !models.ScopeIncludes(req.token.Scope, scope) {
+		return newAPIError(http.StatusForbidden, "insufficient_scope", fmt.Sprintf("This needs an access token with the %s scope", scope))
+	}
+	return nil
+}
+
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// decodeBody reads the JSON request body into v, only JSON is accepted.
+func (req *apiRequest) decodeBody(v interface{}) error {
+	if !isJSONRequest(req.Request) {
+		return newAPIError(http.StatusUnsupportedMediaType, "unsupported_media_type", "The request body must be JSON")
+	}
+	decoder := json.NewDecoder(io.LimitReader(req.Body, apiMaxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return newAPIError(http.StatusBadRequest, "invalid_body", "The request body is not valid: "+err.Error())
+	}
+	return nil
+}
+
+// pageParams reads ?page= and ?per_page=, pages start at 1.
+func (req *apiRequest) pageParams() (int, int, error) {
+	page, perPage := 1, apiDefaultPerPage
+	query := req.URL.Query()
+	if value := query.Get("page"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return 0, 0, newAPIError(http.StatusBadRequest, "invalid_parameter", "page must be a positive number")
+		}
+		page = number
+	}
+	if value := query.Get("per_page"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 || number > apiMaxPerPage {
+			return 0, 0, newAPIError(http.StatusBadRequest, "invalid_parameter", fmt.Sprintf("per_page must be between 1 and %d", apiMaxPerPage))
+		}
+		perPage = number
+	}
+	return page, perPage, nil
+}
+
+// apiPage is a list response: one page of items and where it is in the whole list.
+type apiPage struct {
+	items      interface{}
+	pagination apiPagination
+}
+
+// paginate cuts the page out of total items; the caller slices its list with the returned bounds.
+func (req *apiRequest) paginate(total int) (int, int, apiPagination, error) {
+	page, perPage, err := req.pageParams()
+	if err != nil {
+		return 0, 0, apiPagination{}, err
+	}
+	pagination := apiPagination{Page: page, PerPage: perPage, Total: total, TotalPages: (total + perPage - 1) / perPage}
+	start := (page - 1) * perPage
+	if start > total {
+		start = total
+	}
+	end := start + perPage
+	if end > total {
+		end = total
+	}
+	return start, end, pagination, nil
+}
+
+func writeAPIData(w http.ResponseWriter, status int, data interface{}) {
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	body := map[string]interface{}{"data": data}
+	if page, ok := data.(apiPage); ok {
+		body = map[string]interface{}{"data": page.items, "pagination": page.pagination}
+	}
+	writeAPIJSON(w, status, body)
+}
+
+// writeAPIError turns the errors of the service layer into the status codes the HTML pages use for them.
+func writeAPIError(w http.ResponseWriter, err error) {
+	var apiErr *apiError
+	var locked *service.LockedOutError
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.Is(err, service.ErrForbidden):
+		apiErr = newAPIError(http.StatusForbidden, "forbidden", "You are not allowed to do this")
+	case errors.As(err, &locked):
+		apiErr = newAPIError(http.StatusTooManyRequests, "locked_out", err.Error())
+	default:
+		log.Printf("API error: %v", err)
+		apiErr = newAPIError(http.StatusInternalServerError, "internal_error", "Something went wrong")
+	}
+	if apiErr.status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	writeAPIJSON(w, apiErr.status, map[string]apiErrorBody{"error": {Code: apiErr.code, Message: apiErr.message}})
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// apiValidationError is for the messages the services return for bad input, which are meant for users.
+func apiValidationError(err error) error {
+	return newAPIError(http.StatusBadRequest, "validation_failed", err.Error())
+}
+
+type apiUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+type apiMe struct {
+	ID         int        `json:"id"`
+	Username   string     `json:"username"`
+	FirstName  string     `json:"first_name"`
+	SecondName string     `json:"second_name"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Bio        string     `json:"bio"`
+	AvatarURL  string     `json:"avatar_url"`
+	JoinedAt   *time.Time `json:"joined_at"`
+	Scope      string     `json:"token_scope,omitempty"`
+}
+
+func (h *Handler) apiGetMe(req *apiRequest) (int, interface{}, error) {
+	if err := req.requireUser(); err != nil {
+		return 0, nil, err
+	}
+	user, err := h.service.UserServiceInterface.GetUserByUserID(req.userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	profile, err := h.service.UserServiceInterface.GetUserProfile(req.userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	me := apiMe{
+		ID:         user.UserUserID,
+		Username:   user.Username,
+		FirstName:  user.FirstName,
+		SecondName: user.SecondName,
+		Email:      user.Email,
+		Role:       user.Role,
+		Bio:        profile.Bio,
+		AvatarURL:  fmt.Sprintf("/avatar/%d", user.UserUserID),
+	}
+	if !profile.JoinedTime.IsZero() {
+		me.JoinedAt = &profile.JoinedTime
+	}
+	if req.token != nil {
+		me.Scope = string(req.token.Scope)
+	}
+	return http.StatusOK, me, nil
+}
+
+type apiCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (h *Handler) apiListCategories(req *apiRequest) (int, interface{}, error) {
+	categories, err := h.service.PostServiceInterface.GetAllCategories()
+	if err != nil {
+		return 0, nil, err
+	}
+	items := []apiCategory{}
+	for _, category := range categories {
+		items = append(items, apiCategory{category.CategoryID, category.Category})
+	}
+	return http.StatusOK, items, nil
+}
+
+type apiNotification struct {
+	ID        int        `json:"id"`
+	Type      string     `json:"type" enum:"post_reaction,post_comment,comment_reaction,login_failures,thread_comment,mention,approved,rejected,deleted,moderator_request,role_change"`
+	Message   string     `json:"message"`
+	Actor     *apiUser   `json:"actor"` // null when nobody in particular did it
+	PostID    int        `json:"post_id,omitempty"`
+	PostTitle string     `json:"post_title,omitempty"`
+	CommentID int        `json:"comment_id,omitempty"`
+	Reaction  string     `json:"reaction,omitempty" enum:"like,dislike"`
+	Count     int        `json:"count,omitempty"` // failed logins
+	Reason    string     `json:"reason,omitempty"`
+	OldRole   string     `json:"old_role,omitempty"`
+	NewRole   string     `json:"new_role,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+// apiListNotifications lists the notifications of the caller, newest first, like the notifications page.
+func (h *Handler) apiListNotifications(req *apiRequest) (int, interface{}, error) {
+	if err := req.requireUser(); err != nil {
+		return 0, nil, err
+	}
+	page, perPage, err := req.pageParams()
+	if err != nil {
+		return 0, nil, err
+	}
+	notifications, total, err := h.service.NotificationServiceInterface.GetNotifications(req.userID, perPage, (page-1)*perPage)
+	if err != nil {
+		return 0, nil, err
+	}
+	_, _, pagination, err := req.paginate(total)
+	if err != nil {
+		return 0, nil, err
+	}
+	items := []apiNotification{}
+	for _, notification := range notifications {
+		item := apiNotification{
+			ID:        notification.NotificationID,
+			Type:      notification.Type,
+			Message:   notification.Message(),
+			PostID:    notification.Payload.PostID,
+			PostTitle: notification.Payload.PostTitle,
+			CommentID: notification.Payload.CommentID,
+			Reaction:  notification.Payload.Reaction,
+			Count:     notification.Payload.Count,
+			Reason:    notification.Payload.Reason,
+			OldRole:   notification.Payload.OldRole,
+			NewRole:   notification.Payload.NewRole,
+			CreatedAt: notification.CreatedTime,
+		}
+		if notification.ActorID != 0 {
+			item.Actor = &apiUser{ID: notification.ActorID, Username: notification.ActorUsername}
+		}
+		if notification.IsRead() {
+			item.ReadAt = &notification.ReadTime
+		}
+		items = append(items, item)
+	}
+	return http.StatusOK, apiPage{items, pagination}, nil
+}
+
+// apiNotificationPreferences maps notification types to how they reach the caller: "in_app",
+// "email_digest", "email" or "off".
+type apiNotificationPreferences struct {
+	Deliveries map[string]string `json:"deliveries"`
+}
+
+func (h *Handler) apiGetNotificationPreferences(req *apiRequest) (int, interface{}, error) {
+	if err := req.requireUser(); err != nil {
+		return 0, nil, err
+	}
+	preferences, err := h.service.NotificationServiceInterface.GetNotificationPreferences(req.userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	result := apiNotificationPreferences{Deliveries: map[string]string{}}
+	for _, kind := range models.NotificationTypes {
+		result.Deliveries[kind.Type] = preferences.Delivery(kind.Type)
+	}
+	return http.StatusOK, result, nil
+}
+
+// apiUpdateNotificationPreferences changes the deliveries given in the body and keeps the others.
+func (h *Handler) apiUpdateNotificationPreferences(req *apiRequest) (int, interface{}, error) {
+	if err := req.requireUser(); err != nil {
+		return 0, nil, err
+	}
+	if err := req.requireScope(models.ScopeWrite); err != nil {
+		return 0, nil, err
+	}
+	var body apiNotificationPreferences
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	preferences, err := h.service.NotificationServiceInterface.GetNotificationPreferences(req.userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	for notificationType, delivery := range body.Deliveries {
+		if !models.IsNotificationType(notificationType) || !models.IsNotificationDelivery(delivery) {
+			return 0, nil, newAPIError(http.StatusBadRequest, "validation_failed",
+				fmt.Sprintf("%q cannot be delivered as %q", notificationType, delivery))
+		}
+		preferences.Deliveries[notificationType] = delivery
+	}
+	if err := h.service.NotificationServiceInterface.UpdateNotificationPreferences(preferences); err != nil {
+		return 0, nil, err
+	}
+	return h.apiGetNotificationPreferences(req)
+}
+
+func (h *Handler) apiMarkNotificationRead(req *apiRequest) (int, interface{}, error) {
+	if err := req.requireUser(); err != nil {
+		return 0, nil, err
+	}
+	if err := req.requireScope(models.ScopeWrite); err != nil {
+		return 0, nil, err
+	}
+	err := h.service.NotificationServiceInterface.MarkNotificationRead(req.userID, req.ids[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil, errAPINotFound
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func (h *Handler) apiMarkAllNotificationsRead(req *apiRequest) (int, interface{}, error) {
+	if err := req.requireUser(); err != nil {
+		return 0, nil, err
+	}
+	if err := req.requireScope(models.ScopeWrite); err != nil {
+		return 0, nil, err
+	}
+	if err := h.service.NotificationServiceInterface.MarkAllNotificationsRead(req.userID); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+// apiUserCache looks users up once per request, lists show the same authors over and over.
+func (h *Handler) apiUserCache() func(int) apiUser {
+	cache := map[int]apiUser{}
+	return func(userID int) apiUser {
+		if user, ok := cache[userID]; ok {
+			return user
+		}
+		user := apiUser{ID: userID}
+		if found, err := h.service.UserServiceInterface.GetUserByUserID(userID); err == nil {
+			user.Username = found.Username
+		}
+		cache[userID] = user
+		return user
+	}
+}
+
+func reactionName(reaction int) string {
+	switch reaction {
+	case 1:
+		return "like"
+	case -1:
+		return "dislike"
+	}
+	return "none"
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"forum/internal/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Changes made with the session cookie need a JSON request, which other sites cannot make in the
+// browser of a visitor. Access tokens are not sent by browsers on their own and need nothing more.
+func TestAPISessionChangesNeedJSON(t *testing.T) {
+	forum := newTestForum(t)
+	userID := forum.user("reader", models.RoleUser)
+	session := forum.session(userID)
+	tests := []struct {
+		name        string
+		auth        interface{}
+		contentType string
+		status      int
+	}{
+		{"session without a content type", session, "", http.StatusForbidden},
+		{"session with a form", session, "application/x-www-form-urlencoded", http.StatusForbidden},
+		{"session with JSON", session, "application/json", http.StatusNoContent},
+		{"token without a content type", forum.token(userID, models.ScopeWrite), "", http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := forum.request("POST", "/api/v1/notifications/read-all", nil, test.auth)
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+			res := forum.do(req)
+			if res.Code != test.status {
+				t.Errorf("status %d, want %d: %s", res.Code, test.status, res.Body.String())
+			}
+		})
+	}
+
+	// reading needs nothing
+	res := forum.do(forum.request("GET", "/api/v1/me", nil, session))
+	if res.Code != http.StatusOK {
+		t.Errorf("GET with session: status %d", res.Code)
+	}
+}
+
+// The list of posts is filtered and paged by the database; waiting posts are seen by their author
+// and by moderators only, and the total counts what the caller may see.
+func TestAPIListPosts(t *testing.T) {
+	forum := newTestForum(t)
+	author := forum.user("author", models.RoleUser)
+	other := forum.user("other", models.RoleUser)
+	moderator := forum.user("moderator", models.RoleModerator)
+	first := forum.post(author, "Boba recipes")
+	second := forum.post(other, "Tea without boba")
+	third := forum.post(author, "Coffee")
+	waiting, err := forum.repo.PostRepoInterface.CreatePostRepo(&models.Post{
+		UserID: author, Title: "Waiting boba", Content: "Not approved yet", CreatedTime: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorSession := forum.session(author)
+
+	tests := []struct {
+		name  string
+		query string
+		auth  interface{}
+		ids   []int
+		total int
+	}{
+		{"anonymous", "", nil, []int{third, second, first}, 3},
+		{"author", "", authorSession, []int{int(waiting), third, second, first}, 4},
+		{"other user", "", forum.session(other), []int{third, second, first}, 3},
+		{"moderator", "", forum.session(moderator), []int{int(waiting), third, second, first}, 4},
+		{"search ignores case", "?q=BOBA", nil, []int{second, first}, 2},
+		{"search with waiting", "?q=boba", authorSession, []int{int(waiting), second, first}, 3},
+		{"by author", "?author=author", nil, []int{third, first}, 2},
+		{"unknown author", "?author=nobody", nil, []int{}, 0},
+		{"second page", "?per_page=2&page=2", nil, []int{first}, 3},
+		{"past the end", "?per_page=2&page=3", nil, []int{}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := forum.do(forum.request("GET", "/api/v1/posts"+test.query, nil, test.auth))
+			if res.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", res.Code, res.Body)
+			}
+			var body struct {
+				Data       []apiPost     `json:"data"`
+				Pagination apiPagination `json:"pagination"`
+			}
+			if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			ids := []int{}
+			for _, post := range body.Data {
+				ids = append(ids, post.ID)
+			}
+			if len(ids) != len(test.ids) || body.Pagination.Total != test.total {
+				t.Fatalf("posts %v of %d, want %v of %d", ids, body.Pagination.Total, test.ids, test.total)
+			}
+			for i := range ids {
+				if ids[i] != test.ids[i] {
+					t.Fatalf("posts %v, want %v", ids, test.ids)
+				}
+			}
+		})
+	}
+}
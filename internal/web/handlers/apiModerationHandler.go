@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"forum/internal/models"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type apiQueueItem struct {
+	Type      string    `json:"type" enum:"post,comment"`
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	Title     string    `json:"title,omitempty"` // of the post, also for comments
+	Content   string    `json:"content"`
+	Author    apiUser   `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	Report    string    `json:"report,omitempty"` // the reason a moderator reported the post for
+}
+
+type apiReportBody struct {
+	Reason string `json:"reason" enum:"irrelevant,obscene,illegal,insulting"`
+}
+
+type apiResolveBody struct {
+	Decision string `json:"decision" enum:"keep,remove"`
+	Reason   string `json:"reason,omitempty"` // sent to the author on remove, the report category by default
+}
+
+// apiModerationQueue lists what the moderation part of the feed shows the caller: unapproved posts and
+// comments for moderators, and for administrators also the posts that were reported to them.
+func (h *Handler) apiModerationQueue(req *apiRequest) (int, interface{}, error) {
+	if err := h.apiRequirePermission(req, models.PermApproveContent); err != nil {
+		return 0, nil, err
+	}
+	resolver, err := h.service.UserServiceInterface.HasPermission(req.userID, models.PermResolveReports)
+	if err != nil {
+		return 0, nil, err
+	}
+	posts, err := h.service.PostServiceInterface.GetAllPosts()
+	if err != nil {
+		return 0, nil, err
+	}
+	comments, err := h.service.CommentServiceInterface.GetUnapprovedComments()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	users := h.apiUserCache()
+	titles := map[int]string{}
+	items := []apiQueueItem{}
+	for _, post := range posts {
+		titles[post.PostID] = post.Title
+		reported := post.ReportStatus == 1
+		if post.IsApproved == 1 && !(reported && resolver) {
+			continue
+		}
+		item := apiQueueItem{
+			Type:      "post",
+			ID:        post.PostID,
+			PostID:    post.PostID,
+			Title:     post.Title,
+			Content:   post.Content,
+			Author:    users(post.UserID),
+			CreatedAt: post.CreatedTime,
+		}
+		if reported {
+			item.Report = post.ReportCategories
+		}
+		items = append(items, item)
+	}
+	for _, comment := range comments {
+		title, ok := titles[comment.PostID]
+		if !ok {
+			continue // left behind by a deleted post
+		}
+		items = append(items, apiQueueItem{
+			Type:      "comment",
+			ID:        comment.CommentID,
+			PostID:    comment.PostID,
+			Title:     title,
+			Content:   comment.Content,
+			Author:    users(comment.UserID),
+			CreatedAt: comment.CreatedTime,
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].CreatedAt.Before(items[j].CreatedAt) })
+
+	start, end, pagination, err := req.paginate(len(items))
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, apiPage{items[start:end], pagination}, nil
+}
+
+func (h *Handler) apiApprovePost(req *apiRequest) (int, interface{}, error) {
+	if err := h.apiRequirePermission(req, models.PermApproveContent); err != nil {
+		return 0, nil, err
+	}
+	post, err := h.apiVisiblePost(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := h.service.PostServiceInterface.ApprovePost(req.userID, req.scope(), post.PostID); err != nil {
+		return 0, nil, err
+	}
+	return h.apiGetPost(req)
+}
+
+func (h *Handler) apiApproveComment(req *apiRequest) (int, interface{}, error) {
+	if err := h.apiRequirePermission(req, models.PermApproveContent); err != nil {
+		return 0, nil, err
+	}
+	comment, err := h.apiVisibleComment(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := h.service.CommentServiceInterface.ApproveComment(req.userID, req.scope(), comment.CommentID); err != nil {
+		return 0, nil, err
+	}
+	return h.apiGetComment(req)
+}
+
+// apiReportPost is the report button of moderators: the post goes to the administrators with a reason.
+func (h *Handler) apiReportPost(req *apiRequest) (int, interface{}, error) {
+	if err := h.apiRequirePermission(req, models.PermReportContent); err != nil {
+		return 0, nil, err
+	}
+	post, err := h.apiVisiblePost(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	var body apiReportBody
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	switch body.Reason {
+	case "irrelevant", "obscene", "illegal", "insulting":
+	default:
+		return 0, nil, newAPIError(http.StatusBadRequest, "validation_failed", `reason must be "irrelevant", "obscene", "illegal" or "insulting"`)
+	}
+	if err := h.service.PostServiceInterface.ChangeReportStatusOfPostbyPostID(post.PostID, 1); err != nil {
+		return 0, nil, err
+	}
+	if err := h.service.PostServiceInterface.AddPostReportCategory(post.PostID, body.Reason); err != nil {
+		return 0, nil, err
+	}
+	return h.apiGetPost(req)
+}
+
+// apiResolveReport answers a report like the buttons of administrators do: keep approves the post and
+// clears the report, remove deletes the post.
+func (h *Handler) apiResolveReport(req *apiRequest) (int, interface{}, error) {
+	if err := h.apiRequirePermission(req, models.PermResolveReports); err != nil {
+		return 0, nil, err
+	}
+	post, err := h.apiVisiblePost(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	var body apiResolveBody
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	if post.ReportStatus != 1 {
+		return 0, nil, newAPIError(http.StatusConflict, "not_reported", "The post has not been reported")
+	}
+	switch body.Decision {
+	case "keep":
+		if err := h.service.PostServiceInterface.ApprovePost(req.userID, req.scope(), post.PostID); err != nil {
+			return 0, nil, err
+		}
+		err = h.service.PostServiceInterface.ChangeReportStatusOfPostbyPostID(post.PostID, 0)
+	case "remove":
+		err = h.apiRemovePost(req, post.PostID, body.Reason)
+	default:
+		return 0, nil, newAPIError(http.StatusBadRequest, "validation_failed", `decision must be "keep" or "remove"`)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
@@ -0,0 +1,540 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"forum/internal/models"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type apiPost struct {
+	ID         int       `json:"id"`
+	Author     apiUser   `json:"author"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Categories []string  `json:"categories"`
+	ImageURL   string    `json:"image_url,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	Likes      int       `json:"likes"`
+	Dislikes   int       `json:"dislikes"`
+	Approved   bool      `json:"approved"`
+	MyReaction string    `json:"my_reaction,omitempty" enum:"like,dislike,none"` // only for logged in callers
+}
+
+type apiComment struct {
+	ID         int       `json:"id"`
+	PostID     int       `json:"post_id"`
+	Author     apiUser   `json:"author"`
+	Content    string    `json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+	Likes      int       `json:"likes"`
+	Dislikes   int       `json:"dislikes"`
+	Approved   bool      `json:"approved"`
+	MyReaction string    `json:"my_reaction,omitempty" enum:"like,dislike,none"`
+}
+
+type apiCreatePostBody struct {
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Categories []string `json:"categories"`
+}
+
+type apiContentBody struct {
+	Content string `json:"content"`
+}
+
+type apiReactionBody struct {
+	Reaction string `json:"reaction" enum:"like,dislike,none"`
+}
+
+// canSee applies the rule of the feed: unapproved content is only shown to its author and to moderators.
+func (h *Handler) canSee(req *apiRequest, ownerID, isApproved int) (bool, error) {
+	if isApproved == 1 {
+		return true, nil
+	}
+	if req.userID == 0 {
+		return false, nil
+	}
+	if req.userID == ownerID {
+		return true, nil
+	}
+	return h.service.UserServiceInterface.HasPermission(req.userID, models.PermApproveContent)
+}
+
+// apiVisiblePost returns the post of the request path, or not found when the caller may not see it.
+func (h *Handler) apiVisiblePost(req *apiRequest, postID int) (*models.Post, error) {
+	post, err := h.service.PostServiceInterface.GetPostByID(postID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errAPINotFound
+		}
+		return nil, err
+	}
+	visible, err := h.canSee(req, post.UserID, post.IsApproved)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, errAPINotFound
+	}
+	return post, nil
+}
+
+func (h *Handler) apiVisibleComment(req *apiRequest, commentID int) (*models.Comment, error) {
+	comment, err := h.service.CommentServiceInterface.GetCommentByID(commentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errAPINotFound
+		}
+		return nil, err
+	}
+	if _, err := h.apiVisiblePost(req, comment.PostID); err != nil {
+		return nil, err
+	}
+	visible, err := h.canSee(req, comment.UserID, comment.IsApproved)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, errAPINotFound
+	}
+	return comment, nil
+}
+
+// requireChangeScope is the token scope needed to edit or delete content: write for the caller's own,
+// moderate for anybody else's. The policy service refuses the same, this answers with the API's error.
+func (req *apiRequest) requireChangeScope(ownerID int) error {
+	if ownerID == req.userID {
+		return req.requireScope(models.ScopeWrite)
+	}
+	return req.requireScope(models.ScopeModerate)
+}
+
+func (h *Handler) toAPIPost(post *models.Post, users func(int) apiUser, reactions map[int]int) (apiPost, error) {
+	categories, err := h.service.PostServiceInterface.GetCategories(post.PostID)
+	if err != nil {
+		return apiPost{}, err
+	}
+	item := apiPost{
+		ID:         post.PostID,
+		Author:     users(post.UserID),
+		Title:      post.Title,
+		Content:    post.Content,
+		Categories: categories,
+		ImageURL:   post.ImagePath,
+		CreatedAt:  post.CreatedTime,
+		Likes:      post.LikesCounter,
+		Dislikes:   post.DislikeCounter,
+		Approved:   post.IsApproved == 1,
+	}
+	if reactions != nil {
+		item.MyReaction = reactionName(reactions[post.PostID])
+	}
+	return item, nil
+}
+
+func toAPIComment(comment *models.Comment, users func(int) apiUser, reactions map[int]int) apiComment {
+	item := apiComment{
+		ID:        comment.CommentID,
+		PostID:    comment.PostID,
+		Author:    users(comment.UserID),
+		Content:   comment.Content,
+		CreatedAt: comment.CreatedTime,
+		Likes:     comment.LikesCounter,
+		Dislikes:  comment.DislikeCounter,
+		Approved:  comment.IsApproved == 1,
+	}
+	if reactions != nil {
+		item.MyReaction = reactionName(reactions[comment.CommentID])
+	}
+	return item
+}
+
+// myPostReactions returns the reactions of the caller by post, or nil for anonymous callers.
+func (h *Handler) myPostReactions(req *apiRequest) (map[int]int, error) {
+	if req.userID == 0 {
+		return nil, nil
+	}
+	return h.service.PostServiceInterface.GetMyReactedPosts(req.userID)
+}
+
+func (h *Handler) myCommentReactions(req *apiRequest) (map[int]int, error) {
+	if req.userID == 0 {
+		return nil, nil
+	}
+	return h.service.CommentServiceInterface.GetMyReactedComments(req.userID)
+}
+
+// apiListPosts lists posts newest first, optionally only those in ?category= or by ?author= (a username),
+// and only those with ?q= in their title or content. The database filters and pages, the caller sees
+// the posts canSee lets through.
+func (h *Handler) apiListPosts(req *apiRequest) (int, interface{}, error) {
+	page, perPage, err := req.pageParams()
+	if err != nil {
+		return 0, nil, err
+	}
+	query := req.URL.Query()
+	postQuery := &models.PostQuery{
+		// lower case, as the category filter of the pages asks for it
+		Category: strings.ToLower(query.Get("category")),
+		Search:   strings.TrimSpace(query.Get("q")),
+		ViewerID: req.userID,
+		Limit:    perPage,
+		Offset:   (page - 1) * perPage,
+	}
+	if req.userID != 0 {
+		postQuery.WithUnapproved, err = h.service.UserServiceInterface.HasPermission(req.userID, models.PermApproveContent)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	if username := query.Get("author"); username != "" {
+		author, err := h.service.UserServiceInterface.GetUserByUsername(username)
+		if err != nil {
+			// an unknown author simply has no posts
+			_, _, pagination, err := req.paginate(0)
+			return http.StatusOK, apiPage{[]apiPost{}, pagination}, err
+		}
+		postQuery.AuthorID = author.UserUserID
+	}
+
+	posts, total, err := h.service.PostServiceInterface.QueryPosts(postQuery)
+	if err != nil {
+		return 0, nil, err
+	}
+	_, _, pagination, err := req.paginate(total)
+	if err != nil {
+		return 0, nil, err
+	}
+	reactions, err := h.myPostReactions(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	users := h.apiUserCache()
+	items := []apiPost{}
+	for _, post := range posts {
+		item, err := h.toAPIPost(post, users, reactions)
+		if err != nil {
+			return 0, nil, err
+		}
+		items = append(items, item)
+	}
+	return http.StatusOK, apiPage{items, pagination}, nil
+}
+
+func (h *Handler) apiGetPost(req *apiRequest) (int, interface{}, error) {
+	post, err := h.apiVisiblePost(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	reactions, err := h.myPostReactions(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	item, err := h.toAPIPost(post, h.apiUserCache(), reactions)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, item, nil
+}
+
+// apiCreatePost creates a post like the form on the feed does, without an image.
+func (h *Handler) apiCreatePost(req *apiRequest) (int, interface{}, error) {
+	if err := h.apiRequirePermission(req, models.PermCreateContent); err != nil {
+		return 0, nil, err
+	}
+	var body apiCreatePostBody
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	user, err := h.service.UserServiceInterface.GetUserByUserID(req.userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	post := &models.Post{
+		UserID:     req.userID,
+		Title:      body.Title,
+		Content:    body.Content,
+		Categories: body.Categories,
+	}
+	status, postID, err := h.service.PostServiceInterface.CreatePost(post, user.Role)
+	if err != nil {
+		if status == http.StatusBadRequest {
+			return 0, nil, apiValidationError(err)
+		}
+		return 0, nil, err
+	}
+	created, err := h.service.PostServiceInterface.GetPostByID(postID)
+	if err != nil {
+		return 0, nil, err
+	}
+	item, err := h.toAPIPost(created, h.apiUserCache(), map[int]int{})
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, item, nil
+}
+
+func (h *Handler) apiUpdatePost(req *apiRequest) (int, interface{}, error) {
+	if err := req.requireUser(); err != nil {
+		return 0, nil, err
+	}
+	post, err := h.apiVisiblePost(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := req.requireChangeScope(post.UserID); err != nil {
+		return 0, nil, err
+	}
+	var body apiContentBody
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	if strings.TrimSpace(body.Content) == "" {
+		return 0, nil, newAPIError(http.StatusBadRequest, "validation_failed", "content is required")
+	}
+	if err := h.service.PostServiceInterface.UpdatePostContentByPostID(req.userID, req.scope(), post.PostID, body.Content); err != nil {
+		return 0, nil, err
+	}
+	return h.apiGetPost(req)
+}
+
+func (h *Handler) apiDeletePost(req *apiRequest) (int, interface{}, error) {
+	if err := req.requireUser(); err != nil {
+		return 0, nil, err
+	}
+	post, err := h.apiVisiblePost(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := req.requireChangeScope(post.UserID); err != nil {
+		return 0, nil, err
+	}
+	if err := h.apiRemovePost(req, post.PostID, req.URL.Query().Get("reason")); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+// apiRemovePost takes the same steps as the delete button under a post. The reason is sent to the
+// author when a moderator removes it.
+func (h *Handler) apiRemovePost(req *apiRequest, postID int, reason string) error {
+	if err := h.service.PostServiceInterface.DeletePost(req.userID, req.scope(), postID, reason); err != nil {
+		return err
+	}
+	if err := h.service.PostServiceInterface.DeletePostCategoryByPostID(postID); err != nil {
+		return err
+	}
+	if err := h.service.PostServiceInterface.DeleteAllPostVotesByPostID(postID); err != nil {
+		return err
+	}
+	if err := h.service.CommentServiceInterface.DeleteAllCommentVotesByPostID(postID); err != nil {
+		return err
+	}
+	return h.service.CommentServiceInterface.DeleteAllCommentsByPostID(postID)
+}
+
+// apiReaction turns the reaction asked for into the value the services toggle with. The services
+// take back a reaction that is sent twice, so the call is made only when something changes:
+// PUT sets the reaction however often it is repeated.
+func apiReaction(req *apiRequest, previous int) (int, bool, error) {
+	var body apiReactionBody
+	if err := req.decodeBody(&body); err != nil {
+		return 0, false, err
+	}
+	var wanted int
+	switch body.Reaction {
+	case "like":
+		wanted = 1
+	case "dislike":
+		wanted = -1
+	case "none":
+		wanted = 0
+	default:
+		return 0, false, newAPIError(http.StatusBadRequest, "validation_failed", `reaction must be "like", "dislike" or "none"`)
+	}
+	switch {
+	case wanted == previous:
+		return 0, false, nil
+	case wanted == 0:
+		return previous, true, nil // sending the old reaction again removes it
+	default:
+		return wanted, true, nil
+	}
+}
+
+func (h *Handler) apiReactOnPost(req *apiRequest) (int, interface{}, error) {
+	if err := h.apiRequirePermission(req, models.PermReact); err != nil {
+		return 0, nil, err
+	}
+	post, err := h.apiVisiblePost(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	reactions, err := h.myPostReactions(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	reaction, change, err := apiReaction(req, reactions[post.PostID])
+	if err != nil {
+		return 0, nil, err
+	}
+	if change {
+		if err := h.service.PostServiceInterface.UpdateReaction(reaction, post.PostID, req.userID); err != nil {
+			return 0, nil, err
+		}
+	}
+	return h.apiGetPost(req)
+}
+
+func (h *Handler) apiListComments(req *apiRequest) (int, interface{}, error) {
+	post, err := h.apiVisiblePost(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	comments, err := h.service.CommentServiceInterface.GetAlCommentsForPost(post.PostID)
+	if err != nil {
+		return 0, nil, err
+	}
+	visible := []*models.Comment{}
+	for _, comment := range comments {
+		ok, err := h.canSee(req, comment.UserID, comment.IsApproved)
+		if err != nil {
+			return 0, nil, err
+		}
+		if ok {
+			visible = append(visible, comment)
+		}
+	}
+	// oldest first, the order a conversation is read in
+	sort.SliceStable(visible, func(i, j int) bool { return visible[i].CreatedTime.Before(visible[j].CreatedTime) })
+
+	start, end, pagination, err := req.paginate(len(visible))
+	if err != nil {
+		return 0, nil, err
+	}
+	reactions, err := h.myCommentReactions(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	users := h.apiUserCache()
+	items := []apiComment{}
+	for _, comment := range visible[start:end] {
+		items = append(items, toAPIComment(comment, users, reactions))
+	}
+	return http.StatusOK, apiPage{items, pagination}, nil
+}
+
+func (h *Handler) apiCreateComment(req *apiRequest) (int, interface{}, error) {
+	if err := h.apiRequirePermission(req, models.PermCreateContent); err != nil {
+		return 0, nil, err
+	}
+	post, err := h.apiVisiblePost(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	var body apiContentBody
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	user, err := h.service.UserServiceInterface.GetUserByUserID(req.userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	comment := &models.Comment{UserID: req.userID, PostID: post.PostID, Content: body.Content}
+	status, commentID, err := h.service.CommentServiceInterface.CreateComment(comment, user.Role)
+	if err != nil {
+		if status == http.StatusBadRequest {
+			return 0, nil, apiValidationError(err)
+		}
+		return 0, nil, err
+	}
+	created, err := h.service.CommentServiceInterface.GetCommentByID(commentID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, toAPIComment(created, h.apiUserCache(), map[int]int{}), nil
+}
+
+func (h *Handler) apiGetComment(req *apiRequest) (int, interface{}, error) {
+	comment, err := h.apiVisibleComment(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	reactions, err := h.myCommentReactions(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, toAPIComment(comment, h.apiUserCache(), reactions), nil
+}
+
+func (h *Handler) apiUpdateComment(req *apiRequest) (int, interface{}, error) {
+	if err := req.requireUser(); err != nil {
+		return 0, nil, err
+	}
+	comment, err := h.apiVisibleComment(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := req.requireChangeScope(comment.UserID); err != nil {
+		return 0, nil, err
+	}
+	var body apiContentBody
+	if err := req.decodeBody(&body); err != nil {
+		return 0, nil, err
+	}
+	if strings.TrimSpace(body.Content) == "" {
+		return 0, nil, newAPIError(http.StatusBadRequest, "validation_failed", "content is required")
+	}
+	if err := h.service.CommentServiceInterface.UpdateCommentContentByPostID(req.userID, req.scope(), comment.CommentID, body.Content); err != nil {
+		return 0, nil, err
+	}
+	return h.apiGetComment(req)
+}
+
+func (h *Handler) apiDeleteComment(req *apiRequest) (int, interface{}, error) {
+	if err := req.requireUser(); err != nil {
+		return 0, nil, err
+	}
+	comment, err := h.apiVisibleComment(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := req.requireChangeScope(comment.UserID); err != nil {
+		return 0, nil, err
+	}
+	if err := h.service.CommentServiceInterface.DeleteCommentByCommentID(req.userID, req.scope(), comment.CommentID, req.URL.Query().Get("reason")); err != nil {
+		return 0, nil, err
+	}
+	if err := h.service.CommentServiceInterface.DeleteAllCommentVotesByCommentID(comment.CommentID); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func (h *Handler) apiReactOnComment(req *apiRequest) (int, interface{}, error) {
+	if err := h.apiRequirePermission(req, models.PermReact); err != nil {
+		return 0, nil, err
+	}
+	comment, err := h.apiVisibleComment(req, req.ids[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	reactions, err := h.myCommentReactions(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	reaction, change, err := apiReaction(req, reactions[comment.CommentID])
+	if err != nil {
+		return 0, nil, err
+	}
+	if change {
+		if err := h.service.CommentServiceInterface.UpdateReaction(reaction, comment.CommentID, req.userID); err != nil {
+			return 0, nil, err
+		}
+	}
+	return h.apiGetComment(req)
+}
@@ -3,88 +3,42 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"forum/internal/models"
+	"forum/internal/oauth"
+	"forum/internal/service"
 	helpers "forum/internal/web/handlers/helpers"
+	"net"
 	"net/http"
-
-	"golang.org/x/crypto/bcrypt"
+	"strconv"
+	"time"
 )
 
+type registrationData struct {
+	InviteRole string
+	Providers  []oauth.ProviderInfo
+}
+
 func (h *Handler) RegistrationHandler(w http.ResponseWriter, r *http.Request) {
 	registerPath := "internal/web/templates/registration.html"
 
 	switch r.Method {
 	case "GET":
-		helpers.RenderTemplate(w, registerPath, nil)
+		helpers.RenderTemplate(w, registerPath, registrationData{Providers: h.oauth.List()})
 		return
 	case "POST":
-
-		var validationErrors []string
-
-		// Retrieve form values
-		firstName := r.FormValue("firstName")
-		secondName := r.FormValue("secondName")
-		username := r.FormValue("username")
-		email := r.FormValue("email")
-		password := r.FormValue("password")
-
-		// Input validation
-		if firstName == "" {
-			validationErrors = append(validationErrors, "First Name is required.")
-		}
-		if secondName == "" {
-			validationErrors = append(validationErrors, "Second Name is required.")
-		}
-		if username == "" {
-			validationErrors = append(validationErrors, "Username is required.")
-		}
-		if email == "" {
-			validationErrors = append(validationErrors, "Email is required.")
-		}
-		if password == "" {
-			validationErrors = append(validationErrors, "Password is required.")
-		}
-
+		user, validationErrors := parseRegistrationForm(r)
 		if len(validationErrors) > 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"errors":  validationErrors,
-			})
+			writeRegistrationErrors(w, http.StatusBadRequest, validationErrors)
 			return
 		}
 
-		// Encrypt password
-		psw, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-		var userRole string
-		admin := r.FormValue("admin") == "on"
-		if admin {
-			userRole = "admin"
-		} else {
-			userRole = "user"
-		}
-
-		user := &models.User{
-			FirstName:  firstName,
-			SecondName: secondName,
-			Username:   username,
-			Email:      email,
-			Password:   string(psw),
-			Role:       userRole,
-		}
+		// public registration only ever creates regular users
+		user.Role = models.RoleUser
 
 		statusCode, id, err := h.service.UserServiceInterface.CreateUser(user)
 		if err != nil {
-			validationErrors = append(validationErrors, err.Error())
-
-			// Use the statusCode to set appropriate HTTP response
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(statusCode)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"errors":  validationErrors,
-			})
+			writeRegistrationErrors(w, statusCode, []string{err.Error()})
 			return
 		}
 
@@ -104,12 +58,100 @@ func (h *Handler) RegistrationHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// InviteHandler registers a staff member through a single-use invitation link.
+func (h *Handler) InviteHandler(w http.ResponseWriter, r *http.Request) {
+	registerPath := "internal/web/templates/registration.html"
+	token := pathParam(r, "token")
+
+	switch r.Method {
+	case "GET":
+		invitation, err := h.service.UserServiceInterface.GetInvitation(token)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusNotFound, err)
+			return
+		}
+		helpers.RenderTemplate(w, registerPath, registrationData{InviteRole: invitation.Role})
+		return
+	case "POST":
+		user, validationErrors := parseRegistrationForm(r)
+		if len(validationErrors) > 0 {
+			writeRegistrationErrors(w, http.StatusBadRequest, validationErrors)
+			return
+		}
+
+		statusCode, _, err := h.service.UserServiceInterface.AcceptInvitation(token, user)
+		if err != nil {
+			writeRegistrationErrors(w, statusCode, []string{err.Error()})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Registration successful! Redirecting to login...",
+		})
+		return
+	default:
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Invite Handler"))
+		return
+	}
+}
+
+func parseRegistrationForm(r *http.Request) (*models.User, []string) {
+	var validationErrors []string
+
+	// Retrieve form values
+	firstName := r.FormValue("firstName")
+	secondName := r.FormValue("secondName")
+	username := r.FormValue("username")
+	email := r.FormValue("email")
+	password := r.FormValue("password")
+
+	// Input validation
+	if firstName == "" {
+		validationErrors = append(validationErrors, "First Name is required.")
+	}
+	if secondName == "" {
+		validationErrors = append(validationErrors, "Second Name is required.")
+	}
+	if username == "" {
+		validationErrors = append(validationErrors, "Username is required.")
+	}
+	if email == "" {
+		validationErrors = append(validationErrors, "Email is required.")
+	}
+	if password == "" {
+		validationErrors = append(validationErrors, "Password is required.")
+	}
+	if len(validationErrors) > 0 {
+		return nil, validationErrors
+	}
+
+	// the password is validated and hashed by the service
+	return &models.User{
+		FirstName:  firstName,
+		SecondName: secondName,
+		Username:   username,
+		Email:      email,
+		Password:   password,
+	}, nil
+}
+
+func writeRegistrationErrors(w http.ResponseWriter, statusCode int, validationErrors []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"errors":  validationErrors,
+	})
+}
+
 func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	loginPath := "internal/web/templates/login.html"
 
 	switch r.Method {
 	case "GET":
-		helpers.RenderTemplate(w, loginPath, nil)
+		helpers.RenderTemplate(w, loginPath, struct{ Providers []oauth.ProviderInfo }{h.oauth.List()})
 		return
 	case "POST":
 
@@ -136,14 +178,20 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		session, err := h.service.UserServiceInterface.Login(email, password, admin)
+		session, failedAttempts, err := h.service.UserServiceInterface.Login(email, password, admin, clientIP(r))
 		if err != nil {
 			validationErrors = append(validationErrors, err.Error())
 		}
 
 		if len(validationErrors) > 0 {
+			statusCode := http.StatusUnauthorized
+			var lockedOut *service.LockedOutError
+			if errors.As(err, &lockedOut) {
+				statusCode = http.StatusTooManyRequests
+				w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(lockedOut.Until).Seconds())+1))
+			}
 			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
+			w.WriteHeader(statusCode)
 			json.NewEncoder(w).Encode(map[string]interface{}{
 				"success": false,
 				"errors":  validationErrors,
@@ -161,10 +209,14 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		// 	return
 		// }
 
+		message := "Login successful! Redirecting..."
+		if failedAttempts > 0 {
+			message = fmt.Sprintf("Login successful! Warning: there were %d failed attempts to log in to your account since your last login. If it was not you, consider changing your password.", failedAttempts)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": true,
-			"message": "Login successful! Redirecting...",
+			"message": message,
 		})
 		return
 
@@ -174,6 +226,74 @@ func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// clientIP is the address failed logins are counted against. X-Forwarded-For is not trusted,
+// anyone could send it to spread their attempts over made up addresses.
+type passwordResetData struct {
+	Token   string // set once the link from the e-mail was opened
+	Sent    bool
+	Invalid bool // the link cannot be used, only the error is shown
+	Error   string
+}
+
+// ForgotPasswordHandler mails a link for choosing a new password. The page looks the same whether
+// or not an account uses the address.
+func (h *Handler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	resetPath := "internal/web/templates/passwordReset.html"
+
+	switch r.Method {
+	case "GET":
+		helpers.RenderTemplate(w, resetPath, passwordResetData{})
+	case "POST":
+		if err := h.service.UserServiceInterface.RequestPasswordReset(r.FormValue("email")); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			helpers.RenderTemplate(w, resetPath, passwordResetData{Error: err.Error()})
+			return
+		}
+		helpers.RenderTemplate(w, resetPath, passwordResetData{Sent: true})
+	default:
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Forgot Password Handler"))
+	}
+}
+
+// ResetPasswordHandler sets the new password with the token from the e-mail. A password the policy
+// refuses shows the form again, the link keeps working until one is accepted.
+func (h *Handler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	resetPath := "internal/web/templates/passwordReset.html"
+	token := pathParam(r, "token")
+
+	switch r.Method {
+	case "GET":
+		if err := h.service.UserServiceInterface.CheckPasswordReset(token); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			helpers.RenderTemplate(w, resetPath, passwordResetData{Invalid: true, Error: err.Error()})
+			return
+		}
+		helpers.RenderTemplate(w, resetPath, passwordResetData{Token: token})
+	case "POST":
+		if err := h.service.UserServiceInterface.CheckPasswordReset(token); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			helpers.RenderTemplate(w, resetPath, passwordResetData{Invalid: true, Error: err.Error()})
+			return
+		}
+		if err := h.service.UserServiceInterface.ResetPassword(token, r.FormValue("password")); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			helpers.RenderTemplate(w, resetPath, passwordResetData{Token: token, Error: err.Error()})
+			return
+		}
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	default:
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Reset Password Handler"))
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasswordResetPages(t *testing.T) {
+	forum := newTestForum(t)
+	forum.user("owner", "user")
+
+	res := forum.do(forum.request("GET", "/forgot_password", nil, nil))
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `action="/forgot_password"`) {
+		t.Fatalf("GET /forgot_password: status %d", res.Code)
+	}
+	for _, email := range []string{"owner@example.com", "nobody@example.com"} {
+		res = forum.do(forum.request("POST", "/forgot_password", url.Values{"email": {email}}, nil))
+		if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "If an account uses this email") {
+			t.Errorf("POST /forgot_password for %s: status %d", email, res.Code)
+		}
+	}
+
+	mails, err := forum.repo.MailRepoInterface.GetDueMails(time.Now().Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mails) != 1 || mails[0].To != "owner@example.com" {
+		t.Fatalf("mails %+v", mails)
+	}
+	link := regexp.MustCompile(`https://forum\.test(/reset_password/[0-9a-f]+)`).FindStringSubmatch(mails[0].Text)
+	if link == nil {
+		t.Fatalf("no link in %q", mails[0].Text)
+	}
+	resetPath := link[1]
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		password string
+		status   int
+	}{
+		{"form", "GET", resetPath, "", http.StatusOK},
+		{"unknown token", "GET", "/reset_password/0123", "", http.StatusBadRequest},
+		{"refused password", "POST", resetPath, "short", http.StatusBadRequest},
+		{"new password", "POST", resetPath, "a new long passphrase", http.StatusSeeOther},
+		{"used token", "GET", resetPath, "", http.StatusBadRequest},
+		{"used token again", "POST", resetPath, "another long passphrase", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		var form url.Values
+		if test.method == "POST" {
+			form = url.Values{"password": {test.password}}
+		}
+		res := forum.do(forum.request(test.method, test.path, form, nil))
+		if res.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.name, res.Code, test.status)
+		}
+	}
+
+	// logged in users change their password on the account page
+	session := forum.session(forum.user("reader", "user"))
+	if res := forum.do(forum.request("GET", "/forgot_password", nil, session)); res.Code == http.StatusOK {
+		t.Error("the reset form is shown to a logged in user")
+	}
+}
@@ -7,113 +7,29 @@ import (
 	"forum/internal/web/handlers/helpers"
 	"net/http"
 	"strconv"
-	"strings"
 )
 
+// DisplayCommentsHandler sends the addresses posts had before permalinks, /comments/{id}, to the
+// permalink, so that links shared back then keep working.
 func (h *Handler) DisplayCommentsHandler(w http.ResponseWriter, r *http.Request) {
-	commentsPath := "internal/web/templates/comments.html"
-	var userGlob *models.User
-	type templateData struct {
-		LoggedIn    bool
-		ThePost     *models.Post
-		User        *models.User
-		AllComments []*models.Comment
-	}
-
-	switch r.Method {
-	case "GET":
-		postId := getPostIDFromURL(r.URL.Path)
-		// fmt.Println("POSTID: ", postId)
-		post, err := h.service.PostServiceInterface.GetPostByID(postId)
-		if err != nil {
-			// fmt.Println("failed in getting the post")
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
-			return
-		}
-
-		// get username
-		user, err := h.service.UserServiceInterface.GetUserByUserID(post.UserID)
-		// fmt.Println("USERNAME LOGGED IN: ", user.Username)
-		if err != nil {
-			// fmt.Println("failed in getting User")
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
-			return
-		}
-		post.Username = user.Username
-
-		// change the time format
-		post.CreatedTimeString = post.CreatedTime.Format("Jan 2, 2006 at 15:04")
-		// fmt.Println("REACHING HERE")
-		cookie := helpers.SessionCookieGet(r)
-		if cookie != nil {
-			expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
-			if err != nil {
-				helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("The Time cannot be extended"))
-				return
-			}
-			if err := helpers.SessionCookieExtend(r, w, expTime); err != nil {
-				helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended"))
-				return
-			}
-			// getting info about the looged user
-			session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
-			if err != nil {
-				helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Session cannot be returned"))
-			}
-			userGlob, err = h.service.UserServiceInterface.GetUserByUserID(session.UserID)
-
-			if err != nil {
-				helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("User cannot be get because no session"))
-			}
-		}
-		comments, err := h.service.CommentServiceInterface.GetAlCommentsForPost(postId)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
-			return
-		}
-
-		for _, comment := range comments {
-			// fmt.Println(comment.Content, " :: ", comment.IsApproved)
-			user, err := h.service.UserServiceInterface.GetUserByUserID(comment.UserID)
-			if err != nil {
-				helpers.ErrorHandler(w, http.StatusInternalServerError, err)
-				return
-			}
-			comment.Username = user.Username
-			comment.CreatedTimeString = comment.CreatedTime.Format("Jan 2, 2006 at 15:04")
-			if userGlob != nil {
-				comment.UserRole = userGlob.Role
-			}
-		}
-
-		helpers.RenderTemplate(w, commentsPath, templateData{h.service.IsUserLoggedIn(r), post, userGlob, comments})
-	default:
-		helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Error in DisplayCommentsHandler"))
+	if r.Method != "GET" && r.Method != "HEAD" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in DisplayCommentsHandler"))
 		return
 	}
-}
-
-func getPostIDFromURL(url string) int {
-	strID := strings.TrimPrefix(url, "/comments/")
-	id, err := strconv.Atoi(strID)
+	postID, err := strconv.Atoi(pathParam(r, "id"))
 	if err != nil {
-		return -1
+		helpers.ErrorHandler(w, http.StatusNotFound, errors.New("Post not found"))
+		return
 	}
-	return id
+	http.Redirect(w, r, h.postPath(postID), http.StatusMovedPermanently)
 }
 
 func (h *Handler) CreateCommentsHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Unauthenticated user during creating comment"))
-			return
-		}
-
-		session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Session doesn't exist"))
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -139,17 +55,7 @@ func (h *Handler) CreateCommentsHandler(w http.ResponseWriter, r *http.Request)
 			helpers.ErrorHandler(w, statusCode, err)
 			return
 		}
-
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("The Time cannot be extended"))
-			return
-		}
-		if err := helpers.SessionCookieExtend(r, w, expTime); err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended"))
-			return
-		}
-		http.Redirect(w, r, "/comments/"+fmt.Sprint(comment.PostID), http.StatusSeeOther)
+		http.Redirect(w, r, h.postPath(comment.PostID), http.StatusSeeOther)
 		return
 	default:
 		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Comment creation Handler"))
@@ -173,15 +79,9 @@ func (h *Handler) ReactOnCommentHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie cannot be reseived in Comment Reaction Handler"))
-			return
-		}
-
-		session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, fmt.Errorf("Get Session in Reactin on Comment: %w", err))
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -194,19 +94,7 @@ func (h *Handler) ReactOnCommentHandler(w http.ResponseWriter, r *http.Request)
 			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 			return
 		}
-
-		// related to session an cookies updates:
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
-			return
-		}
-		http.Redirect(w, r, "/comments/"+fmt.Sprint(postId), http.StatusSeeOther)
+		http.Redirect(w, r, h.postPath(postId), http.StatusSeeOther)
 		return
 	default:
 		helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Error in Comment Reaction Handler"))
@@ -220,21 +108,12 @@ func (h *Handler) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
 		// fmt.Println("INSIDE DELETE HANDLER OF POST")
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("couldn't get the cookie in the Post Creation Handler"))
-			return
-		}
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("The Time cannot be extended"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("The Time cannot be extended"))
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
+
 		commentID := r.FormValue("commentId")
 		intCommentID, err := strconv.Atoi(commentID)
 		if err != nil {
@@ -243,15 +122,15 @@ func (h *Handler) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		// fmt.Println("COmment ID: ", intCommentID)
 
-		err = h.service.CommentServiceInterface.DeleteAllCommentVotesByCommentID(intCommentID)
+		err = h.service.CommentServiceInterface.DeleteCommentByCommentID(session.UserID, requestScope(r), intCommentID, r.FormValue("reason"))
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("failed when was deleting the votes for posts"))
+			helpers.ErrorHandler(w, serviceErrorStatus(err), fmt.Errorf("failed when was deleting the comment: %w", err))
 			return
 		}
 
-		err = h.service.CommentServiceInterface.DeleteCommentByCommentID(intCommentID)
+		err = h.service.CommentServiceInterface.DeleteAllCommentVotesByCommentID(intCommentID)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("failed when was deleting the post"))
+			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("failed when was deleting the votes for comment"))
 			return
 		}
 
@@ -261,7 +140,7 @@ func (h *Handler) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 			helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Converstion of PostID is not allowed"))
 			return
 		}
-		http.Redirect(w, r, "/comments/"+fmt.Sprint(postId), http.StatusSeeOther)
+		http.Redirect(w, r, h.postPath(postId), http.StatusSeeOther)
 		return
 	default:
 		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Post Handler"))
@@ -272,21 +151,9 @@ func (h *Handler) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ApproveCommentHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie cannot be reseived in ApprovePostHandler"))
-			return
-		}
-
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended in Approval of the Post"))
-			return
-		}
-
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -297,9 +164,9 @@ func (h *Handler) ApproveCommentHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		err = h.service.CommentServiceInterface.ApproveComment(intCommentID)
+		err = h.service.CommentServiceInterface.ApproveComment(session.UserID, requestScope(r), intCommentID)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("failed when was deleting the votes for posts"))
+			helpers.ErrorHandler(w, serviceErrorStatus(err), fmt.Errorf("failed when was approving the comment: %w", err))
 			return
 		}
 
@@ -309,7 +176,7 @@ func (h *Handler) ApproveCommentHandler(w http.ResponseWriter, r *http.Request)
 			helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Converstion of PostID is not allowed"))
 			return
 		}
-		http.Redirect(w, r, "/comments/"+fmt.Sprint(postId), http.StatusSeeOther)
+		http.Redirect(w, r, h.postPath(postId), http.StatusSeeOther)
 		return
 	default:
 		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Moderator Request Handler"))
@@ -322,19 +189,9 @@ func (h *Handler) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
 	// EditPostPagePath := "internal/web/templates/editPost.html"
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie failed in the Moderator Request Handler"))
-			return
-		}
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended in Approval of the Post"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -346,9 +203,9 @@ func (h *Handler) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		// fmt.Println(intCommentID, content)
-		err = h.service.CommentServiceInterface.UpdateCommentContentByPostID(intCommentID, content)
+		err = h.service.CommentServiceInterface.UpdateCommentContentByPostID(session.UserID, requestScope(r), intCommentID, content)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, serviceErrorStatus(err), err)
 			return
 		}
 		postId, err := strconv.Atoi(r.FormValue("postId"))
@@ -356,7 +213,7 @@ func (h *Handler) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
 			helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Converstion of PostID is not allowed"))
 			return
 		}
-		http.Redirect(w, r, "/comments/"+fmt.Sprint(postId), http.StatusSeeOther)
+		http.Redirect(w, r, h.postPath(postId), http.StatusSeeOther)
 		return
 	default:
 		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Moderator Request Handler"))
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"forum/internal/events"
+	"forum/internal/web/handlers/helpers"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	eventsHeartbeat = 25 * time.Second // keeps proxies from closing a quiet stream
+	// a stream ends after a while, the browser reconnects and the session is checked again
+	eventsMaxDuration = 15 * time.Minute
+)
+
+// EventsHandler streams the events of the logged in user as Server-Sent Events. Browsers reconnect
+// on their own and send Last-Event-ID, the events they missed in between are sent first. When they
+// are no longer known a "resync" event tells the page to reload what it shows.
+func (h *Handler) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Events Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id") // for clients that cannot set headers
+	}
+	sub, missed, complete := h.service.Events.Subscribe(userID, lastEventID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	if !complete {
+		fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+	}
+	for _, event := range missed {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	deadline := time.NewTimer(eventsMaxDuration)
+	defer deadline.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline.C:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, open := <-sub.C:
+			if !open {
+				return // dropped for falling behind, the browser reconnects and catches up
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		log.Printf("events: encoding %s: %v", event.Type, err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"forum/internal/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Event streams stay open for minutes. The server closes them when it shuts down, as InitServer sets
+// up, so that Shutdown does not wait for them until its deadline.
+func TestEventStreamsEndOnShutdown(t *testing.T) {
+	forum := newTestForum(t)
+	session := forum.session(forum.user("reader", models.RoleUser))
+	server := httptest.NewUnstartedServer(forum.router)
+	server.Config.RegisterOnShutdown(forum.service.Events.Close)
+	server.Start()
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(session)
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	stream := bufio.NewReader(res.Body)
+	if line, err := stream.ReadString('\n'); err != nil || !strings.HasPrefix(line, "retry:") {
+		t.Fatalf("stream starts with %q, %v", line, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	started := time.Now()
+	if err := server.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v after %v", err, time.Since(started).Round(time.Millisecond))
+	}
+	if rest, err := io.ReadAll(stream); err != nil || strings.TrimSpace(string(rest)) != "" {
+		t.Errorf("after shutdown the stream ends with %q, %v", rest, err)
+	}
+}
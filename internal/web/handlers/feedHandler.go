@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"forum/internal/models"
+	service "forum/internal/service"
+	"forum/internal/web/handlers/helpers"
+	"net/http"
+	"path"
+	"time"
+)
+
+// atomFeed and rssFeed are the two formats a models.Feed is written in: Atom (RFC 4287) at feed.xml
+// and RSS 2.0 at rss.xml.
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Links      []atomLink     `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     atomAuthor     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          rssSelf   `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssSelf struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Creator     string        `xml:"dc:creator"`
+	Categories  []string      `xml:"category"`
+	Description string        `xml:"description"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// FeedHandler serves the feeds of the latest approved posts: /feed.xml and /rss.xml for the front page,
+// /feeds/categories/{name}/feed.xml and /feeds/users/{username}/feed.xml (and rss.xml) for one
+// category or user. Feed readers poll, so every feed has an ETag. There is no Last-Modified date: posts
+// only keep when they were written, and edits and deletions change a feed without a newer post.
+func (h *Handler) FeedHandler(w http.ResponseWriter, r *http.Request) {
+	var feed *models.Feed
+	var err error
+	category, username := pathParam(r, "category"), pathParam(r, "username")
+	switch {
+	case category != "":
+		feed, err = h.service.FeedServiceInterface.GetCategoryFeed(category)
+	case username != "":
+		feed, err = h.service.FeedServiceInterface.GetUserFeed(username)
+	default:
+		feed, err = h.service.FeedServiceInterface.GetFrontPageFeed()
+	}
+	if errors.Is(err, service.ErrFeedNotFound) {
+		helpers.ErrorHandler(w, http.StatusNotFound, errors.New("Feed not found"))
+		return
+	}
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var body []byte
+	if path.Base(r.URL.Path) == "feed.xml" {
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		body, err = xml.MarshalIndent(newAtomFeed(feed), "", "  ")
+	} else {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		body, err = xml.MarshalIndent(newRSSFeed(feed), "", "  ")
+	}
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	body = append([]byte(xml.Header), body...)
+
+	sum := sha256.Sum256(body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+func newAtomFeed(feed *models.Feed) *atomFeed {
+	atom := &atomFeed{
+		Title:    feed.Title,
+		Subtitle: feed.Subtitle,
+		ID:       feed.AtomURL,
+		Updated:  feedUpdated(feed).Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "alternate", Href: feed.Link, Type: "text/html"},
+			{Rel: "self", Href: feed.AtomURL, Type: "application/atom+xml"},
+		},
+	}
+	for _, entry := range feed.Entries {
+		item := atomEntry{
+			Title:     entry.Title,
+			ID:        entry.ID,
+			Links:     []atomLink{{Rel: "alternate", Href: entry.Link, Type: "text/html"}},
+			Published: entry.Published.UTC().Format(time.RFC3339),
+			Updated:   entry.Published.UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: entry.Author, URI: entry.AuthorLink},
+			Content:   atomContent{Type: "html", Body: entry.ContentHTML},
+		}
+		if entry.Image != nil {
+			item.Links = append(item.Links, atomLink{Rel: "enclosure", Href: entry.Image.URL, Type: entry.Image.Type, Length: entry.Image.Length})
+		}
+		for _, category := range entry.Categories {
+			item.Categories = append(item.Categories, atomCategory{Term: category})
+		}
+		atom.Entries = append(atom.Entries, item)
+	}
+	return atom
+}
+
+func newRSSFeed(feed *models.Feed) *rssFeed {
+	rss := &rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       feed.Title,
+			Link:        feed.Link,
+			Description: feed.Subtitle,
+			Self:        rssSelf{Rel: "self", Href: feed.RSSURL, Type: "application/rss+xml"},
+		},
+	}
+	if !feed.Updated.IsZero() {
+		rss.Channel.LastBuildDate = feed.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, entry := range feed.Entries {
+		item := rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			GUID:        rssGUID{IsPermaLink: true, Value: entry.ID},
+			PubDate:     entry.Published.UTC().Format(time.RFC1123Z),
+			Creator:     entry.Author,
+			Categories:  entry.Categories,
+			Description: entry.ContentHTML,
+		}
+		if entry.Image != nil {
+			item.Enclosure = &rssEnclosure{URL: entry.Image.URL, Length: entry.Image.Length, Type: entry.Image.Type}
+		}
+		rss.Channel.Items = append(rss.Channel.Items, item)
+	}
+	return rss
+}
+
+// feedUpdated is when the feed last changed as far as Atom is concerned, which requires a date even
+// for a feed without entries.
+func feedUpdated(feed *models.Feed) time.Time {
+	if feed.Updated.IsZero() {
+		return time.Unix(0, 0).UTC()
+	}
+	return feed.Updated.UTC()
+}
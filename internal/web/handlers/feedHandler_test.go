@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Readers polling with the ETag get a 304 until a post changes, an edit included.
+func TestFeedConditionalRequests(t *testing.T) {
+	forum := newTestForum(t)
+	author := forum.user("author", "user")
+	postID := forum.post(author, "First post")
+
+	for _, target := range []string{"/feed.xml", "/rss.xml"} {
+		t.Run(target, func(t *testing.T) {
+			first := forum.do(forum.request("GET", target, nil, nil))
+			etag := first.Header().Get("ETag")
+			if first.Code != http.StatusOK || etag == "" {
+				t.Fatalf("status %d, ETag %q", first.Code, etag)
+			}
+			if modified := first.Header().Get("Last-Modified"); modified != "" {
+				t.Errorf("Last-Modified %q", modified)
+			}
+
+			req := forum.request("GET", target, nil, nil)
+			req.Header.Set("If-None-Match", etag)
+			if res := forum.do(req); res.Code != http.StatusNotModified || res.Body.Len() != 0 {
+				t.Fatalf("unchanged feed: status %d, %d bytes", res.Code, res.Body.Len())
+			}
+
+			if err := forum.repo.PostRepoInterface.UpdatePostContentByPostID(postID, "Edited for "+target); err != nil {
+				t.Fatal(err)
+			}
+			req = forum.request("GET", target, nil, nil)
+			req.Header.Set("If-None-Match", etag)
+			res := forum.do(req)
+			if res.Code != http.StatusOK || res.Header().Get("ETag") == etag {
+				t.Fatalf("edited feed: status %d, ETag %q", res.Code, res.Header().Get("ETag"))
+			}
+			if !strings.Contains(res.Body.String(), "Edited for "+target) {
+				t.Errorf("feed without the edit: %s", res.Body)
+			}
+		})
+	}
+}
+
+// Entries are identified by the short link of the post, which does not change with the title, and
+// link to the permalink with the slug.
+func TestFeedEntryIDs(t *testing.T) {
+	forum := newTestForum(t)
+	author := forum.user("author", "user")
+	postID := forum.post(author, "Hello world")
+	id := "https://forum.test/p/" + itoa(postID)
+	link := id + "/hello-world"
+
+	var atom struct {
+		Entries []struct {
+			ID    string `xml:"id"`
+			Links []struct {
+				Rel  string `xml:"rel,attr"`
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(forum.do(forum.request("GET", "/feed.xml", nil, nil)).Body.Bytes(), &atom); err != nil {
+		t.Fatal(err)
+	}
+	if len(atom.Entries) != 1 || atom.Entries[0].ID != id {
+		t.Fatalf("Atom entries %+v, want ID %s", atom.Entries, id)
+	}
+	if links := atom.Entries[0].Links; len(links) != 1 || links[0].Rel != "alternate" || links[0].Href != link {
+		t.Errorf("Atom links %+v, want %s", links, link)
+	}
+
+	var rss struct {
+		Items []struct {
+			Link string `xml:"link"`
+			GUID struct {
+				IsPermaLink string `xml:"isPermaLink,attr"`
+				Value       string `xml:",chardata"`
+			} `xml:"guid"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(forum.do(forum.request("GET", "/rss.xml", nil, nil)).Body.Bytes(), &rss); err != nil {
+		t.Fatal(err)
+	}
+	if len(rss.Items) != 1 || rss.Items[0].GUID.Value != id || rss.Items[0].GUID.IsPermaLink != "true" || rss.Items[0].Link != link {
+		t.Errorf("RSS items %+v, want guid %s and link %s", rss.Items, id, link)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"forum/internal/database"
+	"forum/internal/database/migration"
+	"forum/internal/mail"
+	"forum/internal/models"
+	"forum/internal/oauth"
+	"forum/internal/password"
+	"forum/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// the templates are loaded by paths relative to the root of the repository
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// testForum is the whole web application on a database of its own.
+type testForum struct {
+	t       *testing.T
+	repo    *database.Repository
+	service *service.Service
+	handler *Handler
+	router  http.Handler
+}
+
+func newTestForum(t *testing.T) *testForum {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := migration.CreateAllTables(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	repo := database.NewRepository(db)
+	mailer, err := mail.New(mail.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := service.NewService(repo, password.NewPolicy(password.Config{}), mailer, mail.Config{BaseURL: "https://forum.test"})
+	providers, err := oauth.NewRegistry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(srv, providers)
+	return &testForum{t: t, repo: repo, service: srv, handler: handler, router: handler.InitRouter()}
+}
+
+// user adds a user with the role and returns their ID.
+func (forum *testForum) user(username, role string) int {
+	forum.t.Helper()
+	id, err := forum.repo.UserRepoInterface.CreateUserRepo(&models.User{
+		Username: username,
+		Email:    username + "@example.com",
+		Role:     role,
+	})
+	if err != nil {
+		forum.t.Fatal(err)
+	}
+	return int(id)
+}
+
+// session logs the user in and returns the session cookie.
+func (forum *testForum) session(userID int) *http.Cookie {
+	forum.t.Helper()
+	session := &models.Session{UserID: userID, Token: uuid.New().String(), ExpTime: time.Now().Add(time.Hour)}
+	if err := forum.repo.UserRepoInterface.CreateSession(session); err != nil {
+		forum.t.Fatal(err)
+	}
+	return &http.Cookie{Name: cookieName, Value: session.Token}
+}
+
+// token returns a personal access token of the user with the scope.
+func (forum *testForum) token(userID int, scope models.TokenScope) string {
+	forum.t.Helper()
+	token, err := forum.service.TokenServiceInterface.CreateAccessToken(userID, "test", scope, time.Hour)
+	if err != nil {
+		forum.t.Fatal(err)
+	}
+	return token
+}
+
+// post adds an approved post by the user and returns its ID.
+func (forum *testForum) post(userID int, title string) int {
+	forum.t.Helper()
+	id, err := forum.repo.PostRepoInterface.CreatePostRepo(&models.Post{
+		UserID:      userID,
+		Title:       title,
+		Content:     "Content of " + title,
+		CreatedTime: time.Now(),
+		IsApproved:  1,
+	})
+	if err != nil {
+		forum.t.Fatal(err)
+	}
+	return int(id)
+}
+
+// request builds a request to the forum. A form makes it a form POST; auth is a session cookie,
+// an access token or nil.
+func (forum *testForum) request(method, target string, form url.Values, auth interface{}) *http.Request {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	switch auth := auth.(type) {
+	case *http.Cookie:
+		req.AddCookie(auth)
+	case string:
+		req.Header.Set("Authorization", "Bearer "+auth)
+	}
+	return req
+}
+
+func (forum *testForum) do(req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	forum.router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func (forum *testForum) postExists(postID int) bool {
+	forum.t.Helper()
+	_, err := forum.repo.PostRepoInterface.GetPostByID(postID)
+	if err != nil && err != sql.ErrNoRows {
+		forum.t.Fatal(err)
+	}
+	return err == nil
+}
+
+func itoa(n int) string {
+	return strconv.Itoa(n)
+}
@@ -1,66 +1,245 @@
 package handlers
 
 import (
+	"errors"
+	"forum/internal/models"
+	"forum/internal/oauth"
 	service "forum/internal/service"
+	"forum/internal/web/handlers/helpers"
 	"net/http"
-	"time"
+	"strconv"
+	"strings"
 )
 
 type Handler struct {
 	service *service.Service
+	oauth   *oauth.Registry
 }
 
-func NewHandler(service *service.Service) *Handler {
-	handlerObj := Handler{service: service}
+func NewHandler(service *service.Service, oauth *oauth.Registry) *Handler {
+	handlerObj := Handler{service: service, oauth: oauth}
 	return &handlerObj
 }
 
-func (handler *Handler) InitRouter() *http.ServeMux {
-	mux := http.NewServeMux()
-
-	images := http.FileServer(http.Dir("./data/assets/images"))
-	mux.Handle("/images/", http.StripPrefix("/images/", images))
-	mux.HandleFunc("/", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.GetMainPage)))
-	mux.HandleFunc("/registration", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.OnlyUnauthMiddleware(handler.RegistrationHandler))))
-	mux.HandleFunc("/login", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.OnlyUnauthMiddleware(handler.CheckCookieMiddleware(handler.LoginHandler))))
-	mux.HandleFunc("/logout", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.LogoutHandler))))
-	mux.HandleFunc("/submit-post", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.CreatePostHandler))))
-	mux.HandleFunc("/post/react", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ReactOnPostHandler))))
-	mux.HandleFunc("/comments/", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.DisplayCommentsHandler)))
-	mux.HandleFunc("/submit-comment", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.CreateCommentsHandler))))
-	mux.HandleFunc("/comment/react", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ReactOnCommentHandler))))
-	mux.HandleFunc("/filter/", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.FilterHandler)))
-	// authorisation
-	mux.HandleFunc("/auth/google/in", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.OnlyUnauthMiddleware(handler.GoogleAuthHandler))))
-	mux.HandleFunc("/google/callback", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.OnlyUnauthMiddleware(handler.GoogleCallback))))
-	mux.HandleFunc("/auth/github/in", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.OnlyUnauthMiddleware(handler.GithubAuthHandler))))
-	mux.HandleFunc("/github/callback", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.OnlyUnauthMiddleware(handler.GithubCallback))))
-	// moderation
-	mux.HandleFunc("/moderator", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ModeratorRequestHandler))))
-	mux.HandleFunc("/admin_page", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.AdminMainPageHandler))))
-	mux.HandleFunc("/approve-reject", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ApproveRejectModeratorHandler))))
-	mux.HandleFunc("/moderator_list", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ManageModeratorsHandler))))
-	mux.HandleFunc("/delete_moderator", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.DeleteModeratorHandler))))
-	mux.HandleFunc("/delete_post", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.DeletePostHandler))))
-	mux.HandleFunc("/delete_comment", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.DeleteCommentHandler))))
-	mux.HandleFunc("/approve_post", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ApprovePostHandler))))
-	mux.HandleFunc("/approve_comment", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ApproveCommentHandler))))
-	mux.HandleFunc("/report_post", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ReportPostHandler))))
-	mux.HandleFunc("/answer_report", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.AnswerPostReportHandler))))
-	mux.HandleFunc("/create_categories", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.AdminDisplayCategoriesHandler))))
-	mux.HandleFunc("/delete_category", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.AdminDeleteCategoryHandler))))
-	mux.HandleFunc("/add_category", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.AdminAddCategoryHandler))))
-	// advanced-features
-	mux.HandleFunc("/edit_post", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.EditPostHandler))))
-	mux.HandleFunc("/edit_comment", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.EditCommentHandler))))
-	mux.HandleFunc("/created_my_posts", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ShowMyPostsHandler))))
-	mux.HandleFunc("/reacted_posts", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ShowMyReactedPostsHandler))))
-	mux.HandleFunc("/reacted_comments", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ShowMyReactedCommentsHandler))))
-	mux.HandleFunc("/commented_posts", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ShowMyCommentsWithPostsHandler))))
-	mux.HandleFunc("/notifications", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.ShowMyNotificationsHandler))))
-	// dfhsdh
-	mux.HandleFunc("/check-notifications", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.CheckNotificationsHandler))))
-
-	mux.HandleFunc("/api/mark-notification-seen", NewRateLimiter(300, time.Minute).LimitMiddleware(handler.CheckCookieMiddleware(handler.NeedAuthMiddleware(handler.MarkNotificationSeenHandler))))
-	return mux
+// InitRouter builds the route table. Every group adds its middleware to the one it is made from:
+// public pages know the session, guest pages are only for visitors who are not logged in, the
+// authenticated group needs a login and the account group a session cookie rather than an access token.
+// Staff pages and the actions of users sit behind the permission they need. Rate limits are per route.
+func (handler *Handler) InitRouter() http.Handler {
+	router := newRouter()
+	images := http.StripPrefix("/images/", http.FileServer(http.Dir("./data/assets/images")))
+	router.group().handle(
+		route{"GET", "/images/{path...}", images.ServeHTTP},
+	)
+
+	// no session: the API authenticates on its own, feeds and avatars are the same for everyone
+	open := router.group(rateLimit)
+	open.handle(
+		route{"GET", "/api/openapi.json", handler.OpenAPIHandler},
+		route{methodAny, "/api/v1/{path...}", handler.APIHandler},
+		route{"GET", "/avatar/{id}", handler.AvatarHandler},
+		route{"GET", "/feed.xml", handler.FeedHandler},
+		route{"GET", "/rss.xml", handler.FeedHandler},
+		route{"GET", "/feeds/categories/{category}/feed.xml", handler.FeedHandler},
+		route{"GET", "/feeds/categories/{category}/rss.xml", handler.FeedHandler},
+		route{"GET", "/feeds/users/{username}/feed.xml", handler.FeedHandler},
+		route{"GET", "/feeds/users/{username}/rss.xml", handler.FeedHandler},
+		// addresses of posts before permalinks
+		route{"GET", "/comments/{id}", handler.DisplayCommentsHandler},
+	)
+
+	public := open.group(handler.CheckCookieMiddleware)
+	public.handle(
+		route{"GET", "/", handler.GetMainPage},
+		route{"GET", "/p/{id}", handler.PostPageHandler},
+		route{"GET", "/p/{id}/{slug}", handler.PostPageHandler},
+		route{"GET", "/filter/{field}", handler.FilterHandler},
+		route{"GET", "/u/{username}", handler.PublicProfileHandler},
+		route{"GET", "/confirm_email/{token}", handler.ConfirmEmailHandler},
+		// logged in users come here too, to link providers to their account
+		route{"GET", "/auth/{provider}/in", handler.OAuthSignInHandler},
+		route{"GET", "/auth/{provider}/callback", handler.OAuthCallbackHandler},
+		// callback URLs registered before the providers were made configurable
+		route{"GET", "/google/callback", handler.OAuthCallbackHandler},
+		route{"GET", "/github/callback", handler.OAuthCallbackHandler},
+	)
+
+	guest := public.group(handler.OnlyUnauthMiddleware)
+	guest.handle(
+		route{"GET", "/registration", handler.RegistrationHandler},
+		route{"POST", "/registration", handler.RegistrationHandler},
+		route{"GET", "/login", handler.LoginHandler},
+		route{"POST", "/login", handler.LoginHandler},
+		route{"GET", "/invite/{token}", handler.InviteHandler},
+		route{"POST", "/invite/{token}", handler.InviteHandler},
+		route{"GET", "/forgot_password", handler.ForgotPasswordHandler},
+		route{"POST", "/forgot_password", handler.ForgotPasswordHandler},
+		route{"GET", "/reset_password/{token}", handler.ResetPasswordHandler},
+		route{"POST", "/reset_password/{token}", handler.ResetPasswordHandler},
+	)
+
+	authenticated := public.group(handler.NeedAuthMiddleware)
+	authenticated.handle(
+		route{"GET", "/logout", handler.LogoutHandler},
+		route{"POST", "/delete_post", handler.DeletePostHandler},
+		route{"POST", "/delete_comment", handler.DeleteCommentHandler},
+		route{"POST", "/edit_post", handler.EditPostHandler},
+		route{"POST", "/edit_comment", handler.EditCommentHandler},
+		route{"GET", "/created_my_posts", handler.ShowMyPostsHandler},
+		route{"GET", "/reacted_posts", handler.ShowMyReactedPostsHandler},
+		route{"GET", "/reacted_comments", handler.ShowMyReactedCommentsHandler},
+		route{"GET", "/commented_posts", handler.ShowMyCommentsWithPostsHandler},
+		route{"GET", "/profile_privacy", handler.ProfilePrivacyHandler},
+		route{"POST", "/profile_privacy", handler.ProfilePrivacyHandler},
+		route{"GET", "/notifications", handler.ShowMyNotificationsHandler},
+		route{"POST", "/mark_notifications_read", handler.MarkAllNotificationsReadHandler},
+		route{"GET", "/notification_settings", handler.NotificationSettingsHandler},
+		route{"POST", "/notification_settings", handler.NotificationSettingsHandler},
+		route{"POST", "/digest_settings", handler.DigestSettingsHandler},
+		route{"POST", "/mute", handler.MuteHandler},
+		route{"GET", "/events", handler.EventsHandler},
+		route{"GET", "/check-notifications", handler.CheckNotificationsHandler},
+		route{"POST", "/api/mark-notification-seen", handler.MarkNotificationSeenHandler},
+	)
+
+	account := authenticated.group(handler.SessionOnlyMiddleware)
+	account.handle(
+		route{"GET", "/account", handler.AccountHandler},
+		route{"POST", "/auth/{provider}/link", handler.OAuthLinkHandler},
+		route{"POST", "/unlink_identity", handler.UnlinkIdentityHandler},
+		route{"POST", "/set_password", handler.SetPasswordHandler},
+		route{"POST", "/update_names", handler.UpdateNamesHandler},
+		route{"POST", "/update_bio", handler.UpdateBioHandler},
+		route{"POST", "/upload_avatar", handler.UploadAvatarHandler},
+		route{"POST", "/remove_avatar", handler.RemoveAvatarHandler},
+		route{"POST", "/change_username", handler.ChangeUsernameHandler},
+		route{"POST", "/change_email", handler.ChangeEmailHandler},
+		route{"POST", "/change_password", handler.ChangePasswordHandler},
+		route{"POST", "/request_data_export", handler.RequestDataExportHandler},
+		route{"GET", "/download_data_export", handler.DownloadDataExportHandler},
+		route{"POST", "/delete_account", handler.DeleteAccountHandler},
+		route{"POST", "/cancel_account_deletion", handler.CancelAccountDeletionHandler},
+		route{"GET", "/tokens", handler.AccessTokensHandler},
+		route{"POST", "/tokens", handler.AccessTokensHandler},
+		route{"POST", "/revoke_token", handler.RevokeAccessTokenHandler},
+	)
+
+	permitted := func(perm models.Permission) *routeGroup {
+		return authenticated.group(handler.requirePermission(perm))
+	}
+	permitted(models.PermCreateContent).handle(
+		route{"POST", "/submit-post", handler.CreatePostHandler},
+		route{"POST", "/submit-comment", handler.CreateCommentsHandler},
+	)
+	permitted(models.PermReact).handle(
+		route{"POST", "/post/react", handler.ReactOnPostHandler},
+		route{"POST", "/comment/react", handler.ReactOnCommentHandler},
+	)
+	permitted(models.PermRequestModerator).handle(
+		route{"POST", "/moderator", handler.ModeratorRequestHandler},
+	)
+
+	// staff
+	permitted(models.PermApproveContent).handle(
+		route{"POST", "/approve_post", handler.ApprovePostHandler},
+		route{"POST", "/approve_comment", handler.ApproveCommentHandler},
+	)
+	permitted(models.PermReportContent).handle(
+		route{"POST", "/report_post", handler.ReportPostHandler},
+	)
+	permitted(models.PermResolveReports).handle(
+		route{"POST", "/answer_report", handler.AnswerPostReportHandler},
+	)
+	permitted(models.PermManageModerators).handle(
+		route{"GET", "/admin_page", handler.AdminMainPageHandler},
+		route{"POST", "/approve-reject", handler.ApproveRejectModeratorHandler},
+		route{"GET", "/moderator_list", handler.ManageModeratorsHandler},
+		route{"POST", "/delete_moderator", handler.DeleteModeratorHandler},
+	)
+	permitted(models.PermManageCategories).handle(
+		route{"GET", "/create_categories", handler.AdminDisplayCategoriesHandler},
+		route{"POST", "/add_category", handler.AdminAddCategoryHandler},
+		route{"POST", "/delete_category", handler.AdminDeleteCategoryHandler},
+	)
+	permitted(models.PermInviteStaff).handle(
+		route{"GET", "/invitations", handler.AdminInvitationsHandler},
+		route{"POST", "/invitations", handler.AdminInvitationsHandler},
+	)
+	permitted(models.PermUnlockAccounts).handle(
+		route{"GET", "/locked_logins", handler.AdminLockedLoginsHandler},
+		route{"POST", "/locked_logins", handler.AdminLockedLoginsHandler},
+	)
+	permitted(models.PermManageWebhooks).handle(
+		route{"GET", "/webhooks", handler.AdminWebhooksHandler},
+		route{"POST", "/webhooks", handler.AdminWebhooksHandler},
+	)
+	return router
+}
+
+// serviceErrorStatus picks the response status for an error returned by the service layer
+func serviceErrorStatus(err error) int {
+	if errors.Is(err, service.ErrForbidden) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// postPath is the permalink of a post, for redirects after actions that only know the ID of the post.
+func (h *Handler) postPath(postID int) string {
+	post, err := h.service.PostServiceInterface.GetPostByID(postID)
+	if err != nil {
+		return "/p/" + strconv.Itoa(postID)
+	}
+	return post.Permalink()
+}
+
+// returnPath is the page in the "return" form value to go back to after an action, or fallback.
+// Only pages of this site are accepted, "//host" would leave it.
+func returnPath(r *http.Request, fallback string) string {
+	next := r.FormValue("return")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return fallback
+	}
+	return next
+}
+
+// sessionUserID returns the ID of the logged in user the request belongs to, from the session
+// cookie or the personal access token. Handlers must use it instead of trusting user IDs sent by the client.
+func (h *Handler) sessionUserID(r *http.Request) (int, error) {
+	if token := accessTokenFromContext(r); token != nil {
+		return token.UserID, nil
+	}
+	cookie := helpers.SessionCookieGet(r)
+	if cookie == nil {
+		return -1, errors.New("you are not logged in")
+	}
+	session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
+	if err != nil {
+		return -1, errors.New("your session is invalid or expired")
+	}
+	return session.UserID, nil
+}
+
+// currentSession returns the session the request is authenticated with and slides a cookie session's expiry forward.
+// Requests made with a personal access token get a session built from the token, which is never stored.
+func (h *Handler) currentSession(w http.ResponseWriter, r *http.Request) (*models.Session, error) {
+	if token := accessTokenFromContext(r); token != nil {
+		return &models.Session{UserID: token.UserID}, nil
+	}
+	cookie := helpers.SessionCookieGet(r)
+	if cookie == nil {
+		return nil, errors.New("you are not logged in")
+	}
+	session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
+	if err != nil {
+		return nil, errors.New("your session is invalid or expired")
+	}
+	expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+	if err != nil {
+		return nil, errors.New("Cookie cannot be extended")
+	}
+	if err := helpers.SessionCookieExtend(r, w, expTime); err != nil {
+		return nil, err
+	}
+	return session, nil
 }
@@ -0,0 +1,31 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// Identicon draws the avatar of a user who has not uploaded one: a symmetric 5x5 pattern in a colour,
+// both taken from a hash of seed, so the same user always gets the same picture.
+func Identicon(seed string) []byte {
+	sum := sha256.Sum256([]byte(seed))
+	color := fmt.Sprintf("hsl(%d, 65%%, 55%%)", (int(sum[0])<<8|int(sum[1]))%360)
+
+	var svg strings.Builder
+	svg.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 5 5" width="120" height="120" shape-rendering="crispEdges">`)
+	svg.WriteString(`<rect width="5" height="5" fill="#f1f1f1"/>`)
+	for row := 0; row < 5; row++ {
+		for col := 0; col < 3; col++ {
+			if sum[2+row*3+col]%2 == 0 {
+				continue
+			}
+			fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="1" height="1" fill="%s"/>`, col, row, color)
+			if col < 2 {
+				fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="1" height="1" fill="%s"/>`, 4-col, row, color)
+			}
+		}
+	}
+	svg.WriteString(`</svg>`)
+	return []byte(svg.String())
+}
@@ -28,10 +28,14 @@ func SessionCookieExpire(w http.ResponseWriter) {
 
 func SessionCookieSet(w http.ResponseWriter, token string, expirationTime time.Time) {
 	cookie := http.Cookie{
-		Name:    cookieName,
-		Value:   token,
-		Path:    "/",
-		Expires: expirationTime,
+		Name:     cookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expirationTime,
+		HttpOnly: true,
+		Secure:   true,
+		// not sent with forms other sites submit; links to the forum from elsewhere still arrive logged in
+		SameSite: http.SameSiteLaxMode,
 	}
 	http.SetCookie(w, &cookie)
 }
@@ -41,8 +45,6 @@ func SessionCookieExtend(r *http.Request, w http.ResponseWriter, expirationTime
 	if err != nil {
 		return fmt.Errorf("SessionCookieExtend: %w", err)
 	}
-	cookie.Expires = expirationTime
-	cookie.Path = "/"
-	http.SetCookie(w, cookie)
+	SessionCookieSet(w, cookie.Value, expirationTime)
 	return nil
 }
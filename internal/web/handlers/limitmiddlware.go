@@ -23,11 +23,15 @@ func NewRateLimiter(maxRequests int, interval time.Duration) *rateLimiter {
 	}
 }
 
+// rateLimit gives the route it wraps a limiter of its own, 300 requests a minute for every client.
+func rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return NewRateLimiter(300, time.Minute).LimitMiddleware(next)
+}
+
 func (rl *rateLimiter) LimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ip := r.RemoteAddr
 		rl.mu.Lock()
-		defer rl.mu.Unlock()
 		now := time.Now()
 		counter := rl.counters[ip]
 		// Remove expired requests from the counter
@@ -39,11 +43,14 @@ func (rl *rateLimiter) LimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 		// Check if the request is allowed
 		if len(counter) >= rl.maxRequests {
+			rl.mu.Unlock()
 			helpers.ErrorHandler(w, http.StatusTooManyRequests, errors.New(""))
 			return
 		}
 		// Add the request to the counter
 		rl.counters[ip] = append(counter, now)
+		// not held while the request runs, long requests such as /events would hold up all others
+		rl.mu.Unlock()
 		next.ServeHTTP(w, r)
 	}
 }
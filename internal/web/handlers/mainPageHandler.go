@@ -9,10 +9,6 @@ import (
 
 func (h *Handler) GetMainPage(w http.ResponseWriter, r *http.Request) {
 	var userGlob *models.User
-	if r.URL.Path != "/" {
-		helpers.ErrorHandler(w, http.StatusNotFound, errors.New(" "))
-		return
-	}
 
 	type templateData struct {
 		LoggedIn      bool
@@ -31,15 +27,8 @@ func (h *Handler) GetMainPage(w http.ResponseWriter, r *http.Request) {
 	// fmt.Printf("After getting all posts")
 
 	// getting session for getting the user details:
-	cookie := helpers.SessionCookieGet(r)
-	if cookie != nil {
-		session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Session failed in the Main Handler"))
-			return
-		}
-
-		userGlob, err = h.service.UserServiceInterface.GetUserByUserID(session.UserID)
+	if userID, err := h.sessionUserID(r); err == nil {
+		userGlob, err = h.service.UserServiceInterface.GetUserByUserID(userID)
 		if err != nil {
 			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 			return
@@ -1,15 +1,56 @@
 package handlers
 
 import (
+	"context"
 	"errors"
+	"forum/internal/models"
 	"forum/internal/web/handlers/helpers"
 	"net/http"
+	"strings"
 )
 
 const cookieName = "session_id"
 
+type accessTokenKey struct{}
+
+// accessTokenFromContext returns the personal access token the request was authenticated with, if any.
+func accessTokenFromContext(r *http.Request) *models.AccessToken {
+	token, _ := r.Context().Value(accessTokenKey{}).(*models.AccessToken)
+	return token
+}
+
+// requestScope is what the request may do with the user's role: the scope of its access token, or
+// everything for a browser session.
+func requestScope(r *http.Request) models.TokenScope {
+	if token := accessTokenFromContext(r); token != nil {
+		return token.Scope
+	}
+	return models.SessionScope
+}
+
+func isSafeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+// CheckCookieMiddleware also accepts an "Authorization: Bearer" personal access token in place of the session cookie.
 func (h *Handler) CheckCookieMiddleware(someHandler http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Authorization"); header != "" {
+			bearer, found := strings.CutPrefix(header, "Bearer ")
+			if !found {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Only Bearer authorization is supported"))
+				return
+			}
+			token, err := h.service.TokenServiceInterface.AuthenticateToken(strings.TrimSpace(bearer))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+				return
+			}
+			someHandler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accessTokenKey{}, token)))
+			return
+		}
 		c, err := r.Cookie(cookieName)
 		if err != nil && c != nil {
 			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Error with Cookie!!!"))
@@ -41,6 +82,14 @@ func (h *Handler) OnlyUnauthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 func (h *Handler) NeedAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := accessTokenFromContext(r); token != nil {
+			if !isSafeMethod(r.Method) && !models.ScopeIncludes(token.Scope, models.ScopeWrite) {
+				helpers.ErrorHandler(w, http.StatusForbidden, errors.New("Access token scope does not allow changes"))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
 		c, err := r.Cookie(cookieName)
 		if err != nil && c != nil {
 			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Error with Cookie"))
@@ -53,3 +102,48 @@ func (h *Handler) NeedAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 	})
 }
+
+// requirePermission is RequirePermission for a route group.
+func (h *Handler) requirePermission(perm models.Permission) middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return h.RequirePermission(perm, next)
+	}
+}
+
+// RequirePermission lets the request through only if the logged in user's role grants perm.
+// It must be wrapped by NeedAuthMiddleware.
+func (h *Handler) RequirePermission(perm models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := h.sessionUserID(r)
+		if err != nil {
+			http.Redirect(w, r, "/login", 302)
+			return
+		}
+		allowed, err := h.service.UserServiceInterface.HasPermission(userID, perm)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !allowed {
+			helpers.ErrorHandler(w, http.StatusForbidden, errors.New("Access denied: you do not have permission to do this"))
+			return
+		}
+		if token := accessTokenFromContext(r); token != nil && !isSafeMethod(r.Method) && !models.ScopeIncludes(token.Scope, models.PermissionScopes[perm]) {
+			helpers.ErrorHandler(w, http.StatusForbidden, errors.New("Access token scope does not allow this"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SessionOnlyMiddleware keeps access tokens away from pages that manage the account itself,
+// so a leaked token cannot be used to mint new tokens or change the login methods.
+func (h *Handler) SessionOnlyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accessTokenFromContext(r) != nil {
+			helpers.ErrorHandler(w, http.StatusForbidden, errors.New("This page cannot be used with an access token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"errors"
+	"forum/internal/models"
 	helpers "forum/internal/web/handlers/helpers"
 	"net/http"
 )
@@ -9,25 +10,9 @@ import (
 func (h *Handler) ModeratorRequestHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie failed in the Moderator Request Handler"))
-			return
-		}
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended in Approval of the Post"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
-			return
-		}
-
-		session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Session failed in the Moderator Request Handler"))
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -38,7 +23,7 @@ func (h *Handler) ModeratorRequestHandler(w http.ResponseWriter, r *http.Request
 		}
 
 		// changing role to pending from user
-		err = h.service.UserServiceInterface.ChangeUserRole("pending", user.UserUserID)
+		err = h.service.UserServiceInterface.ChangeUserRole(models.RolePending, user.UserUserID)
 		if err != nil {
 			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 			return
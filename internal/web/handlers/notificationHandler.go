@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"forum/internal/models"
+	"forum/internal/service"
+	"forum/internal/web/handlers/helpers"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const notificationsPerPage = 20
+
+// notificationItem is one row of the notifications page.
+type notificationItem struct {
+	ID         int
+	Message    string
+	Link       string
+	TimeString string
+	Read       bool
+}
+
+func (h *Handler) ShowMyNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Notifications Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	page := 1
+	if value := r.URL.Query().Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Invalid page"))
+			return
+		}
+	}
+
+	notifications, total, err := h.service.NotificationServiceInterface.GetNotifications(userID, notificationsPerPage, (page-1)*notificationsPerPage)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	unread, err := h.service.NotificationServiceInterface.CountUnreadNotifications(userID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := struct {
+		Notifications []notificationItem
+		Unread        int
+		PrevPage      int // 0 when there is none
+		NextPage      int
+	}{Notifications: []notificationItem{}, Unread: unread}
+	for _, notification := range notifications {
+		data.Notifications = append(data.Notifications, notificationItem{
+			ID:         notification.NotificationID,
+			Message:    notification.Message(),
+			Link:       notification.Link(),
+			TimeString: notification.CreatedTime.Format("Jan 2, 2006 at 15:04"),
+			Read:       notification.IsRead(),
+		})
+	}
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if page*notificationsPerPage < total {
+		data.NextPage = page + 1
+	}
+	helpers.RenderTemplate(w, "internal/web/templates/notifications.html", data)
+}
+
+// MarkNotificationSeenHandler marks one notification of the logged in user as read, for the script of
+// the notifications page: {"notification_id": 1}.
+func (h *Handler) MarkNotificationSeenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		NotificationID int `json:"notification_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	err = h.service.NotificationServiceInterface.MarkNotificationRead(userID, req.NotificationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error marking notification as seen", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+func (h *Handler) MarkAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Notifications Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err := h.service.NotificationServiceInterface.MarkAllNotificationsRead(userID); err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// CheckNotificationsHandler returns the number of unread notifications: {"count": 3}.
+func (h *Handler) CheckNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	count, err := h.service.NotificationServiceInterface.CountUnreadNotifications(userID)
+	if err != nil {
+		http.Error(w, "Error checking notifications", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"count": count})
+}
+
+// NotificationSettingsHandler shows and saves how each type of notification reaches the user, shows
+// the digest settings and lists the muted threads and users.
+func (h *Handler) NotificationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settingsPath := "internal/web/templates/notificationSettings.html"
+
+	type typeSetting struct {
+		Type     string
+		Label    string
+		Delivery string
+	}
+	type muteItem struct {
+		TargetType string
+		TargetID   int
+		Name       string
+		Link       string
+	}
+	type categoryItem struct {
+		ID       int
+		Name     string
+		Followed bool
+	}
+	type templateData struct {
+		Types             []typeSetting
+		Deliveries        []string
+		HasEmail          bool
+		DigestFrequency   string
+		DigestFrequencies []string
+		Categories        []categoryItem
+		Mutes             []muteItem
+	}
+
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		preferences, err := h.service.NotificationServiceInterface.GetNotificationPreferences(userID)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+		mutes, err := h.service.NotificationServiceInterface.GetNotificationMutes(userID)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+		digest, err := h.service.DigestServiceInterface.GetDigestSettings(userID)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+		categories, err := h.service.PostServiceInterface.GetAllCategories()
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+		data := templateData{
+			Deliveries:        models.NotificationDeliveries,
+			HasEmail:          h.service.NotificationServiceInterface.HasNotificationChannel(service.ChannelEmail),
+			DigestFrequency:   digest.Frequency,
+			DigestFrequencies: models.DigestFrequencies,
+		}
+		for _, kind := range models.NotificationTypes {
+			data.Types = append(data.Types, typeSetting{kind.Type, kind.Label, preferences.Delivery(kind.Type)})
+		}
+		for _, category := range categories {
+			data.Categories = append(data.Categories, categoryItem{category.CategoryID, category.Category, digest.Follows(category.CategoryID)})
+		}
+		for _, mute := range mutes {
+			item := muteItem{TargetType: mute.TargetType, TargetID: mute.TargetID, Name: mute.Name}
+			if mute.TargetType == models.MuteThread && mute.Name != "" {
+				item.Link = models.PostPath(mute.TargetID, mute.Name)
+			} else if mute.TargetType == models.MuteUser && mute.Name != "" {
+				item.Link = "/u/" + url.PathEscape(mute.Name)
+			}
+			data.Mutes = append(data.Mutes, item)
+		}
+		helpers.RenderTemplate(w, settingsPath, data)
+		return
+	case "POST":
+		preferences := &models.NotificationPreferences{UserID: userID, Deliveries: map[string]string{}}
+		for _, kind := range models.NotificationTypes {
+			if delivery := r.FormValue("delivery_" + kind.Type); delivery != "" {
+				preferences.Deliveries[kind.Type] = delivery
+			}
+		}
+		if err := h.service.NotificationServiceInterface.UpdateNotificationPreferences(preferences); err != nil {
+			helpers.ErrorHandler(w, http.StatusBadRequest, err)
+			return
+		}
+		http.Redirect(w, r, "/notification_settings", http.StatusSeeOther)
+		return
+	default:
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Notification Settings Handler"))
+		return
+	}
+}
+
+// DigestSettingsHandler saves how often the user gets the digest e-mail and the categories whose new
+// posts go into it.
+func (h *Handler) DigestSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Digest Settings Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	settings := &models.DigestSettings{UserID: userID, Frequency: r.FormValue("frequency"), CategoryIDs: []int{}}
+	for _, value := range r.Form["category_id"] {
+		categoryID, err := strconv.Atoi(value)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Invalid category"))
+			return
+		}
+		settings.CategoryIDs = append(settings.CategoryIDs, categoryID)
+	}
+	if err := h.service.DigestServiceInterface.UpdateDigestSettings(settings); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	http.Redirect(w, r, "/notification_settings", http.StatusSeeOther)
+}
+
+// MuteHandler mutes or unmutes a thread or a user for the logged in user, then goes back to the page
+// in "return".
+func (h *Handler) MuteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Mute Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	targetType := r.FormValue("target_type")
+	targetID, err := strconv.Atoi(r.FormValue("target_id"))
+	if err != nil || (targetType != models.MuteThread && targetType != models.MuteUser) {
+		helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Invalid mute"))
+		return
+	}
+
+	switch {
+	case r.FormValue("action") == "unmute":
+		err = h.service.NotificationServiceInterface.Unmute(userID, targetType, targetID)
+	case targetType == models.MuteThread:
+		err = h.service.NotificationServiceInterface.MuteThread(userID, targetID)
+	default:
+		err = h.service.NotificationServiceInterface.MuteUser(userID, targetID)
+	}
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+
+	http.Redirect(w, r, returnPath(r, "/notification_settings"), http.StatusSeeOther)
+}
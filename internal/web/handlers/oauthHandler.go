@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"forum/internal/web/handlers/helpers"
+	"net/http"
+)
+
+const oauthStateCookie = "oauth_state"
+
+// OAuthSignInHandler serves /auth/{provider}/in, logging in or registering with a provider.
+func (h *Handler) OAuthSignInHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.sessionUserID(r); err == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	h.OAuthLoginHandler(w, r, pathParam(r, "provider"), 0)
+}
+
+// OAuthLinkHandler serves /auth/{provider}/link, adding a provider account to the logged in user's.
+func (h *Handler) OAuthLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	h.OAuthLoginHandler(w, r, pathParam(r, "provider"), userID)
+}
+
+// OAuthLoginHandler sends the browser to the provider. A non-zero linkUserID links the provider account
+// to that user instead of logging in with it.
+func (h *Handler) OAuthLoginHandler(w http.ResponseWriter, r *http.Request, providerName string, linkUserID int) {
+	provider, ok := h.oauth.Get(providerName)
+	if !ok {
+		helpers.ErrorHandler(w, http.StatusNotFound, errors.New("Unknown login provider"))
+		return
+	}
+	authRequest, authURL, err := provider.NewAuthRequest()
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusBadGateway, fmt.Errorf("Login provider is unavailable: %v", err))
+		return
+	}
+	authRequest.LinkUserID = linkUserID
+	h.oauth.SaveAuthRequest(authRequest)
+
+	// binds the login to this browser, so a callback URL cannot be replayed in someone else's
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    authRequest.State,
+		Path:     "/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// OAuthCallbackHandler finishes a login for any provider; the provider is looked up from the state.
+func (h *Handler) OAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Login state is missing or does not match"))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Value: "", Path: "/", MaxAge: -1})
+
+	authRequest, err := h.oauth.TakeAuthRequest(state)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	if providerErr := r.URL.Query().Get("error"); providerErr != "" {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, fmt.Errorf("Login was cancelled: %s", providerErr))
+		return
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Temporary token is invalid"))
+		return
+	}
+
+	provider, ok := h.oauth.Get(authRequest.Provider)
+	if !ok {
+		helpers.ErrorHandler(w, http.StatusNotFound, errors.New("Unknown login provider"))
+		return
+	}
+	identity, err := provider.Identity(code, authRequest)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusBadGateway, fmt.Errorf("Error retrieving user data: %v", err))
+		return
+	}
+
+	userID, err := h.sessionUserID(r)
+	if authRequest.LinkUserID != 0 {
+		// the link was started by the user who is logged in in this browser
+		if err != nil || userID != authRequest.LinkUserID {
+			helpers.ErrorHandler(w, http.StatusForbidden, errors.New("Log in to the account you want to link the provider to"))
+			return
+		}
+		if err := h.service.UserServiceInterface.LinkIdentity(userID, identity); err != nil {
+			helpers.ErrorHandler(w, http.StatusBadRequest, err)
+			return
+		}
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+	if err == nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	session, err := h.service.ExternalAuthorization(identity)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	helpers.SessionCookieSet(w, session.Token, session.ExpTime)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+// The callback only continues a login started in the same browser, whose state cookie matches the state.
+func TestOAuthCallbackNeedsMatchingState(t *testing.T) {
+	forum := newTestForum(t)
+	tests := []struct {
+		name   string
+		cookie string
+		target string
+	}{
+		{"no state cookie", "", "/auth/mock/callback?state=abc&code=x"},
+		{"other browser", "xyz", "/auth/mock/callback?state=abc&code=x"},
+		{"no state", "abc", "/auth/mock/callback?code=x"},
+		{"state not pending", "abc", "/auth/mock/callback?state=abc&code=x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := forum.request("GET", test.target, nil, nil)
+			if test.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oauthStateCookie, Value: test.cookie})
+			}
+			if res := forum.do(req); res.Code != http.StatusBadRequest {
+				t.Errorf("status %d, want %d", res.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
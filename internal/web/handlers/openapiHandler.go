@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"forum/internal/web/handlers/helpers"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenAPIHandler serves /api/openapi.json, the OpenAPI 3 description of /api/v1. It is generated from
+// apiRoutes and the types the endpoints read and write, so a change to either shows up in it.
+func (h *Handler) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in OpenAPI Handler"))
+		return
+	}
+	document, err := json.MarshalIndent(h.openAPIDocument(), "", "  ")
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(document)
+}
+
+type openAPIObject = map[string]interface{}
+
+func (h *Handler) openAPIDocument() openAPIObject {
+	schemas := openAPIObject{
+		"Error": openAPIObject{
+			"type":     "object",
+			"required": []string{"error"},
+			"properties": openAPIObject{
+				"error": schemaRef(reflect.TypeOf(apiErrorBody{})),
+			},
+		},
+	}
+	builder := &schemaBuilder{schemas: schemas}
+	builder.schemaOf(reflect.TypeOf(apiErrorBody{}))
+	builder.schemaOf(reflect.TypeOf(apiPagination{}))
+
+	paths := openAPIObject{}
+	for _, route := range h.apiRoutes() {
+		path := "/api/v1/" + route.pattern
+		item, ok := paths[path].(openAPIObject)
+		if !ok {
+			item = openAPIObject{}
+			paths[path] = item
+		}
+		item[strings.ToLower(route.method)] = builder.operation(route)
+	}
+
+	return openAPIObject{
+		"openapi": "3.0.3",
+		"info": openAPIObject{
+			"title":   "Forum API",
+			"version": "1",
+			"description": "Anyone can read. Changes need the session cookie or a personal access token whose scope " +
+				"allows them. Lists are paged with page and per_page.",
+		},
+		"paths": paths,
+		"components": openAPIObject{
+			"schemas": schemas,
+			"securitySchemes": openAPIObject{
+				"accessToken": openAPIObject{"type": "http", "scheme": "bearer", "description": "personal access token, forum_pat_..."},
+				"session":     openAPIObject{"type": "apiKey", "in": "cookie", "name": cookieName},
+			},
+			"responses": openAPIObject{
+				"Error": openAPIObject{
+					"description": "The request failed, see the code in the body",
+					"content":     openAPIObject{"application/json": openAPIObject{"schema": openAPIObject{"$ref": "#/components/schemas/Error"}}},
+				},
+			},
+		},
+	}
+}
+
+func (builder *schemaBuilder) operation(route apiRoute) openAPIObject {
+	doc := route.doc
+	operation := openAPIObject{
+		"summary":     doc.summary,
+		"operationId": operationID(route),
+	}
+	params := []openAPIObject{}
+	if strings.Contains(route.pattern, "{id}") {
+		params = append(params, openAPIObject{"name": "id", "in": "path", "required": true, "schema": openAPIObject{"type": "integer", "minimum": 1}})
+	}
+	for _, param := range doc.query {
+		schema := openAPIObject{"type": "string"}
+		if param.name == "page" || param.name == "per_page" {
+			schema = openAPIObject{"type": "integer", "minimum": 1}
+		}
+		params = append(params, openAPIObject{"name": param.name, "in": "query", "description": param.description, "schema": schema})
+	}
+	if len(params) != 0 {
+		operation["parameters"] = params
+	}
+	if doc.body != nil {
+		operation["requestBody"] = openAPIObject{
+			"required": true,
+			"content":  openAPIObject{"application/json": openAPIObject{"schema": builder.schemaOf(reflect.TypeOf(doc.body))}},
+		}
+	}
+	if doc.auth {
+		operation["security"] = []openAPIObject{{"accessToken": []string{}}, {"session": []string{}}}
+	}
+
+	responses := openAPIObject{"default": openAPIObject{"$ref": "#/components/responses/Error"}}
+	status := "200"
+	if route.method == "POST" && !doc.action {
+		status = "201"
+	}
+	if doc.response == nil {
+		responses["204"] = openAPIObject{"description": "Done"}
+	} else {
+		envelope := openAPIObject{"type": "object", "required": []string{"data"}}
+		if doc.list {
+			envelope["required"] = []string{"data", "pagination"}
+			envelope["properties"] = openAPIObject{
+				"data":       openAPIObject{"type": "array", "items": builder.schemaOf(reflect.TypeOf(doc.response))},
+				"pagination": builder.schemaOf(reflect.TypeOf(apiPagination{})),
+			}
+		} else {
+			envelope["properties"] = openAPIObject{"data": builder.schemaOf(reflect.TypeOf(doc.response))}
+		}
+		responses[status] = openAPIObject{
+			"description": "OK",
+			"content":     openAPIObject{"application/json": openAPIObject{"schema": envelope}},
+		}
+	}
+	operation["responses"] = responses
+	return operation
+}
+
+// operationID names an operation after its method and path: GET posts/{id}/comments is getPostsIdComments.
+func operationID(route apiRoute) string {
+	id := strings.ToLower(route.method)
+	for _, part := range strings.Split(route.pattern, "/") {
+		part = strings.Trim(part, "{}")
+		if part != "" {
+			id += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return id
+}
+
+// schemaBuilder turns the Go types of the API into JSON schemas, following encoding/json: the json tag
+// names a field and omitempty makes it optional. Structs become named schemas under components.
+type schemaBuilder struct {
+	schemas openAPIObject
+}
+
+func schemaRef(t reflect.Type) openAPIObject {
+	return openAPIObject{"$ref": "#/components/schemas/" + schemaName(t)}
+}
+
+// schemaName drops the api prefix of the Go type: apiPost is Post.
+func schemaName(t reflect.Type) string {
+	return strings.TrimPrefix(strings.TrimPrefix(t.Name(), "api"), "API")
+}
+
+func (builder *schemaBuilder) schemaOf(t reflect.Type) openAPIObject {
+	if t == reflect.TypeOf(time.Time{}) {
+		return openAPIObject{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := openAPIObject{}
+		for key, value := range builder.schemaOf(t.Elem()) {
+			schema[key] = value
+		}
+		if _, isRef := schema["$ref"]; isRef {
+			return openAPIObject{"allOf": []openAPIObject{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Slice, reflect.Array:
+		return openAPIObject{"type": "array", "items": builder.schemaOf(t.Elem())}
+	case reflect.Map:
+		return openAPIObject{"type": "object", "additionalProperties": builder.schemaOf(t.Elem())}
+	case reflect.String:
+		return openAPIObject{"type": "string"}
+	case reflect.Bool:
+		return openAPIObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openAPIObject{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return openAPIObject{"type": "number"}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, done := builder.schemas[name]; !done {
+			builder.schemas[name] = openAPIObject{} // a placeholder, in case the type refers to itself
+			builder.schemas[name] = builder.structSchema(t)
+		}
+		return schemaRef(t)
+	}
+	return openAPIObject{}
+}
+
+func (builder *schemaBuilder) structSchema(t reflect.Type) openAPIObject {
+	properties := openAPIObject{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := builder.schemaOf(field.Type)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = schema
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	schema := openAPIObject{"type": "object", "properties": properties}
+	if len(required) != 0 {
+		schema["required"] = required
+	}
+	return schema
+}
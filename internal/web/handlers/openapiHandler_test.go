@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"forum/pkg/forumclient"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The OpenAPI document and forumclient must offer every endpoint of apiRoutes, and the client nothing
+// else. Endpoints added to one of the three without the others fail here.
+func TestAPIRoutesDocumentAndClientAgree(t *testing.T) {
+	forum := newTestForum(t)
+	routes := forum.handler.apiRoutes()
+
+	res := forum.do(forum.request("GET", "/api/openapi.json", nil, nil))
+	if res.Code != http.StatusOK {
+		t.Fatalf("GET /api/openapi.json: status %d", res.Code)
+	}
+	var document struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	documented := 0
+	for _, route := range routes {
+		if _, ok := document.Paths["/api/v1/"+route.pattern][strings.ToLower(route.method)]; !ok {
+			t.Errorf("%s /api/v1/%s is not in the OpenAPI document", route.method, route.pattern)
+		}
+	}
+	for _, operations := range document.Paths {
+		documented += len(operations)
+	}
+	if documented != len(routes) {
+		t.Errorf("the OpenAPI document has %d operations, apiRoutes %d", documented, len(routes))
+	}
+
+	// every exported method of the client is called once against a server that records the requests
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": null}`))
+	}))
+	defer server.Close()
+	client := forumclient.New(server.URL, forumclient.WithToken("forum_pat_test"))
+	ctx := context.Background()
+
+	calls := map[string]func() error{
+		"Me":                            func() error { _, err := client.Me(ctx); return err },
+		"Categories":                    func() error { _, err := client.Categories(ctx); return err },
+		"Notifications":                 func() error { _, err := client.Notifications(ctx, forumclient.PageOptions{}); return err },
+		"MarkNotificationRead":          func() error { return client.MarkNotificationRead(ctx, 1) },
+		"MarkAllNotificationsRead":      func() error { return client.MarkAllNotificationsRead(ctx) },
+		"NotificationPreferences":       func() error { _, err := client.NotificationPreferences(ctx); return err },
+		"UpdateNotificationPreferences": func() error { _, err := client.UpdateNotificationPreferences(ctx, nil); return err },
+		"ListPosts":                     func() error { _, err := client.ListPosts(ctx, forumclient.ListPostsOptions{}); return err },
+		"GetPost":                       func() error { _, err := client.GetPost(ctx, 1); return err },
+		"CreatePost":                    func() error { _, err := client.CreatePost(ctx, forumclient.NewPost{}); return err },
+		"UpdatePost":                    func() error { _, err := client.UpdatePost(ctx, 1, ""); return err },
+		"DeletePost":                    func() error { return client.DeletePost(ctx, 1, "") },
+		"SetPostReaction":               func() error { _, err := client.SetPostReaction(ctx, 1, "like"); return err },
+		"ListComments":                  func() error { _, err := client.ListComments(ctx, 1, forumclient.PageOptions{}); return err },
+		"CreateComment":                 func() error { _, err := client.CreateComment(ctx, 1, ""); return err },
+		"GetComment":                    func() error { _, err := client.GetComment(ctx, 1); return err },
+		"UpdateComment":                 func() error { _, err := client.UpdateComment(ctx, 1, ""); return err },
+		"DeleteComment":                 func() error { return client.DeleteComment(ctx, 1, "") },
+		"SetCommentReaction":            func() error { _, err := client.SetCommentReaction(ctx, 1, "like"); return err },
+		"ModerationQueue":               func() error { _, err := client.ModerationQueue(ctx, forumclient.PageOptions{}); return err },
+		"ApprovePost":                   func() error { _, err := client.ApprovePost(ctx, 1); return err },
+		"ApproveComment":                func() error { _, err := client.ApproveComment(ctx, 1); return err },
+		"ReportPost":                    func() error { _, err := client.ReportPost(ctx, 1, ""); return err },
+		"ResolveReport":                 func() error { return client.ResolveReport(ctx, 1, "keep", "") },
+	}
+	clientType := reflect.TypeOf(client)
+	for i := 0; i < clientType.NumMethod(); i++ {
+		if _, ok := calls[clientType.Method(i).Name]; !ok {
+			t.Errorf("forumclient.Client.%s is not called by this test", clientType.Method(i).Name)
+		}
+	}
+	for name, call := range calls {
+		if err := call(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	called := map[int]bool{}
+	for _, request := range requests {
+		method, path, _ := strings.Cut(request, " ")
+		found := false
+		for i, route := range routes {
+			if _, ok := matchAPIRoute(route.pattern, strings.TrimPrefix(path, apiPrefix)); ok && route.method == method {
+				called[i], found = true, true
+			}
+		}
+		if !found {
+			t.Errorf("forumclient sends %s, which is not in apiRoutes", request)
+		}
+	}
+	for i, route := range routes {
+		if !called[i] {
+			t.Errorf("forumclient has no method for %s /api/v1/%s", route.method, route.pattern)
+		}
+	}
+}
+
+// openAPISchema is the part of a JSON schema the document uses.
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref"`
+	AllOf                []*openAPISchema          `json:"allOf"`
+	Nullable             bool                      `json:"nullable"`
+	Type                 string                    `json:"type"`
+	Format               string                    `json:"format"`
+	Items                *openAPISchema            `json:"items"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties"`
+	Properties           map[string]*openAPISchema `json:"properties"`
+	Required             []string                  `json:"required"`
+}
+
+// The types of forumclient must decode what the document says the server sends: the same JSON
+// names, each of the same kind, optional where the schema does not require it.
+func TestAPIClientTypesMatchDocument(t *testing.T) {
+	forum := newTestForum(t)
+	res := forum.do(forum.request("GET", "/api/openapi.json", nil, nil))
+	var document struct {
+		Components struct {
+			Schemas map[string]*openAPISchema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	schemas := document.Components.Schemas
+
+	types := map[string]interface{}{
+		"User":                    forumclient.User{},
+		"Me":                      forumclient.Me{},
+		"Category":                forumclient.Category{},
+		"Post":                    forumclient.Post{},
+		"Comment":                 forumclient.Comment{},
+		"Notification":            forumclient.Notification{},
+		"NotificationPreferences": forumclient.NotificationPreferences{},
+		"QueueItem":               forumclient.QueueItem{},
+		"Pagination":              forumclient.Pagination{},
+		"CreatePostBody":          forumclient.NewPost{},
+	}
+	for name, value := range types {
+		schema, ok := schemas[name]
+		if !ok {
+			t.Errorf("the document has no schema %s for forumclient.%T", name, value)
+			continue
+		}
+		compareSchema(t, schemas, "forumclient."+reflect.TypeOf(value).Name(), reflect.TypeOf(value), schema)
+	}
+}
+
+// compareSchema reports where the Go type at path does not decode what schema describes.
+func compareSchema(t *testing.T, schemas map[string]*openAPISchema, path string, goType reflect.Type, schema *openAPISchema) {
+	t.Helper()
+	if goType.Kind() == reflect.Ptr {
+		if !schema.Nullable {
+			t.Errorf("%s is a pointer, the schema is not nullable", path)
+		}
+		goType = goType.Elem()
+	}
+	if len(schema.AllOf) == 1 {
+		schema = schema.AllOf[0]
+	}
+	if schema.Ref != "" {
+		resolved, ok := schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			t.Errorf("%s: the document has no schema %s", path, schema.Ref)
+			return
+		}
+		schema = resolved
+	}
+
+	kind := ""
+	switch goType.Kind() {
+	case reflect.String:
+		kind = "string"
+	case reflect.Bool:
+		kind = "boolean"
+	case reflect.Int, reflect.Int64:
+		kind = "integer"
+	case reflect.Float64:
+		kind = "number"
+	case reflect.Slice:
+		kind = "array"
+	case reflect.Map, reflect.Struct:
+		kind = "object"
+	}
+	if goType == reflect.TypeOf(time.Time{}) {
+		if schema.Type != "string" || schema.Format != "date-time" {
+			t.Errorf("%s is a time, the schema is %s %s", path, schema.Type, schema.Format)
+		}
+		return
+	}
+	if schema.Type != kind {
+		t.Errorf("%s is a %s, the schema is %q", path, goType, schema.Type)
+		return
+	}
+
+	switch goType.Kind() {
+	case reflect.Slice:
+		compareSchema(t, schemas, path+"[]", goType.Elem(), schema.Items)
+	case reflect.Map:
+		if schema.AdditionalProperties == nil {
+			t.Errorf("%s is a map, the schema has fixed properties", path)
+			return
+		}
+		compareSchema(t, schemas, path+"{}", goType.Elem(), schema.AdditionalProperties)
+	case reflect.Struct:
+		required := map[string]bool{}
+		for _, name := range schema.Required {
+			required[name] = true
+		}
+		fields := map[string]bool{}
+		for i := 0; i < goType.NumField(); i++ {
+			field := goType.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" || name == "" {
+				continue
+			}
+			fields[name] = true
+			property, ok := schema.Properties[name]
+			if !ok {
+				t.Errorf("%s.%s: the schema has no property %q", path, field.Name, name)
+				continue
+			}
+			optional := strings.Contains(options, "omitempty") || field.Type.Kind() == reflect.Ptr
+			if optional == required[name] {
+				t.Errorf("%s.%s: optional %t, but required in the schema %t", path, field.Name, optional, required[name])
+			}
+			compareSchema(t, schemas, path+"."+field.Name, field.Type, property)
+		}
+		for name := range schema.Properties {
+			if !fields[name] {
+				t.Errorf("%s has no field for the property %q", path, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"forum/internal/models"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// Which role reaches which route, one route for every permission group of InitRouter. Visitors are
+// sent to the login page, roles without the permission get 403, the rest reach the handler. Pending
+// users, who already asked to become moderators, can do what users do except asking again.
+func TestRolesReachPermittedRoutes(t *testing.T) {
+	forum := newTestForum(t)
+	roles := []string{models.RoleUser, models.RolePending, models.RoleModerator, models.RoleAdmin}
+	sessions := map[string]*http.Cookie{}
+	for _, role := range roles {
+		sessions[role] = forum.session(forum.user(role+"-user", role))
+	}
+
+	const guest = "guest"
+	tests := []struct {
+		method, path string
+		allowed      []string
+	}{
+		{"POST", "/submit-post", []string{models.RoleUser, models.RolePending, models.RoleModerator, models.RoleAdmin}},
+		{"POST", "/submit-comment", []string{models.RoleUser, models.RolePending, models.RoleModerator, models.RoleAdmin}},
+		{"POST", "/post/react", []string{models.RoleUser, models.RolePending, models.RoleModerator, models.RoleAdmin}},
+		{"POST", "/comment/react", []string{models.RoleUser, models.RolePending, models.RoleModerator, models.RoleAdmin}},
+		{"POST", "/moderator", []string{models.RoleUser}},
+		{"POST", "/approve_post", []string{models.RoleModerator, models.RoleAdmin}},
+		{"POST", "/approve_comment", []string{models.RoleModerator, models.RoleAdmin}},
+		{"POST", "/report_post", []string{models.RoleModerator, models.RoleAdmin}},
+		{"POST", "/answer_report", []string{models.RoleAdmin}},
+		{"GET", "/admin_page", []string{models.RoleAdmin}},
+		{"GET", "/moderator_list", []string{models.RoleAdmin}},
+		{"GET", "/create_categories", []string{models.RoleAdmin}},
+		{"GET", "/invitations", []string{models.RoleAdmin}},
+		{"GET", "/locked_logins", []string{models.RoleAdmin}},
+		{"GET", "/webhooks", []string{models.RoleAdmin}},
+	}
+	for _, test := range tests {
+		allowed := map[string]bool{}
+		for _, role := range test.allowed {
+			allowed[role] = true
+		}
+		for _, role := range append([]string{guest}, roles...) {
+			t.Run(role+" "+test.method+" "+test.path, func(t *testing.T) {
+				var form url.Values
+				if test.method == "POST" {
+					form = url.Values{}
+				}
+				var auth interface{}
+				if role != guest {
+					auth = sessions[role]
+				}
+				res := forum.do(forum.request(test.method, test.path, form, auth))
+
+				switch {
+				case role == guest:
+					if res.Code != http.StatusFound || res.Header().Get("Location") != "/login" {
+						t.Errorf("status %d to %q, want a redirect to /login", res.Code, res.Header().Get("Location"))
+					}
+				case allowed[role]:
+					if res.Code == http.StatusForbidden || res.Header().Get("Location") == "/login" {
+						t.Errorf("status %d, want the handler to be reached", res.Code)
+					}
+				default:
+					if res.Code != http.StatusForbidden {
+						t.Errorf("status %d, want %d", res.Code, http.StatusForbidden)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"forum/internal/models"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// A staff member's token acts on other people's content only with the scope the permission needs,
+// in the HTML forms as in the JSON API.
+func TestTokenScopeLimitsStaffOnOthersContent(t *testing.T) {
+	forum := newTestForum(t)
+	author := forum.user("author", models.RoleUser)
+	admin := forum.user("admin", models.RoleAdmin)
+	writeToken := forum.token(admin, models.ScopeWrite)
+	moderateToken := forum.token(admin, models.ScopeModerate)
+
+	tests := []struct {
+		name    string
+		req     func(postID int) *http.Request
+		status  int
+		deleted bool
+	}{
+		{"form delete with write token", func(postID int) *http.Request {
+			return forum.request("POST", "/delete_post", url.Values{"postId": {itoa(postID)}}, writeToken)
+		}, http.StatusForbidden, false},
+		{"form edit with write token", func(postID int) *http.Request {
+			return forum.request("POST", "/edit_post", url.Values{"postId": {itoa(postID)}, "content": {"Edited"}}, writeToken)
+		}, http.StatusForbidden, false},
+		{"API delete with write token", func(postID int) *http.Request {
+			return forum.request("DELETE", "/api/v1/posts/"+itoa(postID), nil, writeToken)
+		}, http.StatusForbidden, false},
+		{"form delete with moderate token", func(postID int) *http.Request {
+			return forum.request("POST", "/delete_post", url.Values{"postId": {itoa(postID)}}, moderateToken)
+		}, http.StatusSeeOther, true},
+		{"API delete with moderate token", func(postID int) *http.Request {
+			return forum.request("DELETE", "/api/v1/posts/"+itoa(postID), nil, moderateToken)
+		}, http.StatusNoContent, true},
+		{"form delete with session", func(postID int) *http.Request {
+			return forum.request("POST", "/delete_post", url.Values{"postId": {itoa(postID)}}, forum.session(admin))
+		}, http.StatusSeeOther, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			postID := forum.post(author, "Post of the author")
+			res := forum.do(test.req(postID))
+			if res.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", res.Code, test.status, res.Body.String())
+			}
+			if deleted := !forum.postExists(postID); deleted != test.deleted {
+				t.Errorf("post deleted: %v, want %v", deleted, test.deleted)
+			}
+		})
+	}
+}
+
+func TestWriteTokenChangesOwnPost(t *testing.T) {
+	forum := newTestForum(t)
+	admin := forum.user("admin", models.RoleAdmin)
+	postID := forum.post(admin, "Own post")
+	res := forum.do(forum.request("POST", "/delete_post", url.Values{"postId": {itoa(postID)}}, forum.token(admin, models.ScopeWrite)))
+	if res.Code != http.StatusSeeOther || forum.postExists(postID) {
+		t.Fatalf("status %d, post exists %v: %s", res.Code, forum.postExists(postID), res.Body.String())
+	}
+}
@@ -1,16 +1,11 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"forum/internal/models"
 	helpers "forum/internal/web/handlers/helpers"
-	"io"
-	"log"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
 )
@@ -20,14 +15,9 @@ func (h *Handler) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		const MaxImageSize = 20 * 1024 * 1024
 
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("couldn't get the cookie in the Post Creation Handler"))
-			return
-		}
-		session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Session failed in the Post Creation Handler"))
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -84,17 +74,6 @@ func (h *Handler) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("The Time cannot be extended"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("The Time cannot be extended"))
-			return
-		}
-
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	default:
@@ -118,25 +97,9 @@ func (h *Handler) ReactOnPostHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie cannot be reseived in Post Reaction Handler"))
-			return
-		}
-
-		session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
-			return
-		}
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -144,7 +107,7 @@ func (h *Handler) ReactOnPostHandler(w http.ResponseWriter, r *http.Request) {
 			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
 			return
 		}
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, returnPath(r, "/"), http.StatusSeeOther)
 		return
 	default:
 		helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Error in Post Reaction Handler"))
@@ -164,27 +127,8 @@ func (h *Handler) FilterHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
 		var userID int
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			userID = 0
-		} else {
-			session, err := h.service.UserServiceInterface.GetSession(cookie.Value)
-			if err != nil {
-				helpers.ErrorHandler(w, http.StatusInternalServerError, err)
-				return
-			}
+		if session, err := h.currentSession(w, r); err == nil {
 			userID = session.UserID
-			// related to session an cookies updates:
-			expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
-			if err != nil {
-				helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Cookie cannot be extended"))
-				return
-			}
-			err = helpers.SessionCookieExtend(r, w, expTime)
-			if err != nil {
-				helpers.ErrorHandler(w, http.StatusInternalServerError, err)
-				return
-			}
 			userGlob, err = h.service.UserServiceInterface.GetUserByUserID(session.UserID)
 			if err != nil {
 				helpers.ErrorHandler(w, http.StatusInternalServerError, err)
@@ -193,7 +137,7 @@ func (h *Handler) FilterHandler(w http.ResponseWriter, r *http.Request) {
 
 		}
 
-		field := getFiltersFieldFromURL(r.URL.Path)
+		field := strings.Title(pathParam(r, "field"))
 		posts, err := h.service.PostServiceInterface.Filter(field, userID)
 		if err != nil {
 			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
@@ -245,31 +189,18 @@ func (h *Handler) FilterHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func getFiltersFieldFromURL(url string) string {
-	return strings.Title(strings.TrimPrefix(url, "/filter/"))
-}
-
 func (h *Handler) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("DELETE")
 
 	switch r.Method {
 	case "POST":
 		fmt.Println("INSIDE DELETE HANDLER OF POST")
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("couldn't get the cookie in the Post Creation Handler"))
-			return
-		}
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("The Time cannot be extended"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("The Time cannot be extended"))
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
+
 		postID := r.FormValue("postId")
 		intPostID, err := strconv.Atoi(postID)
 		if err != nil {
@@ -277,9 +208,9 @@ func (h *Handler) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		fmt.Println("POST ID: ", postID, "calling service method")
-		err = h.service.PostServiceInterface.DeletePost(intPostID)
+		err = h.service.PostServiceInterface.DeletePost(session.UserID, requestScope(r), intPostID, r.FormValue("reason"))
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("failed when was deleting the post"))
+			helpers.ErrorHandler(w, serviceErrorStatus(err), fmt.Errorf("failed when was deleting the post: %w", err))
 			return
 		}
 
@@ -316,21 +247,9 @@ func (h *Handler) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ApprovePostHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie cannot be reseived in ApprovePostHandler"))
-			return
-		}
-
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended in Approval of the Post"))
-			return
-		}
-
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -341,13 +260,13 @@ func (h *Handler) ApprovePostHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = h.service.PostServiceInterface.ApprovePost(intPostID)
+		err = h.service.PostServiceInterface.ApprovePost(session.UserID, requestScope(r), intPostID)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("failed when was deleting the votes for posts"))
+			helpers.ErrorHandler(w, serviceErrorStatus(err), fmt.Errorf("failed when was approving the post: %w", err))
 			return
 		}
 
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, returnPath(r, "/"), http.StatusSeeOther)
 		return
 	default:
 		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Moderator Request Handler"))
@@ -359,19 +278,9 @@ func (h *Handler) ApprovePostHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ReportPostHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie failed in the Moderator Request Handler"))
-			return
-		}
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+		_, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended in Approval of the Post"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -399,7 +308,7 @@ func (h *Handler) ReportPostHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		err = h.service.PostServiceInterface.AddPostReportCategory(intPostID, reportCategory)
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, returnPath(r, "/"), http.StatusSeeOther)
 		return
 	default:
 		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Moderator Request Handler"))
@@ -411,19 +320,9 @@ func (h *Handler) ReportPostHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) AnswerPostReportHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie failed in the Moderator Request Handler"))
-			return
-		}
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended in Approval of the Post"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -441,9 +340,9 @@ func (h *Handler) AnswerPostReportHandler(w http.ResponseWriter, r *http.Request
 			return
 		}
 		if reportStatus == 0 {
-			err = h.service.PostServiceInterface.ApprovePost(intPostID)
+			err = h.service.PostServiceInterface.ApprovePost(session.UserID, requestScope(r), intPostID)
 			if err != nil {
-				helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("failed when was deleting the votes for posts"))
+				helpers.ErrorHandler(w, serviceErrorStatus(err), fmt.Errorf("failed when was approving the post: %w", err))
 				return
 			}
 			err = h.service.PostServiceInterface.ChangeReportStatusOfPostbyPostID(intPostID, reportStatus)
@@ -452,9 +351,9 @@ func (h *Handler) AnswerPostReportHandler(w http.ResponseWriter, r *http.Request
 				return
 			}
 		} else {
-			err = h.service.PostServiceInterface.DeletePost(intPostID)
+			err = h.service.PostServiceInterface.DeletePost(session.UserID, requestScope(r), intPostID, r.FormValue("reason"))
 			if err != nil {
-				helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("failed when was deleting the post"))
+				helpers.ErrorHandler(w, serviceErrorStatus(err), fmt.Errorf("failed when was deleting the post: %w", err))
 				return
 			}
 
@@ -482,7 +381,7 @@ func (h *Handler) AnswerPostReportHandler(w http.ResponseWriter, r *http.Request
 			}
 		}
 
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, returnPath(r, "/"), http.StatusSeeOther)
 		return
 	default:
 		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Moderator Request Handler"))
@@ -494,21 +393,12 @@ func (h *Handler) EditPostHandler(w http.ResponseWriter, r *http.Request) {
 	// EditPostPagePath := "internal/web/templates/editPost.html"
 	switch r.Method {
 	case "POST":
-		cookie := helpers.SessionCookieGet(r)
-		if cookie == nil {
-			helpers.ErrorHandler(w, http.StatusUnauthorized, errors.New("Cookie failed in the Moderator Request Handler"))
-			return
-		}
-		expTime, err := h.service.UserServiceInterface.ExtendSessionTimeout(cookie.Value)
+		session, err := h.currentSession(w, r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, errors.New("Cookie cannot be extended in Approval of the Post"))
-			return
-		}
-		err = helpers.SessionCookieExtend(r, w, expTime)
-		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
+
 		postID := r.FormValue("postId")
 		content := r.FormValue("updatedContent")
 		intPostID, err := strconv.Atoi(postID)
@@ -517,13 +407,13 @@ func (h *Handler) EditPostHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		// fmt.Println(intPostID, content)
-		err = h.service.PostServiceInterface.UpdatePostContentByPostID(intPostID, content)
+		err = h.service.PostServiceInterface.UpdatePostContentByPostID(session.UserID, requestScope(r), intPostID, content)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, serviceErrorStatus(err), err)
 			return
 		}
 
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, returnPath(r, "/"), http.StatusSeeOther)
 		return
 	default:
 		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Moderator Request Handler"))
@@ -537,12 +427,10 @@ func (h *Handler) ShowMyPostsHandler(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		type templateData struct {
 			MyPosts []*models.Post
-			UserID  int
 		}
-		userID := r.FormValue("quserID")
-		intuserID, err := strconv.Atoi(userID)
+		intuserID, err := h.sessionUserID(r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 		myPosts, err := h.service.PostServiceInterface.GetPostsByUserId(intuserID)
@@ -551,7 +439,6 @@ func (h *Handler) ShowMyPostsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		data := templateData{
 			MyPosts: myPosts,
-			UserID:  intuserID,
 		}
 		helpers.RenderTemplate(w, historyPagePath, data)
 		return
@@ -567,12 +454,10 @@ func (h *Handler) ShowMyReactedPostsHandler(w http.ResponseWriter, r *http.Reque
 	case "GET":
 		type templateData struct {
 			ReactedPosts []*models.Post
-			UserID       int
 		}
-		userID := r.FormValue("quserID")
-		intuserID, err := strconv.Atoi(userID)
+		intuserID, err := h.sessionUserID(r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 		var reactedPosts []*models.Post
@@ -600,7 +485,6 @@ func (h *Handler) ShowMyReactedPostsHandler(w http.ResponseWriter, r *http.Reque
 		}
 		data := templateData{
 			ReactedPosts: reactedPosts,
-			UserID:       intuserID,
 		}
 		helpers.RenderTemplate(w, historyPagePath, data)
 		return
@@ -616,12 +500,10 @@ func (h *Handler) ShowMyReactedCommentsHandler(w http.ResponseWriter, r *http.Re
 	case "GET":
 		type templateData struct {
 			ReactedComments []*models.Comment
-			UserID          int
 		}
-		userID := r.FormValue("quserID")
-		intuserID, err := strconv.Atoi(userID)
+		intuserID, err := h.sessionUserID(r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 		var reactedComments []*models.Comment
@@ -649,7 +531,6 @@ func (h *Handler) ShowMyReactedCommentsHandler(w http.ResponseWriter, r *http.Re
 		}
 		data := templateData{
 			ReactedComments: reactedComments,
-			UserID:          intuserID,
 		}
 		helpers.RenderTemplate(w, historyPagePath, data)
 		return
@@ -665,13 +546,11 @@ func (h *Handler) ShowMyCommentsWithPostsHandler(w http.ResponseWriter, r *http.
 	case "GET":
 		type templateData struct {
 			MyCommentedPosts []*models.CommentsWithPosts
-			UserID           int
 		}
 		var MyCommentedPosts []*models.CommentsWithPosts
-		userID := r.FormValue("quserID")
-		intuserID, err := strconv.Atoi(userID)
+		intuserID, err := h.sessionUserID(r)
 		if err != nil {
-			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			helpers.ErrorHandler(w, http.StatusUnauthorized, err)
 			return
 		}
 
@@ -703,7 +582,6 @@ func (h *Handler) ShowMyCommentsWithPostsHandler(w http.ResponseWriter, r *http.
 
 		data := templateData{
 			MyCommentedPosts: MyCommentedPosts,
-			UserID:           intuserID,
 		}
 		helpers.RenderTemplate(w, path, data)
 		return
@@ -712,119 +590,3 @@ func (h *Handler) ShowMyCommentsWithPostsHandler(w http.ResponseWriter, r *http.
 		return
 	}
 }
-
-func (h *Handler) ShowMyNotificationsHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.FormValue("quserID")
-	intuserID, err := strconv.Atoi(userID)
-	if err != nil {
-		helpers.ErrorHandler(w, http.StatusBadRequest, err)
-		return
-	}
-
-	// Get reactions
-	reactions, err := h.service.PostServiceInterface.GetAllMyPostsLikedByOtherUsers(intuserID)
-	if err != nil {
-		log.Printf("Error getting reactions: %v", err)
-		reactions = []*models.PostVotes{}
-	}
-
-	// Process reactions
-	for _, pv := range reactions {
-		if pv.Reaction == 1 {
-			pv.ReactionStr = "liked"
-		} else if pv.Reaction == -1 {
-			pv.ReactionStr = "disliked"
-		}
-		// Get post title and username
-		post, _ := h.service.PostServiceInterface.GetPostByID(pv.PostID)
-		if post != nil {
-			pv.PostTitle = post.Title
-		}
-		user, _ := h.service.UserServiceInterface.GetUserByUserID(pv.UserID)
-		if user != nil {
-			pv.ReactorUsername = user.Username
-		}
-	}
-
-	// Get comments
-	comments, err := h.service.PostServiceInterface.GetAllMyPostsCommentedByOtherUsers(intuserID)
-	if err != nil {
-		log.Printf("Error getting comments: %v", err)
-		comments = []*models.PostVotes{}
-	}
-
-	// Process comments
-	for _, pv := range comments {
-		post, _ := h.service.PostServiceInterface.GetPostByID(pv.PostID)
-		if post != nil {
-			pv.PostTitle = post.Title
-		}
-		user, _ := h.service.UserServiceInterface.GetUserByUserID(pv.UserID)
-		if user != nil {
-			pv.ReactorUsername = user.Username
-		}
-	}
-
-	allNotifications := append([]*models.PostVotes{}, reactions...)
-	allNotifications = append(allNotifications, comments...)
-	sort.Slice(allNotifications, func(i, j int) bool {
-		return allNotifications[i].Time.After(allNotifications[j].Time)
-	})
-
-	data := struct {
-		Notifications []*models.PostVotes
-	}{
-		Notifications: allNotifications,
-	}
-
-	helpers.RenderTemplate(w, "internal/web/templates/notifications.html", data)
-}
-
-func (h *Handler) MarkNotificationSeenHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Received request to mark notification as seen")
-
-	var req struct {
-		NotificationID int `json:"notification_id"`
-	}
-
-	// Log the raw request body
-	body, _ := io.ReadAll(r.Body)
-	r.Body = io.NopCloser(bytes.NewBuffer(body)) // Replace the body for later use
-	log.Printf("Request body: %s", string(body))
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request: %v", err)
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
-
-	log.Printf("Notification ID: %d", req.NotificationID)
-
-	err := h.service.PostServiceInterface.MarkNotificationAsSeen(req.NotificationID)
-	if err != nil {
-		log.Printf("Error marking notification as seen: %v", err)
-		http.Error(w, "Error marking notification as seen", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"success": true})
-}
-
-func (h *Handler) CheckNotificationsHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("userID")
-	intUserID, err := strconv.Atoi(userID)
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
-	}
-
-	count, err := h.service.PostServiceInterface.CountUnseenNotifications(intUserID)
-	if err != nil {
-		http.Error(w, "Error checking notifications", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"count": count})
-}
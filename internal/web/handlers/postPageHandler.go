@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"forum/internal/models"
+	"forum/internal/web/handlers/helpers"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const postDescriptionLength = 200 // runes of the post in the description link previews show
+
+// pageMeta is what chat tools and social sites show when a link to the page is shared,
+// sent as OpenGraph and Twitter card tags. URL and Image are absolute.
+type pageMeta struct {
+	Title       string
+	Description string
+	URL         string
+	Image       string
+	Card        string // "summary_large_image" with an image, "summary" without
+}
+
+// PostPageHandler shows a post with its comments and everything the viewer may do with them, at
+// /p/{id}/{slug}. Only the ID counts: addresses with an old slug or none are redirected to the current one.
+// Posts waiting for approval are only shown to their author and to the staff who can approve them.
+func (h *Handler) PostPageHandler(w http.ResponseWriter, r *http.Request) {
+	postPath := "internal/web/templates/post.html"
+	type templateData struct {
+		LoggedIn    bool
+		ThePost     *models.Post
+		User        *models.User
+		AllComments []*models.Comment
+		ThreadMuted bool
+		CanApprove  bool
+		Meta        pageMeta
+	}
+
+	slug := pathParam(r, "slug")
+	postID, err := strconv.Atoi(pathParam(r, "id"))
+	if err != nil || postID <= 0 {
+		helpers.ErrorHandler(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+	post, err := h.service.PostServiceInterface.GetPostByID(postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ErrorHandler(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var viewer *models.User
+	if session, err := h.currentSession(w, r); err == nil {
+		viewer, err = h.service.UserServiceInterface.GetUserByUserID(session.UserID)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	canApprove := viewer != nil && models.RoleHasPermission(viewer.Role, models.PermApproveContent)
+	if post.IsApproved != 1 && !canApprove && (viewer == nil || viewer.UserUserID != post.UserID) {
+		helpers.ErrorHandler(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+	if slug != models.Slugify(post.Title) {
+		target := post.Permalink()
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	author, err := h.service.UserServiceInterface.GetUserByUserID(post.UserID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	post.Username = author.Username
+	post.CreatedTimeString = post.CreatedTime.Format("Jan 2, 2006 at 15:04")
+	post.Categories, err = h.service.PostServiceInterface.GetCategories(post.PostID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	comments, err := h.service.CommentServiceInterface.GetAlCommentsForPost(post.PostID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, comment := range comments {
+		user, err := h.service.UserServiceInterface.GetUserByUserID(comment.UserID)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+		comment.Username = user.Username
+		comment.CreatedTimeString = comment.CreatedTime.Format("Jan 2, 2006 at 15:04")
+		// the templates decide what to show by the role of the viewer
+		if viewer != nil {
+			comment.UserRole = viewer.Role
+		}
+	}
+	if viewer != nil {
+		post.UserRole = viewer.Role
+	}
+
+	threadMuted := false
+	if viewer != nil {
+		threadMuted, err = h.service.NotificationServiceInterface.IsThreadMuted(viewer.UserUserID, post.PostID)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	helpers.RenderTemplate(w, postPath, templateData{
+		LoggedIn:    viewer != nil,
+		ThePost:     post,
+		User:        viewer,
+		AllComments: comments,
+		ThreadMuted: threadMuted,
+		CanApprove:  canApprove,
+		Meta:        h.postMeta(post),
+	})
+}
+
+func (h *Handler) postMeta(post *models.Post) pageMeta {
+	meta := pageMeta{
+		Title:       post.Title,
+		Description: post.Excerpt(postDescriptionLength),
+		URL:         h.service.BaseURL + post.Permalink(),
+		Card:        "summary",
+	}
+	if post.ImagePath != "" {
+		meta.Image = h.service.BaseURL + (&url.URL{Path: post.ImagePath}).EscapedPath()
+		meta.Card = "summary_large_image"
+	}
+	return meta
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"forum/internal/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Posts are found by their ID; any other slug, or none, is redirected for good to the permalink,
+// keeping the query.
+func TestPostPageRedirectsToPermalink(t *testing.T) {
+	forum := newTestForum(t)
+	author := forum.user("author", models.RoleUser)
+	postID := itoa(forum.post(author, "Hello world"))
+	unicodeID := itoa(forum.post(author, "Crème brûlée"))
+
+	tests := []struct {
+		target   string
+		status   int
+		location string
+	}{
+		{"/p/" + postID + "/hello-world", http.StatusOK, ""},
+		{"/p/" + postID, http.StatusMovedPermanently, "/p/" + postID + "/hello-world"},
+		{"/p/" + postID + "/old-title", http.StatusMovedPermanently, "/p/" + postID + "/hello-world"},
+		{"/p/" + postID + "/Hello-World", http.StatusMovedPermanently, "/p/" + postID + "/hello-world"},
+		{"/p/" + postID + "/old-title?sort=new&page=2", http.StatusMovedPermanently, "/p/" + postID + "/hello-world?sort=new&page=2"},
+		{"/p/" + unicodeID + "/cr%C3%A8me-br%C3%BBl%C3%A9e", http.StatusOK, ""},
+		{"/p/" + unicodeID, http.StatusMovedPermanently, "/p/" + unicodeID + "/cr%C3%A8me-br%C3%BBl%C3%A9e"},
+		{"/p/999999/hello-world", http.StatusNotFound, ""},
+		{"/p/0", http.StatusNotFound, ""},
+		{"/p/hello-world", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		res := forum.do(forum.request("GET", test.target, nil, nil))
+		if res.Code != test.status || res.Header().Get("Location") != test.location {
+			t.Errorf("GET %s: status %d to %q, want %d to %q", test.target, res.Code, res.Header().Get("Location"), test.status, test.location)
+		}
+	}
+}
+
+// A post waiting for approval is not found by others, with or without its slug, so the redirect does
+// not give its title away either.
+func TestPostPageHidesUnapprovedPosts(t *testing.T) {
+	forum := newTestForum(t)
+	author := forum.user("author", models.RoleUser)
+	id, err := forum.repo.PostRepoInterface.CreatePostRepo(&models.Post{
+		UserID: author, Title: "Secret plans", Content: "Not approved yet", CreatedTime: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	permalink := "/p/" + itoa(int(id)) + "/secret-plans"
+
+	tests := []struct {
+		name   string
+		auth   *http.Cookie
+		status int
+	}{
+		{"anonymous", nil, http.StatusNotFound},
+		{"other user", forum.session(forum.user("other", models.RoleUser)), http.StatusNotFound},
+		{"author", forum.session(author), http.StatusOK},
+		{"moderator", forum.session(forum.user("moderator", models.RoleModerator)), http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var auth interface{}
+			if test.auth != nil {
+				auth = test.auth
+			}
+			if res := forum.do(forum.request("GET", permalink, nil, auth)); res.Code != test.status {
+				t.Errorf("GET %s: status %d, want %d", permalink, res.Code, test.status)
+			}
+			res := forum.do(forum.request("GET", "/p/"+itoa(int(id)), nil, auth))
+			if test.status == http.StatusNotFound && (res.Code != http.StatusNotFound || res.Header().Get("Location") != "") {
+				t.Errorf("GET without the slug: status %d to %q", res.Code, res.Header().Get("Location"))
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"errors"
+	"forum/internal/models"
+	"forum/internal/web/handlers/helpers"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// activityItem is one line of "Recent activity" on a public profile.
+type activityItem struct {
+	Kind       string // "post" or "comment"
+	PostLink   string
+	PostTitle  string
+	Content    string
+	time       time.Time
+	TimeString string
+}
+
+const recentActivityLimit = 10
+
+func (h *Handler) PublicProfileHandler(w http.ResponseWriter, r *http.Request) {
+	profilePath := "internal/web/templates/publicProfile.html"
+
+	type templateData struct {
+		Username       string
+		UserID         int
+		Deleted        bool
+		Profile        *models.UserProfile
+		JoinedString   string
+		Privacy        *models.ProfilePrivacy
+		Posts          []*models.Post
+		Comments       []*models.CommentsWithPosts
+		ReactedPosts   []*models.Post
+		RecentActivity []activityItem
+		IsOwner        bool
+		CanMute        bool // a logged in visitor
+		Muted          bool
+	}
+
+	switch r.Method {
+	case "GET":
+		username := pathParam(r, "username")
+		user, err := h.service.UserServiceInterface.GetUserByUsername(username)
+		if err != nil {
+			// links to a username the user has since changed still lead to them
+			if renamed, err := h.service.UserServiceInterface.GetUserByFormerUsername(username); err == nil {
+				http.Redirect(w, r, "/u/"+url.PathEscape(renamed.Username), http.StatusMovedPermanently)
+				return
+			}
+			helpers.ErrorHandler(w, http.StatusNotFound, errors.New("User not found"))
+			return
+		}
+		// content of deleted accounts that was kept is shown as written by this placeholder user
+		if user.Role == models.RoleDeleted {
+			helpers.RenderTemplate(w, profilePath, templateData{Username: user.Username, Deleted: true, Privacy: &models.ProfilePrivacy{}})
+			return
+		}
+		privacy, err := h.service.UserServiceInterface.GetProfilePrivacy(user.UserUserID)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+		profile, err := h.service.UserServiceInterface.GetUserProfile(user.UserUserID)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		data := templateData{
+			Username: user.Username,
+			UserID:   user.UserUserID,
+			Profile:  profile,
+			Privacy:  privacy,
+		}
+		if !profile.JoinedTime.IsZero() {
+			data.JoinedString = profile.JoinedTime.Format("Jan 2, 2006")
+		}
+		if viewerID, err := h.sessionUserID(r); err == nil {
+			data.IsOwner = viewerID == user.UserUserID
+			data.CanMute = !data.IsOwner
+			if data.CanMute {
+				data.Muted, err = h.service.NotificationServiceInterface.IsUserMuted(viewerID, user.UserUserID)
+				if err != nil {
+					helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+					return
+				}
+			}
+		}
+
+		// only approved content is ever shown to other people
+		if privacy.ShowPosts {
+			posts, err := h.service.PostServiceInterface.GetPostsByUserId(user.UserUserID)
+			if err != nil {
+				helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+				return
+			}
+			for _, post := range posts {
+				if post.IsApproved == 1 {
+					post.CreatedTimeString = post.CreatedTime.Format("Jan 2, 2006 at 15:04")
+					data.Posts = append(data.Posts, post)
+					data.RecentActivity = append(data.RecentActivity, activityItem{
+						Kind:       "post",
+						PostLink:   post.Permalink(),
+						PostTitle:  post.Title,
+						time:       post.CreatedTime,
+						TimeString: post.CreatedTimeString,
+					})
+				}
+			}
+		}
+
+		if privacy.ShowComments {
+			comments, err := h.service.CommentServiceInterface.GetCommentByUserID(user.UserUserID)
+			if err != nil {
+				helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+				return
+			}
+			for _, comment := range comments {
+				if comment.IsApproved != 1 {
+					continue
+				}
+				post, err := h.service.PostServiceInterface.GetPostByID(comment.PostID)
+				if err != nil {
+					continue // Skip if post not found or error
+				}
+				data.Comments = append(data.Comments, &models.CommentsWithPosts{
+					PostID:            post.PostID,
+					PostTitle:         post.Title,
+					CommentID:         comment.CommentID,
+					CommentContent:    comment.Content,
+					CommentTimeString: comment.CreatedTime.Format("Jan 2, 2006 at 15:04"),
+				})
+				data.RecentActivity = append(data.RecentActivity, activityItem{
+					Kind:       "comment",
+					PostLink:   post.Permalink(),
+					PostTitle:  post.Title,
+					Content:    comment.Content,
+					time:       comment.CreatedTime,
+					TimeString: comment.CreatedTime.Format("Jan 2, 2006 at 15:04"),
+				})
+			}
+		}
+		sort.SliceStable(data.RecentActivity, func(i, j int) bool {
+			return data.RecentActivity[i].time.After(data.RecentActivity[j].time)
+		})
+		if len(data.RecentActivity) > recentActivityLimit {
+			data.RecentActivity = data.RecentActivity[:recentActivityLimit]
+		}
+
+		if privacy.ShowReactions {
+			mapa, err := h.service.PostServiceInterface.GetMyReactedPosts(user.UserUserID)
+			if err != nil {
+				helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+				return
+			}
+			for postID, reaction := range mapa {
+				post, err := h.service.PostServiceInterface.GetPostByID(postID)
+				if err != nil {
+					continue
+				}
+				if reaction == 1 {
+					post.Reaction = "Like"
+				} else if reaction == -1 {
+					post.Reaction = "Dislike"
+				}
+				post.CreatedTimeString = post.CreatedTime.Format("Jan 2, 2006 at 15:04")
+				data.ReactedPosts = append(data.ReactedPosts, post)
+			}
+		}
+
+		helpers.RenderTemplate(w, profilePath, data)
+		return
+	default:
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Public Profile Handler"))
+		return
+	}
+}
+
+func (h *Handler) ProfilePrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	privacyPath := "internal/web/templates/profilePrivacy.html"
+
+	type templateData struct {
+		Username string
+		Privacy  *models.ProfilePrivacy
+	}
+
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		user, err := h.service.UserServiceInterface.GetUserByUserID(userID)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+		privacy, err := h.service.UserServiceInterface.GetProfilePrivacy(userID)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+		helpers.RenderTemplate(w, privacyPath, templateData{user.Username, privacy})
+		return
+	case "POST":
+		privacy := &models.ProfilePrivacy{
+			UserID:        userID,
+			ShowPosts:     r.FormValue("show_posts") == "on",
+			ShowComments:  r.FormValue("show_comments") == "on",
+			ShowReactions: r.FormValue("show_reactions") == "on",
+			ShowStats:     r.FormValue("show_stats") == "on",
+		}
+		if err := h.service.UserServiceInterface.UpdateProfilePrivacy(privacy); err != nil {
+			helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+			return
+		}
+		http.Redirect(w, r, "/profile_privacy", http.StatusSeeOther)
+		return
+	default:
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Profile Privacy Handler"))
+		return
+	}
+}
+
+// AvatarHandler serves /avatar/{userID}: the uploaded picture, or a generated one for users without.
+func (h *Handler) AvatarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Avatar Handler"))
+		return
+	}
+	userID, err := strconv.Atoi(pathParam(r, "id"))
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusNotFound, errors.New("User not found"))
+		return
+	}
+	avatarFile, err := h.service.UserServiceInterface.GetAvatarFile(userID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusNotFound, errors.New("User not found"))
+		return
+	}
+	// the address stays the same when the picture changes
+	w.Header().Set("Cache-Control", "no-cache")
+	if avatarFile != "" {
+		http.ServeFile(w, r, avatarFile)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write(helpers.Identicon(strconv.Itoa(userID)))
+}
+
+func (h *Handler) UpdateBioHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Update Bio Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err := h.service.UserServiceInterface.UpdateBio(userID, r.FormValue("bio")); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func (h *Handler) UploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Upload Avatar Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 2<<20)
+	_, file, err := r.FormFile("avatar")
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Choose a picture to upload, at most 1 MB"))
+		return
+	}
+	if err := h.service.UserServiceInterface.UpdateAvatar(userID, file); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func (h *Handler) RemoveAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Remove Avatar Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err := h.service.UserServiceInterface.RemoveAvatar(userID); err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"forum/internal/web/handlers/helpers"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// middleware wraps a handler in behaviour that routes share: rate limits, sessions, permissions.
+type middleware func(http.HandlerFunc) http.HandlerFunc
+
+// methodAny registers a handler for every method; it answers 405, HEAD and OPTIONS itself.
+const methodAny = "*"
+
+// route is one line of the route table in InitRouter. Segments of the pattern in braces are path
+// parameters, read with pathParam: "{id}" matches one segment and "{name...}" as the last segment
+// matches the rest of the path, "/" included.
+type route struct {
+	method  string
+	pattern string
+	handler http.HandlerFunc
+}
+
+type compiledRoute struct {
+	method   string
+	pattern  string
+	segments []string
+	handler  http.HandlerFunc // wrapped in the middleware of its group
+}
+
+// router sends a request to the route matching its path and method. Static segments win over
+// parameters and parameters over the rest of the path. When only the method is wrong the answer is
+// 405 with an Allow header; HEAD is served by the GET route and OPTIONS lists the methods of the path.
+type router struct {
+	routes []*compiledRoute
+}
+
+// routeGroup registers routes behind a shared middleware stack. A group made from a group runs the
+// middleware of the outer group first.
+type routeGroup struct {
+	router     *router
+	middleware []middleware
+}
+
+type pathParamsKey struct{}
+
+func newRouter() *router {
+	return &router{}
+}
+
+func (rt *router) group(stack ...middleware) *routeGroup {
+	return &routeGroup{router: rt, middleware: stack}
+}
+
+func (group *routeGroup) group(stack ...middleware) *routeGroup {
+	combined := append(append([]middleware{}, group.middleware...), stack...)
+	return &routeGroup{router: group.router, middleware: combined}
+}
+
+// handle adds routes to the router. A malformed pattern or one registered twice for a method is a
+// programming error and panics when the server starts.
+func (group *routeGroup) handle(routes ...route) {
+	for _, r := range routes {
+		segments := splitPath(r.pattern)
+		for i, segment := range segments {
+			name, isParam := paramName(segment)
+			if isParam && (name == "" || strings.HasSuffix(segment, "...}") && i != len(segments)-1) {
+				panic(fmt.Sprintf("router: bad pattern %q", r.pattern))
+			}
+		}
+		for _, existing := range group.router.routes {
+			if existing.method == r.method && samePattern(existing.segments, segments) {
+				panic(fmt.Sprintf("router: %s %s is registered twice", r.method, r.pattern))
+			}
+		}
+		handler := r.handler
+		for i := len(group.middleware) - 1; i >= 0; i-- {
+			handler = group.middleware[i](handler)
+		}
+		group.router.routes = append(group.router.routes, &compiledRoute{
+			method:   r.method,
+			pattern:  r.pattern,
+			segments: segments,
+			handler:  handler,
+		})
+	}
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := splitPath(r.URL.EscapedPath())
+	var best *compiledRoute
+	var bestParams map[string]string
+	methods := map[string]bool{}
+	for _, candidate := range rt.routes {
+		params, ok := candidate.match(path)
+		if !ok {
+			continue
+		}
+		methods[candidate.method] = true
+		if !candidate.serves(r.Method) {
+			continue
+		}
+		// an explicit HEAD route beats the GET route that would serve HEAD otherwise
+		if best == nil || moreSpecific(candidate, best) || samePattern(candidate.segments, best.segments) && candidate.method == r.Method {
+			best, bestParams = candidate, params
+		}
+	}
+
+	if best == nil && len(methods) == 0 {
+		helpers.ErrorHandler(w, http.StatusNotFound, errors.New("Page not found"))
+		return
+	}
+	if best == nil {
+		w.Header().Set("Allow", allowHeader(methods))
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New(r.Method+" is not allowed here"))
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), pathParamsKey{}, bestParams)
+	request := r.WithContext(ctx)
+	if r.Method == "HEAD" && best.method == "GET" {
+		// the handler sees a GET, the server still leaves the body out of the response to the HEAD
+		request.Method = "GET"
+	}
+	best.handler(w, request)
+}
+
+// serves tells whether the route answers the method, HEAD being answered by GET routes.
+func (candidate *compiledRoute) serves(method string) bool {
+	return candidate.method == method || candidate.method == methodAny ||
+		method == "HEAD" && candidate.method == "GET"
+}
+
+func (candidate *compiledRoute) match(path []string) (map[string]string, bool) {
+	params := map[string]string{}
+	for i, segment := range candidate.segments {
+		name, isParam := paramName(segment)
+		if isParam && strings.HasSuffix(segment, "...}") {
+			if i >= len(path) {
+				return nil, false
+			}
+			value, err := url.PathUnescape(strings.Join(path[i:], "/"))
+			if err != nil || value == "" {
+				return nil, false
+			}
+			params[name] = value
+			return params, true
+		}
+		if i >= len(path) {
+			return nil, false
+		}
+		value, err := url.PathUnescape(path[i])
+		if err != nil {
+			return nil, false
+		}
+		if !isParam {
+			if value != segment {
+				return nil, false
+			}
+			continue
+		}
+		if value == "" {
+			return nil, false
+		}
+		params[name] = value
+	}
+	if len(path) != len(candidate.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// pathParam returns a parameter from the pattern of the route that matched the request, unescaped.
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
+}
+
+// splitPath splits a path into its segments; "/" has none.
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func paramName(segment string) (string, bool) {
+	if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.Trim(segment, "{}"), "..."), true
+}
+
+// segmentRank orders the kinds of segments from the most to the least specific.
+func segmentRank(segment string) int {
+	if _, isParam := paramName(segment); !isParam {
+		return 0
+	}
+	if strings.HasSuffix(segment, "...}") {
+		return 2
+	}
+	return 1
+}
+
+// moreSpecific tells whether a matches more precisely than b: at the first segment where they
+// differ in kind, a has the static one or the single-segment parameter.
+func moreSpecific(a, b *compiledRoute) bool {
+	for i := 0; i < len(a.segments) && i < len(b.segments); i++ {
+		rankA, rankB := segmentRank(a.segments[i]), segmentRank(b.segments[i])
+		if rankA != rankB {
+			return rankA < rankB
+		}
+	}
+	return len(a.segments) > len(b.segments)
+}
+
+// samePattern tells whether two patterns match the same paths, whatever their parameters are called.
+func samePattern(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		rankA, rankB := segmentRank(a[i]), segmentRank(b[i])
+		if rankA != rankB || rankA == 0 && a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func allowHeader(methods map[string]bool) string {
+	if methods["GET"] {
+		methods["HEAD"] = true
+	}
+	methods["OPTIONS"] = true
+	allowed := []string{}
+	for method := range methods {
+		if method != methodAny {
+			allowed = append(allowed, method)
+		}
+	}
+	sort.Strings(allowed)
+	return strings.Join(allowed, ", ")
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testRouter answers every request with the route that served it and its parameters.
+func testRouter() *router {
+	echo := func(name string, params ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			reply := r.Method + " " + name
+			for _, param := range params {
+				reply += " " + param + "=" + pathParam(r, param)
+			}
+			w.Write([]byte(reply))
+		}
+	}
+	rt := newRouter()
+	rt.group().handle(
+		route{"GET", "/", echo("root")},
+		route{"GET", "/p/{id}", echo("post", "id")},
+		route{"GET", "/p/{id}/{slug}", echo("post", "id", "slug")},
+		route{"GET", "/p/new/{slug}", echo("new", "slug")},
+		route{"POST", "/p/{id}", echo("update", "id")},
+		route{"HEAD", "/head", echo("head")},
+		route{"GET", "/head", echo("get")},
+		route{"GET", "/files/{path...}", echo("files", "path")},
+		route{"GET", "/files/readme", echo("readme")},
+		route{methodAny, "/any/{path...}", echo("any", "path")},
+	)
+	return rt
+}
+
+func TestRouter(t *testing.T) {
+	tests := []struct {
+		method, target string
+		status         int
+		body           string // the start of the body
+		allow          string
+	}{
+		{"GET", "/", 200, "GET root", ""},
+		{"GET", "/p/12", 200, "GET post id=12", ""},
+		{"GET", "/p/12/a-title", 200, "GET post id=12 slug=a-title", ""},
+		{"GET", "/p/12/caf%C3%A9", 200, "GET post id=12 slug=café", ""},
+		{"GET", "/p/12/a%2Fb", 200, "GET post id=12 slug=a/b", ""},
+		{"GET", "/p/new/a-title", 200, "GET new slug=a-title", ""}, // static segments win over parameters
+		{"POST", "/p/12", 200, "POST update id=12", ""},
+		{"GET", "/p/12/a/b", 404, "", ""},
+		{"GET", "/p/", 404, "", ""},
+		{"GET", "/p", 404, "", ""},
+		{"GET", "/nowhere", 404, "", ""},
+		{"DELETE", "/p/12", 405, "", "GET, HEAD, OPTIONS, POST"},
+		{"POST", "/", 405, "", "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/p/12", 204, "", "GET, HEAD, OPTIONS, POST"},
+		{"HEAD", "/p/12", 200, "GET post id=12", ""}, // served by the GET route, which sees a GET
+		{"HEAD", "/head", 200, "HEAD head", ""},      // unless the path has a HEAD route
+		{"GET", "/files/a/b.txt", 200, "GET files path=a/b.txt", ""},
+		{"GET", "/files/readme", 200, "GET readme", ""},
+		{"GET", "/files/", 404, "", ""},
+		{"PATCH", "/any/thing", 200, "PATCH any path=thing", ""},
+		{"OPTIONS", "/any/thing", 200, "OPTIONS any path=thing", ""}, // methodAny answers OPTIONS itself
+	}
+	rt := testRouter()
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			rt.ServeHTTP(res, httptest.NewRequest(test.method, test.target, nil))
+			if res.Code != test.status {
+				t.Fatalf("status %d, want %d", res.Code, test.status)
+			}
+			if !strings.HasPrefix(res.Body.String(), test.body) {
+				t.Errorf("body %q, want %q", res.Body.String(), test.body)
+			}
+			if allow := res.Header().Get("Allow"); allow != test.allow {
+				t.Errorf("Allow %q, want %q", allow, test.allow)
+			}
+		})
+	}
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	var calls []string
+	mark := func(name string) middleware {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next(w, r)
+			}
+		}
+	}
+	rt := newRouter()
+	outer := rt.group(mark("outer"))
+	inner := outer.group(mark("inner"), mark("last"))
+	outer.group(mark("sibling")).handle(route{"GET", "/sibling", func(http.ResponseWriter, *http.Request) {}})
+	inner.handle(route{"GET", "/", func(http.ResponseWriter, *http.Request) { calls = append(calls, "handler") }})
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := strings.Join(calls, " "); got != "outer inner last handler" {
+		t.Errorf("calls %q, want the outer group first and nothing of the sibling group", got)
+	}
+}
+
+func TestRouterRefusesBadRoutes(t *testing.T) {
+	noop := func(http.ResponseWriter, *http.Request) {}
+	tests := []struct {
+		name   string
+		routes []route
+	}{
+		{"registered twice", []route{{"GET", "/p/{id}", noop}, {"GET", "/p/{postID}", noop}}},
+		{"rest of the path not last", []route{{"GET", "/files/{path...}/x", noop}}},
+		{"parameter without a name", []route{{"GET", "/p/{}", noop}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic")
+				}
+			}()
+			newRouter().group().handle(test.routes...)
+		})
+	}
+}
+
+// The JSON API under /api/v1/ answers HEAD and OPTIONS like the router does.
+func TestAPIHeadAndOptions(t *testing.T) {
+	forum := newTestForum(t)
+	forum.post(forum.user("author", "user"), "A post")
+	tests := []struct {
+		method, target string
+		status         int
+		allow          string
+	}{
+		{"HEAD", "/api/v1/posts", 200, ""},
+		{"OPTIONS", "/api/v1/posts", 204, "GET, HEAD, OPTIONS, POST"},
+		{"OPTIONS", "/api/v1/posts/1", 204, "DELETE, GET, HEAD, OPTIONS, PATCH"},
+		{"PUT", "/api/v1/posts", 405, "GET, HEAD, OPTIONS, POST"},
+		{"HEAD", "/api/v1/nothing", 404, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			res := forum.do(forum.request(test.method, test.target, nil, nil))
+			if res.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", res.Code, test.status, res.Body.String())
+			}
+			if allow := res.Header().Get("Allow"); allow != test.allow {
+				t.Errorf("Allow %q, want %q", allow, test.allow)
+			}
+		})
+	}
+}
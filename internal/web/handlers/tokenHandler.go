@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"forum/internal/models"
+	"forum/internal/web/handlers/helpers"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AccessTokensHandler lists the user's personal access tokens and creates new ones.
+// A new token is shown once, right after it was created.
+func (h *Handler) AccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	tokensPath := "internal/web/templates/tokens.html"
+
+	type tokenRow struct {
+		*models.AccessToken
+		CreatedTimeString  string
+		ExpiresAtString    string
+		LastUsedTimeString string
+	}
+	type templateData struct {
+		Tokens   []tokenRow
+		Scopes   []models.TokenScope
+		NewToken string
+	}
+
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	data := templateData{Scopes: models.TokenScopes}
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var ttl time.Duration
+		if days, err := strconv.Atoi(r.FormValue("expires_in_days")); err == nil && days > 0 {
+			ttl = time.Duration(days) * 24 * time.Hour
+		}
+		token, err := h.service.TokenServiceInterface.CreateAccessToken(userID, r.FormValue("name"), models.TokenScope(r.FormValue("scope")), ttl)
+		if err != nil {
+			helpers.ErrorHandler(w, http.StatusBadRequest, err)
+			return
+		}
+		data.NewToken = token
+	default:
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Access Tokens Handler"))
+		return
+	}
+
+	tokens, err := h.service.TokenServiceInterface.GetAccessTokens(userID)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, token := range tokens {
+		row := tokenRow{
+			AccessToken:        token,
+			CreatedTimeString:  token.CreatedTime.Format("Jan 2, 2006 at 15:04"),
+			ExpiresAtString:    "never",
+			LastUsedTimeString: "never",
+		}
+		if !token.ExpiresAt.IsZero() {
+			row.ExpiresAtString = token.ExpiresAt.Format("Jan 2, 2006 at 15:04")
+		}
+		if !token.LastUsedTime.IsZero() {
+			row.LastUsedTimeString = token.LastUsedTime.Format("Jan 2, 2006 at 15:04")
+		}
+		data.Tokens = append(data.Tokens, row)
+	}
+	helpers.RenderTemplate(w, tokensPath, data)
+}
+
+func (h *Handler) RevokeAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		helpers.ErrorHandler(w, http.StatusMethodNotAllowed, errors.New("Error in Revoke Access Token Handler"))
+		return
+	}
+	userID, err := h.sessionUserID(r)
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	tokenID, err := strconv.Atoi(r.FormValue("token_id"))
+	if err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, errors.New("Invalid token ID"))
+		return
+	}
+	if err := h.service.TokenServiceInterface.RevokeAccessToken(userID, tokenID); err != nil {
+		helpers.ErrorHandler(w, http.StatusBadRequest, err)
+		return
+	}
+	http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+}
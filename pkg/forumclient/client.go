@@ -0,0 +1,142 @@
+// Package forumclient talks to the JSON API of the forum, /api/v1. The types mirror the schemas of
+// /api/openapi.json; when an endpoint changes, this package is changed with it.
+package forumclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client calls the API of one forum. The zero value is not usable, create clients with New.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// Option changes how New sets up a Client.
+type Option func(*Client)
+
+// WithToken authenticates every request with a personal access token (forum_pat_...).
+func WithToken(token string) Option {
+	return func(client *Client) {
+		client.token = token
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, for timeouts or a custom TLS configuration.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = httpClient
+	}
+}
+
+// New returns a client for the forum at baseURL, like "https://localhost:8080".
+func New(baseURL string, options ...Option) *Client {
+	client := &Client{baseURL: strings.TrimRight(baseURL, "/"), httpClient: http.DefaultClient}
+	for _, option := range options {
+		option(client)
+	}
+	return client
+}
+
+// Error is a failed request, with the code and message the forum sent.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("forum: %s (%d %s)", err.Message, err.StatusCode, err.Code)
+}
+
+// IsNotFound reports whether err is the forum saying that something does not exist or is hidden.
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// PageOptions picks a page of a list. Zero values leave the choice to the forum.
+type PageOptions struct {
+	Page    int
+	PerPage int
+}
+
+func (options PageOptions) values() url.Values {
+	values := url.Values{}
+	if options.Page > 0 {
+		values.Set("page", strconv.Itoa(options.Page))
+	}
+	if options.PerPage > 0 {
+		values.Set("per_page", strconv.Itoa(options.PerPage))
+	}
+	return values
+}
+
+// do sends the request and decodes the envelope of the response: data into data, and pagination,
+// when the response has it, into pagination. Either may be nil.
+func (client *Client) do(ctx context.Context, method, path string, query url.Values, body, data interface{}, pagination *Pagination) error {
+	target := client.baseURL + "/api/v1/" + path
+	if len(query) != 0 {
+		target += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if client.token != "" {
+		request.Header.Set("Authorization", "Bearer "+client.token)
+	}
+
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		var envelope struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		apiErr := &Error{StatusCode: response.StatusCode, Code: "unknown", Message: http.StatusText(response.StatusCode)}
+		if json.NewDecoder(response.Body).Decode(&envelope) == nil && envelope.Error.Code != "" {
+			apiErr.Code, apiErr.Message = envelope.Error.Code, envelope.Error.Message
+		}
+		return apiErr
+	}
+	if response.StatusCode == http.StatusNoContent || data == nil {
+		return nil
+	}
+	envelope := struct {
+		Data       interface{} `json:"data"`
+		Pagination *Pagination `json:"pagination"`
+	}{Data: data, Pagination: pagination}
+	if err := json.NewDecoder(response.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("forum: decoding the response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package forumclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Me returns the account the client's token belongs to.
+func (client *Client) Me(ctx context.Context) (*Me, error) {
+	var me Me
+	if err := client.do(ctx, http.MethodGet, "me", nil, nil, &me, nil); err != nil {
+		return nil, err
+	}
+	return &me, nil
+}
+
+func (client *Client) Categories(ctx context.Context) ([]Category, error) {
+	var categories []Category
+	if err := client.do(ctx, http.MethodGet, "categories", nil, nil, &categories, nil); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (client *Client) Notifications(ctx context.Context, page PageOptions) (*NotificationPage, error) {
+	result := &NotificationPage{}
+	if err := client.do(ctx, http.MethodGet, "notifications", page.values(), nil, &result.Notifications, &result.Pagination); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (client *Client) MarkNotificationRead(ctx context.Context, notificationID int) error {
+	return client.do(ctx, http.MethodPost, fmt.Sprintf("notifications/%d/read", notificationID), nil, nil, nil, nil)
+}
+
+func (client *Client) MarkAllNotificationsRead(ctx context.Context) error {
+	return client.do(ctx, http.MethodPost, "notifications/read-all", nil, nil, nil, nil)
+}
+
+func (client *Client) NotificationPreferences(ctx context.Context) (*NotificationPreferences, error) {
+	var preferences NotificationPreferences
+	if err := client.do(ctx, http.MethodGet, "notifications/preferences", nil, nil, &preferences, nil); err != nil {
+		return nil, err
+	}
+	return &preferences, nil
+}
+
+// UpdateNotificationPreferences changes the deliveries of the notification types in deliveries and
+// keeps the others. It returns the preferences of every type.
+func (client *Client) UpdateNotificationPreferences(ctx context.Context, deliveries map[string]string) (*NotificationPreferences, error) {
+	var preferences NotificationPreferences
+	body := NotificationPreferences{Deliveries: deliveries}
+	if err := client.do(ctx, http.MethodPatch, "notifications/preferences", nil, body, &preferences, nil); err != nil {
+		return nil, err
+	}
+	return &preferences, nil
+}
+
+// ListPostsOptions filters ListPosts. Empty fields do not filter.
+type ListPostsOptions struct {
+	PageOptions
+	Category string
+	Author   string // username
+	Query    string // text in the title or content
+}
+
+// ListPosts returns a page of the posts the caller may see, newest first.
+func (client *Client) ListPosts(ctx context.Context, options ListPostsOptions) (*PostPage, error) {
+	query := options.values()
+	if options.Category != "" {
+		query.Set("category", options.Category)
+	}
+	if options.Author != "" {
+		query.Set("author", options.Author)
+	}
+	if options.Query != "" {
+		query.Set("q", options.Query)
+	}
+	result := &PostPage{}
+	if err := client.do(ctx, http.MethodGet, "posts", query, nil, &result.Posts, &result.Pagination); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (client *Client) GetPost(ctx context.Context, postID int) (*Post, error) {
+	return client.post(ctx, http.MethodGet, postID, "", nil)
+}
+
+// CreatePost publishes a post. Posts of regular users wait for a moderator before others see them.
+func (client *Client) CreatePost(ctx context.Context, post NewPost) (*Post, error) {
+	var created Post
+	if err := client.do(ctx, http.MethodPost, "posts", nil, post, &created, nil); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdatePost replaces the content of a post.
+func (client *Client) UpdatePost(ctx context.Context, postID int, content string) (*Post, error) {
+	return client.post(ctx, http.MethodPatch, postID, "", map[string]string{"content": content})
+}
+
+// DeletePost deletes a post together with its comments and reactions. A moderator deleting the post of
+// somebody else can give a reason for the author, or "".
+func (client *Client) DeletePost(ctx context.Context, postID int, reason string) error {
+	return client.do(ctx, http.MethodDelete, fmt.Sprintf("posts/%d", postID), reasonQuery(reason), nil, nil, nil)
+}
+
+// SetPostReaction sets the caller's reaction to Like, Dislike or NoReaction.
+func (client *Client) SetPostReaction(ctx context.Context, postID int, reaction string) (*Post, error) {
+	return client.post(ctx, http.MethodPut, postID, "/reaction", map[string]string{"reaction": reaction})
+}
+
+func (client *Client) post(ctx context.Context, method string, postID int, suffix string, body interface{}) (*Post, error) {
+	var post Post
+	if err := client.do(ctx, method, fmt.Sprintf("posts/%d%s", postID, suffix), nil, body, &post, nil); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// ListComments returns a page of the comments on a post, oldest first.
+func (client *Client) ListComments(ctx context.Context, postID int, page PageOptions) (*CommentPage, error) {
+	result := &CommentPage{}
+	if err := client.do(ctx, http.MethodGet, fmt.Sprintf("posts/%d/comments", postID), page.values(), nil, &result.Comments, &result.Pagination); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (client *Client) CreateComment(ctx context.Context, postID int, content string) (*Comment, error) {
+	var comment Comment
+	if err := client.do(ctx, http.MethodPost, fmt.Sprintf("posts/%d/comments", postID), nil, map[string]string{"content": content}, &comment, nil); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+func (client *Client) GetComment(ctx context.Context, commentID int) (*Comment, error) {
+	return client.comment(ctx, http.MethodGet, commentID, "", nil)
+}
+
+func (client *Client) UpdateComment(ctx context.Context, commentID int, content string) (*Comment, error) {
+	return client.comment(ctx, http.MethodPatch, commentID, "", map[string]string{"content": content})
+}
+
+// DeleteComment deletes a comment, with a reason for the author like DeletePost.
+func (client *Client) DeleteComment(ctx context.Context, commentID int, reason string) error {
+	return client.do(ctx, http.MethodDelete, fmt.Sprintf("comments/%d", commentID), reasonQuery(reason), nil, nil, nil)
+}
+
+func reasonQuery(reason string) url.Values {
+	if reason == "" {
+		return nil
+	}
+	return url.Values{"reason": {reason}}
+}
+
+// SetCommentReaction sets the caller's reaction to Like, Dislike or NoReaction.
+func (client *Client) SetCommentReaction(ctx context.Context, commentID int, reaction string) (*Comment, error) {
+	return client.comment(ctx, http.MethodPut, commentID, "/reaction", map[string]string{"reaction": reaction})
+}
+
+func (client *Client) comment(ctx context.Context, method string, commentID int, suffix string, body interface{}) (*Comment, error) {
+	var comment Comment
+	if err := client.do(ctx, method, fmt.Sprintf("comments/%d%s", commentID, suffix), nil, body, &comment, nil); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// ModerationQueue returns a page of what waits for the caller as a moderator, oldest first.
+func (client *Client) ModerationQueue(ctx context.Context, page PageOptions) (*QueuePage, error) {
+	result := &QueuePage{}
+	if err := client.do(ctx, http.MethodGet, "moderation/queue", page.values(), nil, &result.Items, &result.Pagination); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (client *Client) ApprovePost(ctx context.Context, postID int) (*Post, error) {
+	return client.post(ctx, http.MethodPost, postID, "/approve", nil)
+}
+
+func (client *Client) ApproveComment(ctx context.Context, commentID int) (*Comment, error) {
+	return client.comment(ctx, http.MethodPost, commentID, "/approve", nil)
+}
+
+// ReportPost sends a post to the administrators. The reason is "irrelevant", "obscene", "illegal" or "insulting".
+func (client *Client) ReportPost(ctx context.Context, postID int, reason string) (*Post, error) {
+	return client.post(ctx, http.MethodPost, postID, "/report", map[string]string{"reason": reason})
+}
+
+// ResolveReport answers the report on a post: "keep" approves the post, "remove" deletes it. The
+// reason is sent to the author on remove; with "" the report category is.
+func (client *Client) ResolveReport(ctx context.Context, postID int, decision, reason string) error {
+	body := map[string]string{"decision": decision}
+	if reason != "" {
+		body["reason"] = reason
+	}
+	return client.do(ctx, http.MethodPost, fmt.Sprintf("posts/%d/resolve", postID), nil, body, nil, nil)
+}
@@ -0,0 +1,131 @@
+package forumclient
+
+import "time"
+
+// Reactions, as sent with SetPostReaction and SetCommentReaction and returned in MyReaction.
+const (
+	Like       = "like"
+	Dislike    = "dislike"
+	NoReaction = "none"
+)
+
+type User struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+// Me is the account the client is authenticated as.
+type Me struct {
+	ID         int        `json:"id"`
+	Username   string     `json:"username"`
+	FirstName  string     `json:"first_name"`
+	SecondName string     `json:"second_name"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Bio        string     `json:"bio"`
+	AvatarURL  string     `json:"avatar_url"`
+	JoinedAt   *time.Time `json:"joined_at"`
+	TokenScope string     `json:"token_scope,omitempty"`
+}
+
+type Category struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Post struct {
+	ID         int       `json:"id"`
+	Author     User      `json:"author"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Categories []string  `json:"categories"`
+	ImageURL   string    `json:"image_url,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	Likes      int       `json:"likes"`
+	Dislikes   int       `json:"dislikes"`
+	Approved   bool      `json:"approved"`
+	MyReaction string    `json:"my_reaction,omitempty"`
+}
+
+type Comment struct {
+	ID         int       `json:"id"`
+	PostID     int       `json:"post_id"`
+	Author     User      `json:"author"`
+	Content    string    `json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+	Likes      int       `json:"likes"`
+	Dislikes   int       `json:"dislikes"`
+	Approved   bool      `json:"approved"`
+	MyReaction string    `json:"my_reaction,omitempty"`
+}
+
+// Notification tells the caller that something happened to their content or account.
+type Notification struct {
+	ID        int        `json:"id"`
+	Type      string     `json:"type"` // "post_reaction", "comment_reaction", "mention", "approved", "role_change"...
+	Message   string     `json:"message"`
+	Actor     *User      `json:"actor"` // nil when nobody in particular did it
+	PostID    int        `json:"post_id,omitempty"`
+	PostTitle string     `json:"post_title,omitempty"`
+	CommentID int        `json:"comment_id,omitempty"`
+	Reaction  string     `json:"reaction,omitempty"`
+	Count     int        `json:"count,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	OldRole   string     `json:"old_role,omitempty"`
+	NewRole   string     `json:"new_role,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"` // nil while unread
+}
+
+// NotificationPreferences tells how each type of notification reaches the caller, by notification type:
+// "in_app", "email_digest", "email" or "off".
+type NotificationPreferences struct {
+	Deliveries map[string]string `json:"deliveries"`
+}
+
+// QueueItem is a post or a comment waiting for a moderator, or a post reported to the administrators.
+type QueueItem struct {
+	Type      string    `json:"type"` // "post" or "comment"
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	Title     string    `json:"title,omitempty"`
+	Content   string    `json:"content"`
+	Author    User      `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	Report    string    `json:"report,omitempty"` // the reason, when the post was reported
+}
+
+// Pagination tells where a page is in the whole list.
+type Pagination struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+// NewPost is what CreatePost sends. Categories must already exist.
+type NewPost struct {
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Categories []string `json:"categories"`
+}
+
+type PostPage struct {
+	Posts      []Post
+	Pagination Pagination
+}
+
+type CommentPage struct {
+	Comments   []Comment
+	Pagination Pagination
+}
+
+type NotificationPage struct {
+	Notifications []Notification
+	Pagination    Pagination
+}
+
+type QueuePage struct {
+	Items      []QueueItem
+	Pagination Pagination
+}